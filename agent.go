@@ -0,0 +1,31 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrNoAgent is returned when agent forwarding is enabled without an agent.
+var ErrNoAgent = errors.New("goph: no ssh agent, SSH_AUTH_SOCK is not set")
+
+// forwardAgent serves the agent channels the server opens on client with
+// the agent of the config.
+func (c *Config) forwardAgent(client *ssh.Client) error {
+
+	if c.Agent != nil {
+		return agent.ForwardToAgent(client, c.Agent)
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return ErrNoAgent
+	}
+
+	return agent.ForwardToRemote(client, sock)
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import "time"
+
+// AuditRecord describes a single executed command or file transfer.
+type AuditRecord struct {
+
+	// Time the operation started.
+	Time time.Time
+
+	User string
+
+	// Host is the "host:port" address of the server.
+	Host string
+
+	// Operation is "run", "upload" or "download".
+	Operation string
+
+	// Command is the command line of run operations, with secrets redacted.
+	Command string
+
+	// LocalPath and RemotePath are the paths of transfer operations.
+	LocalPath  string
+	RemotePath string
+
+	// Bytes transferred by upload and download operations.
+	Bytes int64
+
+	// Err is the operation result, nil on success.
+	Err error
+
+	Duration time.Duration
+}
+
+// AuditFunc receives an audit record for every Run, Upload and Download,
+// it is called synchronously once the operation completes.
+type AuditFunc func(AuditRecord)
+
+// audit sends r to the config audit func, filling the connection fields.
+func (c *Config) audit(r AuditRecord) {
+
+	if c == nil || c.Audit == nil {
+		return
+	}
+
+	r.User = c.User
+	r.Host = c.hostPort()
+	r.Command = c.Redact(r.Command)
+	r.Err = c.redactError(r.Err)
+
+	c.Audit(r)
+}
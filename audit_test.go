@@ -0,0 +1,122 @@
+package goph_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestAudit(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("true", func(e *gophtest.Exec) int { return 0 })
+	srv.HandleFunc("false", func(e *gophtest.Exec) int { return 1 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var records []goph.AuditRecord
+
+	config := srv.Config("alice", "secret")
+	config.Audit = func(r goph.AuditRecord) { records = append(records, r) }
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err = client.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := client.Command("false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Run(); err == nil {
+		t.Fatal("false should fail")
+	}
+	cmd.Close()
+
+	local := filepath.Join(t.TempDir(), "data")
+	if err = os.WriteFile(local, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Upload(local, "/data"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Download("/missing", local+".missing"); err == nil {
+		t.Fatal("the download of a missing file should fail")
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("expected 4 audit records, got %+v", records)
+	}
+
+	for _, r := range records {
+		if r.User != "alice" || r.Host != srv.Addr() || r.Time.IsZero() || r.Duration <= 0 {
+			t.Errorf("expected the connection and timing filled, got %+v", r)
+		}
+	}
+
+	run, failed, upload, download := records[0], records[1], records[2], records[3]
+
+	if run.Operation != "run" || run.Command != "true" || run.Err != nil {
+		t.Errorf("unexpected run record %+v", run)
+	}
+	if failed.Operation != "run" || failed.Command != "false" || failed.Err == nil {
+		t.Errorf("unexpected failed run record %+v", failed)
+	}
+	if upload.Operation != "upload" || upload.LocalPath != local || upload.RemotePath != "/data" || upload.Bytes != 5 || upload.Err != nil {
+		t.Errorf("unexpected upload record %+v", upload)
+	}
+	if download.Operation != "download" || download.RemotePath != "/missing" || download.Err == nil {
+		t.Errorf("unexpected download record %+v", download)
+	}
+}
+
+func TestAuditStartWait(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("false", func(e *gophtest.Exec) int { return 1 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var records []goph.AuditRecord
+
+	config := srv.Config("alice", "secret")
+	config.Audit = func(r goph.AuditRecord) { records = append(records, r) }
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	cmd, err := client.Command("false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected the record on Wait, got %+v", records)
+	}
+	if err = cmd.Wait(); err == nil {
+		t.Fatal("false should fail")
+	}
+
+	if len(records) != 1 || records[0].Operation != "run" || records[0].Command != "false" || records[0].Err == nil || records[0].Duration <= 0 {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
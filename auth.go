@@ -8,7 +8,9 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
@@ -41,6 +43,14 @@ func KeyboardInteractive(pass string) Auth {
 	}
 }
 
+// KeyboardInteractiveFunc returns keyboard interactive auth method answering
+// the server challenges with fn, for one-time passwords and other prompts.
+func KeyboardInteractiveFunc(fn func(name, instruction string, questions []string, echos []bool) ([]string, error)) Auth {
+	return Auth{
+		ssh.KeyboardInteractive(fn),
+	}
+}
+
 // Key returns auth method from private key with or without passphrase.
 func Key(prvFile string, passphrase string) (Auth, error) {
 
@@ -66,6 +76,134 @@ func RawKey(privateKey string, passphrase string) (Auth, error) {
 	}, nil
 }
 
+// Certificate returns auth method from a certificate signed by a user CA
+// and the signer of its key.
+func Certificate(cert *ssh.Certificate, signer ssh.Signer) (Auth, error) {
+
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return Auth{
+		ssh.PublicKeys(certSigner),
+	}, nil
+}
+
+// CertKey returns auth method from private key with or without passphrase
+// and its certificate file, prvFile+"-cert.pub" when certFile is empty,
+// like OpenSSH. See LoadIdentity for identity files bundling both.
+func CertKey(prvFile string, certFile string, passphrase string) (Auth, error) {
+
+	signer, err := GetSigner(prvFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if certFile == "" {
+		certFile = prvFile + "-cert.pub"
+	}
+
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := parseUserCert(data)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s: %w", certFile, err)
+	}
+
+	return Certificate(cert, signer)
+}
+
+// Fallback returns the methods of auths tried in order. The ssh client
+// tries a method name once, so the keys of every public key method are
+// merged into one offering them in order, and the passwords into one
+// retrying them in order. Other methods are kept once, the first wins.
+func Fallback(auths ...Auth) Auth {
+
+	var keys, passwords []reflect.Value
+
+	for _, auth := range auths {
+		for _, m := range auth {
+			switch authMethodName(m) {
+			case "publickey":
+				keys = append(keys, reflect.ValueOf(m))
+			case "password":
+				passwords = append(passwords, reflect.ValueOf(m))
+			}
+		}
+	}
+
+	var (
+		merged Auth
+		seen   = make(map[string]bool)
+	)
+
+	for _, auth := range auths {
+		for _, m := range auth {
+
+			name := authMethodName(m)
+			if seen[name] && name != "unknown" {
+				continue
+			}
+			seen[name] = true
+
+			switch name {
+			case "publickey":
+				merged = append(merged, fallbackKeys(keys))
+			case "password":
+				merged = append(merged, fallbackPasswords(passwords))
+			default:
+				merged = append(merged, m)
+			}
+		}
+	}
+
+	return merged
+}
+
+// fallbackKeys returns a public key method offering the signers of the
+// public key callbacks in turn.
+func fallbackKeys(keys []reflect.Value) ssh.AuthMethod {
+	return ssh.PublicKeysCallback(func() (signers []ssh.Signer, err error) {
+		for _, fn := range keys {
+			out := fn.Call(nil)
+			if err, _ := out[1].Interface().(error); err != nil {
+				return nil, err
+			}
+			s, _ := out[0].Interface().([]ssh.Signer)
+			signers = append(signers, s...)
+		}
+		return signers, nil
+	})
+}
+
+// fallbackPasswords returns a password method trying the password
+// callbacks in turn, up to one attempt each per connection. Each attempt
+// counts against Config.MaxAuthTries.
+func fallbackPasswords(passwords []reflect.Value) ssh.AuthMethod {
+
+	var (
+		mu   sync.Mutex
+		next int
+	)
+
+	method := ssh.PasswordCallback(func() (string, error) {
+		mu.Lock()
+		fn := passwords[next%len(passwords)]
+		next++
+		mu.Unlock()
+
+		out := fn.Call(nil)
+		err, _ := out[1].Interface().(error)
+		return out[0].String(), err
+	})
+
+	return ssh.RetryableAuthMethod(method, len(passwords))
+}
+
 // HasAgent checks if ssh agent exists.
 func HasAgent() bool {
 	return os.Getenv("SSH_AUTH_SOCK") != ""
@@ -0,0 +1,241 @@
+package goph_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startAuthServer starts a server running whoami for the connected user.
+func startAuthServer(t *testing.T) *gophtest.Server {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("whoami", func(e *gophtest.Exec) int {
+		fmt.Fprintln(e.Stdout, e.User)
+		return 0
+	})
+
+	return srv
+}
+
+// connectAs connects to srv as user with auth and runs whoami.
+func connectAs(t *testing.T, srv *gophtest.Server, user string, auth goph.Auth) error {
+
+	config := srv.Config(user, "")
+	config.Auth = auth
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	out, err := client.Run("whoami")
+	if err != nil || strings.TrimSpace(string(out)) != user {
+		t.Errorf("expected whoami %s, got %q, %v", user, out, err)
+	}
+
+	return nil
+}
+
+func TestCertificateAuth(t *testing.T) {
+
+	ca, _ := newSigner(t)
+	signer, keyPEM := newSigner(t)
+
+	srv := startAuthServer(t)
+	srv.UserCA = ca.PublicKey()
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	cert := signCert(t, ca, signer.PublicKey(), ssh.UserCert, 1, "carol")
+
+	auth, err := goph.Certificate(cert, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connectAs(t, srv, "carol", auth); err != nil {
+		t.Fatal(err)
+	}
+	if err := connectAs(t, srv, "dave", auth); err == nil {
+		t.Error("expected a certificate without the principal to be rejected")
+	}
+
+	// the certificate is read next to the key, like OpenSSH.
+	prvFile := filepath.Join(t.TempDir(), "id_ed25519")
+	os.WriteFile(prvFile, keyPEM, 0600)
+	os.WriteFile(prvFile+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0644)
+
+	if auth, err = goph.CertKey(prvFile, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := connectAs(t, srv, "carol", auth); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := goph.CertKey(prvFile, prvFile, ""); err == nil {
+		t.Error("expected an error for a certificate file holding a key")
+	}
+}
+
+func TestFallbackAuth(t *testing.T) {
+
+	unknown, _ := newSigner(t)
+	signer, _ := newSigner(t)
+
+	srv := startAuthServer(t)
+	srv.AddKey("bob", signer.PublicKey())
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	keys := goph.Fallback(goph.Auth{ssh.PublicKeys(unknown)}, goph.Auth{ssh.PublicKeys(signer)})
+	if err := connectAs(t, srv, "bob", keys); err != nil {
+		t.Fatalf("expected the second key to be offered: %v", err)
+	}
+
+	auth := goph.Fallback(goph.Auth{ssh.PublicKeys(unknown)}, goph.Password("wrong"), goph.Password("secret"))
+	if len(auth) != 2 {
+		t.Errorf("expected a publickey and a password method, got %d methods", len(auth))
+	}
+
+	// every connection tries the passwords again.
+	for range 2 {
+		if err := connectAs(t, srv, "alice", auth); err != nil {
+			t.Fatalf("expected the second password to be tried: %v", err)
+		}
+	}
+}
+
+func TestKeyboardInteractiveFunc(t *testing.T) {
+
+	srv := startAuthServer(t)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var prompts []string
+	auth := goph.KeyboardInteractiveFunc(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		prompts = append(prompts, questions...)
+		return []string{"secret"}, nil
+	})
+
+	if err := connectAs(t, srv, "alice", auth); err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 1 || prompts[0] != "Password: " {
+		t.Errorf("unexpected prompts %q", prompts)
+	}
+}
+
+func TestForwardAgent(t *testing.T) {
+
+	_, keyPEM := newSigner(t)
+	key, err := ssh.ParseRawPrivateKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key, Comment: "deploy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := startAuthServer(t)
+	srv.HandleFunc("ssh-add -L", func(e *gophtest.Exec) int {
+		if e.Agent == nil {
+			fmt.Fprintln(e.Stderr, "Could not open a connection to your authentication agent.")
+			return 2
+		}
+		keys, err := e.Agent.List()
+		if err != nil {
+			fmt.Fprintln(e.Stderr, err)
+			return 1
+		}
+		for _, k := range keys {
+			fmt.Fprintln(e.Stdout, k.Comment)
+		}
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	config := srv.Config("alice", "secret")
+	config.ForwardAgent = true
+	config.Agent = keyring
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	out, err := client.Run("ssh-add -L")
+	if err != nil || string(out) != "deploy\n" {
+		t.Errorf("expected the forwarded key, got %q, %v", out, err)
+	}
+
+	// without forwarding, the remote has no agent.
+	config = srv.Config("alice", "secret")
+	plain, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+
+	if _, err := plain.Run("ssh-add -L"); err == nil {
+		t.Error("expected no agent without forwarding")
+	}
+}
+
+func TestFallbackMaxAuthTries(t *testing.T) {
+
+	srv := startAuthServer(t)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var tried atomic.Int32
+	password := func(pass string) goph.Auth {
+		return goph.Auth{ssh.PasswordCallback(func() (string, error) {
+			tried.Add(1)
+			return pass, nil
+		})}
+	}
+
+	config := srv.Config("alice", "")
+	config.Auth = goph.Fallback(password("wrong"), password("wrong"), password("secret"))
+	config.MaxAuthTries = 2
+
+	if _, err := goph.NewConn(config); !errors.Is(err, goph.ErrMaxAuthTries) {
+		t.Errorf("expected ErrMaxAuthTries, got %v", err)
+	}
+	if tried.Load() != 2 {
+		t.Errorf("expected 2 passwords tried, got %d", tried.Load())
+	}
+
+	config.MaxAuthTries = 3
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatalf("expected the third password to be tried: %v", err)
+	}
+	client.Close()
+}
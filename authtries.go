@@ -0,0 +1,148 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrMaxAuthTries is returned when authentication stopped because the
+// Config.MaxAuthTries attempts were used.
+var ErrMaxAuthTries = errors.New("goph: max auth tries reached")
+
+// authBudget counts the authentication attempts left for a connection.
+type authBudget struct {
+	mu   sync.Mutex
+	left int
+}
+
+// take reserves up to n attempts and returns the number reserved.
+func (b *authBudget) take(n int) int {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n = min(n, b.left)
+	b.left -= n
+
+	return n
+}
+
+// authMethods returns the auth methods of the config, sorted by AuthOrder
+// and limited to MaxAuthTries attempts.
+func (c *Config) authMethods() []ssh.AuthMethod {
+
+	methods := append([]ssh.AuthMethod(nil), c.Auth...)
+
+	if len(c.AuthOrder) > 0 {
+		rank := func(m ssh.AuthMethod) int {
+			name := authMethodName(m)
+			for i, n := range c.AuthOrder {
+				if n == name {
+					return i
+				}
+			}
+			return len(c.AuthOrder)
+		}
+		sort.SliceStable(methods, func(i, j int) bool {
+			return rank(methods[i]) < rank(methods[j])
+		})
+	}
+
+	if c.MaxAuthTries <= 0 {
+		return methods
+	}
+
+	budget := &authBudget{left: c.MaxAuthTries}
+	for i, m := range methods {
+		methods[i] = budget.limit(m)
+	}
+
+	return methods
+}
+
+// limit returns m drawing its attempts from the budget. Every password,
+// public key and keyboard-interactive prompt is an attempt, retried ones
+// included, other methods are returned as is.
+//
+// The ssh constructors return unexported function types, they are called
+// through reflection to wrap them.
+func (b *authBudget) limit(m ssh.AuthMethod) ssh.AuthMethod {
+
+	switch authMethodName(m) {
+
+	case "password":
+		fn := reflect.ValueOf(m)
+		return ssh.PasswordCallback(func() (string, error) {
+			if b.take(1) == 0 {
+				return "", ErrMaxAuthTries
+			}
+			out := fn.Call(nil)
+			err, _ := out[1].Interface().(error)
+			return out[0].String(), err
+		})
+
+	case "publickey":
+		fn := reflect.ValueOf(m)
+		return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			out := fn.Call(nil)
+			if err, _ := out[1].Interface().(error); err != nil {
+				return nil, err
+			}
+			signers, _ := out[0].Interface().([]ssh.Signer)
+			if len(signers) == 0 {
+				return nil, nil
+			}
+			n := b.take(len(signers))
+			if n == 0 {
+				return nil, ErrMaxAuthTries
+			}
+			return signers[:n], nil
+		})
+
+	case "keyboard-interactive":
+		challenge := m.(ssh.KeyboardInteractiveChallenge)
+		return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			// info requests without questions are not attempts.
+			if len(questions) > 0 && b.take(1) == 0 {
+				return nil, ErrMaxAuthTries
+			}
+			return challenge(name, instruction, questions, echos)
+		})
+
+	case "retryable":
+		if inner, tries, ok := unwrapRetryable(m); ok {
+			return ssh.RetryableAuthMethod(b.limit(inner), tries)
+		}
+	}
+
+	return m
+}
+
+// unwrapRetryable returns the method and the tries of a method returned by
+// ssh.RetryableAuthMethod, like the passwords of Fallback, so each retry
+// draws from the budget. The fields are unexported, ok is false if they
+// are not found.
+func unwrapRetryable(m ssh.AuthMethod) (inner ssh.AuthMethod, tries int, ok bool) {
+
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, 0, false
+	}
+
+	method := v.Elem().FieldByName("authMethod")
+	maxTries := v.Elem().FieldByName("maxTries")
+	if !method.IsValid() || method.Type() != reflect.TypeFor[ssh.AuthMethod]() || !maxTries.IsValid() || maxTries.Kind() != reflect.Int {
+		return nil, 0, false
+	}
+
+	inner, _ = reflect.NewAt(method.Type(), unsafe.Pointer(method.UnsafeAddr())).Elem().Interface().(ssh.AuthMethod)
+	return inner, int(maxTries.Int()), inner != nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"fmt"
+	"regexp"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// BannerError is returned when the BannerPolicy rejects the server banner.
+type BannerError struct {
+	Banner string
+	Err    error
+}
+
+func (e *BannerError) Error() string {
+	return fmt.Sprintf("goph: server banner rejected: %s", e.Err)
+}
+
+func (e *BannerError) Unwrap() error {
+	return e.Err
+}
+
+// bannerCallback captures the banner in state and applies the banner policy
+// before calling the user callback.
+func (c *Config) bannerCallback(state *clientState, callback ssh.BannerCallback) ssh.BannerCallback {
+	return func(message string) error {
+
+		state.banner += message
+		state.bannerReceived = true
+
+		if c.BannerPolicy != nil {
+			if err := c.BannerPolicy(message); err != nil {
+				return &BannerError{Banner: message, Err: err}
+			}
+		}
+
+		if callback != nil {
+			return callback(message)
+		}
+		return nil
+	}
+}
+
+// RequireBanner returns a banner policy rejecting banners that don't match
+// the regular expression, including servers sending no banner.
+func RequireBanner(pattern string) (func(string) error, error) {
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(banner string) error {
+		if !re.MatchString(banner) {
+			return fmt.Errorf("banner does not match %q", pattern)
+		}
+		return nil
+	}, nil
+}
+
+// Banner returns the pre-auth banner sent by the server, if any.
+func (c Client) Banner() string {
+	c = c.live()
+	if c.state == nil {
+		return ""
+	}
+	return c.state.banner
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrCircuitOpen is returned for hosts skipped because their circuit breaker is open.
+var ErrCircuitOpen = errors.New("goph: circuit breaker open")
+
+// BreakerState is the state of a host circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every operation through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen skips the host until the cooldown expires.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a single probe through, its result closes or re-opens the breaker.
+	BreakerHalfOpen
+)
+
+// String returns the state name.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// CircuitBreaker tracks consecutive failures per host and skips hosts that
+// keep failing, so a dead host does not add its timeout to every fleet run.
+// A CircuitBreaker is safe for concurrent use and can be shared between groups.
+type CircuitBreaker struct {
+
+	// Threshold is the number of consecutive failures that opens the breaker.
+	Threshold int
+
+	// Cooldown is how long the breaker stays open before a probe is allowed.
+	Cooldown time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*breakerHost
+}
+
+type breakerHost struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns a breaker opening after threshold consecutive
+// failures and probing again after cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+	}
+}
+
+func (b *CircuitBreaker) host(host string) *breakerHost {
+
+	if b.hosts == nil {
+		b.hosts = make(map[string]*breakerHost)
+	}
+
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &breakerHost{}
+		b.hosts[host] = h
+	}
+
+	return h
+}
+
+// Allow reports whether an operation on host may proceed. When the cooldown
+// of an open breaker has expired, a single caller is allowed through as a probe.
+func (b *CircuitBreaker) Allow(host string) bool {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.host(host)
+
+	switch h.state {
+	case BreakerOpen:
+		if time.Since(h.openedAt) < b.Cooldown {
+			return false
+		}
+		h.state = BreakerHalfOpen
+		h.probing = true
+		return true
+
+	case BreakerHalfOpen:
+		if h.probing {
+			return false
+		}
+		h.probing = true
+		return true
+	}
+
+	return true
+}
+
+// Success records a successful operation on host and closes its breaker.
+func (b *CircuitBreaker) Success(host string) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.host(host)
+	h.state = BreakerClosed
+	h.failures = 0
+	h.probing = false
+}
+
+// Failure records a failed operation on host, opening the breaker once the
+// threshold is reached or when a half-open probe fails.
+func (b *CircuitBreaker) Failure(host string) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.host(host)
+	h.failures++
+	h.probing = false
+
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	if h.state == BreakerHalfOpen || h.failures >= threshold {
+		h.state = BreakerOpen
+		h.openedAt = time.Now()
+	}
+}
+
+// Record records the result of an operation on host run with ctx. Remote
+// command failures (*ssh.ExitError) prove the host is reachable and count
+// as a success. Operations ended because ctx is done count as neither,
+// they say nothing about the host, while dial and handshake timeouts of
+// the host count as failures.
+func (b *CircuitBreaker) Record(ctx context.Context, host string, err error) {
+
+	var exitErr *ssh.ExitError
+
+	if ctx.Err() != nil {
+		b.release(host)
+		return
+	}
+
+	if err == nil || errors.As(err, &exitErr) {
+		b.Success(host)
+		return
+	}
+
+	b.Failure(host)
+}
+
+// release lets another probe through a half-open breaker of host whose
+// probe ended without result.
+func (b *CircuitBreaker) release(host string) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.host(host).probing = false
+}
+
+// State returns the breaker state of host.
+func (b *CircuitBreaker) State(host string) BreakerState {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.host(host)
+	if h.state == BreakerOpen && time.Since(h.openedAt) >= b.Cooldown {
+		return BreakerHalfOpen
+	}
+
+	return h.state
+}
+
+// Reset closes the breaker of host.
+func (b *CircuitBreaker) Reset(host string) {
+	b.Success(host)
+}
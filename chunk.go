@@ -0,0 +1,128 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultChunkSize is the size of the chunks of chunked copies when
+// ChunkOptions.Size is zero.
+var DefaultChunkSize = 256 << 10
+
+// ChunkOptions make Upload and Download copy the large files in chunks,
+// read and written at their offset over concurrent sftp requests, for the
+// high latency links where the round trips of a single stream bound the
+// throughput. The files are still opened once. The copies with
+// Config.Transforms stay sequential, and so do the files of servers
+// refusing writes at offsets.
+type ChunkOptions struct {
+
+	// Concurrency is the number of chunks of a file copied at once, zero
+	// or one copies the files sequentially.
+	Concurrency int
+
+	// Size of the chunks, DefaultChunkSize when zero. The files no larger
+	// than a chunk are copied sequentially.
+	Size int
+}
+
+// chunkOptions returns the chunk options of the config.
+func (c *Config) chunkOptions() ChunkOptions {
+	if c == nil {
+		return ChunkOptions{}
+	}
+	return c.Chunks
+}
+
+// size returns the size of the chunks.
+func (o ChunkOptions) size() int64 {
+	if o.Size <= 0 {
+		return int64(DefaultChunkSize)
+	}
+	return int64(o.Size)
+}
+
+// copyChunks copies the size bytes of the file of e from src to dst in
+// chunks, and reports whether it did. The copy is left to the sequential
+// one when the config does not chunk the file, or the server refused the
+// chunks without writing any.
+func (t *transfer) copyChunks(e *FileEvent, dst io.WriterAt, src io.ReaderAt, size int64) (bool, int64, error) {
+
+	opts := t.config.chunkOptions()
+	chunk := opts.size()
+
+	if opts.Concurrency < 2 || size <= chunk || len(t.config.Transforms) > 0 {
+		return false, 0, nil
+	}
+
+	eg, ctx := errgroup.WithContext(t.ctx)
+	eg.SetLimit(opts.Concurrency)
+
+	var (
+		mu     sync.Mutex
+		copied int64
+	)
+
+	for off := int64(0); off < size; off += chunk {
+		eg.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			buf := make([]byte, min(chunk, size-off))
+
+			n, err := src.ReadAt(buf, off)
+			if err == io.EOF && n == len(buf) {
+				err = nil
+			}
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return err
+			}
+
+			if _, err = dst.WriteAt(buf, off); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			copied += int64(n)
+			t.chunk(e, buf, copied)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+
+	var statusErr *sftp.StatusError
+	if errors.As(err, &statusErr) && statusErr.FxCode() == sftp.ErrSSHFxOpUnsupported && copied == 0 {
+		t.config.logger().Info("chunks unsupported, copying sequentially", t.config.logAttrs("local", e.LocalPath, "remote", e.RemotePath)...)
+		return false, 0, nil
+	}
+
+	return true, copied, err
+}
+
+// chunk reports the chunk p of the file of e copied by a chunked copy,
+// with fileBytes of the file copied, like source does for sequential
+// copies. The chunks are not read through ProxyReader.
+func (t *transfer) chunk(e *FileEvent, p []byte, fileBytes int64) {
+
+	if t.progress != nil {
+		t.progress.Write(p)
+	}
+
+	if t.onProgress != nil {
+		t.report(e, int64(len(p)), fileBytes)
+	}
+}
@@ -0,0 +1,66 @@
+package goph_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+)
+
+func TestChunks(t *testing.T) {
+
+	client := newFileServer(t)
+	client.Config.Chunks = goph.ChunkOptions{Concurrency: 4, Size: 1000}
+
+	data := make([]byte, 10500)
+	rand.Read(data)
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "big.bin")
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var bar countWriter
+	client.Config.Progress = &bar
+
+	var last goph.TransferProgress
+	if err := client.UploadContext(context.Background(), local, "/big.bin", func(p goph.TransferProgress) { last = p }); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readRemote(t, client, "/big.bin"); got != string(data) {
+		t.Fatalf("unexpected content of %d bytes uploaded", len(got))
+	}
+	if bar.n != len(data) || last.Bytes != int64(len(data)) || last.FileBytes != int64(len(data)) {
+		t.Errorf("expected the progress of %d bytes, got %d and %+v", len(data), bar.n, last)
+	}
+
+	back := filepath.Join(dir, "back.bin")
+	if err := client.Download("/big.bin", back); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(back); !bytes.Equal(got, data) {
+		t.Errorf("unexpected content of %d bytes downloaded", len(got))
+	}
+
+	// the transforms are sequential.
+	aes, err := goph.AESGCM(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Config.Transforms = []goph.Transform{aes}
+	if err = client.Upload(local, "/big.enc"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Download("/big.enc", back); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(back); !bytes.Equal(got, data) {
+		t.Errorf("unexpected content of %d bytes with transforms", len(got))
+	}
+}
@@ -4,22 +4,36 @@
 package goph
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/sync/errgroup"
 )
 
 // Client represents Goph client.
+//
+// The embedded ssh.Client is the connection of NewConn or of the last
+// Reconnect. The methods of Client also follow the reconnects made in the
+// background with Config.AutoReconnect.
 type Client struct {
 	*ssh.Client
 	Config *Config
+
+	state *clientState
 }
 
 // Config for Client.
@@ -31,6 +45,220 @@ type Config struct {
 	Timeout        time.Duration
 	Callback       ssh.HostKeyCallback
 	BannerCallback ssh.BannerCallback
+
+	// BannerPolicy, if set, is called with the pre-auth banner of the server,
+	// or an empty string if the server sent none. Returning an error rejects
+	// the connection with a *BannerError.
+	BannerPolicy func(banner string) error
+
+	// Ciphers, KeyExchanges and MACs restrict the algorithms offered during
+	// key exchange, in order of preference. Nil uses the x/crypto/ssh defaults.
+	Ciphers      []string
+	KeyExchanges []string
+	MACs         []string
+
+	// HostKeyAlgorithms restricts the host key algorithms accepted from the
+	// server, in order of preference. Nil uses the x/crypto/ssh defaults.
+	HostKeyAlgorithms []string
+
+	// profile is the name of the algorithm profile set by UseProfile.
+	profile string
+
+	// Logger receives structured events, nil disables logging.
+	Logger Logger
+
+	// Tracer, if set, traces dial, auth, command and transfer operations.
+	Tracer Tracer
+
+	// Metrics, if set, receives connection, command and transfer measurements.
+	Metrics Metrics
+
+	// Audit, if set, receives a record of every executed command and transfer.
+	Audit AuditFunc
+
+	// OnFileStart and OnFileComplete, if set, are called for every file copied
+	// by Upload and Download, including each file of directory transfers.
+	OnFileStart    func(FileEvent)
+	OnFileComplete func(FileEvent)
+
+	// OnFileError, if set, is called when a file fails to copy. Returning nil
+	// skips the file and continues the transfer, which then returns a
+	// PartialTransferError, returning an error aborts it. Without a hook the
+	// transfer is aborted with the file error.
+	OnFileError func(FileEvent) error
+
+	// Progress, if set, is written a copy of the bytes read from the source
+	// files of Upload and Download, so progress bars implementing io.Writer
+	// plug in as is. OnFileStart reports the size of each file.
+	Progress io.Writer
+
+	// ProxyReader, if set, wraps the source of every file copied by Upload
+	// and Download, for progress bars proxying an io.Reader.
+	ProxyReader func(io.Reader) io.Reader
+
+	// DownloadWorkers bounds the files of a directory Download fetched at
+	// once over the shared sftp client, which hides the round trips of
+	// distant hosts. Zero or one downloads the files one after another.
+	// The file hooks and Progress are not called concurrently.
+	DownloadWorkers int
+
+	// Chunks, if set, copies the large files of Upload and Download in
+	// chunks over concurrent sftp requests, see ChunkOptions.
+	Chunks ChunkOptions
+
+	// Transforms are applied in order to the files of Upload, and reversed
+	// on Download, see AESGCM.
+	Transforms []Transform
+
+	// ExpandEnv expands the $VAR and ${VAR} references of the remote paths
+	// of transfers and file edits to the remote environment, see Environ.
+	ExpandEnv bool
+
+	// IgnoreFiles, if set, are the names of the ignore files honored by
+	// directory uploads, like DefaultIgnoreFiles. Their gitignore patterns
+	// apply to the directory holding them and its subdirectories.
+	IgnoreFiles []string
+
+	// Transfer sets the file attributes preserved by Upload and Download,
+	// and how they copy symbolic links.
+	Transfer TransferOptions
+
+	// SCPFallback makes Upload and Download copy over scp when the server
+	// has no sftp subsystem, see UploadSCP.
+	SCPFallback bool
+
+	// ForwardAgent forwards Agent, or the local agent at SSH_AUTH_SOCK when
+	// nil, to the commands and shells of the client, like ssh -A. Only
+	// forward agents to hosts trusted with the keys.
+	ForwardAgent bool
+	Agent        agent.Agent
+
+	// Dialer, if set, opens the connection to the server instead of a
+	// net.Dialer, to reach hosts through tunnels or overlay networks.
+	Dialer Dialer
+
+	// Proxy, if set, is the config of a jump host the server is reached
+	// through, like OpenSSH ProxyJump. Chain jump hosts by setting the
+	// Proxy of Proxy. The jump host connections are closed with the client.
+	// Dialer is ignored when Proxy is set.
+	Proxy *Config
+
+	// PreConnect, if set, is called before the TCP dial, for port knocking,
+	// just-in-time firewall openings or environment checks. An error aborts
+	// the connection.
+	PreConnect func(ctx context.Context, c *Config) error
+
+	// PostConnect, if set, is called once the connection attempt completes,
+	// successful or not, to clean up after PreConnect. An error closes a
+	// successful connection.
+	PostConnect func(ctx context.Context, c *Config) error
+
+	// OnConnect, OnDisconnect and OnReconnect, if set, are called when the
+	// client connects, when its connection closes, and when it re-dials.
+	// A connection keeps the hooks of the config it was dialed with,
+	// changing them applies from the next dial.
+	OnConnect    func(ConnInfo)
+	OnDisconnect func(ConnInfo)
+	OnReconnect  func(ConnInfo)
+
+	// OnDial, OnHostKey and OnAuthResult, if set, are called after every
+	// TCP dial, host key check and handshake of the server, to measure and
+	// trace the connection steps.
+	OnDial       func(DialEvent)
+	OnHostKey    func(HostKeyEvent)
+	OnAuthResult func(AuthEvent)
+
+	// OnSessionStart and OnSessionEnd, if set, are called when a session
+	// channel is opened and closed.
+	OnSessionStart func(SessionEvent)
+	OnSessionEnd   func(SessionEvent)
+
+	// OnTransferStart and OnTransferEnd, if set, are called around every
+	// transfer, with its byte counts and duration on end, see OnFileStart
+	// for its files.
+	OnTransferStart func(TransferEvent)
+	OnTransferEnd   func(TransferEvent)
+
+	// MaxAuthTries, if set, bounds the passwords, keys and prompts offered
+	// to the server, so automation runs cannot trigger account lockouts or
+	// fail2ban bans. Authentication fails with ErrMaxAuthTries once reached.
+	MaxAuthTries int
+
+	// AuthOrder, if set, sorts Auth by method name, for example
+	// []string{"publickey", "password"}. Unlisted methods are tried last.
+	AuthOrder []string
+
+	// AuthKey, if set, names the credentials of Auth for the Registry:
+	// configs with the same user, address, port and AuthKey share a
+	// connection. Otherwise only configs with the same Auth slice share one,
+	// the auth methods are never called to tell credentials apart.
+	AuthKey string
+
+	// CommandRate, if set, limits the commands, shells and subsystems
+	// started per second, with bursts of up to CommandBurst, so automation
+	// does not trip sshd MaxStartups or intrusion detection.
+	CommandRate  float64
+	CommandBurst int
+
+	// MaxSessions, if set, bounds the concurrent commands, shells and
+	// subsystems of the connection, others wait for a session to close.
+	// Keep it under the sshd MaxSessions, 10 by default.
+	MaxSessions int
+
+	// IdleTimeout, if set, closes the connection and its sessions once no
+	// bytes were sent or received for the duration.
+	IdleTimeout time.Duration
+
+	// OnIdle, if set, is called before an idle connection is closed,
+	// returning false keeps the connection open for another IdleTimeout.
+	// Like the lifecycle hooks, both are read when the connection is dialed.
+	OnIdle func(ConnInfo) bool
+
+	// KeepAlive, if set, sends a keepalive request at this interval and
+	// closes the connection with ErrKeepAlive when one is not answered
+	// within the interval, so dropped connections are noticed and NAT
+	// mappings stay open.
+	KeepAlive time.Duration
+
+	// AutoReconnect re-dials the host in the background when the connection
+	// breaks, with backoff until it succeeds or the client is closed, then
+	// calls OnReconnect. The client and its copies use the new connection
+	// from then on. Operations running meanwhile fail, see WithRedial to
+	// retry them. KeepAlive and AutoReconnect are read when the connection
+	// is dialed, the re-dials use the config of the broken connection.
+	AutoReconnect bool
+
+	// Retry, if set, tries the connection of NewConn again when it fails
+	// with a retryable error, and resumes the resumable transfers broken
+	// by a dropped connection, see RetryPolicy.
+	Retry RetryPolicy
+
+	// RemoteOS, if set, is the operating system of the server, RemoteUnix
+	// or RemoteWindows, detected from its version otherwise. The remote
+	// paths of Windows servers may use backslashes.
+	RemoteOS string
+
+	// RemoteShell, if set, is the shell running the commands of the
+	// server, ShellPOSIX, ShellCmd or ShellPowerShell, which Command
+	// quotes the args for. See Client.RemoteShell for the default.
+	RemoteShell string
+
+	// SecretPatterns match the secrets redacted from commands and errors in
+	// logs and audit records, DefaultSecretPatterns are used when nil.
+	SecretPatterns []*regexp.Regexp
+
+	// Debug logs host key decisions, banner, negotiated algorithms, channels
+	// and global requests to Logger at debug level, like ssh -vvv.
+	// Secrets are never logged.
+	Debug bool
+}
+
+// downloadWorkers returns the number of files downloaded at once.
+func (c *Config) downloadWorkers() int {
+	if c == nil || c.DownloadWorkers < 1 {
+		return 1
+	}
+	return c.DownloadWorkers
 }
 
 // DefaultTimeout is the timeout of ssh client connection.
@@ -73,41 +301,327 @@ func NewUnknown(user string, addr string, auth Auth) (*Client, error) {
 
 // NewConn returns new client and error if any.
 func NewConn(config *Config) (c *Client, err error) {
+	return NewConnContext(context.Background(), config)
+}
+
+// hostPort returns the "host:port" address of the config.
+func (c *Config) hostPort() string {
+	if c == nil {
+		return ""
+	}
+	return net.JoinHostPort(c.Addr, fmt.Sprint(c.Port))
+}
+
+// NewConnContext returns new client and error if any, the context bounds the
+// dial and handshake.
+func NewConnContext(ctx context.Context, config *Config) (c *Client, err error) {
+
+	log := config.logger()
+	start := time.Now()
+
+	log.Debug("connecting", config.logAttrs("auth", authMethodNames(config.Auth))...)
+
+	ctx, span := config.startSpan(ctx, "goph.connect",
+		slog.String("ssh.auth_methods", strings.Join(authMethodNames(config.Auth), ",")),
+	)
+	defer func() { span.End(err) }()
 
 	c = &Client{
 		Config: config,
 	}
 
-	c.Client, err = Dial("tcp", config)
+	var state *clientState
+
+	if c.Client, state, err = config.dialRetry(ctx, "tcp"); err != nil {
+		log.Error("connect failed", config.logAttrs("error", err, "duration", time.Since(start))...)
+		config.metrics().ConnectionFailed(config.hostPort(), err)
+		if isAuthError(err) {
+			config.metrics().AuthFailed(config.hostPort())
+		}
+		return
+	}
+
+	config.metrics().ConnectionOpened(config.hostPort())
+
+	log.Info("connected", config.logAttrs(
+		"auth", authMethodNames(config.Auth),
+		"server_version", string(c.ServerVersion()),
+		"duration", time.Since(start),
+	)...)
+
+	c.connected(c.Client, state)
 	return
 }
 
+// clientConfig returns the ssh client config for c.
+func (c *Config) clientConfig() *ssh.ClientConfig {
+
+	config := &ssh.ClientConfig{
+		Config: ssh.Config{
+			Ciphers:      c.Ciphers,
+			KeyExchanges: c.KeyExchanges,
+			MACs:         c.MACs,
+		},
+		User:              c.User,
+		Auth:              c.authMethods(),
+		Timeout:           c.Timeout,
+		HostKeyCallback:   c.Callback,
+		BannerCallback:    c.BannerCallback,
+		HostKeyAlgorithms: c.HostKeyAlgorithms,
+	}
+
+	if c.Debug {
+		config.HostKeyCallback = c.debugHostKeyCallback(config.HostKeyCallback)
+		config.BannerCallback = c.debugBannerCallback(config.BannerCallback)
+	}
+
+	config.HostKeyCallback = c.hostKeyHook(config.HostKeyCallback)
+
+	return config
+}
+
 // Dial starts a client connection to SSH server based on config.
 func Dial(proto string, c *Config) (*ssh.Client, error) {
-	return ssh.Dial(proto, net.JoinHostPort(c.Addr, fmt.Sprint(c.Port)), &ssh.ClientConfig{
-		User:            c.User,
-		Auth:            c.Auth,
-		Timeout:         c.Timeout,
-		HostKeyCallback: c.Callback,
-		BannerCallback:  c.BannerCallback,
+	return ssh.Dial(proto, c.hostPort(), c.clientConfig())
+}
+
+// DialContext starts a client connection to SSH server based on config,
+// the connection is aborted if ctx is done before the handshake completes.
+func DialContext(ctx context.Context, proto string, c *Config) (*ssh.Client, error) {
+	client, _, err := c.dial(ctx, proto)
+	return client, err
+}
+
+// dial starts a client connection and returns it with its initial state.
+func (c *Config) dial(ctx context.Context, proto string) (client *ssh.Client, state *clientState, err error) {
+
+	defer func() {
+		err = c.opError(OpError{Op: "connect", Err: err})
+	}()
+
+	if c.PreConnect != nil {
+		if err = c.PreConnect(ctx, c); err != nil {
+			return nil, nil, fmt.Errorf("pre-connect: %w", err)
+		}
+	}
+
+	if c.PostConnect != nil {
+		defer func() {
+			postErr := c.PostConnect(ctx, c)
+			switch {
+			case postErr == nil:
+			case err != nil:
+				c.logger().Warn("post-connect failed", c.logAttrs("error", postErr)...)
+			default:
+				client.Close()
+				client, state, err = nil, nil, fmt.Errorf("post-connect: %w", postErr)
+			}
+		}()
+	}
+
+	var dialer Dialer = &net.Dialer{Timeout: c.Timeout}
+	if c.Dialer != nil {
+		dialer = c.Dialer
+	}
+
+	dialStart := time.Now()
+
+	var tcpConn net.Conn
+	if c.Proxy != nil {
+		tcpConn, err = c.proxyDial(ctx, proto)
+	} else {
+		tcpConn, err = dialer.DialContext(ctx, proto, c.hostPort())
+	}
+	c.onDial(dialStart, tcpConn, connectError(err))
+	if err != nil {
+		return nil, nil, connectError(err)
+	}
+
+	state = &clientState{
+		counter: newCountingConn(tcpConn),
+		done:    make(chan struct{}),
+		limiter: c.newLimiter(),
+	}
+	var conn net.Conn = state.counter
+
+	// the handshake span covers key exchange, host key verification and auth.
+	_, span := c.startSpan(ctx, "goph.handshake")
+	defer func() { span.End(err) }()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
 	})
+	defer stop()
+
+	// capture the kex init packets for debug logs and profile diagnostics.
+	var kex *kexConn
+	if c.Debug || c.profile != "" {
+		kex = &kexConn{Conn: conn}
+		conn = kex
+	}
+
+	config := c.clientConfig()
+	config.BannerCallback = c.bannerCallback(state, config.BannerCallback)
+
+	handshakeStart := time.Now()
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.hostPort(), config)
+	c.onAuthResult(handshakeStart, connectError(err))
+
+	if kex != nil && c.Debug {
+		c.logNegotiation(kex)
+	}
+
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, nil, connectError(ctx.Err())
+		}
+		var bannerErr *BannerError
+		if errors.As(err, &bannerErr) {
+			return nil, nil, bannerErr
+		}
+		return nil, nil, connectError(c.profileError(err, kex))
+	}
+
+	// servers without a banner are checked against the policy too.
+	if !state.bannerReceived && c.BannerPolicy != nil {
+		if err = c.BannerPolicy(""); err != nil {
+			sshConn.Close()
+			return nil, nil, &BannerError{Err: err}
+		}
+	}
+
+	if c.Debug {
+		chans = c.debugChannels(chans)
+		reqs = c.debugRequests(reqs)
+	}
+
+	client = ssh.NewClient(c.countSessions(sshConn), chans, reqs)
+
+	if c.ForwardAgent {
+		if err = c.forwardAgent(client); err != nil {
+			client.Close()
+			return nil, nil, err
+		}
+	}
+
+	return client, state, nil
+}
+
+// NewSession opens a new session channel on the connection.
+func (c Client) NewSession() (*ssh.Session, error) {
+
+	c = c.live()
+
+	if c.state != nil {
+		if err := c.state.drain.accepting(); err != nil {
+			return nil, err
+		}
+	}
+
+	sess, err := c.Client.NewSession()
+	err = sessionError(err)
+	if err == nil {
+		c.Config.onSessionStart()
+	}
+
+	if err == nil && c.Config != nil && c.Config.ForwardAgent {
+		if err = agent.RequestAgentForwarding(sess); err != nil {
+			sess.Close()
+			sess, err = nil, fmt.Errorf("agent forwarding: %w", err)
+		}
+	}
+
+	if c.Config != nil && c.Config.Debug {
+		if err != nil {
+			c.Config.logger().Debug("session channel open failed", c.Config.logAttrs("error", err)...)
+		} else {
+			c.Config.logger().Debug("session channel opened", c.Config.logAttrs()...)
+		}
+	}
+
+	return sess, err
+}
+
+// closeSession closes a session opened by the client.
+func (c Client) closeSession(sess *ssh.Session) {
+
+	sess.Close()
+	c.endOp(sess)
+	c.Config.onSessionEnd("")
+
+	if c.Config != nil && c.Config.Debug {
+		c.Config.logger().Debug("session channel closed", c.Config.logAttrs()...)
+	}
 }
 
 // Run starts a new SSH session and runs the cmd, it returns CombinedOutput and err if any.
 func (c Client) Run(cmd string) ([]byte, error) {
 
-	var (
-		err  error
-		sess *ssh.Session
-	)
+	buf := getBuffer()
+	defer putBuffer(buf)
 
-	if sess, err = c.NewSession(); err != nil {
+	err := c.run(cmd, buf)
+	if buf.Len() == 0 {
 		return nil, err
 	}
 
-	defer sess.Close()
+	return bytes.Clone(buf.Bytes()), err
+}
+
+// RunAppend is like Run, and appends the output to dst, so tools running
+// many commands can reuse a buffer: out, err = c.RunAppend(cmd, out[:0]).
+func (c Client) RunAppend(cmd string, dst []byte) ([]byte, error) {
+
+	buf := bytes.NewBuffer(dst)
+	err := c.run(cmd, buf)
 
-	return sess.CombinedOutput(cmd)
+	return buf.Bytes(), err
+}
+
+// run runs cmd in a new session, writing its combined output to buf.
+func (c Client) run(cmd string, buf *bytes.Buffer) (err error) {
+
+	var sess *ssh.Session
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "run", Command: cmd, Err: err})
+	}()
+
+	log := c.Config.logger()
+	start := time.Now()
+
+	_, span := c.Config.startSpan(context.Background(), "goph.run", slog.String("goph.command_hash", commandHash(cmd)))
+	defer func() {
+		span.End(err)
+		c.Config.audit(AuditRecord{Time: start, Operation: "run", Command: cmd, Err: err, Duration: time.Since(start)})
+	}()
+
+	if sess, err = c.openSession(context.Background()); err != nil {
+		log.Error("session failed", c.Config.logAttrs("command", cmd, "error", err)...)
+		return err
+	}
+
+	defer c.closeSession(sess)
+
+	log.Debug("command started", c.Config.logAttrs("command", cmd)...)
+
+	// stdout and stderr are written concurrently.
+	w := &lockedWriter{w: buf}
+	sess.Stdout = w
+	sess.Stderr = w
+
+	n := buf.Len()
+	err = sess.Run(cmd)
+	span.SetAttributes(slog.Int("goph.output_bytes", buf.Len()-n))
+	c.Config.metrics().CommandDuration(c.Config.hostPort(), time.Since(start), err)
+	if err != nil {
+		log.Error("command failed", c.Config.logAttrs("command", cmd, "error", err, "duration", time.Since(start))...)
+	} else {
+		log.Debug("command finished", c.Config.logAttrs("command", cmd, "duration", time.Since(start))...)
+	}
+
+	return err
 }
 
 // Run starts a new SSH session with context and runs the cmd. It returns CombinedOutput and err if any.
@@ -120,15 +634,17 @@ func (c Client) RunContext(ctx context.Context, name string) ([]byte, error) {
 	return cmd.CombinedOutput()
 }
 
-// Command returns new Cmd and error if any.
+// Command returns new Cmd and error if any. The args are quoted for the
+// remote shell, name is passed to the shell as is, see Cmd.Args.
 func (c Client) Command(name string, args ...string) (*Cmd, error) {
+	return c.CommandContext(context.Background(), name, args...)
+}
 
-	var (
-		sess *ssh.Session
-		err  error
-	)
+// Command returns new Cmd with context and error, if any.
+func (c Client) CommandContext(ctx context.Context, name string, args ...string) (*Cmd, error) {
 
-	if sess, err = c.NewSession(); err != nil {
+	sess, err := c.openSession(ctx)
+	if err != nil {
 		return nil, err
 	}
 
@@ -136,111 +652,303 @@ func (c Client) Command(name string, args ...string) (*Cmd, error) {
 		Path:    name,
 		Args:    args,
 		Session: sess,
-		Context: context.Background(),
+		Context: ctx,
+		config:  c.Config,
+		shell:   c.RemoteShell(),
+		done:    func() { c.endOp(sess) },
 	}, nil
 }
 
-// Command returns new Cmd with context and error, if any.
-func (c Client) CommandContext(ctx context.Context, name string, args ...string) (*Cmd, error) {
-	cmd, err := c.Command(name, args...)
-	if err != nil {
-		return cmd, err
-	}
-
-	cmd.Context = ctx
-
-	return cmd, nil
-}
-
 // NewSftp returns new sftp client and error if any.
 func (c Client) NewSftp(opts ...sftp.ClientOption) (*sftp.Client, error) {
-	return sftp.NewClient(c.Client, opts...)
+	c = c.live()
+	if c.state != nil {
+		if err := c.state.drain.accepting(); err != nil {
+			return nil, c.Config.opError(OpError{Op: "sftp", Err: err})
+		}
+	}
+	client, err := sftp.NewClient(c.Client, opts...)
+	return client, c.Config.opError(OpError{Op: "sftp", Err: withKind(ErrSFTPUnavailable, err)})
 }
 
-// Close client net connection.
+// Close client net connection. A client of a Registry is only closed
+// once every Connect that returned it was closed.
 func (c Client) Close() error {
+	c = c.live()
+	if c.state != nil && c.state.release != nil && !c.state.release() {
+		return nil
+	}
+	return c.closeConn()
+}
+
+// closeConn closes the client net connection.
+func (c Client) closeConn() error {
+	if c.state != nil {
+		c.state.closed.Store(true)
+	}
 	return c.Client.Close()
 }
 
+// Upload uploads a local file or directory to the remote server.
 func (c *Client) Upload(srcPath, dstPath string) error {
+	return c.UploadContext(context.Background(), srcPath, dstPath, nil)
+}
+
+// UploadContext is like Upload, but the transfer stops with the context error
+// once ctx is done, even in the middle of a file. progress, if not nil, is
+// called as bytes are copied.
+func (c *Client) UploadContext(ctx context.Context, srcPath, dstPath string, progress func(TransferProgress)) error {
+	return c.upload(ctx, srcPath, dstPath, progress, false)
+}
+
+// upload uploads srcPath to dstPath over sftp, or over scp with useSCP or
+// when sftp is unavailable and Config.SCPFallback is set.
+func (c *Client) upload(ctx context.Context, srcPath, dstPath string, progress func(TransferProgress), useSCP bool) (err error) {
+	t := c.Config.startTransfer(ctx, "upload", srcPath, dstPath)
+	defer func() { err = t.end(err) }()
+
+	if err = c.beginOp(t); err != nil {
+		return err
+	}
+	defer c.endOp(t)
+
+	if dstPath, err = c.remotePath(dstPath); err != nil {
+		return err
+	}
+	t.remote = dstPath
+
 	stat, err := os.Stat(srcPath)
 	if err != nil {
 		return fmt.Errorf("failed to stat source path: %w", err)
 	}
 
-	if stat.IsDir() {
-		// Directory upload
-		return c.uploadDirectory(srcPath, dstPath)
+	if progress != nil {
+		t.onProgress = progress
+		t.total = stat.Size()
+		if stat.IsDir() {
+			t.total, err = c.uploadSize(srcPath)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	// File upload
-	return c.uploadFile(srcPath, dstPath)
-}
+	if useSCP {
+		return c.uploadSCP(t, srcPath, dstPath, stat)
+	}
 
-func (c *Client) uploadFile(srcPath, dstPath string) error {
-	sftpClient, err := sftp.NewClient(c.Client)
+	sftpClient, err := c.NewSftp()
+	if errors.Is(err, ErrSFTPUnavailable) && c.Config.scpFallback() {
+		c.Config.logger().Info("sftp unavailable, uploading with scp", c.Config.logAttrs("remote", dstPath)...)
+		return c.uploadSCP(t, srcPath, dstPath, stat)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create sftp client: %w", err)
 	}
 	defer sftpClient.Close()
 
-	srcFile, err := os.Open(srcPath)
-	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+	if stat.IsDir() {
+		// Directory upload
+		return c.uploadDirectory(t, sftpClient, srcPath, dstPath)
 	}
-	defer srcFile.Close()
 
-	dstFile, err := sftpClient.Create(dstPath)
-	if err != nil {
-		return fmt.Errorf("failed to create remote file: %w", err)
-	}
-	defer dstFile.Close()
-
-	_, err = io.Copy(dstFile, srcFile)
-	return err
+	// File upload
+	return c.copyToRemote(t, sftpClient, srcPath, dstPath)
 }
 
-func (c *Client) uploadDirectory(srcDir, dstDir string) error {
-	sftpClient, err := sftp.NewClient(c.Client)
-	if err != nil {
-		return fmt.Errorf("failed to create sftp client: %w", err)
-	}
-	defer sftpClient.Close()
+func (c *Client) uploadDirectory(t *transfer, sftpClient *sftp.Client, srcDir, dstDir string) error {
+	opts := c.Config.transferOptions()
 
-	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	// directory attributes are set once their content is copied.
+	var dirs []copiedDir
 
-		relPath, err := filepath.Rel(srcDir, path)
-		if err != nil {
+	err := c.walkUpload(srcDir, func(localPath, relPath string, info os.FileInfo) error {
+		if err := t.ctx.Err(); err != nil {
 			return err
 		}
 
-		targetPath := filepath.Join(dstDir, relPath)
+		targetPath := path.Join(dstDir, filepath.ToSlash(relPath))
 
 		if info.IsDir() {
 			sftpClient.MkdirAll(targetPath)
-		} else {
-			srcFile, err := os.Open(path)
-			if err != nil {
-				return err
+			dirs = append(dirs, copiedDir{targetPath, info})
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 && !opts.FollowSymlinks {
+			return c.linkToRemote(t, sftpClient, localPath, targetPath)
+		}
+
+		return c.copyToRemote(t, sftpClient, localPath, targetPath)
+	})
+	if err != nil || !opts.preserve() {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := opts.setRemote(sftpClient, dirs[i].path, dirs[i].info); err != nil {
+			return fmt.Errorf("failed to set remote directory attributes: %w", err)
+		}
+	}
+	return nil
+}
+
+// copiedDir is a directory copied by a directory transfer.
+type copiedDir struct {
+	path string
+	info os.FileInfo
+}
+
+// uploadSize returns the size of the files uploaded from srcDir.
+func (c *Client) uploadSize(srcDir string) (size int64, err error) {
+	err = c.walkUpload(srcDir, func(_, _ string, info os.FileInfo) error {
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// walkUpload walks the local directory srcDir, skipping the paths ignored
+// by Config.IgnoreFiles, and calls fn with every path and its path
+// relative to srcDir. Symbolic links are passed as is, or replaced by what
+// they point to with TransferOptions.FollowSymlinks.
+func (c *Client) walkUpload(srcDir string, fn func(path, relPath string, info os.FileInfo) error) error {
+	var ignore *ignoreMatcher
+	if c.Config != nil && len(c.Config.IgnoreFiles) > 0 {
+		ignore = newIgnoreMatcher(srcDir, c.Config.IgnoreFiles)
+	}
+
+	follow := c.Config.transferOptions().FollowSymlinks
+
+	// walking are the directories being walked, to break link cycles.
+	walking := make(map[string]bool)
+
+	var walk func(dir, base string) error
+	walk = func(dir, base string) error {
+
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			if walking[real] {
+				return nil
 			}
-			defer srcFile.Close()
+			walking[real] = true
+			defer delete(walking, real)
+		}
 
-			dstFile, err := sftpClient.Create(targetPath)
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			defer dstFile.Close()
 
-			_, err = io.Copy(dstFile, srcFile)
+			relPath, err := filepath.Rel(dir, path)
 			if err != nil {
 				return err
 			}
+			relPath = filepath.Join(base, relPath)
+
+			// broken links are passed as is, and fail to copy.
+			linked := false
+			if follow && info.Mode()&os.ModeSymlink != 0 {
+				if target, err := os.Stat(path); err == nil {
+					info, linked = target, true
+				}
+			}
+
+			if ignore != nil && relPath != "." && ignore.ignored(filepath.ToSlash(relPath), info.IsDir()) {
+				if info.IsDir() && !linked {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			// filepath.Walk does not enter links, walk what they point to.
+			if linked && info.IsDir() {
+				real, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return err
+				}
+				return walk(real, relPath)
+			}
+
+			if ignore != nil && info.IsDir() {
+				if err := ignore.load(filepath.ToSlash(relPath)); err != nil {
+					return err
+				}
+			}
+
+			return fn(path, relPath, info)
+		})
+	}
+
+	return walk(srcDir, ".")
+}
+
+// copyToRemote copies a single local file to the remote server.
+func (c *Client) copyToRemote(t *transfer, sftpClient *sftp.Client, srcPath, dstPath string) error {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return t.fileError(t.fileStart(srcPath, dstPath, 0), fmt.Errorf("failed to open source file: %w", err))
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return t.fileError(t.fileStart(srcPath, dstPath, 0), fmt.Errorf("failed to stat source file: %w", err))
+	}
+
+	e := t.fileStart(srcPath, dstPath, info.Size())
+
+	dstFile, err := sftpClient.Create(dstPath)
+	if err != nil {
+		return t.fileError(e, fmt.Errorf("failed to create remote file: %w", err))
+	}
+	defer dstFile.Close()
+
+	chunked, n, err := t.copyChunks(e, dstFile, srcFile, info.Size())
+	if !chunked {
+		n, err = c.copySequential(t, e, dstFile, srcFile)
+	}
+	e.Bytes = n
+	if err != nil {
+		return t.fileError(e, err)
+	}
+
+	// flush to stable storage when the server supports it.
+	if _, ok := sftpClient.HasExtension(ExtFsync); ok {
+		if err := dstFile.Sync(); err != nil {
+			return t.fileError(e, fmt.Errorf("failed to sync remote file: %w", err))
 		}
-		return nil
-	})
+	}
+
+	if err := c.Config.transferOptions().setRemote(sftpClient, dstPath, info); err != nil {
+		return t.fileError(e, fmt.Errorf("failed to set remote file attributes: %w", err))
+	}
+
+	t.file(e, n)
+	return nil
+}
+
+// copySequential copies the local file src to the remote dst from start to
+// end, through the config transforms.
+func (c *Client) copySequential(t *transfer, e *FileEvent, dst io.Writer, src io.Reader) (int64, error) {
+
+	w, err := c.Config.transformWriter(dst)
+	if err != nil {
+		return 0, fmt.Errorf("failed to transform remote file: %w", err)
+	}
+
+	n, err := io.Copy(w, t.source(e, src))
+	if err != nil {
+		w.Close()
+		return n, err
+	}
+
+	if err := w.Close(); err != nil {
+		return n, fmt.Errorf("failed to transform remote file: %w", err)
+	}
+
+	return n, nil
 }
 
 // The original Upload method on the goph package that doesn't handle directories.
@@ -297,8 +1005,45 @@ func (c Client) DownloadV1(remotePath string, localPath string) (err error) {
 }
 
 // Download downloads a file or directory from the remote server to the local filesystem.
-func (c Client) Download(remotePath string, localPath string) (err error) {
+func (c Client) Download(remotePath string, localPath string) error {
+	return c.DownloadContext(context.Background(), remotePath, localPath, nil)
+}
+
+// DownloadContext is like Download, but the transfer stops with the context
+// error once ctx is done, even in the middle of a file. progress, if not
+// nil, is called as bytes are copied.
+func (c Client) DownloadContext(ctx context.Context, remotePath, localPath string, progress func(TransferProgress)) error {
+	return c.download(ctx, remotePath, localPath, progress, false)
+}
+
+// download downloads remotePath to localPath over sftp, or over scp with
+// useSCP or when sftp is unavailable and Config.SCPFallback is set.
+func (c Client) download(ctx context.Context, remotePath, localPath string, progress func(TransferProgress), useSCP bool) (err error) {
+	t := c.Config.startTransfer(ctx, "download", localPath, remotePath)
+	defer func() { err = t.end(err) }()
+
+	if err = c.beginOp(t); err != nil {
+		return err
+	}
+	defer c.endOp(t)
+
+	if remotePath, err = c.remotePath(remotePath); err != nil {
+		return err
+	}
+	t.remote = remotePath
+
+	// the size of scp downloads is unknown until they end.
+	t.onProgress = progress
+
+	if useSCP {
+		return c.downloadSCP(t, remotePath, localPath)
+	}
+
 	sftpClient, err := c.NewSftp()
+	if errors.Is(err, ErrSFTPUnavailable) && c.Config.scpFallback() {
+		c.Config.logger().Info("sftp unavailable, downloading with scp", c.Config.logAttrs("remote", remotePath)...)
+		return c.downloadSCP(t, remotePath, localPath)
+	}
 	if err != nil {
 		return err
 	}
@@ -309,61 +1054,193 @@ func (c Client) Download(remotePath string, localPath string) (err error) {
 		return fmt.Errorf("failed to stat remote path: %w", err)
 	}
 
+	if progress != nil {
+		t.total = info.Size()
+		if info.IsDir() {
+			t.total, err = c.downloadSize(sftpClient, remotePath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	if info.IsDir() {
-		return downloadDirectory(sftpClient, remotePath, localPath)
+		return c.downloadDirectory(t, sftpClient, remotePath, localPath)
 	}
-	return downloadFile(sftpClient, remotePath, localPath)
+	return c.downloadFile(t, sftpClient, remotePath, localPath)
 }
 
 // downloadFile downloads a single file from the remote server.
-func downloadFile(sftpClient *sftp.Client, remotePath, localPath string) error {
+func (c Client) downloadFile(t *transfer, sftpClient *sftp.Client, remotePath, localPath string) error {
 	srcFile, err := sftpClient.Open(remotePath)
 	if err != nil {
-		return fmt.Errorf("failed to open remote file: %w", err)
+		return t.fileError(t.fileStart(localPath, remotePath, 0), fmt.Errorf("failed to open remote file: %w", err))
 	}
 	defer srcFile.Close()
 
+	info, err := srcFile.Stat()
+	if err != nil {
+		return t.fileError(t.fileStart(localPath, remotePath, 0), fmt.Errorf("failed to stat remote file: %w", err))
+	}
+
+	e := t.fileStart(localPath, remotePath, info.Size())
+
 	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
-		return fmt.Errorf("failed to create local directories: %w", err)
+		return t.fileError(e, fmt.Errorf("failed to create local directories: %w", err))
 	}
 
 	dstFile, err := os.Create(localPath)
 	if err != nil {
-		return fmt.Errorf("failed to create local file: %w", err)
+		return t.fileError(e, fmt.Errorf("failed to create local file: %w", err))
 	}
 	defer dstFile.Close()
 
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
-		return fmt.Errorf("failed to copy data: %w", err)
+	chunked, n, err := t.copyChunks(e, dstFile, srcFile, info.Size())
+	if !chunked {
+		var r io.Reader
+		if r, err = c.Config.transformReader(t.source(e, srcFile)); err != nil {
+			return t.fileError(e, fmt.Errorf("failed to transform remote file: %w", err))
+		}
+		n, err = io.Copy(dstFile, r)
+	}
+	e.Bytes = n
+	if err != nil {
+		return t.fileError(e, fmt.Errorf("failed to copy data: %w", err))
+	}
+
+	if err := dstFile.Sync(); err != nil {
+		return t.fileError(e, err)
+	}
+
+	if err := c.Config.transferOptions().setLocal(localPath, info); err != nil {
+		return t.fileError(e, fmt.Errorf("failed to set local file attributes: %w", err))
 	}
 
-	return dstFile.Sync()
+	t.file(e, n)
+	return nil
 }
 
-// downloadDirectory recursively downloads a directory from the remote server.
-func downloadDirectory(sftpClient *sftp.Client, remoteDir, localDir string) error {
-	walker := sftpClient.Walk(remoteDir)
-	for walker.Step() {
-		if err := walker.Err(); err != nil {
-			return err
+// downloadSize returns the size of the files of the remote directory.
+func (c Client) downloadSize(sftpClient *sftp.Client, remoteDir string) (size int64, err error) {
+	err = c.walkDownload(sftpClient, remoteDir, func(_, _ string, info os.FileInfo) error {
+		if info.Mode().IsRegular() {
+			size += info.Size()
 		}
+		return nil
+	})
+	return size, err
+}
 
-		relPath, err := filepath.Rel(remoteDir, walker.Path())
-		if err != nil {
-			return fmt.Errorf("failed to get relative path: %w", err)
+// walkDownload walks the remote directory remoteDir and calls fn with every
+// path and its path relative to remoteDir. Symbolic links are passed as is,
+// or replaced by what they point to with TransferOptions.FollowSymlinks.
+func (c Client) walkDownload(sftpClient *sftp.Client, remoteDir string, fn func(path, relPath string, info os.FileInfo) error) error {
+
+	follow := c.Config.transferOptions().FollowSymlinks
+
+	// walking are the directories being walked, to break link cycles.
+	walking := make(map[string]bool)
+
+	var walk func(dir, base string) error
+	walk = func(dir, base string) error {
+
+		walking[dir] = true
+		defer delete(walking, dir)
+
+		walker := sftpClient.Walk(dir)
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				return err
+			}
+
+			// remote paths are slash separated whatever the local OS.
+			relPath := path.Join(base, remoteRel(dir, walker.Path()))
+
+			info := walker.Stat()
+			if follow && info.Mode()&os.ModeSymlink != 0 {
+				// broken links are passed as is, and fail to copy.
+				real, err := resolveRemote(sftpClient, walker.Path())
+				if err == nil {
+					if target, err := sftpClient.Stat(real); err == nil {
+						info = target
+					}
+				}
+				if info.IsDir() {
+					if walking[real] {
+						continue
+					}
+					if err := walk(real, relPath); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			if err := fn(walker.Path(), relPath, info); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
+
+	return walk(path.Clean(remoteDir), ".")
+}
+
+// downloadDirectory recursively downloads a directory from the remote server,
+// with up to Config.DownloadWorkers files at once.
+func (c Client) downloadDirectory(t *transfer, sftpClient *sftp.Client, remoteDir, localDir string) error {
+	eg, ctx := errgroup.WithContext(t.ctx)
+	eg.SetLimit(c.Config.downloadWorkers())
 
-		localPath := filepath.Join(localDir, relPath)
+	opts := c.Config.transferOptions()
 
-		if walker.Stat().IsDir() {
+	// directory attributes are set once their content is copied.
+	var dirs []copiedDir
+
+	err := c.walkDownload(sftpClient, remoteDir, func(remotePath, relPath string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		localPath := filepath.Join(localDir, filepath.FromSlash(relPath))
+
+		if info.IsDir() {
 			if err := os.MkdirAll(localPath, 0755); err != nil {
 				return fmt.Errorf("failed to create local directory: %w", err)
 			}
-			continue
+			dirs = append(dirs, copiedDir{localPath, info})
+			return nil
 		}
 
-		if err := downloadFile(sftpClient, walker.Path(), localPath); err != nil {
-			return err
+		if info.Mode()&os.ModeSymlink != 0 && !opts.FollowSymlinks {
+			return c.linkToLocal(t, sftpClient, remotePath, localPath)
+		}
+
+		eg.Go(func() error {
+			// a file failed, or the transfer was cancelled, while this
+			// one was waiting for a worker.
+			if ctx.Err() != nil {
+				return nil
+			}
+			return c.downloadFile(t, sftpClient, remotePath, localPath)
+		})
+		return nil
+	})
+	if werr := eg.Wait(); werr != nil {
+		return werr
+	}
+	if err != nil {
+		return err
+	}
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+
+	if opts.preserve() {
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if err := opts.setLocal(dirs[i].path, dirs[i].info); err != nil {
+				return fmt.Errorf("failed to set local directory attributes: %w", err)
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,379 @@
+package goph_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func testConfig(port uint) *goph.Config {
+	return &goph.Config{
+		Addr:     "127.0.10.10",
+		Port:     port,
+		User:     "babbage88",
+		Auth:     goph.Password("123456"),
+		Callback: ssh.InsecureIgnoreHostKey(),
+	}
+}
+
+func TestClient(t *testing.T) {
+
+	t.Run("latencyTest", latencyTest)
+	t.Run("statsTest", statsTest)
+	t.Run("algorithmsTest", algorithmsTest)
+	t.Run("fipsProfileTest", fipsProfileTest)
+	t.Run("hardenedProfileTest", hardenedProfileTest)
+	t.Run("legacyProfileTest", legacyProfileTest)
+	t.Run("bannerPolicyTest", bannerPolicyTest)
+	t.Run("idleTimeoutTest", idleTimeoutTest)
+	t.Run("redactAuditTest", redactAuditTest)
+	t.Run("maxAuthTriesTest", maxAuthTriesTest)
+	t.Run("connectHooksTest", connectHooksTest)
+	t.Run("sentinelErrorsTest", sentinelErrorsTest)
+	t.Run("customDialerTest", customDialerTest)
+}
+
+func latencyTest(t *testing.T) {
+
+	newServer("2040")
+
+	client, err := goph.NewConn(testConfig(2040))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	d, err := client.Latency(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d <= 0 {
+		t.Errorf("expected a positive latency, got %s", d)
+	}
+}
+
+func statsTest(t *testing.T) {
+
+	newServer("2041")
+
+	client, err := goph.NewConn(testConfig(2041))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stats := client.Stats()
+	if stats.BytesIn == 0 || stats.BytesOut == 0 {
+		t.Errorf("expected handshake bytes to be counted, got %+v", stats)
+	}
+}
+
+func algorithmsTest(t *testing.T) {
+
+	newServer("2042")
+
+	config := testConfig(2042)
+	config.Ciphers = []string{"aes256-ctr"}
+	config.KeyExchanges = []string{"curve25519-sha256@libssh.org"}
+	config.MACs = []string{"hmac-sha2-256"}
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	newServer("2043")
+
+	// the watchers of the first connection may still run.
+	config = testConfig(2043)
+	config.Ciphers = []string{"not-a-cipher"}
+	if _, err = goph.NewConn(config); err == nil {
+		t.Error("it should return an error")
+	}
+}
+
+func fipsProfileTest(t *testing.T) {
+
+	// the test server host key is ssh-rsa, which the FIPS profile accepts via rsa-sha2.
+	newServer("2044")
+
+	client, err := goph.NewConn(testConfig(2044).UseFIPSProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+func hardenedProfileTest(t *testing.T) {
+
+	// the test server only has an rsa host key.
+	newServer("2045")
+
+	_, err := goph.NewConn(testConfig(2045).UseHardenedProfile())
+
+	var algErr *goph.AlgorithmError
+	if !errors.As(err, &algErr) {
+		t.Fatalf("expected an AlgorithmError, got %v", err)
+	}
+
+	if len(algErr.HostKeys) == 0 {
+		t.Errorf("expected the server host keys in the error: %s", err)
+	}
+}
+
+func legacyProfileTest(t *testing.T) {
+
+	newServer("2046")
+
+	config := testConfig(2046).UseLegacyProfile()
+
+	// force the legacy algorithms only.
+	config.KeyExchanges = []string{"diffie-hellman-group14-sha1"}
+	config.HostKeyAlgorithms = []string{"ssh-rsa"}
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if goph.LegacyProfile.Name != config.Profile() || testConfig(2046).Profile() != "" {
+		t.Error("the legacy profile should be scoped to its config")
+	}
+}
+
+func bannerPolicyTest(t *testing.T) {
+
+	newServer("2047")
+
+	policy, err := goph.RequireBanner(`(?i)authorized use only`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := testConfig(2047)
+	config.BannerPolicy = policy
+
+	_, err = goph.NewConn(config)
+
+	var bannerErr *goph.BannerError
+	if !errors.As(err, &bannerErr) {
+		t.Errorf("expected a BannerError for a server without banner, got %v", err)
+	}
+}
+
+func idleTimeoutTest(t *testing.T) {
+
+	newServer("2048")
+
+	idle := make(chan goph.ConnInfo, 1)
+	closed := make(chan goph.ConnInfo, 1)
+
+	config := testConfig(2048)
+	config.IdleTimeout = 100 * time.Millisecond
+	config.OnIdle = func(info goph.ConnInfo) bool {
+		idle <- info
+		return true
+	}
+	config.OnDisconnect = func(info goph.ConnInfo) {
+		closed <- info
+	}
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	select {
+	case <-idle:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle connection was not closed")
+	}
+
+	if info := <-closed; info.Err != nil {
+		t.Errorf("an idle close should not be reported as an error: %s", info.Err)
+	}
+}
+
+func redactAuditTest(t *testing.T) {
+
+	newServer("2049")
+
+	var record goph.AuditRecord
+
+	config := testConfig(2049)
+	config.Audit = func(r goph.AuditRecord) { record = r }
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err = client.Run("mysql --password=hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Command != "mysql --password=[REDACTED]" {
+		t.Errorf("the audit command was not redacted: %q", record.Command)
+	}
+}
+
+func maxAuthTriesTest(t *testing.T) {
+
+	newServer("2050")
+
+	var prompted int
+
+	config := testConfig(2050)
+	config.Auth = goph.Auth{
+		ssh.KeyboardInteractive(func(string, string, []string, []bool) ([]string, error) {
+			prompted++
+			return nil, errors.New("no answer")
+		}),
+		ssh.Password("123456"),
+	}
+	config.AuthOrder = []string{"password"}
+	config.MaxAuthTries = 1
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if prompted != 0 {
+		t.Error("the password should be tried first")
+	}
+}
+
+func connectHooksTest(t *testing.T) {
+
+	newServer("2051")
+
+	var calls []string
+
+	config := testConfig(2051)
+	config.PreConnect = func(ctx context.Context, c *goph.Config) error {
+		calls = append(calls, "pre")
+		return nil
+	}
+	config.PostConnect = func(ctx context.Context, c *goph.Config) error {
+		calls = append(calls, "post")
+		return nil
+	}
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if len(calls) != 2 || calls[0] != "pre" || calls[1] != "post" {
+		t.Errorf("unexpected hook calls: %v", calls)
+	}
+
+	errKnock := errors.New("knock failed")
+	config.PreConnect = func(ctx context.Context, c *goph.Config) error {
+		return errKnock
+	}
+
+	if _, err = goph.NewConn(config); !errors.Is(err, errKnock) {
+		t.Errorf("expected the pre-connect error, got %v", err)
+	}
+}
+
+func sentinelErrorsTest(t *testing.T) {
+
+	newServer("2052")
+
+	config := testConfig(2052)
+	config.Auth = goph.Password("wrong")
+
+	_, err := goph.NewConn(config)
+	if !errors.Is(err, goph.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
+	}
+
+	var opErr *goph.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "connect" || opErr.Host != "127.0.10.10:2052" {
+		t.Errorf("expected the connect context in the error, got %v", err)
+	}
+
+	newServer("2053")
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("127.0.10.10:2053")}, key)
+	if err = os.WriteFile(file, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config = testConfig(2053)
+	if config.Callback, err = goph.KnownHosts(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = goph.NewConn(config); !errors.Is(err, goph.ErrHostKeyMismatch) {
+		t.Errorf("expected ErrHostKeyMismatch, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	if _, err = goph.NewConnContext(ctx, testConfig(2054)); !errors.Is(err, goph.ErrConnectTimeout) {
+		t.Errorf("expected ErrConnectTimeout, got %v", err)
+	}
+}
+
+// countingDialer counts the connections it opens.
+type countingDialer struct {
+	net.Dialer
+	dials int
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.dials++
+	return d.Dialer.DialContext(ctx, network, addr)
+}
+
+func customDialerTest(t *testing.T) {
+
+	newServer("2055")
+
+	dialer := &countingDialer{}
+
+	config := testConfig(2055)
+	config.Dialer = dialer
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if dialer.dials != 1 {
+		t.Errorf("expected the config dialer to be used, got %d dials", dialer.dials)
+	}
+}
@@ -4,11 +4,13 @@
 package goph
 
 import (
+	"bytes"
 	"context"
-	"fmt"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
+	"log/slog"
 	"strings"
+	"time"
 )
 
 // Cmd it's like os/exec.Cmd but for ssh session.
@@ -17,70 +19,255 @@ type Cmd struct {
 	// Path to command executable filename
 	Path string
 
-	// Command args.
+	// Command args, each quoted as a single shell word, so spaces and
+	// shell characters are passed as is. Path is passed to the shell
+	// unquoted, for pipelines, see Quote.
 	Args []string
 
+	// NoShell quotes Path too and runs it with exec, so the remote shell
+	// interprets nothing and is replaced by the program, like os/exec.
+	NoShell bool
+
 	// Session env vars.
 	Env []string
 
-	// SSH session.
+	// Dir, if set, is the remote working directory of the command.
+	Dir string
+
+	// SSH session, its Stdin, Stdout and Stderr are those of the command,
+	// like os/exec.
 	*ssh.Session
 
 	// Context for cancellation
 	Context context.Context
+
+	// Recorder, if set, records the session output and input.
+	Recorder *SessionRecorder
+
+	// Timeout, if set, kills the command once it ran for the duration, so a
+	// hung remote process cannot hold its session forever.
+	Timeout time.Duration
+
+	// IdleTimeout, if set, kills the command once it wrote nothing to
+	// stdout or stderr for the duration.
+	IdleTimeout time.Duration
+
+	// activity tracks the output for IdleTimeout, expired receives the
+	// deadline error and stopDeadline stops watching the deadlines.
+	activity     *activity
+	expired      chan error
+	stopDeadline func()
+
+	// stopContext stops watching the Context of a started command.
+	stopContext func() bool
+
+	// started and span time and trace the command, from begin to finish.
+	started time.Time
+	span    Span
+
+	// config of the client that created the command, used for logging.
+	config *Config
+
+	// shell is the remote shell String quotes the command line for, the
+	// POSIX one when empty.
+	shell string
+
+	// done, if set, releases the session for Shutdown.
+	done func()
 }
 
 // CombinedOutput runs cmd on the remote host and returns its combined stdout and stderr.
-func (c *Cmd) CombinedOutput() ([]byte, error) {
+func (c *Cmd) CombinedOutput() (_ []byte, err error) {
+	defer func() { err = c.opError(err) }()
+
 	if err := c.init(); err != nil {
 		return nil, errors.Wrap(err, "cmd init")
 	}
 
 	return c.runWithContext(func() ([]byte, error) {
-		return c.Session.CombinedOutput(c.String())
+		if c.Recorder == nil && c.activity == nil {
+			return c.Session.CombinedOutput(c.String())
+		}
+
+		// stdout and stderr are written concurrently.
+		var b bytes.Buffer
+		c.Session.Stdout = c.track(&lockedWriter{w: &b})
+		if c.Recorder != nil {
+			c.Session.Stdout = c.Recorder.Writer(c.Session.Stdout)
+		}
+		c.Session.Stderr = c.Session.Stdout
+		err := c.Session.Run(c.String())
+		return b.Bytes(), err
 	})
 }
 
 // Output runs cmd on the remote host and returns its stdout.
-func (c *Cmd) Output() ([]byte, error) {
+func (c *Cmd) Output() (_ []byte, err error) {
+	defer func() { err = c.opError(err) }()
+
 	if err := c.init(); err != nil {
 		return nil, errors.Wrap(err, "cmd init")
 	}
 
 	return c.runWithContext(func() ([]byte, error) {
-		return c.Session.Output(c.String())
+		if c.Recorder == nil && c.activity == nil {
+			return c.Session.Output(c.String())
+		}
+
+		var b bytes.Buffer
+		c.Session.Stdout = c.track(&b)
+		if c.Recorder != nil {
+			c.Session.Stdout = c.Recorder.Writer(c.Session.Stdout)
+		}
+		err := c.Session.Run(c.String())
+		return b.Bytes(), err
 	})
 }
 
 // Run runs cmd on the remote host.
-func (c *Cmd) Run() error {
+func (c *Cmd) Run() (err error) {
+	defer func() { err = c.opError(err) }()
+
 	if err := c.init(); err != nil {
 		return errors.Wrap(err, "cmd init")
 	}
 
-	_, err := c.runWithContext(func() ([]byte, error) {
+	_, err = c.runWithContext(func() ([]byte, error) {
 		return nil, c.Session.Run(c.String())
 	})
 
 	return err
 }
 
-// Start runs the command on the remote host.
-func (c *Cmd) Start() error {
+// Start runs the command on the remote host. Once Context is done, the
+// command is sent SIGINT and its session closed, and Wait returns the
+// context error.
+func (c *Cmd) Start() (err error) {
+	defer func() { err = c.opError(err) }()
+
 	if err := c.init(); err != nil {
 		return errors.Wrap(err, "cmd init")
 	}
-	return c.Session.Start(c.String())
+
+	c.begin()
+	if err = c.Session.Start(c.String()); err != nil {
+		c.finish(err)
+		return err
+	}
+
+	c.stopDeadline = c.watchDeadline()
+
+	if c.Context != nil {
+		c.stopContext = context.AfterFunc(c.Context, func() {
+			_ = c.Session.Signal(ssh.SIGINT)
+			_ = c.Session.Close()
+		})
+	}
+
+	return nil
+}
+
+// Wait waits for the command started with Start to exit.
+func (c *Cmd) Wait() (err error) {
+	defer func() { err = c.opError(err) }()
+	defer c.release()
+
+	err = c.Session.Wait()
+	if c.stopDeadline != nil {
+		c.stopDeadline()
+		err = c.deadlineError(err)
+	}
+	if c.stopContext != nil && !c.stopContext() {
+		err = c.Context.Err()
+	}
+
+	c.finish(err)
+
+	return err
+}
+
+// release releases the session for Shutdown.
+func (c *Cmd) release() {
+	if c.done != nil {
+		c.done()
+	}
+}
+
+// Close closes the command session.
+func (c *Cmd) Close() error {
+
+	err := c.Session.Close()
+	c.release()
+	c.config.onSessionEnd(c.String())
+
+	if c.config != nil && c.config.Debug {
+		c.config.logger().Debug("session channel closed", c.config.logAttrs("command", c.String())...)
+	}
+
+	return err
+}
+
+// opError returns err with the command context.
+func (c *Cmd) opError(err error) error {
+	return c.config.opError(OpError{Op: "run", Command: c.String(), Err: err})
 }
 
-// String return the command line string.
+// String return the command line string, with the quoted Args, run from
+// Dir when set. The commands of Client.Command are quoted for the shell
+// of Client.RemoteShell.
 func (c *Cmd) String() string {
-	return fmt.Sprintf("%s %s", c.Path, strings.Join(c.Args, " "))
+
+	cmd := c.Path
+	if c.NoShell {
+		switch c.shell {
+		case ShellCmd:
+			cmd = cmdQuote(c.Path)
+		case ShellPowerShell:
+			cmd = "& " + powerShellQuote(c.Path)
+		default:
+			cmd = "exec " + shellQuote(c.Path)
+		}
+	}
+
+	if len(c.Args) > 0 {
+		cmd += " " + QuoteShell(c.shell, c.Args...)
+	}
+
+	if c.Dir != "" {
+		switch c.shell {
+		case ShellCmd:
+			cmd = "cd /d " + cmdQuote(c.Dir) + " && " + cmd
+		case ShellPowerShell:
+			cmd = "Set-Location -LiteralPath " + powerShellQuote(c.Dir) + " -ErrorAction Stop; " + cmd
+		default:
+			cmd = "cd " + shellQuote(c.Dir) + " && " + cmd
+		}
+	}
+
+	return cmd
 }
 
-// Init inits and sets session env vars.
+// Init inits and sets session env vars, and wires the recorder.
 func (c *Cmd) init() (err error) {
 
+	if c.IdleTimeout > 0 {
+		c.activity = newActivity(c.IdleTimeout)
+		c.Session.Stdout = c.track(c.Session.Stdout)
+		c.Session.Stderr = c.track(c.Session.Stderr)
+	}
+
+	if c.Recorder != nil {
+		if c.Session.Stdout != nil {
+			c.Session.Stdout = c.Recorder.Writer(c.Session.Stdout)
+		}
+		if c.Session.Stderr != nil {
+			c.Session.Stderr = c.Recorder.Writer(c.Session.Stderr)
+		}
+		if c.Session.Stdin != nil {
+			c.Session.Stdin = c.Recorder.Reader(c.Session.Stdin)
+		}
+	}
+
 	// Set session env vars
 	var env []string
 	for _, value := range c.Env {
@@ -93,15 +280,61 @@ func (c *Cmd) init() (err error) {
 	return nil
 }
 
+// begin logs the start of the command and starts its span.
+func (c *Cmd) begin() {
+
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	c.started = time.Now()
+	c.config.logger().Debug("command started", c.config.logAttrs("command", c.String())...)
+	_, c.span = c.config.startSpan(ctx, "goph.run", slog.String("goph.command_hash", commandHash(c.String())))
+}
+
+// finish ends the span of the command started by begin, and measures,
+// audits and logs its outcome.
+func (c *Cmd) finish(err error) {
+
+	if c.span == nil {
+		return
+	}
+
+	elapsed := time.Since(c.started)
+
+	c.span.End(err)
+	c.span = nil
+	c.config.metrics().CommandDuration(c.config.hostPort(), elapsed, err)
+	c.config.audit(AuditRecord{Time: c.started, Operation: "run", Command: c.String(), Err: err, Duration: elapsed})
+
+	log := c.config.logger()
+	if err != nil {
+		log.Error("command failed", c.config.logAttrs("command", c.String(), "error", err, "duration", elapsed)...)
+		return
+	}
+	log.Debug("command finished", c.config.logAttrs("command", c.String(), "duration", elapsed)...)
+}
+
 // Command with context output.
 type ctxCmdOutput struct {
 	output []byte
 	err    error
 }
 
-// Executes the given callback within session. Sends SIGINT when the context is canceled.
-func (c *Cmd) runWithContext(callback func() ([]byte, error)) ([]byte, error) {
-	outputChan := make(chan ctxCmdOutput)
+// Executes the given callback within session. Sends SIGINT and closes the session when the context is canceled.
+func (c *Cmd) runWithContext(callback func() ([]byte, error)) (output []byte, err error) {
+	c.begin()
+	defer func() {
+		c.release()
+		c.span.SetAttributes(slog.Int("goph.output_bytes", len(output)))
+		c.finish(err)
+	}()
+
+	stop := c.watchDeadline()
+	defer stop()
+
+	outputChan := make(chan ctxCmdOutput, 1)
 	go func() {
 		output, err := callback()
 		outputChan <- ctxCmdOutput{
@@ -113,9 +346,12 @@ func (c *Cmd) runWithContext(callback func() ([]byte, error)) ([]byte, error) {
 	select {
 	case <-c.Context.Done():
 		_ = c.Session.Signal(ssh.SIGINT)
+		_ = c.Session.Close()
 
 		return nil, c.Context.Err()
+	case err := <-c.expired:
+		return nil, err
 	case result := <-outputChan:
-		return result.output, result.err
+		return result.output, c.deadlineError(result.err)
 	}
 }
@@ -0,0 +1,94 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+// Command goph runs commands, copies files, forwards ports and opens shells
+// over ssh with the goph library.
+//
+//	goph run web1,web2,web3 uptime
+//	goph run -json -c 50 @hosts.txt 'systemctl is-active app'
+//	goph upload web1 ./app.conf /etc/app/app.conf
+//	goph download web1 /var/log/app.log ./app.log
+//	goph tunnel -L 5432:localhost:5432 db1
+//	goph shell web1
+//	goph repl web1
+//
+// Hosts are [user@]host[:port], settings are read from ~/.ssh/config.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `usage: goph <command> [flags] <args>
+
+commands:
+  run       run a command on one or more hosts
+  upload    upload a file or directory
+  download  download a file or directory
+  tunnel    forward a local port through a host
+  shell     open an interactive shell
+  repl      open an interactive session mixing remote and local commands
+
+Run "goph <command> -h" for the command flags.
+`
+
+// exitError is returned by commands to exit with a specific code.
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func main() {
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var (
+		err  error
+		args = os.Args[2:]
+	)
+
+	switch os.Args[1] {
+	case "run":
+		err = runCmd(ctx, args)
+	case "upload":
+		err = transferCmd(ctx, "upload", args)
+	case "download":
+		err = transferCmd(ctx, "download", args)
+	case "tunnel":
+		err = tunnelCmd(ctx, args)
+	case "shell":
+		err = shellCmd(ctx, args)
+	case "repl":
+		err = replCmd(ctx, args)
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "goph: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	var exitErr exitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		os.Exit(exitErr.code)
+	default:
+		fmt.Fprintln(os.Stderr, "goph:", err)
+		os.Exit(1)
+	}
+}
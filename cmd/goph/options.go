@@ -0,0 +1,281 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// options are the connection flags shared by every command.
+type options struct {
+	user     string
+	port     uint
+	identity string
+	password bool
+	insecure bool
+	config   string
+	timeout  time.Duration
+	json     bool
+
+	// auth is built once and shared by every host.
+	auth goph.Auth
+}
+
+func newFlagSet(name, args string, o *options) *flag.FlagSet {
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: goph %s [flags] %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+
+	home, _ := os.UserHomeDir()
+
+	fs.StringVar(&o.user, "l", "", "login user, defaults to ssh_config or the current user.")
+	fs.UintVar(&o.port, "P", 0, "port, defaults to ssh_config or 22.")
+	fs.StringVar(&o.identity, "i", "", "private key file.")
+	fs.BoolVar(&o.password, "password", false, "ask for a password instead of using keys.")
+	fs.BoolVar(&o.insecure, "insecure", false, "do not verify host keys.")
+	fs.StringVar(&o.config, "F", filepath.Join(home, ".ssh", "config"), "ssh_config file.")
+	fs.DurationVar(&o.timeout, "timeout", 0, "connect timeout, defaults to ssh_config or 20s.")
+	fs.BoolVar(&o.json, "json", false, "print results as JSON.")
+
+	return fs
+}
+
+// configs returns the client configs of the comma separated targets, a
+// "@file" target reads one host per line from file.
+func (o *options) configs(targets string) ([]*goph.Config, error) {
+
+	var hosts []string
+	for _, t := range strings.Split(targets, ",") {
+
+		t = strings.TrimSpace(t)
+		if !strings.HasPrefix(t, "@") {
+			if t != "" {
+				hosts = append(hosts, t)
+			}
+			continue
+		}
+
+		lines, err := readLines(t[1:])
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, lines...)
+	}
+
+	if len(hosts) == 0 {
+		return nil, errors.New("no host given")
+	}
+
+	sshConfig, err := goph.LoadSSHConfig(o.config)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]*goph.Config, 0, len(hosts))
+	for _, h := range hosts {
+		config, err := o.hostConfig(h, sshConfig)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// hostConfig returns the client config of a single [user@]host[:port] target.
+func (o *options) hostConfig(target string, sshConfig *goph.SSHConfig) (*goph.Config, error) {
+
+	user, host := "", target
+	if i := strings.LastIndex(target, "@"); i >= 0 {
+		user, host = target[:i], target[i+1:]
+	}
+
+	var port uint
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in %q", target)
+		}
+		host, port = h, uint(n)
+	}
+
+	// ssh_config sets the address, port, timeout, known hosts and jump
+	// hosts, the target and the flags win.
+	config, err := sshConfig.Config(host)
+	if err != nil {
+		return nil, err
+	}
+
+	config.User = first(user, o.user, config.User)
+	if port == 0 {
+		port = o.port
+	}
+	if port != 0 {
+		config.Port = port
+	}
+	if o.timeout != 0 {
+		config.Timeout = o.timeout
+	}
+
+	auth, err := o.authFor(sshConfig.Get(host, "identityfile"))
+	if err != nil {
+		return nil, err
+	}
+	config.Auth = auth
+
+	if o.insecure {
+		for c := config; c != nil; c = c.Proxy {
+			c.Callback = ssh.InsecureIgnoreHostKey()
+		}
+	}
+
+	return config, nil
+}
+
+// authFor returns the auth methods, identity is the ssh_config IdentityFile.
+func (o *options) authFor(identity string) (goph.Auth, error) {
+
+	if o.auth != nil {
+		return o.auth, nil
+	}
+
+	if o.password {
+		pass, err := prompt("Password: ")
+		if err != nil {
+			return nil, err
+		}
+		o.auth = goph.Password(pass)
+		return o.auth, nil
+	}
+
+	var auths []goph.Auth
+
+	if goph.HasAgent() {
+		if a, err := goph.UseAgent(); err == nil {
+			auths = append(auths, a)
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	files := []string{o.identity}
+	if o.identity == "" {
+		files = []string{
+			expandHome(identity),
+			filepath.Join(home, ".ssh", "id_ed25519"),
+			filepath.Join(home, ".ssh", "id_ecdsa"),
+			filepath.Join(home, ".ssh", "id_rsa"),
+		}
+	}
+
+	for _, file := range files {
+
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			if o.identity != "" {
+				return nil, err
+			}
+			continue
+		}
+
+		a, err := goph.Key(file, "")
+
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			var passphrase string
+			if passphrase, err = prompt(fmt.Sprintf("Passphrase for %s: ", file)); err == nil {
+				a, err = goph.Key(file, passphrase)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		auths = append(auths, a)
+	}
+
+	if len(auths) == 0 {
+		return nil, errors.New("no ssh agent or private key found, use -i or -password")
+	}
+
+	// the ssh client tries a method name once, offer every key in one.
+	o.auth = goph.Fallback(auths...)
+	return o.auth, nil
+}
+
+// prompt reads a secret from the terminal.
+func prompt(msg string) (string, error) {
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("can not prompt %q, stdin is not a terminal", strings.TrimSpace(msg))
+	}
+
+	fmt.Fprint(os.Stderr, msg)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	return string(secret), err
+}
+
+func readLines(file string) ([]string, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// first returns the first non empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
+
+func hostPort(c *goph.Config) string {
+	return net.JoinHostPort(c.Addr, strconv.FormatUint(uint64(c.Port), 10))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestHostConfig(t *testing.T) {
+
+	t.Setenv("HOME", t.TempDir())
+
+	sshConfig, err := goph.ParseSSHConfig(strings.NewReader(`
+Host bastion
+  HostName 10.0.0.1
+
+Host target
+  HostName 10.0.0.2
+  Port 2222
+  User bob
+  ProxyJump bastion
+  ConnectTimeout 5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &options{auth: goph.Password("secret")}
+
+	config, err := o.hostConfig("target", sshConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.User != "bob" || config.Addr != "10.0.0.2" || config.Port != 2222 || config.Timeout != 5*time.Second {
+		t.Errorf("unexpected config %s@%s:%d, timeout %s", config.User, config.Addr, config.Port, config.Timeout)
+	}
+	if config.Proxy == nil || config.Proxy.Addr != "10.0.0.1" {
+		t.Error("expected the bastion as jump host")
+	}
+
+	// the target and the flags win over ssh_config.
+	o.timeout = time.Second
+	if config, err = o.hostConfig("alice@target:22", sshConfig); err != nil {
+		t.Fatal(err)
+	}
+	if config.User != "alice" || config.Port != 22 || config.Timeout != time.Second {
+		t.Errorf("unexpected config %s@%s:%d, timeout %s", config.User, config.Addr, config.Port, config.Timeout)
+	}
+}
+
+func TestAuthForAgentAndIdentity(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// the agent offers a key the server refuses.
+	_, agentKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: agentKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := filepath.Join(dir, "id_test")
+	if err := os.WriteFile(identity, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := gophtest.NewServer()
+	srv.AddKey("alice", signer.PublicKey())
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	o := &options{identity: identity}
+	auth, err := o.authFor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the identity file is offered after the agent keys.
+	config := srv.Config("alice", "")
+	config.Auth = auth
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
@@ -0,0 +1,491 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+const replHelp = `remote:
+  <command>              run command in the remote shell, kept for the session
+  cd [dir]               change the remote directory
+  pwd                    print the remote directory
+  get remote [local]     download a file or directory (alias lget)
+  put local [remote]     upload a file or directory (alias lput)
+local:
+  !<command>             run command locally
+  lcd [dir]              change the local directory
+  lpwd                   print the local directory
+  help, exit
+`
+
+// repl is an interactive session on a single connection.
+type repl struct {
+	ctx    context.Context
+	client *goph.Client
+	ftp    *sftp.Client
+
+	// out is written by the remote shell stderr too, concurrently.
+	out *lockedWriter
+
+	// cwd is the remote working directory.
+	cwd string
+
+	// shell runs the remote commands, started on the first one.
+	shell *remoteShell
+}
+
+// lockedWriter serializes the writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+func replCmd(ctx context.Context, args []string) error {
+
+	var o options
+
+	fs := newFlagSet("repl", "host", &o)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError{2}
+	}
+
+	configs, err := o.configs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	client, err := goph.NewConnContext(ctx, configs[0])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	r := &repl{ctx: ctx, client: client, ftp: ftp, out: &lockedWriter{w: os.Stdout}}
+	if r.cwd, err = ftp.Getwd(); err != nil {
+		return err
+	}
+	defer r.closeShell()
+
+	prompt := func() string {
+		return fmt.Sprintf("%s@%s:%s> ", configs[0].User, configs[0].Addr, r.cwd)
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if r.exec(scanner.Text()) {
+				return nil
+			}
+		}
+		return scanner.Err()
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt())
+	t.AutoCompleteCallback = r.complete
+
+	if width, height, err := term.GetSize(fd); err == nil {
+		t.SetSize(width, height)
+	}
+
+	r.out.mu.Lock()
+	r.out.w = t
+	r.out.mu.Unlock()
+
+	for {
+		t.SetPrompt(prompt())
+
+		line, err := t.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if r.exec(line) {
+			return nil
+		}
+	}
+}
+
+// exec runs a single line, it returns true to exit.
+func (r *repl) exec(line string) bool {
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		r.report(r.local(line[1:]))
+		return false
+	}
+
+	fields := strings.Fields(line)
+	args := fields[1:]
+
+	switch fields[0] {
+	case "exit", "quit":
+		return true
+	case "help", "?":
+		fmt.Fprint(r.out, replHelp)
+	case "cd":
+		r.report(r.cd(args))
+	case "pwd":
+		fmt.Fprintln(r.out, r.cwd)
+	case "get", "lget":
+		r.report(r.get(args))
+	case "put", "lput":
+		r.report(r.put(args))
+	case "lcd":
+		dir, _ := os.UserHomeDir()
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		r.report(os.Chdir(expandHome(dir)))
+	case "lpwd":
+		dir, err := os.Getwd()
+		r.report(err)
+		fmt.Fprintln(r.out, dir)
+	default:
+		r.report(r.remote(line))
+	}
+
+	return false
+}
+
+func (r *repl) report(err error) {
+	if err != nil {
+		fmt.Fprintln(r.out, "error:", err)
+	}
+}
+
+// remote runs cmd in the remote shell, started in the remote working
+// directory on first use, or again once it exited.
+func (r *repl) remote(cmd string) error {
+
+	if r.shell == nil {
+
+		shell, err := startShell(r.client, r.out)
+		if err != nil {
+			return err
+		}
+		r.shell = shell
+
+		if err = r.shellRun("cd " + goph.Quote(r.cwd)); err != nil {
+			return err
+		}
+	}
+
+	return r.shellRun(cmd)
+}
+
+// shellRun runs cmd in the started remote shell.
+func (r *repl) shellRun(cmd string) error {
+
+	status, err := r.shell.run(cmd, r.out)
+	if err != nil {
+		r.closeShell()
+		return fmt.Errorf("remote shell: %w", err)
+	}
+	if status != 0 {
+		return fmt.Errorf("exit status %d", status)
+	}
+
+	return nil
+}
+
+func (r *repl) closeShell() {
+	if r.shell != nil {
+		r.shell.close()
+		r.shell = nil
+	}
+}
+
+// remoteShell is a remote sh reading the commands from its stdin, so the
+// directory, variables and functions set by a command are kept for the
+// next ones. The end of every command is marked on its stdout with its
+// exit status.
+type remoteShell struct {
+	sess   *ssh.Session
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	marker string
+}
+
+func startShell(client *goph.Client, stderr io.Writer) (*remoteShell, error) {
+
+	sess, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, err := sess.StdinPipe()
+	if err != nil {
+		sess.Close()
+		return nil, err
+	}
+
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		sess.Close()
+		return nil, err
+	}
+
+	sess.Stderr = stderr
+
+	if err = sess.Start("sh"); err != nil {
+		sess.Close()
+		return nil, err
+	}
+
+	marker := make([]byte, 8)
+	rand.Read(marker)
+
+	return &remoteShell{
+		sess:   sess,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		marker: "goph-repl-" + hex.EncodeToString(marker),
+	}, nil
+}
+
+// run runs cmd, with its stdin closed so it cannot read the next commands,
+// copies its stdout to out and returns its exit status.
+func (s *remoteShell) run(cmd string, out io.Writer) (int, error) {
+
+	if _, err := fmt.Fprintf(s.stdin, "{ %s\n} </dev/null\necho %s $?\n", cmd, s.marker); err != nil {
+		return 0, err
+	}
+
+	for {
+		line, err := s.stdout.ReadString('\n')
+
+		// the last line of the command output may not end with a newline.
+		if i := strings.Index(line, s.marker); i >= 0 {
+			if i > 0 {
+				fmt.Fprintln(out, line[:i])
+			}
+			return strconv.Atoi(strings.TrimSpace(line[i+len(s.marker):]))
+		}
+
+		io.WriteString(out, line)
+
+		if err == io.EOF {
+			return 0, errors.New("exited")
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *remoteShell) close() {
+	s.stdin.Close()
+	s.sess.Close()
+}
+
+// local runs cmd with the local shell.
+func (r *repl) local(cmd string) error {
+
+	c := exec.CommandContext(r.ctx, "sh", "-c", cmd)
+	c.Stdout, c.Stderr = r.out, r.out
+
+	return c.Run()
+}
+
+func (r *repl) cd(args []string) error {
+
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	} else if home, err := r.ftp.Getwd(); err == nil {
+		dir = home
+	}
+
+	dir = r.remotePath(dir)
+
+	info, err := r.ftp.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", dir)
+	}
+
+	r.cwd = dir
+
+	if r.shell != nil {
+		return r.shellRun("cd " + goph.Quote(dir))
+	}
+
+	return nil
+}
+
+func (r *repl) get(args []string) error {
+
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: get remote [local]")
+	}
+
+	local := path.Base(args[0])
+	if len(args) == 2 {
+		local = args[1]
+	}
+
+	return r.client.Download(r.remotePath(args[0]), local)
+}
+
+func (r *repl) put(args []string) error {
+
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: put local [remote]")
+	}
+
+	remote := filepath.Base(args[0])
+	if len(args) == 2 {
+		remote = args[1]
+	}
+
+	return r.client.Upload(args[0], r.remotePath(remote))
+}
+
+// remotePath resolves p against the remote working directory.
+func (r *repl) remotePath(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(r.cwd, p)
+}
+
+// complete completes the word before the cursor with remote paths, or
+// local paths for the arguments of local commands.
+func (r *repl) complete(line string, pos int, key rune) (string, int, bool) {
+
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	head := line[:pos]
+	start := strings.LastIndexAny(head, " \t") + 1
+	word := head[start:]
+
+	fields := strings.Fields(head)
+	local := len(fields) > 0 && start > 0 && (fields[0] == "lcd" || strings.HasPrefix(fields[0], "!") ||
+		((fields[0] == "put" || fields[0] == "lput") && len(strings.Fields(head[:start])) == 1))
+
+	var names []string
+	if local {
+		names = localMatches(word)
+	} else {
+		names = r.remoteMatches(word)
+	}
+
+	if len(names) == 0 {
+		return "", 0, false
+	}
+
+	completed := commonPrefix(names)
+	if len(names) > 1 && completed == word {
+		fmt.Fprintln(r.out, strings.Join(names, "  "))
+		return "", 0, false
+	}
+
+	return head[:start] + completed + line[pos:], start + len(completed), true
+}
+
+// remoteMatches returns the remote paths starting with word.
+func (r *repl) remoteMatches(word string) []string {
+
+	dir, prefix := path.Split(word)
+
+	entries, err := r.ftp.ReadDir(r.remotePath(first(dir, ".")))
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), prefix) {
+			name := dir + e.Name()
+			if e.IsDir() {
+				name += "/"
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// localMatches returns the local paths starting with word.
+func localMatches(word string) []string {
+
+	matches, _ := filepath.Glob(word + "*")
+	for i, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.IsDir() {
+			matches[i] += string(filepath.Separator)
+		}
+	}
+
+	return matches
+}
+
+func commonPrefix(names []string) string {
+
+	prefix := names[0]
+	for _, n := range names[1:] {
+		for !strings.HasPrefix(n, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestREPL(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+
+	var shells atomic.Int32
+	srv.HandleFunc("sh", func(e *gophtest.Exec) int {
+		shells.Add(1)
+		fakeShell(e)
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	local := filepath.Join(t.TempDir(), "app.conf")
+	if err = os.WriteFile(local, []byte("port=80"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	r := &repl{ctx: context.Background(), client: client, ftp: ftp, out: &lockedWriter{w: &out}, cwd: "/"}
+	defer r.closeShell()
+
+	ftp.Mkdir("/srv")
+
+	for _, line := range []string{"cd srv", "put " + local, "export NAME=web-1", "hostname", "printf $NAME"} {
+		if r.exec(line) {
+			t.Fatalf("%q should not exit", line)
+		}
+	}
+
+	if r.cwd != "/srv" || strings.Contains(out.String(), "error") {
+		t.Errorf("unexpected session: cwd %s, output %q", r.cwd, out.String())
+	}
+	if !strings.Contains(out.String(), "host in /srv\nweb-1\n") {
+		t.Errorf("the shell should keep its directory and variables, got %q", out.String())
+	}
+	if n := shells.Load(); n != 1 {
+		t.Errorf("expected a single remote shell, got %d", n)
+	}
+
+	out.Reset()
+	r.exec("false")
+	if !strings.Contains(out.String(), "error: exit status 1") {
+		t.Errorf("expected the exit status reported, got %q", out.String())
+	}
+
+	line, pos, ok := r.complete("get app", 7, '\t')
+	if !ok || line != "get app.conf" || pos != len(line) {
+		t.Errorf("unexpected completion %q %d %t", line, pos, ok)
+	}
+
+	if !r.exec("exit") {
+		t.Error("exit should exit")
+	}
+}
+
+// fakeShell runs the few commands of TestREPL read from stdin, keeping
+// its directory and variables between them like sh.
+func fakeShell(e *gophtest.Exec) {
+
+	var (
+		cwd    = "/"
+		env    = map[string]string{}
+		status int
+	)
+
+	scanner := bufio.NewScanner(e.Stdin)
+	for scanner.Scan() {
+
+		line := strings.TrimPrefix(scanner.Text(), "{ ")
+		fields := strings.Fields(line)
+		if len(fields) == 0 || line == "} </dev/null" {
+			continue
+		}
+
+		if fields[0] != "echo" {
+			status = 0
+		}
+
+		switch fields[0] {
+		case "cd":
+			cwd = strings.Trim(fields[1], "'")
+		case "export":
+			k, v, _ := strings.Cut(fields[1], "=")
+			env[k] = v
+		case "hostname":
+			fmt.Fprintln(e.Stdout, "host in", cwd)
+		case "printf":
+			fmt.Fprint(e.Stdout, env[strings.TrimPrefix(fields[1], "$")])
+		case "false":
+			status = 1
+		case "echo":
+			// the end of command marker.
+			fmt.Fprintln(e.Stdout, fields[1], status)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+// hostResult is the JSON output of a host.
+type hostResult struct {
+	Host       string `json:"host"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ExitStatus int    `json:"exit_status"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+func runCmd(ctx context.Context, args []string) error {
+
+	var (
+		o           options
+		concurrency int
+	)
+
+	fs := newFlagSet("run", "host[,host...|@file] command...", &o)
+	fs.IntVar(&concurrency, "c", goph.DefaultGroupConcurrency, "number of hosts to run on at once.")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return exitError{2}
+	}
+
+	configs, err := o.configs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	group := goph.NewGroup("cli", configs...)
+	group.Concurrency = concurrency
+
+	var (
+		cmd    = strings.Join(fs.Args()[1:], " ")
+		enc    = json.NewEncoder(os.Stdout)
+		status int
+	)
+
+	for r := range group.Stream(ctx, cmd) {
+
+		code := exitStatus(r.Err)
+		if code > status {
+			status = code
+		}
+
+		if o.json {
+			res := hostResult{
+				Host:       hostPort(r.Config),
+				Output:     string(r.Output),
+				ExitStatus: code,
+				DurationMs: r.Duration.Milliseconds(),
+			}
+			if r.Err != nil {
+				res.Error = r.Err.Error()
+			}
+			enc.Encode(res)
+			continue
+		}
+
+		printOutput(r, len(configs) > 1)
+	}
+
+	if status != 0 {
+		return exitError{status}
+	}
+
+	return nil
+}
+
+// printOutput prints the output of a host, prefixed by the host name when
+// running on many hosts.
+func printOutput(r goph.HostResult, prefix bool) {
+
+	if !prefix {
+		os.Stdout.Write(r.Output)
+		if r.Err != nil && !isExit(r.Err) {
+			fmt.Fprintln(os.Stderr, "goph:", r.Err)
+		}
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(r.Output))
+	for scanner.Scan() {
+		fmt.Printf("%s: %s\n", hostPort(r.Config), scanner.Text())
+	}
+
+	if r.Err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", hostPort(r.Config), r.Err)
+	}
+}
+
+// exitStatus returns the exit code matching err, the remote exit status for
+// remote command failures and 1 for other errors.
+func exitStatus(err error) int {
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus()
+	}
+
+	return 1
+}
+
+func isExit(err error) bool {
+	var exitErr *ssh.ExitError
+	return errors.As(err, &exitErr)
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/term"
+)
+
+func shellCmd(ctx context.Context, args []string) error {
+
+	var o options
+
+	fs := newFlagSet("shell", "host", &o)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError{2}
+	}
+
+	configs, err := o.configs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	client, err := goph.NewConnContext(ctx, configs[0])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	opts := goph.ShellOptions{
+		Term:   os.Getenv("TERM"),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+
+		if width, height, err := term.GetSize(fd); err == nil {
+			opts.Rows, opts.Cols = height, width
+		}
+	}
+
+	if err = client.Shell(ctx, opts); err != nil {
+		if status := exitStatus(err); isExit(err) {
+			return exitError{status}
+		}
+		return err
+	}
+
+	return nil
+}
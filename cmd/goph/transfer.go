@@ -0,0 +1,95 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+)
+
+// transferResult is the JSON output of a transfer.
+type transferResult struct {
+	Host       string `json:"host"`
+	Operation  string `json:"operation"`
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+func transferCmd(ctx context.Context, op string, args []string) error {
+
+	var o options
+
+	fs := newFlagSet(op, "host source target", &o)
+	fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return exitError{2}
+	}
+
+	configs, err := o.configs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	config := configs[0]
+	res := transferResult{
+		Host:      hostPort(config),
+		Operation: op,
+		Source:    fs.Arg(1),
+		Target:    fs.Arg(2),
+	}
+
+	config.OnFileComplete = func(e goph.FileEvent) {
+		res.Files++
+		res.Bytes += e.Bytes
+	}
+
+	start := time.Now()
+	err = transfer(ctx, config, op, res.Source, res.Target)
+	res.DurationMs = time.Since(start).Milliseconds()
+
+	if !o.json {
+		return err
+	}
+
+	if err != nil {
+		res.Error = err.Error()
+	}
+	json.NewEncoder(os.Stdout).Encode(res)
+
+	if err != nil {
+		return exitError{1}
+	}
+
+	return nil
+}
+
+func transfer(ctx context.Context, config *goph.Config, op, src, dst string) error {
+
+	client, err := goph.NewConnContext(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+	})
+	defer stop()
+
+	if op == "upload" {
+		return client.Upload(src, dst)
+	}
+
+	return client.Download(src, dst)
+}
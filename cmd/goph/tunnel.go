@@ -0,0 +1,77 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/babbage88/goph/v2"
+)
+
+func tunnelCmd(ctx context.Context, args []string) error {
+
+	var (
+		o       options
+		forward string
+	)
+
+	fs := newFlagSet("tunnel", "-L [bind:]port:host:hostport host", &o)
+	fs.StringVar(&forward, "L", "", "forward the local [bind:]port to host:hostport on the remote side.")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || forward == "" {
+		fs.Usage()
+		return exitError{2}
+	}
+
+	local, remote, err := parseForward(forward)
+	if err != nil {
+		return err
+	}
+
+	configs, err := o.configs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	client, err := goph.NewConnContext(ctx, configs[0])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	tunnel, err := client.LocalForward(ctx, local, remote)
+	if err != nil {
+		return err
+	}
+	defer tunnel.Close()
+
+	fmt.Fprintf(os.Stderr, "forwarding %s to %s via %s\n", tunnel.Addr(), remote, hostPort(configs[0]))
+
+	select {
+	case <-tunnel.Done():
+	case <-client.Done():
+	}
+
+	return nil
+}
+
+// parseForward parses a [bind:]port:host:hostport forward spec.
+func parseForward(spec string) (local, remote string, err error) {
+
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 3:
+		return net.JoinHostPort("127.0.0.1", parts[0]), net.JoinHostPort(parts[1], parts[2]), nil
+	case 4:
+		return net.JoinHostPort(parts[0], parts[1]), net.JoinHostPort(parts[2], parts[3]), nil
+	}
+
+	return "", "", errors.New("invalid forward, expected [bind:]port:host:hostport")
+}
@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestParseForward(t *testing.T) {
+
+	local, remote, err := parseForward("8080:db:5432")
+	if err != nil || local != "127.0.0.1:8080" || remote != "db:5432" {
+		t.Errorf("unexpected forward %s %s %v", local, remote, err)
+	}
+
+	if _, _, err = parseForward("8080"); err == nil {
+		t.Error("it should return an error")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// credentials holds the auth and host key callback replacing the config
+// ones on the next dial.
+type credentials struct {
+	mu       sync.Mutex
+	auth     Auth
+	callback ssh.HostKeyCallback
+}
+
+// UpdateAuth replaces the auth methods of the client from the next dial,
+// by Reconnect, WithRedial or AutoReconnect, for rotating credentials of
+// long-running clients. The current connection and its sessions are not
+// disturbed.
+func (c Client) UpdateAuth(auth Auth) {
+
+	c = c.live()
+
+	if c.state == nil {
+		c.Config.Auth = auth
+		return
+	}
+
+	c.state.credentials.mu.Lock()
+	c.state.credentials.auth = auth
+	c.state.credentials.mu.Unlock()
+
+	c.Config.logger().Info("auth updated", c.Config.logAttrs("auth", authMethodNames(auth))...)
+}
+
+// UpdateHostKeyCallback replaces the host key callback of the client from
+// the next dial, like UpdateAuth.
+func (c Client) UpdateHostKeyCallback(callback ssh.HostKeyCallback) {
+
+	c = c.live()
+
+	if c.state == nil {
+		c.Config.Callback = callback
+		return
+	}
+
+	c.state.credentials.mu.Lock()
+	c.state.credentials.callback = callback
+	c.state.credentials.mu.Unlock()
+
+	c.Config.logger().Info("host key callback updated", c.Config.logAttrs()...)
+}
+
+// applyCredentials sets the auth and host key callback updated on state in
+// config before a dial. They stay pending for the next dial with the client
+// config when config is a copy, like the one of AutoReconnect.
+func (c *Client) applyCredentials(state *clientState, config *Config) (auth Auth, callback ssh.HostKeyCallback) {
+
+	if state == nil {
+		return
+	}
+
+	creds := &state.credentials
+
+	creds.mu.Lock()
+	defer creds.mu.Unlock()
+
+	if creds.auth != nil {
+		config.Auth = creds.auth
+	}
+	if creds.callback != nil {
+		config.Callback = creds.callback
+	}
+
+	if config != c.Config {
+		auth, callback = creds.auth, creds.callback
+	}
+	creds.auth, creds.callback = nil, nil
+
+	return auth, callback
+}
@@ -0,0 +1,55 @@
+package goph_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestUpdateAuth(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("true", func(e *gophtest.Exec) int { return 0 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// rotate the password, the connection keeps working.
+	srv.AddUser("alice", "rotated")
+	client.UpdateAuth(goph.Password("rotated"))
+
+	var checked bool
+	client.UpdateHostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		checked = true
+		return nil
+	})
+
+	if _, err = client.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+	if checked {
+		t.Error("the host key callback should only be used on the next dial")
+	}
+
+	if err = client.Reconnect(context.Background()); err != nil {
+		t.Fatalf("reconnect with the updated auth: %s", err)
+	}
+	if !checked {
+		t.Error("the updated host key callback was not used")
+	}
+	if _, err = client.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// cronMarker prefixes the comment naming the crontab entries managed by goph.
+const cronMarker = "# goph: "
+
+// CronEntry is a crontab job.
+type CronEntry struct {
+
+	// Name identifies the entries managed by goph, it is kept in a comment
+	// line above the job. Entries without a marker have no name.
+	Name string
+
+	// Schedule is the five time fields, like "*/5 * * * *", or a special
+	// string like "@daily".
+	Schedule string
+
+	Command string
+}
+
+// String returns the crontab lines of the entry.
+func (e CronEntry) String() string {
+
+	line := e.Schedule + " " + e.Command
+	if e.Name == "" {
+		return line
+	}
+
+	return cronMarker + e.Name + "\n" + line
+}
+
+// cronLine is a line of a crontab, job is set for job lines.
+type cronLine struct {
+	text string
+	job  *CronEntry
+}
+
+// Crontab is a parsed crontab. Comments, blank lines and variables are kept
+// as is.
+type Crontab struct {
+	lines []cronLine
+}
+
+// ParseCrontab parses the crontab as printed by crontab -l.
+func ParseCrontab(data string) *Crontab {
+
+	t := &Crontab{}
+	if data == "" {
+		return t
+	}
+
+	name := ""
+	for _, text := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+
+		trimmed := strings.TrimSpace(text)
+
+		switch {
+		case strings.HasPrefix(trimmed, cronMarker):
+			name = strings.TrimSpace(strings.TrimPrefix(trimmed, cronMarker))
+
+		case trimmed == "", strings.HasPrefix(trimmed, "#"), isCronVariable(trimmed):
+			t.lines = append(t.lines, cronLine{text: text})
+
+		default:
+			job := parseCronJob(trimmed)
+			job.Name, name = name, ""
+			t.lines = append(t.lines, cronLine{text: text, job: &job})
+		}
+	}
+
+	return t
+}
+
+// isCronVariable reports whether line is a "NAME=value" assignment.
+func isCronVariable(line string) bool {
+	eq := strings.IndexByte(line, '=')
+	return eq > 0 && !strings.ContainsAny(line[:eq], " \t")
+}
+
+// parseCronJob splits a job line in schedule and command.
+func parseCronJob(line string) CronEntry {
+
+	fields := 5
+	if strings.HasPrefix(line, "@") {
+		fields = 1
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) <= fields {
+		return CronEntry{Schedule: line}
+	}
+
+	// the command keeps its own spacing.
+	rest := line
+	for range fields {
+		rest = strings.TrimLeft(rest, " \t")
+		rest = rest[strings.IndexAny(rest+" ", " \t"):]
+	}
+
+	return CronEntry{
+		Schedule: strings.Join(parts[:fields], " "),
+		Command:  strings.TrimSpace(rest),
+	}
+}
+
+// Entries returns the jobs of the crontab.
+func (t *Crontab) Entries() []CronEntry {
+
+	var entries []CronEntry
+	for _, l := range t.lines {
+		if l.job != nil {
+			entries = append(entries, *l.job)
+		}
+	}
+
+	return entries
+}
+
+// Set adds the entry, or updates the entry with the same name, and reports
+// whether the crontab changed. Unnamed entries are only added when no
+// identical job exists.
+func (t *Crontab) Set(e CronEntry) bool {
+
+	for i, l := range t.lines {
+		if l.job != nil && l.job.Name == e.Name && (e.Name != "" || *l.job == e) {
+			if *l.job == e {
+				return false
+			}
+			t.lines[i] = cronLine{text: e.Schedule + " " + e.Command, job: &e}
+			return true
+		}
+	}
+
+	t.lines = append(t.lines, cronLine{text: e.Schedule + " " + e.Command, job: &e})
+	return true
+}
+
+// Remove removes the named entry, and reports whether it was found.
+func (t *Crontab) Remove(name string) bool {
+
+	for i, l := range t.lines {
+		if l.job != nil && l.job.Name == name {
+			t.lines = append(t.lines[:i], t.lines[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns the crontab content.
+func (t *Crontab) String() string {
+
+	var b strings.Builder
+	for _, l := range t.lines {
+		if l.job != nil && l.job.Name != "" {
+			b.WriteString(cronMarker + l.job.Name + "\n")
+		}
+		b.WriteString(l.text + "\n")
+	}
+
+	return b.String()
+}
+
+// crontabArgs returns the crontab arguments selecting user, empty for the
+// connection user.
+func crontabArgs(user string, args ...string) []string {
+	if user == "" {
+		return args
+	}
+	return append([]string{"-u", user}, args...)
+}
+
+// Crontab returns the crontab of the remote user, or of the connection user
+// when user is empty. A user without crontab has an empty one.
+func (c Client) Crontab(ctx context.Context, user string) (*Crontab, error) {
+
+	cmd, err := c.CommandContext(ctx, "crontab", crontabArgs(user, "-l")...)
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && strings.Contains(stderr.String(), "no crontab for") {
+		return ParseCrontab(""), nil
+	}
+	if err != nil {
+		return nil, outputError(err, stderr.Bytes())
+	}
+
+	return ParseCrontab(string(out)), nil
+}
+
+// InstallCrontab replaces the crontab of the remote user, or of the
+// connection user when user is empty. crontab installs it atomically.
+func (c Client) InstallCrontab(ctx context.Context, user string, t *Crontab) error {
+
+	cmd, err := c.CommandContext(ctx, "crontab", crontabArgs(user, "-")...)
+	if err != nil {
+		return err
+	}
+
+	cmd.Stdin = strings.NewReader(t.String())
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return outputError(err, out)
+	}
+
+	return nil
+}
+
+// SetCronEntry adds or updates the named entry in the crontab of user, and
+// reports whether the crontab changed.
+func (c Client) SetCronEntry(ctx context.Context, user string, e CronEntry) (bool, error) {
+	return c.editCrontab(ctx, user, func(t *Crontab) bool { return t.Set(e) })
+}
+
+// RemoveCronEntry removes the named entry from the crontab of user, and
+// reports whether the crontab changed.
+func (c Client) RemoveCronEntry(ctx context.Context, user, name string) (bool, error) {
+	return c.editCrontab(ctx, user, func(t *Crontab) bool { return t.Remove(name) })
+}
+
+// editCrontab reads, edits and installs the crontab of user when edit
+// reports a change.
+func (c Client) editCrontab(ctx context.Context, user string, edit func(*Crontab) bool) (bool, error) {
+
+	t, err := c.Crontab(ctx, user)
+	if err != nil {
+		return false, err
+	}
+
+	if !edit(t) {
+		return false, nil
+	}
+
+	return true, c.InstallCrontab(ctx, user, t)
+}
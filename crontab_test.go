@@ -0,0 +1,75 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestCrontab(t *testing.T) {
+
+	tab := goph.ParseCrontab("MAILTO=ops\n# nightly\n0 3 * * *  /usr/bin/backup --all\n# goph: cleanup\n@hourly  rm -rf /tmp/cache\n")
+
+	entries := tab.Entries()
+	if len(entries) != 2 || entries[0].Command != "/usr/bin/backup --all" || entries[1].Name != "cleanup" || entries[1].Schedule != "@hourly" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	installed := tab.String()
+	srv.HandleFunc("crontab -l", func(e *gophtest.Exec) int {
+		if installed == "" {
+			fmt.Fprintln(e.Stderr, "no crontab for alice")
+			return 1
+		}
+		io.WriteString(e.Stdout, installed)
+		return 0
+	})
+	srv.HandleFunc("crontab -", func(e *gophtest.Exec) int {
+		data, _ := io.ReadAll(e.Stdin)
+		installed = string(data)
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	entry := goph.CronEntry{Name: "cleanup", Schedule: "*/10 * * * *", Command: "rm -rf /tmp/cache"}
+
+	for i, want := range []bool{true, false} {
+		changed, err := client.SetCronEntry(ctx, "", entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != want {
+			t.Errorf("set %d: changed %t, want %t", i, changed, want)
+		}
+	}
+
+	want := "MAILTO=ops\n# nightly\n0 3 * * *  /usr/bin/backup --all\n# goph: cleanup\n*/10 * * * * rm -rf /tmp/cache\n"
+	if installed != want {
+		t.Errorf("got %q, want %q", installed, want)
+	}
+
+	installed = ""
+	if tab, err = client.Crontab(ctx, ""); err != nil || len(tab.Entries()) != 0 {
+		t.Errorf("a user without crontab should have an empty one: %v", err)
+	}
+
+	if changed, err := client.RemoveCronEntry(ctx, "", "cleanup"); err != nil || changed {
+		t.Errorf("removing a missing entry should not change the crontab: %v", err)
+	}
+}
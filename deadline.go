@@ -0,0 +1,143 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrCommandTimeout is returned when a command was killed for passing its
+// Timeout or IdleTimeout.
+var ErrCommandTimeout = errors.New("goph: command deadline exceeded")
+
+// activity fires once no output was written for its duration.
+type activity struct {
+	d     time.Duration
+	timer *time.Timer
+	once  sync.Once
+	fired chan struct{}
+}
+
+func newActivity(d time.Duration) *activity {
+	a := &activity{d: d, fired: make(chan struct{})}
+	a.timer = time.AfterFunc(d, func() {
+		a.once.Do(func() { close(a.fired) })
+	})
+	return a
+}
+
+// touch restarts the idle duration.
+func (a *activity) touch() {
+	a.timer.Reset(a.d)
+}
+
+func (a *activity) stop() {
+	a.timer.Stop()
+}
+
+// activityWriter touches its activity on every write.
+type activityWriter struct {
+	w io.Writer
+	a *activity
+}
+
+func (w *activityWriter) Write(p []byte) (int, error) {
+	w.a.touch()
+	return w.w.Write(p)
+}
+
+// lockedWriter serializes the writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// track returns w touching the idle deadline of the command on writes.
+func (c *Cmd) track(w io.Writer) io.Writer {
+	if c.activity == nil || w == nil {
+		return w
+	}
+	return &activityWriter{w: w, a: c.activity}
+}
+
+// watchDeadline kills the command once it passes its Timeout or
+// IdleTimeout, and sends the deadline error to c.expired, until the
+// returned stop function is called.
+func (c *Cmd) watchDeadline() (stop func()) {
+
+	var (
+		lifetime <-chan time.Time
+		idle     <-chan struct{}
+		timer    *time.Timer
+	)
+
+	if c.Timeout > 0 {
+		timer = time.NewTimer(c.Timeout)
+		lifetime = timer.C
+	}
+	if c.activity != nil {
+		idle = c.activity.fired
+	}
+
+	c.expired = make(chan error, 1)
+	if lifetime == nil && idle == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		var err error
+		select {
+		case <-lifetime:
+			err = fmt.Errorf("%w: ran for %s", ErrCommandTimeout, c.Timeout)
+		case <-idle:
+			err = fmt.Errorf("%w: no output for %s", ErrCommandTimeout, c.IdleTimeout)
+		case <-done:
+			return
+		}
+
+		// report the deadline before the killed command returns.
+		c.expired <- err
+		c.Session.Signal(ssh.SIGKILL)
+		c.Session.Close()
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			if timer != nil {
+				timer.Stop()
+			}
+			if c.activity != nil {
+				c.activity.stop()
+			}
+		})
+	}
+}
+
+// deadlineError returns the deadline error of a killed command, or err.
+func (c *Cmd) deadlineError(err error) error {
+	if err == nil {
+		return nil
+	}
+	select {
+	case expired := <-c.expired:
+		return expired
+	default:
+		return err
+	}
+}
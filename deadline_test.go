@@ -0,0 +1,76 @@
+package goph_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestCmdDeadlines(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("hang", func(e *gophtest.Exec) int {
+		time.Sleep(2 * time.Second)
+		return 0
+	})
+	srv.HandleFunc("chatty", func(e *gophtest.Exec) int {
+		for i := range 10 {
+			fmt.Fprintln(e.Stdout, i)
+			time.Sleep(30 * time.Millisecond)
+		}
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	run := func(name string, timeout, idle time.Duration) error {
+		cmd, err := client.Command(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd.Timeout, cmd.IdleTimeout = timeout, idle
+		_, err = cmd.CombinedOutput()
+		return err
+	}
+
+	start := time.Now()
+	if err = run("hang", 0, 100*time.Millisecond); !errors.Is(err, goph.ErrCommandTimeout) {
+		t.Errorf("expected ErrCommandTimeout for a silent command, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("the silent command was not killed")
+	}
+
+	if err = run("chatty", 0, 100*time.Millisecond); err != nil {
+		t.Errorf("a command writing output should not be idle: %v", err)
+	}
+
+	if err = run("chatty", 100*time.Millisecond, 0); !errors.Is(err, goph.ErrCommandTimeout) {
+		t.Errorf("expected ErrCommandTimeout past the lifetime, got %v", err)
+	}
+
+	cmd, err := client.Command("hang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Timeout = 100 * time.Millisecond
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Wait(); !errors.Is(err, goph.ErrCommandTimeout) || goph.Category(err) != goph.CategoryRemoteCommand {
+		t.Errorf("expected ErrCommandTimeout from Wait, got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// msgKexInit is the ssh key exchange init message number.
+const msgKexInit = 20
+
+// maxSniffSize bounds the bytes buffered while looking for the kex init packet.
+const maxSniffSize = 64 * 1024
+
+// kexInit holds the algorithm lists of a key exchange init message.
+type kexInit struct {
+	KeyExchanges []string
+	HostKeys     []string
+	CiphersC2S   []string
+	CiphersS2C   []string
+	MACsC2S      []string
+	MACsS2C      []string
+}
+
+// parseKexInit parses a key exchange init payload.
+func parseKexInit(payload []byte) (*kexInit, bool) {
+
+	if len(payload) < 17 || payload[0] != msgKexInit {
+		return nil, false
+	}
+
+	// skip message number and cookie.
+	data := payload[17:]
+
+	lists := make([][]string, 6)
+	for i := range lists {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := binary.BigEndian.Uint32(data)
+		if uint32(len(data)-4) < n {
+			return nil, false
+		}
+		if n > 0 {
+			lists[i] = strings.Split(string(data[4:4+n]), ",")
+		}
+		data = data[4+n:]
+	}
+
+	return &kexInit{
+		KeyExchanges: lists[0],
+		HostKeys:     lists[1],
+		CiphersC2S:   lists[2],
+		CiphersS2C:   lists[3],
+		MACsC2S:      lists[4],
+		MACsS2C:      lists[5],
+	}, true
+}
+
+// negotiate returns the first client algorithm supported by the server, like
+// the ssh algorithm negotiation does.
+func negotiate(client, server []string) string {
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+// kexSniffer captures the first kex init packet flowing in one direction of
+// the connection, before encryption is enabled.
+type kexSniffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	done bool
+	kex  *kexInit
+}
+
+func (s *kexSniffer) feed(p []byte) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return
+	}
+
+	s.buf = append(s.buf, p...)
+
+	if kex, ok := s.parse(); ok {
+		s.kex = kex
+		s.done = true
+		s.buf = nil
+	} else if len(s.buf) > maxSniffSize {
+		s.done = true
+		s.buf = nil
+	}
+}
+
+// parse skips the identification lines and parses the first binary packet.
+func (s *kexSniffer) parse() (*kexInit, bool) {
+
+	data := s.buf
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil, false
+		}
+		line := data[:i]
+		data = data[i+1:]
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			break
+		}
+	}
+
+	if len(data) < 5 {
+		return nil, false
+	}
+
+	length := binary.BigEndian.Uint32(data)
+	if uint32(len(data)-4) < length || length < 1 {
+		return nil, false
+	}
+
+	padding := uint32(data[4])
+	if padding+1 > length {
+		return nil, false
+	}
+
+	return parseKexInit(data[5 : 4+length-padding])
+}
+
+func (s *kexSniffer) result() *kexInit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.kex
+}
+
+// kexConn is a net.Conn capturing the kex init packets of both peers.
+type kexConn struct {
+	net.Conn
+	client kexSniffer
+	server kexSniffer
+}
+
+func (c *kexConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.server.feed(p[:n])
+	}
+	return n, err
+}
+
+func (c *kexConn) Write(p []byte) (int, error) {
+	c.client.feed(p)
+	return c.Conn.Write(p)
+}
+
+// logNegotiation logs the algorithms offered by the server and the ones
+// picked by the negotiation.
+func (c *Config) logNegotiation(conn *kexConn) {
+
+	log := c.logger()
+	server := conn.server.result()
+	client := conn.client.result()
+
+	if server == nil {
+		log.Debug("no kex init received from server", c.logAttrs()...)
+		return
+	}
+
+	log.Debug("server algorithms", c.logAttrs(
+		"kex", server.KeyExchanges,
+		"host_key", server.HostKeys,
+		"ciphers", server.CiphersS2C,
+		"macs", server.MACsS2C,
+	)...)
+
+	if client == nil {
+		return
+	}
+
+	log.Debug("negotiated algorithms", c.logAttrs(
+		"kex", negotiate(client.KeyExchanges, server.KeyExchanges),
+		"host_key", negotiate(client.HostKeys, server.HostKeys),
+		"cipher_c2s", negotiate(client.CiphersC2S, server.CiphersC2S),
+		"cipher_s2c", negotiate(client.CiphersS2C, server.CiphersS2C),
+		"mac_c2s", negotiate(client.MACsC2S, server.MACsC2S),
+		"mac_s2c", negotiate(client.MACsS2C, server.MACsS2C),
+	)...)
+}
+
+// debugHostKeyCallback logs host key verification decisions.
+func (c *Config) debugHostKeyCallback(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+
+	if callback == nil {
+		return nil
+	}
+
+	return func(host string, remote net.Addr, key ssh.PublicKey) error {
+
+		err := callback(host, remote, key)
+
+		args := c.logAttrs(
+			"remote", remote.String(),
+			"key_type", key.Type(),
+			"fingerprint", ssh.FingerprintSHA256(key),
+			"accepted", err == nil,
+		)
+		if err != nil {
+			args = append(args, "error", err)
+		}
+
+		c.logger().Debug("host key verification", args...)
+
+		return err
+	}
+}
+
+// debugBannerCallback logs the server banner.
+func (c *Config) debugBannerCallback(callback ssh.BannerCallback) ssh.BannerCallback {
+	return func(message string) error {
+
+		c.logger().Debug("server banner", c.logAttrs("banner", message)...)
+
+		if callback != nil {
+			return callback(message)
+		}
+		return nil
+	}
+}
+
+// debugRequests logs the global requests sent by the server.
+func (c *Config) debugRequests(in <-chan *ssh.Request) <-chan *ssh.Request {
+
+	out := make(chan *ssh.Request)
+
+	go func() {
+		defer close(out)
+		for req := range in {
+			c.logger().Debug("global request", c.logAttrs("type", req.Type, "want_reply", req.WantReply, "payload_size", len(req.Payload))...)
+			out <- req
+		}
+	}()
+
+	return out
+}
+
+// debugChannels logs the channels opened by the server.
+func (c *Config) debugChannels(in <-chan ssh.NewChannel) <-chan ssh.NewChannel {
+
+	out := make(chan ssh.NewChannel)
+
+	go func() {
+		defer close(out)
+		for ch := range in {
+			c.logger().Debug("channel open request", c.logAttrs("type", ch.ChannelType())...)
+			out <- ch
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,42 @@
+package goph_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDebug(t *testing.T) {
+
+	newServer("2032")
+
+	var buf bytes.Buffer
+
+	client, err := goph.NewConn(&goph.Config{
+		Addr:     "127.0.10.10",
+		Port:     2032,
+		User:     "babbage88",
+		Auth:     goph.Password("123456"),
+		Callback: ssh.InsecureIgnoreHostKey(),
+		Logger:   goph.SlogLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Debug:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for _, msg := range []string{"negotiated algorithms", "host key verification", "auth=[password]"} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Errorf("debug log should contain %q:\n%s", msg, buf.String())
+		}
+	}
+
+	if strings.Contains(buf.String(), "123456") {
+		t.Error("debug log should not contain the password")
+	}
+}
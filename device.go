@@ -0,0 +1,317 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DeviceProfile describes the interactive shell of a network appliance.
+type DeviceProfile struct {
+	Name string
+
+	// Prompt matches the last line of the output once a command is done.
+	Prompt *regexp.Regexp
+
+	// DisablePaging commands are run once the shell is ready.
+	DisablePaging []string
+
+	// Pager, if set, matches the paging prompts answered with a space when
+	// paging can not be disabled.
+	Pager *regexp.Regexp
+
+	// LineEnding terminates the commands, "\n" when empty.
+	LineEnding string
+}
+
+// Device profiles of common appliances.
+var (
+	CiscoIOSProfile = DeviceProfile{
+		Name:          "cisco-ios",
+		Prompt:        regexp.MustCompile(`[\w.\-@()/:]+[>#]\s*$`),
+		DisablePaging: []string{"terminal length 0", "terminal width 0"},
+		Pager:         regexp.MustCompile(` *--More--\s*$`),
+	}
+
+	JuniperProfile = DeviceProfile{
+		Name:          "juniper",
+		Prompt:        regexp.MustCompile(`[\w.\-@]+[>#%]\s*$`),
+		DisablePaging: []string{"set cli screen-length 0"},
+		Pager:         regexp.MustCompile(` *---\(more[^)]*\)---\s*$`),
+	}
+
+	GenericDeviceProfile = DeviceProfile{
+		Name:   "generic",
+		Prompt: regexp.MustCompile(`[\w.\-@()/:~\[\] ]*[>#$%]\s*$`),
+		Pager:  regexp.MustCompile(`(?i) *-+\s*more\s*-+\s*$`),
+	}
+)
+
+// ansiEscape matches terminal escape sequences.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]|\x1b[()][AB012]`)
+
+// DeviceShell runs commands through the interactive shell of appliances
+// which reject exec requests, like many routers and switches. Commands are
+// run one at a time and their echo and prompt are stripped from the output.
+type DeviceShell struct {
+	Profile DeviceProfile
+
+	client Client
+	sess   *ssh.Session
+	stdin  io.WriteCloser
+
+	// mu serializes Run calls.
+	mu sync.Mutex
+
+	// out is the shell output, guarded by outMu.
+	outMu   sync.Mutex
+	out     []byte
+	outErr  error
+	updated chan struct{}
+}
+
+// NewDeviceShell opens a pty shell on the device, waits for its prompt
+// and disables paging as described by profile.
+func (c Client) NewDeviceShell(ctx context.Context, profile DeviceProfile) (_ *DeviceShell, err error) {
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "shell", Command: profile.Name, Err: err})
+	}()
+
+	if profile.Prompt == nil {
+		return nil, errors.New("goph: device profile without prompt")
+	}
+
+	sess, err := c.openSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DeviceShell{
+		Profile: profile,
+		client:  c,
+		sess:    sess,
+		updated: make(chan struct{}, 1),
+	}
+
+	defer func() {
+		if err != nil {
+			d.Close()
+		}
+	}()
+
+	if d.stdin, err = sess.StdinPipe(); err != nil {
+		return nil, err
+	}
+
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	sess.Stderr = sess.Stdout
+
+	modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+	if err = sess.RequestPty("vt100", 0, 511, modes); err != nil {
+		return nil, err
+	}
+
+	if err = sess.Shell(); err != nil {
+		return nil, err
+	}
+
+	go d.read(stdout)
+
+	if _, err = d.wait(ctx, 0); err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range profile.DisablePaging {
+		if _, err = d.Run(ctx, cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// read buffers the shell output.
+func (d *DeviceShell) read(r io.Reader) {
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+
+		d.outMu.Lock()
+		d.out = append(d.out, buf[:n]...)
+		if err != nil {
+			d.outErr = err
+		}
+		d.outMu.Unlock()
+
+		select {
+		case d.updated <- struct{}{}:
+		default:
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait waits for the prompt in the output after offset, it answers the
+// pager prompts and returns the output up to the prompt.
+func (d *DeviceShell) wait(ctx context.Context, offset int) ([]byte, error) {
+
+	for {
+		d.outMu.Lock()
+		out, outErr := d.out[offset:], d.outErr
+
+		// answer the pager and drop its prompt from the output.
+		if p := d.Profile.Pager; p != nil {
+			if loc := p.FindIndex(out); loc != nil {
+				d.out = d.out[:offset+loc[0]]
+				d.outMu.Unlock()
+
+				if _, err := io.WriteString(d.stdin, " "); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		d.outMu.Unlock()
+
+		if loc := d.Profile.Prompt.FindIndex(lastLine(out)); loc != nil {
+			return out[:len(out)-len(lastLine(out))], nil
+		}
+
+		if outErr != nil {
+			if outErr == io.EOF {
+				outErr = io.ErrUnexpectedEOF
+			}
+			return nil, outErr
+		}
+
+		select {
+		case <-d.updated:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Run runs cmd in the shell and returns its cleaned output.
+func (d *DeviceShell) Run(ctx context.Context, cmd string) ([]byte, error) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.outMu.Lock()
+	offset := len(d.out)
+	d.outMu.Unlock()
+
+	ending := d.Profile.LineEnding
+	if ending == "" {
+		ending = "\n"
+	}
+
+	if _, err := io.WriteString(d.stdin, cmd+ending); err != nil {
+		return nil, d.client.Config.opError(OpError{Op: "run", Command: cmd, Err: err})
+	}
+
+	out, err := d.wait(ctx, offset)
+	if err != nil {
+		return nil, d.client.Config.opError(OpError{Op: "run", Command: cmd, Err: err})
+	}
+
+	return cleanDeviceOutput(out, cmd), nil
+}
+
+// Close exits the shell and closes its session.
+func (d *DeviceShell) Close() error {
+	if d.stdin != nil {
+		d.stdin.Close()
+	}
+	d.client.closeSession(d.sess)
+	return nil
+}
+
+// cleanDeviceOutput removes the escape sequences, carriage returns and the
+// command echo from out.
+func cleanDeviceOutput(out []byte, cmd string) []byte {
+
+	out = ansiEscape.ReplaceAll(out, nil)
+	out = bytes.ReplaceAll(out, []byte("\r\n"), []byte("\n"))
+	out = removeBackspaces(out)
+	out = applyCarriageReturns(out)
+
+	// the first line is the echo of the command.
+	if first, rest, _ := bytes.Cut(out, []byte("\n")); bytes.Contains(first, []byte(strings.TrimSpace(cmd))) {
+		out = rest
+	}
+
+	return out
+}
+
+// removeBackspaces applies the backspaces of out.
+func removeBackspaces(out []byte) []byte {
+
+	if !bytes.Contains(out, []byte("\b")) {
+		return out
+	}
+
+	clean := make([]byte, 0, len(out))
+	for _, b := range out {
+		if b == '\b' {
+			if len(clean) > 0 {
+				clean = clean[:len(clean)-1]
+			}
+			continue
+		}
+		clean = append(clean, b)
+	}
+
+	return clean
+}
+
+// applyCarriageReturns overwrites the start of lines with the text after
+// their carriage returns, like a terminal does.
+func applyCarriageReturns(out []byte) []byte {
+
+	if !bytes.Contains(out, []byte("\r")) {
+		return out
+	}
+
+	lines := bytes.Split(out, []byte("\n"))
+	for i, line := range lines {
+
+		if !bytes.Contains(line, []byte("\r")) {
+			continue
+		}
+
+		var screen []byte
+		for _, part := range bytes.Split(line, []byte("\r")) {
+			if len(part) > len(screen) {
+				screen = append(screen, make([]byte, len(part)-len(screen))...)
+			}
+			copy(screen, part)
+		}
+		lines[i] = bytes.TrimRight(screen, " ")
+	}
+
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// lastLine returns the text after the last line break of out.
+func lastLine(out []byte) []byte {
+	return out[bytes.LastIndexAny(out, "\r\n")+1:]
+}
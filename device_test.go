@@ -0,0 +1,92 @@
+package goph_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// fakeRouter emulates a router shell with paging and echo.
+func fakeRouter(e *gophtest.Exec) int {
+
+	in := bufio.NewReader(e.Stdin)
+	paging := true
+
+	fmt.Fprint(e.Stdout, "\r\nWelcome\r\nr1#")
+
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return 0
+		}
+		cmd := strings.TrimSpace(line)
+		fmt.Fprintf(e.Stdout, "%s\r\n", cmd)
+
+		switch cmd {
+		case "terminal length 0":
+			paging = false
+		case "show version":
+			fmt.Fprint(e.Stdout, "Cisco IOS Software\r\n")
+			if paging {
+				fmt.Fprint(e.Stdout, " --More-- ")
+				if b, _ := in.ReadByte(); b != ' ' {
+					return 1
+				}
+				fmt.Fprint(e.Stdout, "\r          \r")
+			}
+			fmt.Fprint(e.Stdout, "\x1b[1mUptime is 3 weeks\x1b[0m\r\n")
+		case "exit":
+			return 0
+		}
+
+		fmt.Fprint(e.Stdout, "r1#")
+	}
+}
+
+func TestDeviceShell(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("admin", "cisco")
+	srv.Shell = fakeRouter
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	noPaging := goph.CiscoIOSProfile
+	noPaging.DisablePaging = nil
+
+	for _, profile := range []goph.DeviceProfile{goph.CiscoIOSProfile, noPaging} {
+
+		client, err := goph.NewConn(srv.Config("admin", "cisco"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		shell, err := client.NewDeviceShell(ctx, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := shell.Run(ctx, "show version")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := "Cisco IOS Software\nUptime is 3 weeks\n"; strings.TrimLeft(string(out), " \n") != want {
+			t.Errorf("paging disabled %t: got %q, want %q", profile.DisablePaging != nil, out, want)
+		}
+
+		shell.Close()
+		client.Close()
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	aesgcmMagic     = "GOPHAES1"
+	aesgcmSaltSize  = 16
+	aesgcmChunkSize = 64 * 1024
+	aesgcmInfo      = "goph aes-256-gcm file key"
+)
+
+// ErrDecrypt is returned when downloaded data was not encrypted with the
+// key, or was modified or truncated.
+var ErrDecrypt = errors.New("goph: decryption failed")
+
+// AESGCM returns a Transform encrypting uploaded files with AES-256-GCM and
+// decrypting them on download, key must be 32 bytes.
+//
+// Files are encrypted in authenticated 64KiB chunks with a key derived from
+// key and a random per-file salt, so modified, reordered or truncated files
+// fail to download with ErrDecrypt. Other schemes, like age, can be plugged
+// in by implementing Transform.
+func AESGCM(key []byte) (Transform, error) {
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("goph: AES-256-GCM key must be 32 bytes, got %d", len(key))
+	}
+
+	return aesgcm{key: append([]byte(nil), key...)}, nil
+}
+
+type aesgcm struct {
+	key []byte
+}
+
+// aead returns the cipher of the file with the given salt.
+func (t aesgcm) aead(salt []byte) (cipher.AEAD, error) {
+
+	key, err := hkdf.Key(sha256.New, t.key, salt, aesgcmInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (t aesgcm) Writer(w io.Writer) (io.WriteCloser, error) {
+
+	salt := make([]byte, aesgcmSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := t.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(append([]byte(aesgcmMagic), salt...)); err != nil {
+		return nil, err
+	}
+
+	return &aesgcmWriter{w: w, aead: aead}, nil
+}
+
+func (t aesgcm) Reader(r io.Reader) (io.Reader, error) {
+
+	header := make([]byte, len(aesgcmMagic)+aesgcmSaltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrDecrypt
+	}
+
+	if string(header[:len(aesgcmMagic)]) != aesgcmMagic {
+		return nil, ErrDecrypt
+	}
+
+	aead, err := t.aead(header[len(aesgcmMagic):])
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesgcmReader{
+		r:    bufio.NewReaderSize(r, aesgcmChunkSize+aead.Overhead()),
+		aead: aead,
+		buf:  make([]byte, aesgcmChunkSize+aead.Overhead()),
+	}, nil
+}
+
+// aesgcmNonce returns the nonce of a chunk, the chunk counter followed by
+// the last chunk flag.
+func aesgcmNonce(counter uint64, last bool) []byte {
+
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+
+	return nonce
+}
+
+type aesgcmWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func (w *aesgcmWriter) Write(p []byte) (int, error) {
+
+	if w.closed {
+		return 0, errors.New("goph: write to closed encrypted file")
+	}
+
+	w.buf = append(w.buf, p...)
+
+	// keep the last chunk buffered, it is sealed as such on Close.
+	for len(w.buf) > aesgcmChunkSize {
+		if err := w.seal(w.buf[:aesgcmChunkSize], false); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[aesgcmChunkSize:]...)
+	}
+
+	return len(p), nil
+}
+
+func (w *aesgcmWriter) Close() error {
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	return w.seal(w.buf, true)
+}
+
+func (w *aesgcmWriter) seal(chunk []byte, last bool) error {
+
+	_, err := w.w.Write(w.aead.Seal(nil, aesgcmNonce(w.counter, last), chunk, nil))
+	w.counter++
+
+	return err
+}
+
+type aesgcmReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	buf     []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+func (r *aesgcmReader) Read(p []byte) (int, error) {
+
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+
+	return n, nil
+}
+
+// open reads and decrypts the next chunk.
+func (r *aesgcmReader) open() error {
+
+	n, err := io.ReadFull(r.r, r.buf)
+
+	var last bool
+	switch err {
+	case nil:
+		_, err = r.r.Peek(1)
+		last = err == io.EOF
+		if err != nil && !last {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		// the last chunk is never empty, even for empty files.
+		return ErrDecrypt
+	default:
+		return err
+	}
+
+	plain, err := r.aead.Open(r.buf[:0], aesgcmNonce(r.counter, last), r.buf[:n], nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+
+	r.counter++
+	r.plain, r.done = plain, last
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package goph_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+)
+
+func TestAESGCM(t *testing.T) {
+
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	enc, err := goph.AESGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 10, 64 * 1024, 64*1024 + 1, 200 * 1024} {
+
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		sealed := encrypt(t, enc, plain)
+		if size > 0 && bytes.Contains(sealed, plain) {
+			t.Errorf("size %d: the data was not encrypted", size)
+		}
+
+		got, err := decrypt(enc, sealed)
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: the round trip changed the data", size)
+		}
+	}
+
+	sealed := encrypt(t, enc, make([]byte, 100*1024))
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)/2] ^= 1
+
+	for name, data := range map[string][]byte{
+		"tampered":  tampered,
+		"truncated": sealed[:64*1024+40],
+		"empty":     nil,
+	} {
+		if _, err := decrypt(enc, data); !errors.Is(err, goph.ErrDecrypt) {
+			t.Errorf("%s: expected ErrDecrypt, got %v", name, err)
+		}
+	}
+
+	other, _ := goph.AESGCM(make([]byte, 32))
+	if _, err := decrypt(other, sealed); !errors.Is(err, goph.ErrDecrypt) {
+		t.Errorf("wrong key: expected ErrDecrypt, got %v", err)
+	}
+
+	if _, err := goph.AESGCM(key[:16]); err == nil {
+		t.Error("a short key should be rejected")
+	}
+}
+
+func encrypt(t *testing.T, enc goph.Transform, plain []byte) []byte {
+
+	var buf bytes.Buffer
+
+	w, err := enc.Writer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write in odd sizes to cross the chunk boundaries.
+	for len(plain) > 0 {
+		n := min(len(plain), 1000)
+		if _, err := w.Write(plain[:n]); err != nil {
+			t.Fatal(err)
+		}
+		plain = plain[n:]
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func decrypt(enc goph.Transform, sealed []byte) ([]byte, error) {
+
+	r, err := enc.Reader(bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"maps"
+	"os"
+	"strings"
+)
+
+// Environ returns the environment of the remote user, read once per
+// connection with env.
+func (c Client) Environ(ctx context.Context) (map[string]string, error) {
+
+	c = c.live()
+
+	if c.state != nil {
+		c.state.envMu.Lock()
+		defer c.state.envMu.Unlock()
+
+		if c.state.env != nil {
+			return maps.Clone(c.state.env), nil
+		}
+	}
+
+	out, err := c.RunContext(ctx, "env")
+	if err != nil {
+		return nil, outputError(err, out)
+	}
+
+	env := parseEnv(string(out))
+
+	if c.state != nil {
+		c.state.env = env
+	}
+
+	return maps.Clone(env), nil
+}
+
+// parseEnv parses the output of env, lines without "=" continue the value
+// of the previous variable.
+func parseEnv(out string) map[string]string {
+
+	env := make(map[string]string)
+
+	var last string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			if last != "" {
+				env[last] += "\n" + line
+			}
+			continue
+		}
+
+		env[key] = value
+		last = key
+	}
+
+	return env
+}
+
+// Getenv returns the value of the remote environment variable key.
+func (c Client) Getenv(ctx context.Context, key string) (string, error) {
+
+	env, err := c.Environ(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return env[key], nil
+}
+
+// ExpandEnv replaces the $VAR and ${VAR} references of s with the values
+// of the remote environment, for remote paths and command templates.
+// References to variables not set remotely are kept.
+func (c Client) ExpandEnv(ctx context.Context, s string) (string, error) {
+
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	env, err := c.Environ(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return os.Expand(s, func(key string) string {
+		if value, ok := env[key]; ok {
+			return value
+		}
+		// keep the reference, and its braces.
+		if strings.Contains(s, "${"+key+"}") {
+			return "${" + key + "}"
+		}
+		return "$" + key
+	}), nil
+}
+
+// remotePath returns p with a leading "~" expanded to the home directory,
+// and the remote environment variables when Config.ExpandEnv is set.
+func (c Client) remotePath(p string) (string, error) {
+
+	// sftp paths are slash separated on Windows servers too.
+	if c.RemoteOS() == RemoteWindows {
+		p = strings.ReplaceAll(p, `\`, "/")
+	}
+
+	p, err := c.ExpandHome(p)
+	if err != nil || c.Config == nil || !c.Config.ExpandEnv {
+		return p, err
+	}
+
+	return c.ExpandEnv(context.Background(), p)
+}
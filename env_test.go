@@ -0,0 +1,68 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestExpandEnv(t *testing.T) {
+
+	var calls int
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("env", func(e *gophtest.Exec) int {
+		calls++
+		fmt.Fprint(e.Stdout, "HOME=/home/alice\nXDG_RUNTIME_DIR=/run/user/1000\nMOTD=line1\nline2\nAPP_DIR=/srv\n")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	got, err := client.ExpandEnv(ctx, "${XDG_RUNTIME_DIR}/app.sock $UNSET ${ALSO_UNSET}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/run/user/1000/app.sock $UNSET ${ALSO_UNSET}"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if motd, _ := client.Getenv(ctx, "MOTD"); motd != "line1\nline2" {
+		t.Errorf("unexpected multi-line value %q", motd)
+	}
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+	if err = ftp.Mkdir("/srv"); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Config.ExpandEnv = true
+	if _, err = client.EnsureFile("$APP_DIR/app.conf", []byte("a=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if readRemote(t, client, "/srv/app.conf") != "a=1\n" {
+		t.Error("the remote path was not expanded")
+	}
+
+	if calls != 1 {
+		t.Errorf("the environment should be read once, read %d times", calls)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Errors returned by goph match these sentinels with errors.Is, the
+// original error is kept in the chain and its message is unchanged.
+var (
+	// ErrAuthFailed is returned when the server rejected every auth method.
+	ErrAuthFailed = errors.New("goph: authentication failed")
+
+	// ErrHostKeyMismatch is returned when the server host key differs from
+	// the known one, which may be a man in the middle attack.
+	ErrHostKeyMismatch = errors.New("goph: host key mismatch")
+
+	// ErrUnknownHost is returned when the server is not in known_hosts.
+	ErrUnknownHost = errors.New("goph: unknown host")
+
+	// ErrConnectTimeout is returned when the dial or handshake timed out.
+	ErrConnectTimeout = errors.New("goph: connect timeout")
+
+	// ErrSessionLimit is returned when the server refused to open another
+	// session channel, usually because of sshd MaxSessions.
+	ErrSessionLimit = errors.New("goph: session limit reached")
+
+	// ErrSFTPUnavailable is returned when the sftp subsystem could not be
+	// started on the server.
+	ErrSFTPUnavailable = errors.New("goph: sftp unavailable")
+)
+
+// kindError tags err with a sentinel without changing its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// withKind returns err tagged with kind, nil errors stay nil.
+func withKind(kind, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// connectError tags the dial and handshake err with its sentinel.
+func connectError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	var (
+		keyErr *knownhosts.KeyError
+		netErr net.Error
+	)
+
+	switch {
+	case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+		return withKind(ErrHostKeyMismatch, err)
+	case errors.As(err, &keyErr):
+		return withKind(ErrUnknownHost, err)
+	case errors.Is(err, ErrMaxAuthTries), strings.Contains(err.Error(), "unable to authenticate"):
+		return withKind(ErrAuthFailed, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return withKind(ErrConnectTimeout, err)
+	}
+
+	return err
+}
+
+// sessionError tags the session channel open err with its sentinel.
+func sessionError(err error) error {
+
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) && (openErr.Reason == ssh.Prohibited || openErr.Reason == ssh.ResourceShortage) {
+		return withKind(ErrSessionLimit, err)
+	}
+
+	return err
+}
+
+// ErrorCategory is the broad class of a goph error, see Category.
+type ErrorCategory int
+
+const (
+	// CategoryUnknown is used for nil and unclassified errors.
+	CategoryUnknown ErrorCategory = iota
+
+	// CategoryNetwork errors are dial, timeout and dropped connection errors.
+	CategoryNetwork
+
+	// CategoryAuth errors are rejected credentials, host keys and banners.
+	CategoryAuth
+
+	// CategoryProtocol errors are ssh and sftp protocol failures, like
+	// algorithm negotiation or refused channels.
+	CategoryProtocol
+
+	// CategoryRemoteCommand errors are remote commands exiting non-zero.
+	CategoryRemoteCommand
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryNetwork:
+		return "network"
+	case CategoryAuth:
+		return "auth"
+	case CategoryProtocol:
+		return "protocol"
+	case CategoryRemoteCommand:
+		return "remote-command"
+	}
+	return "unknown"
+}
+
+// Category returns the category of err.
+func Category(err error) ErrorCategory {
+
+	var (
+		exitErr   *ssh.ExitError
+		exitMiss  *ssh.ExitMissingError
+		keyErr    *knownhosts.KeyError
+		bannerErr *BannerError
+		algErr    *AlgorithmError
+		openErr   *ssh.OpenChannelError
+		extErr    *SFTPExtensionError
+		netErr    net.Error
+	)
+
+	switch {
+	case err == nil, isAny(err, context.Canceled, ErrCircuitOpen):
+		return CategoryUnknown
+	case errors.As(err, &exitErr), errors.Is(err, ErrCommandTimeout):
+		return CategoryRemoteCommand
+	case isAny(err, ErrAuthFailed, ErrMaxAuthTries, ErrHostKeyMismatch, ErrUnknownHost),
+		errors.As(err, &keyErr), errors.As(err, &bannerErr):
+		return CategoryAuth
+	case isAny(err, ErrSessionLimit, ErrSFTPUnavailable, ErrDecrypt),
+		errors.As(err, &algErr), errors.As(err, &openErr), errors.As(err, &extErr):
+		return CategoryProtocol
+	case isAny(err, ErrConnectTimeout, io.EOF, io.ErrUnexpectedEOF, net.ErrClosed, context.DeadlineExceeded),
+		errors.As(err, &exitMiss), errors.As(err, &netErr):
+		return CategoryNetwork
+	}
+
+	return CategoryUnknown
+}
+
+// IsRetryable reports whether the operation that failed with err may
+// succeed if tried again: network errors and session limits are retryable,
+// auth, protocol and remote command errors are not, nor are canceled
+// operations. Errors in the chain implementing Retryable() bool decide for
+// themselves.
+func IsRetryable(err error) bool {
+
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+
+	if errors.Is(err, ErrSessionLimit) {
+		return true
+	}
+
+	return Category(err) == CategoryNetwork
+}
+
+// isAny reports whether err matches any of the targets.
+func isAny(err error, targets ...error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpError is the error returned by client operations, it records the host
+// and the command or paths involved so failures in fleet runs identify the
+// host and file at once. Commands are redacted, see Config.Redact.
+type OpError struct {
+
+	// Op is "connect", "run", "upload", "download", "sftp", "subsystem"
+	// or "shell".
+	Op string
+
+	User string
+
+	// Host is the "host:port" address of the server.
+	Host string
+
+	Command    string
+	LocalPath  string
+	RemotePath string
+
+	Err error
+}
+
+func (e *OpError) Error() string {
+
+	var b strings.Builder
+
+	b.WriteString(e.Op)
+	b.WriteString(" ")
+	if e.User != "" {
+		b.WriteString(e.User + "@")
+	}
+	b.WriteString(e.Host)
+
+	switch {
+	case e.Command != "":
+		fmt.Fprintf(&b, " %q", e.Command)
+	case e.Op == "download" && e.RemotePath != "":
+		fmt.Fprintf(&b, " %s -> %s", e.RemotePath, e.LocalPath)
+	case e.LocalPath != "" || e.RemotePath != "":
+		fmt.Fprintf(&b, " %s -> %s", e.LocalPath, e.RemotePath)
+	}
+
+	// the paths are already written, only the offset of a file failure is
+	// left.
+	if te, ok := e.Err.(*TransferError); ok && te.LocalPath == e.LocalPath && te.RemotePath == e.RemotePath {
+		fmt.Fprintf(&b, " at byte %d: %s", te.Offset, te.Err)
+		return b.String()
+	}
+
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+
+	return b.String()
+}
+
+func (e *OpError) Unwrap() error { return e.Err }
+
+// opError returns e as an error with the connection fields of c, or err
+// itself when it is nil or already carries its operation context.
+func (c *Config) opError(e OpError) error {
+
+	var opErr *OpError
+	if e.Err == nil || errors.As(e.Err, &opErr) {
+		return e.Err
+	}
+
+	if c != nil {
+		e.User = c.User
+		e.Host = c.hostPort()
+	}
+	e.Command = c.Redact(e.Command)
+	// wrapped errors may hold the command output, like outputError.
+	e.Err = c.redactError(e.Err)
+
+	return &e
+}
+
+// outputError appends the trimmed command output out to err, the output of
+// failed commands usually tells why.
+func outputError(err error, out []byte) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+
+	return err
+}
@@ -0,0 +1,140 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+)
+
+type retryableError bool
+
+func (e retryableError) Error() string   { return "custom" }
+func (e retryableError) Retryable() bool { return bool(e) }
+
+func TestIsRetryable(t *testing.T) {
+
+	tests := []struct {
+		err       error
+		category  goph.ErrorCategory
+		retryable bool
+	}{
+		{nil, goph.CategoryUnknown, false},
+		{io.EOF, goph.CategoryNetwork, true},
+		{fmt.Errorf("dial: %w", goph.ErrConnectTimeout), goph.CategoryNetwork, true},
+		{fmt.Errorf("connect: %w", goph.ErrAuthFailed), goph.CategoryAuth, false},
+		{goph.ErrHostKeyMismatch, goph.CategoryAuth, false},
+		{&goph.BannerError{Err: errors.New("no banner")}, goph.CategoryAuth, false},
+		{goph.ErrSessionLimit, goph.CategoryProtocol, true},
+		{goph.ErrSFTPUnavailable, goph.CategoryProtocol, false},
+		{context.Canceled, goph.CategoryUnknown, false},
+		{goph.ErrCircuitOpen, goph.CategoryUnknown, false},
+		{retryableError(true), goph.CategoryUnknown, true},
+		{fmt.Errorf("wrapped: %w", retryableError(false)), goph.CategoryUnknown, false},
+	}
+
+	for _, test := range tests {
+		if got := goph.Category(test.err); got != test.category {
+			t.Errorf("Category(%v) = %s, want %s", test.err, got, test.category)
+		}
+		if got := goph.IsRetryable(test.err); got != test.retryable {
+			t.Errorf("IsRetryable(%v) = %t, want %t", test.err, got, test.retryable)
+		}
+	}
+}
+
+func TestOpError(t *testing.T) {
+
+	err := &goph.OpError{
+		Op:         "upload",
+		User:       "root",
+		Host:       "10.0.0.1:22",
+		LocalPath:  "a.txt",
+		RemotePath: "/tmp/a.txt",
+		Err:        goph.ErrSFTPUnavailable,
+	}
+
+	if want := "upload root@10.0.0.1:22 a.txt -> /tmp/a.txt: goph: sftp unavailable"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+
+	if !errors.Is(fmt.Errorf("batch: %w", err), goph.ErrSFTPUnavailable) {
+		t.Error("OpError should unwrap to its cause")
+	}
+}
+
+func TestTransferError(t *testing.T) {
+
+	client := newFileServer(t)
+
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(local, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := client.Upload(local, "/missing/a.txt")
+
+	var transferErr *goph.TransferError
+	if !errors.As(err, &transferErr) {
+		t.Fatalf("expected a TransferError, got %v", err)
+	}
+	if transferErr.Op != "upload" || transferErr.LocalPath != local || transferErr.RemotePath != "/missing/a.txt" || transferErr.Offset != 0 {
+		t.Errorf("unexpected transfer error %+v", transferErr)
+	}
+
+	opErr := &goph.OpError{
+		Op:         "download",
+		Host:       "10.0.0.1:22",
+		LocalPath:  "a.txt",
+		RemotePath: "/tmp/a.txt",
+		Err:        &goph.TransferError{Op: "download", LocalPath: "a.txt", RemotePath: "/tmp/a.txt", Offset: 512, Err: io.ErrUnexpectedEOF},
+	}
+	if want := "download 10.0.0.1:22 /tmp/a.txt -> a.txt at byte 512: unexpected EOF"; opErr.Error() != want {
+		t.Errorf("got %q, want %q", opErr.Error(), want)
+	}
+}
+
+func TestPartialTransferError(t *testing.T) {
+
+	client := newFileServer(t)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+	os.Symlink(filepath.Join(dir, "gone"), filepath.Join(dir, "broken"))
+
+	var skipped int
+	client.Config.Transfer.FollowSymlinks = true
+	client.Config.OnFileError = func(goph.FileEvent) error {
+		skipped++
+		return nil
+	}
+
+	err := client.Upload(dir, "/dst")
+
+	var partial *goph.PartialTransferError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a PartialTransferError, got %v", err)
+	}
+	if skipped != 1 || partial.Files != 2 || len(partial.Errors) != 1 {
+		t.Errorf("unexpected partial transfer %+v", partial)
+	}
+
+	var transferErr *goph.TransferError
+	if !errors.As(err, &transferErr) || transferErr.LocalPath != filepath.Join(dir, "broken") {
+		t.Errorf("the skipped file error should be wrapped, got %v", transferErr)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("the partial error should unwrap to the file causes")
+	}
+
+	if readRemote(t, client, "/dst/b.txt") != "b" {
+		t.Error("the other files should be copied")
+	}
+}
@@ -332,11 +332,8 @@ loop:
 
 		default:
 
-			command, err := client.Command(parts[0], parts[1:]...)
-			if err != nil {
-				panic(err)
-			}
-			out, err = command.CombinedOutput()
+			// the line is a shell command, run it as typed.
+			out, err = client.RunContext(context.Background(), cmd)
 			fmt.Println(string(out), err)
 		}
 
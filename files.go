@@ -0,0 +1,166 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/pkg/sftp"
+)
+
+// EnsureFile makes the remote file hold content with mode, and reports
+// whether it had to change it. The content is compared by hash and only
+// written when it differs, through a temporary file renamed over the
+// remote path, so readers never see a partial file. A replaced file gets
+// the owner of the connection user. A leading "~" is expanded to the home
+// directory of the remote user, and variables with Config.ExpandEnv.
+func (c Client) EnsureFile(remotePath string, content []byte, mode os.FileMode) (bool, error) {
+	return c.EnsureFileBackup(remotePath, content, mode, "")
+}
+
+// EnsureFileBackup is like EnsureFile, and when suffix is not empty, keeps
+// a copy of a replaced file at remotePath+suffix.
+func (c Client) EnsureFileBackup(remotePath string, content []byte, mode os.FileMode, suffix string) (changed bool, err error) {
+
+	if remotePath, err = c.remotePath(remotePath); err != nil {
+		return false, err
+	}
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return false, err
+	}
+	defer ftp.Close()
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "sftp", RemotePath: remotePath, Err: err})
+	}()
+
+	info, err := ftp.Stat(remotePath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		info = nil
+	case err != nil:
+		return false, err
+	}
+
+	if info != nil {
+
+		sum, err := remoteHash(ftp, remotePath)
+		if err != nil {
+			return false, err
+		}
+
+		if sum == sha256.Sum256(content) {
+			if info.Mode().Perm() == mode.Perm() {
+				return false, nil
+			}
+			if err = ftp.Chmod(remotePath, mode.Perm()); err != nil {
+				return false, err
+			}
+			c.Config.logger().Info("file mode changed", c.Config.logAttrs("remote", remotePath, "mode", mode.Perm())...)
+			return true, nil
+		}
+
+		if suffix != "" {
+			if err = copyRemote(ftp, remotePath, remotePath+suffix, info.Mode().Perm()); err != nil {
+				return false, fmt.Errorf("backup: %w", err)
+			}
+		}
+	}
+
+	if err = writeAtomic(ftp, remotePath, bytes.NewReader(content), mode); err != nil {
+		return false, err
+	}
+
+	c.Config.logger().Info("file changed", c.Config.logAttrs("remote", remotePath, "bytes", len(content))...)
+
+	return true, nil
+}
+
+// remoteHash returns the sha256 of a remote file.
+func remoteHash(ftp *sftp.Client, remotePath string) (sum [sha256.Size]byte, err error) {
+
+	f, err := ftp.Open(remotePath)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return sum, err
+	}
+
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// copyRemote copies the remote file src to dst.
+func copyRemote(ftp *sftp.Client, src, dst string, mode os.FileMode) error {
+
+	in, err := ftp.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeAtomic(ftp, dst, in, mode)
+}
+
+// writeAtomic writes r to a temporary file next to remotePath and renames
+// it over remotePath, with posix-rename when the server supports it, or by
+// removing remotePath first otherwise.
+func writeAtomic(ftp *sftp.Client, remotePath string, r io.Reader, mode os.FileMode) (err error) {
+
+	tmp := path.Join(path.Dir(remotePath), "."+path.Base(remotePath)+".goph-tmp")
+
+	f, err := ftp.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			ftp.Remove(tmp)
+		}
+	}()
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, ok := ftp.HasExtension(ExtFsync); ok {
+		if err = f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = ftp.Chmod(tmp, mode.Perm()); err != nil {
+		return err
+	}
+
+	if _, ok := ftp.HasExtension(ExtPosixRename); ok {
+		return ftp.PosixRename(tmp, remotePath)
+	}
+
+	if err = ftp.Remove(remotePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return ftp.Rename(tmp, remotePath)
+}
@@ -0,0 +1,144 @@
+package goph_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// newFileServer starts a gophtest server and connects to it.
+func newFileServer(t *testing.T) *goph.Client {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// readRemote returns the content of a remote file.
+func readRemote(t *testing.T, client *goph.Client, path string) string {
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	f, err := ftp.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestEnsureFile(t *testing.T) {
+
+	client := newFileServer(t)
+
+	changed, err := client.EnsureFile("/app.conf", []byte("port=80\n"), 0644)
+	if err != nil || !changed {
+		t.Fatalf("a missing file should be written: %v", err)
+	}
+
+	if changed, err = client.EnsureFile("/app.conf", []byte("port=80\n"), 0644); err != nil || changed {
+		t.Errorf("an identical file should not change: %v", err)
+	}
+
+	changed, err = client.EnsureFileBackup("/app.conf", []byte("port=8080\n"), 0644, ".bak")
+	if err != nil || !changed {
+		t.Fatalf("a different file should be written: %v", err)
+	}
+
+	if got := readRemote(t, client, "/app.conf"); got != "port=8080\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+
+	if got := readRemote(t, client, "/app.conf.bak"); got != "port=80\n" {
+		t.Errorf("unexpected backup %q", got)
+	}
+}
+
+func TestLineInFile(t *testing.T) {
+
+	client := newFileServer(t)
+
+	if _, err := client.EnsureFile("/sshd_config", []byte("Port 22\n#PermitRootLogin yes\nUsePAM yes\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	edits := []goph.LineEdit{
+		{Line: "PermitRootLogin no", Regexp: regexp.MustCompile(`^#?PermitRootLogin`)},
+		{Line: "PermitRootLogin no", Regexp: regexp.MustCompile(`^#?PermitRootLogin`)},
+		{Line: "PasswordAuthentication no", InsertAfter: regexp.MustCompile(`^Port`)},
+		{Regexp: regexp.MustCompile(`^UsePAM`), Absent: true},
+	}
+
+	for i, want := range []bool{true, false, true, true} {
+		changed, err := client.LineInFile("/sshd_config", edits[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != want {
+			t.Errorf("edit %d: changed %t, want %t", i, changed, want)
+		}
+	}
+
+	want := "Port 22\nPasswordAuthentication no\nPermitRootLogin no\n"
+	if got := readRemote(t, client, "/sshd_config"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := client.LineInFile("/missing", goph.LineEdit{Line: "x"}); err == nil {
+		t.Error("a missing file should not be created without Create")
+	}
+}
+
+func TestDownloadRoot(t *testing.T) {
+
+	client := newFileServer(t)
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	if err = ftp.Mkdir("/logs"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.WriteFile("/logs/a", []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range []string{"/", "."} {
+		dst := filepath.Join(t.TempDir(), "out")
+		if err = client.Download(root, dst); err != nil {
+			t.Fatalf("%s: %v", root, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(dst, "logs", "a")); err != nil || string(got) != "a" {
+			t.Errorf("%s: expected logs/a downloaded, got %q, %v", root, got, err)
+		}
+	}
+}
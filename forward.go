@@ -0,0 +1,252 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Forward is a port forwarded through the client connection, see
+// LocalForward and RemoteForward.
+type Forward struct {
+	listener net.Listener
+	dial     func(ctx context.Context) (net.Conn, error)
+	config   *Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// LocalForward listens on localAddr and forwards the accepted connections
+// to remoteAddr, dialed from the remote host, like ssh -L. The forward
+// stops when ctx is done or it is closed.
+func (c Client) LocalForward(ctx context.Context, localAddr, remoteAddr string) (*Forward, error) {
+
+	c = c.live()
+
+	if c.state != nil {
+		if err := c.state.drain.accepting(); err != nil {
+			return nil, c.Config.opError(OpError{Op: "forward", Err: err})
+		}
+	}
+
+	l, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, c.Config.opError(OpError{Op: "forward", Err: err})
+	}
+
+	f := c.forward(ctx, l, func(ctx context.Context) (net.Conn, error) {
+		return c.DialRemote(ctx, "tcp", remoteAddr)
+	})
+
+	c.Config.logger().Info("local forward started", c.Config.logAttrs("local", l.Addr().String(), "remote", remoteAddr)...)
+
+	return f, nil
+}
+
+// RemoteForward listens on remoteAddr on the remote host and forwards the
+// accepted connections to localAddr, dialed from this host, like ssh -R.
+// A remote port 0 picks a free port, see Forward.Addr. The server decides
+// which interfaces it listens on, see the sshd GatewayPorts. The forward
+// stops when ctx is done or it is closed.
+func (c Client) RemoteForward(ctx context.Context, remoteAddr, localAddr string) (*Forward, error) {
+
+	c = c.live()
+
+	if c.state != nil {
+		if err := c.state.drain.accepting(); err != nil {
+			return nil, c.Config.opError(OpError{Op: "forward", Err: err})
+		}
+	}
+
+	l, err := c.Client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, c.Config.opError(OpError{Op: "forward", Err: err})
+	}
+
+	f := c.forward(ctx, l, func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", localAddr)
+	})
+
+	c.Config.logger().Info("remote forward started", c.Config.logAttrs("remote", l.Addr().String(), "local", localAddr)...)
+
+	return f, nil
+}
+
+// DialRemote connects to addr from the remote host, for "tcp" or "unix"
+// networks, like the direct-tcpip channels of ssh -W. Point an
+// http.Transport or a database driver at it to reach the services of the
+// remote network.
+func (c Client) DialRemote(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	c = c.live()
+
+	if c.state != nil {
+		if err := c.state.drain.accepting(); err != nil {
+			return nil, c.Config.opError(OpError{Op: "dial", Err: err})
+		}
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if strings.HasPrefix(network, "unix") {
+		conn, err = c.Client.Dial(network, addr)
+	} else {
+		conn, err = c.Client.DialContext(ctx, network, addr)
+	}
+
+	return conn, c.Config.opError(OpError{Op: "dial", RemotePath: addr, Err: err})
+}
+
+// forward serves the connections accepted by l, connecting them to dial.
+func (c Client) forward(ctx context.Context, l net.Listener, dial func(ctx context.Context) (net.Conn, error)) *Forward {
+
+	f := &Forward{
+		listener: l,
+		dial:     dial,
+		config:   c.Config,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+
+	f.wg.Add(2)
+	go func() {
+		defer f.wg.Done()
+		<-f.ctx.Done()
+		f.listener.Close()
+		f.closeConns()
+	}()
+	go func() {
+		defer f.wg.Done()
+		f.serve()
+	}()
+
+	return f
+}
+
+// Addr returns the address the forward listens on.
+func (f *Forward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Close stops the forward and closes its connections.
+func (f *Forward) Close() error {
+	f.cancel()
+	f.wg.Wait()
+	return nil
+}
+
+// Done returns a channel closed once the forward stops.
+func (f *Forward) Done() <-chan struct{} {
+	return f.ctx.Done()
+}
+
+// serve accepts connections until the listener is closed.
+func (f *Forward) serve() {
+
+	// a broken listener stops the forward.
+	defer f.cancel()
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if f.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+				f.config.logger().Warn("forward stopped", f.config.logAttrs("error", err)...)
+			}
+			return
+		}
+
+		if !f.track(conn) {
+			conn.Close()
+			return
+		}
+
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer f.untrack(conn)
+
+			peer, err := f.dial(f.ctx)
+			if err != nil {
+				f.config.logger().Warn("forward dial failed", f.config.logAttrs("error", err)...)
+				return
+			}
+			if !f.track(peer) {
+				peer.Close()
+				return
+			}
+			defer f.untrack(peer)
+
+			pipe(conn, peer)
+		}()
+	}
+}
+
+// track adds conn to the connections closed with the forward, unless it
+// is closed.
+func (f *Forward) track(conn net.Conn) bool {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.conns == nil {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+
+	return true
+}
+
+// untrack closes conn and forgets it.
+func (f *Forward) untrack(conn net.Conn) {
+
+	conn.Close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.conns, conn)
+}
+
+// closeConns closes the connections of the forward.
+func (f *Forward) closeConns() {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+// pipe copies data both ways until either side is done.
+func pipe(a, b net.Conn) {
+
+	var once sync.Once
+	done := make(chan struct{})
+
+	cp := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		once.Do(func() { close(done) })
+	}
+
+	go cp(a, b)
+	go cp(b, a)
+
+	<-done
+}
@@ -0,0 +1,128 @@
+package goph_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// startEcho starts a TCP server echoing lines back.
+func startEcho(t *testing.T) string {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// echo sends a line through conn and checks it comes back.
+func echo(t *testing.T, conn net.Conn, line string) {
+
+	t.Helper()
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || got != line+"\n" {
+		t.Errorf("expected %q echoed, got %q, %v", line, got, err)
+	}
+}
+
+func TestForward(t *testing.T) {
+
+	echoAddr := startEcho(t)
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.Forwarding = true
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	conn, err := client.DialRemote(ctx, "tcp", echoAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, conn, "dial")
+
+	local, err := client.LocalForward(ctx, "127.0.0.1:0", echoAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first", "second"} {
+		conn, err := net.Dial("tcp", local.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		echo(t, conn, line)
+	}
+
+	remote, err := client.RemoteForward(ctx, "127.0.0.1:0", echoAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = net.Dial("tcp", remote.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, conn, "reverse")
+
+	// closed forwards stop listening.
+	local.Close()
+	remote.Close()
+	for _, f := range []*goph.Forward{local, remote} {
+		if conn, err := net.Dial("tcp", f.Addr().String()); err == nil {
+			conn.Close()
+			t.Errorf("%s still accepts connections", f.Addr())
+		}
+	}
+
+	// forwards stop with their context.
+	cctx, cancel := context.WithCancel(ctx)
+	f, err := client.LocalForward(cctx, "127.0.0.1:0", echoAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-f.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("the forward did not stop with its context")
+	}
+	f.Close()
+}
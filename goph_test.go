@@ -154,7 +154,8 @@ func newServer(port string) {
 		// net.Conn.
 		_, chans, reqs, err := ssh.NewServerConn(nConn, config)
 		if err != nil {
-			log.Fatal("failed to handshake: ", err)
+			log.Println("failed to handshake: ", err)
+			return
 		}
 
 		// The incoming Request channel must be serviced.
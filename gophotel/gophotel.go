@@ -0,0 +1,93 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+// Package gophotel traces goph operations with OpenTelemetry.
+//
+//	config.Tracer = gophotel.New(nil)
+package gophotel
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/babbage88/goph/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope name of the tracer.
+const ScopeName = "github.com/babbage88/goph/v2"
+
+// Tracer is a goph.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a tracer using the given provider, or the global provider when nil.
+func New(tp trace.TracerProvider) *Tracer {
+
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return &Tracer{
+		tracer: tp.Tracer(ScopeName),
+	}
+}
+
+// Start starts a client span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, goph.Span) {
+
+	ctx, s := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(convert(attrs)...),
+	)
+
+	return ctx, span{s}
+}
+
+type span struct {
+	trace.Span
+}
+
+func (s span) SetAttributes(attrs ...slog.Attr) {
+	s.Span.SetAttributes(convert(attrs)...)
+}
+
+func (s span) End(err error) {
+
+	if err != nil {
+		s.Span.RecordError(err)
+		s.Span.SetStatus(codes.Error, err.Error())
+	}
+
+	s.Span.End()
+}
+
+// convert returns the OpenTelemetry attributes of slog attributes.
+func convert(attrs []slog.Attr) []attribute.KeyValue {
+
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+
+		v := a.Value.Resolve()
+		switch v.Kind() {
+		case slog.KindString:
+			kvs = append(kvs, attribute.String(a.Key, v.String()))
+		case slog.KindInt64:
+			kvs = append(kvs, attribute.Int64(a.Key, v.Int64()))
+		case slog.KindUint64:
+			kvs = append(kvs, attribute.Int64(a.Key, int64(v.Uint64())))
+		case slog.KindFloat64:
+			kvs = append(kvs, attribute.Float64(a.Key, v.Float64()))
+		case slog.KindBool:
+			kvs = append(kvs, attribute.Bool(a.Key, v.Bool()))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, v.String()))
+		}
+	}
+
+	return kvs
+}
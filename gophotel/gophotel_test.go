@@ -0,0 +1,180 @@
+package gophotel_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophotel"
+	"github.com/babbage88/goph/v2/gophtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recorder is a trace.TracerProvider recording the spans in memory.
+type recorder struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+func (r *recorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return tracer{r: r}
+}
+
+// ended returns the ended spans named name.
+func (r *recorder) ended(name string) []*span {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var spans []*span
+	for _, s := range r.spans {
+		if s.name == name && s.ended {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+type tracer struct {
+	embedded.Tracer
+	r *recorder
+}
+
+func (t tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+
+	config := trace.NewSpanStartConfig(opts...)
+
+	s := &span{r: t.r, name: name, kind: config.SpanKind(), attrs: make(map[attribute.Key]attribute.Value)}
+	s.SetAttributes(config.Attributes()...)
+
+	t.r.mu.Lock()
+	t.r.spans = append(t.r.spans, s)
+	t.r.mu.Unlock()
+
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type span struct {
+	noop.Span
+	r *recorder
+
+	name   string
+	kind   trace.SpanKind
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	desc   string
+	errs   []error
+	ended  bool
+}
+
+func (s *span) SetAttributes(kvs ...attribute.KeyValue) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	for _, kv := range kvs {
+		s.attrs[kv.Key] = kv.Value
+	}
+}
+
+func (s *span) SetStatus(code codes.Code, desc string) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.status, s.desc = code, desc
+}
+
+func (s *span) RecordError(err error, _ ...trace.EventOption) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+func (s *span) End(...trace.SpanEndOption) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.ended = true
+}
+
+func TestTracer(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("echo hi", func(e *gophtest.Exec) int {
+		fmt.Fprintln(e.Stdout, "hi")
+		return 0
+	})
+	srv.HandleFunc("false", func(e *gophtest.Exec) int { return 1 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	r := &recorder{}
+
+	config := srv.Config("alice", "secret")
+	config.Tracer = gophotel.New(r)
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err = client.Run("echo hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Run("false"); err == nil {
+		t.Fatal("false should fail")
+	}
+
+	runs := r.ended("goph.run")
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 run spans, got %d", len(runs))
+	}
+
+	ok := runs[0]
+	if ok.kind != trace.SpanKindClient || ok.status != codes.Unset || len(ok.errs) != 0 {
+		t.Errorf("unexpected run span %+v", ok)
+	}
+	if ok.attrs["ssh.user"].AsString() != "alice" || ok.attrs["net.peer.port"].AsInt64() != int64(config.Port) ||
+		ok.attrs["goph.output_bytes"].AsInt64() != 3 || ok.attrs["goph.command_hash"].AsString() == "" {
+		t.Errorf("unexpected run span attributes %v", ok.attrs)
+	}
+
+	failed := runs[1]
+	if failed.status != codes.Error || failed.desc == "" || len(failed.errs) != 1 {
+		t.Errorf("expected the failed run span in error, got %+v", failed)
+	}
+
+	local := filepath.Join(t.TempDir(), "data")
+	if err = os.WriteFile(local, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Upload(local, "/data"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Download("/missing", local+".missing"); err == nil {
+		t.Fatal("the download of a missing file should fail")
+	}
+
+	uploads := r.ended("goph.upload")
+	if len(uploads) != 1 || uploads[0].status != codes.Unset || uploads[0].attrs["goph.bytes"].AsInt64() != 5 ||
+		uploads[0].attrs["goph.remote_path"].AsString() != "/data" {
+		t.Errorf("unexpected upload spans %+v", uploads)
+	}
+
+	downloads := r.ended("goph.download")
+	if len(downloads) != 1 || downloads[0].status != codes.Error || len(downloads[0].errs) != 1 ||
+		downloads[0].attrs["goph.local_path"].AsString() != local+".missing" {
+		t.Errorf("unexpected download spans %+v", downloads)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+// Package gophprom exposes goph metrics as Prometheus collectors.
+//
+//	m := gophprom.New("myapp")
+//	prometheus.MustRegister(m)
+//	config.Metrics = m
+package gophprom
+
+import (
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a goph.Metrics implementation and a prometheus.Collector.
+type Collector struct {
+	connections    *prometheus.CounterVec
+	connectFailed  *prometheus.CounterVec
+	authFailed     *prometheus.CounterVec
+	sessionsActive *prometheus.GaugeVec
+	commands       *prometheus.HistogramVec
+	bytes          *prometheus.CounterVec
+}
+
+// New returns a collector with metric names prefixed by namespace.
+func New(namespace string) *Collector {
+
+	return &Collector{
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ssh",
+			Name:      "connections_opened_total",
+			Help:      "Number of ssh connections opened.",
+		}, []string{"host"}),
+
+		connectFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ssh",
+			Name:      "connections_failed_total",
+			Help:      "Number of failed ssh connection attempts.",
+		}, []string{"host"}),
+
+		authFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ssh",
+			Name:      "auth_failures_total",
+			Help:      "Number of ssh authentication failures.",
+		}, []string{"host"}),
+
+		sessionsActive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "ssh",
+			Name:      "sessions_active",
+			Help:      "Number of open ssh sessions.",
+		}, []string{"host"}),
+
+		commands: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "ssh",
+			Name:      "command_duration_seconds",
+			Help:      "Duration of remote commands.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15),
+		}, []string{"host", "status"}),
+
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ssh",
+			Name:      "transfer_bytes_total",
+			Help:      "Number of bytes transferred.",
+		}, []string{"host", "direction"}),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.connections,
+		c.connectFailed,
+		c.authFailed,
+		c.sessionsActive,
+		c.commands,
+		c.bytes,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.collectors() {
+		m.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.collectors() {
+		m.Collect(ch)
+	}
+}
+
+// ConnectionOpened implements goph.Metrics.
+func (c *Collector) ConnectionOpened(host string) {
+	c.connections.WithLabelValues(host).Inc()
+}
+
+// ConnectionFailed implements goph.Metrics.
+func (c *Collector) ConnectionFailed(host string, err error) {
+	c.connectFailed.WithLabelValues(host).Inc()
+}
+
+// AuthFailed implements goph.Metrics.
+func (c *Collector) AuthFailed(host string) {
+	c.authFailed.WithLabelValues(host).Inc()
+}
+
+// SessionStarted implements goph.Metrics.
+func (c *Collector) SessionStarted(host string) {
+	c.sessionsActive.WithLabelValues(host).Inc()
+}
+
+// SessionEnded implements goph.Metrics.
+func (c *Collector) SessionEnded(host string) {
+	c.sessionsActive.WithLabelValues(host).Dec()
+}
+
+// CommandDuration implements goph.Metrics.
+func (c *Collector) CommandDuration(host string, d time.Duration, err error) {
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	c.commands.WithLabelValues(host, status).Observe(d.Seconds())
+}
+
+// BytesTransferred implements goph.Metrics.
+func (c *Collector) BytesTransferred(host string, direction string, n int64) {
+	c.bytes.WithLabelValues(host, direction).Add(float64(n))
+}
+
+var _ goph.Metrics = (*Collector)(nil)
@@ -0,0 +1,100 @@
+package gophprom_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophprom"
+	"github.com/babbage88/goph/v2/gophtest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gather returns the values of the metrics of reg by name, summed over
+// their labels.
+func gather(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			values[f.GetName()] += m.GetCounter().GetValue() + m.GetGauge().GetValue() + float64(m.GetHistogram().GetSampleCount())
+		}
+	}
+
+	return values
+}
+
+func TestCollector(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("true", func(e *gophtest.Exec) int { return 0 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	m := gophprom.New("test")
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(m); err != nil {
+		t.Fatal(err)
+	}
+
+	config := srv.Config("alice", "wrong")
+	config.Metrics = m
+
+	if _, err := goph.NewConn(config); err == nil {
+		t.Fatal("the connection should fail")
+	}
+
+	config = srv.Config("alice", "secret")
+	config.Metrics = m
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err = client.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+
+	local := filepath.Join(t.TempDir(), "data")
+	if err = os.WriteFile(local, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Upload(local, "/data"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sessions closed by the server are reported asynchronously.
+	var values map[string]float64
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if values = gather(t, reg); values["test_ssh_sessions_active"] == 0 {
+			break
+		}
+	}
+
+	want := map[string]float64{
+		"test_ssh_connections_opened_total": 1,
+		"test_ssh_connections_failed_total": 1,
+		"test_ssh_auth_failures_total":      1,
+		"test_ssh_sessions_active":          0,
+		"test_ssh_command_duration_seconds": 1,
+		"test_ssh_transfer_bytes_total":     5,
+	}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("%s: expected %v, got %v", name, v, values[name])
+		}
+	}
+}
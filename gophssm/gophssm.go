@@ -0,0 +1,151 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+// Package gophssm connects goph clients to EC2 instances through AWS Systems
+// Manager Session Manager, so instances need no public ssh port. The session
+// is started with the aws cli and its session-manager-plugin, which must be
+// installed, using the AWS-StartSSHSession document like an OpenSSH
+// ProxyCommand:
+//
+//	config.Addr = "i-0123456789abcdef0"
+//	config.Dialer = &gophssm.Dialer{Region: "eu-west-1"}
+//	client, err := goph.NewConn(config)
+package gophssm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+)
+
+// DefaultDocument is the SSM document starting ssh sessions.
+const DefaultDocument = "AWS-StartSSHSession"
+
+// Dialer is a goph.Dialer tunneling connections through SSM sessions.
+// The host of the dialed address is the instance ID.
+type Dialer struct {
+
+	// Region and Profile select the AWS region and cli profile, empty
+	// values use the cli defaults.
+	Region  string
+	Profile string
+
+	// Document is the SSM document, DefaultDocument if empty.
+	Document string
+
+	// AWS is the aws cli executable, "aws" from PATH if empty.
+	AWS string
+
+	// Stderr, if set, receives the cli and plugin diagnostics.
+	Stderr io.Writer
+}
+
+var _ goph.Dialer = (*Dialer)(nil)
+
+// DialContext starts an SSM session to the instance and port of addr.
+// ctx only bounds the start of the session.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	target, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	document := d.Document
+	if document == "" {
+		document = DefaultDocument
+	}
+
+	args := []string{
+		"ssm", "start-session",
+		"--target", target,
+		"--document-name", document,
+		"--parameters", "portNumber=" + port,
+	}
+	if d.Region != "" {
+		args = append(args, "--region", d.Region)
+	}
+	if d.Profile != "" {
+		args = append(args, "--profile", d.Profile)
+	}
+
+	aws := d.AWS
+	if aws == "" {
+		aws = "aws"
+	}
+
+	cmd := exec.Command(aws, args...)
+	cmd.Stderr = d.Stderr
+
+	c := &conn{cmd: cmd, addr: sessionAddr(addr)}
+
+	if c.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if c.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ssm start-session: %w", err)
+	}
+
+	return c, nil
+}
+
+// sessionAddr is the address of an SSM session.
+type sessionAddr string
+
+func (a sessionAddr) Network() string { return "ssm" }
+func (a sessionAddr) String() string  { return string(a) }
+
+// conn is the ssh stream of an SSM session, carried by the stdin and
+// stdout of the aws cli.
+type conn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	addr   net.Addr
+
+	once sync.Once
+	err  error
+}
+
+func (c *conn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *conn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Close ends the session and waits for the cli to exit.
+func (c *conn) Close() error {
+
+	c.once.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+
+		// a killed cli is the expected way to end the session.
+		var exitErr *exec.ExitError
+		if err := c.cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+			c.err = err
+		}
+	})
+
+	return c.err
+}
+
+func (c *conn) LocalAddr() net.Addr  { return sessionAddr("local") }
+func (c *conn) RemoteAddr() net.Addr { return c.addr }
+
+// Deadlines are not supported by the cli pipes.
+func (c *conn) SetDeadline(t time.Time) error      { return errors.ErrUnsupported }
+func (c *conn) SetReadDeadline(t time.Time) error  { return errors.ErrUnsupported }
+func (c *conn) SetWriteDeadline(t time.Time) error { return errors.ErrUnsupported }
@@ -0,0 +1,72 @@
+package gophssm_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophssm"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// TestMain runs the test binary as a fake aws cli when GOPHSSM_FAKE_AWS is
+// set, bridging its stdio to 127.0.0.1 on the requested port.
+func TestMain(m *testing.M) {
+
+	if os.Getenv("GOPHSSM_FAKE_AWS") == "" {
+		os.Exit(m.Run())
+	}
+
+	var port string
+	for i, arg := range os.Args {
+		if arg == "--parameters" && i+1 < len(os.Args) {
+			port = os.Args[i+1][len("portNumber="):]
+		}
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		os.Exit(2)
+	}
+
+	go io.Copy(conn, os.Stdin)
+	io.Copy(os.Stdout, conn)
+	os.Exit(0)
+}
+
+func TestDialer(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("ec2-user", "secret")
+	srv.HandleFunc("hostname", func(e *gophtest.Exec) int {
+		io.WriteString(e.Stdout, "ip-10-0-0-1")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	t.Setenv("GOPHSSM_FAKE_AWS", "1")
+
+	config := srv.Config("ec2-user", "secret")
+	config.Addr = "i-0123456789abcdef0"
+	config.Dialer = &gophssm.Dialer{AWS: os.Args[0], Region: "eu-west-1"}
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	out, err := client.Run("hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "ip-10-0-0-1" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package gophtest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var _ Transferer = (*FakeFS)(nil)
+
+// Transferer is the context aware transfer API implemented by FakeFS.
+type Transferer interface {
+	Upload(localPath, remotePath string) error
+	Download(remotePath, localPath string) error
+	UploadContext(ctx context.Context, localPath, remotePath string) error
+	DownloadContext(ctx context.Context, remotePath, localPath string) error
+}
+
+// FakeFS is an in-memory remote filesystem with the transfer API of
+// goph.Client, to unit test file handling code without any server.
+// Remote paths are slash separated, directories exist implicitly.
+type FakeFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewFakeFS returns an empty fake filesystem.
+func NewFakeFS() *FakeFS {
+	return &FakeFS{files: make(map[string][]byte)}
+}
+
+// WriteFile sets the content of the remote file name.
+func (f *FakeFS) WriteFile(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[path.Clean(name)] = append([]byte(nil), data...)
+}
+
+// ReadFile returns the content of the remote file name.
+func (f *FakeFS) ReadFile(name string) ([]byte, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, ok := f.files[path.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+// Remove removes the remote file name, or the files under it.
+func (f *FakeFS) Remove(name string) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, p := range f.under(path.Clean(name)) {
+		delete(f.files, p)
+	}
+}
+
+// Files returns the sorted paths of the remote files.
+func (f *FakeFS) Files() []string {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paths := make([]string, 0, len(f.files))
+	for p := range f.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+func (f *FakeFS) Upload(localPath, remotePath string) error {
+	return f.UploadContext(context.Background(), localPath, remotePath)
+}
+
+func (f *FakeFS) Download(remotePath, localPath string) error {
+	return f.DownloadContext(context.Background(), remotePath, localPath)
+}
+
+// UploadContext copies the local file or directory to remotePath.
+func (f *FakeFS) UploadContext(ctx context.Context, localPath, remotePath string) error {
+
+	files, err := readFiles(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat source path: %w", err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for rel, data := range files {
+		f.files[path.Join(remotePath, filepath.ToSlash(rel))] = data
+	}
+
+	return nil
+}
+
+// DownloadContext copies the remote file or directory to localPath.
+func (f *FakeFS) DownloadContext(ctx context.Context, remotePath, localPath string) error {
+
+	f.mu.Lock()
+	remotePath = path.Clean(remotePath)
+	files := make(map[string][]byte)
+	for _, p := range f.under(remotePath) {
+		files[strings.TrimPrefix(strings.TrimPrefix(p, remotePath), "/")] = f.files[p]
+	}
+	f.mu.Unlock()
+
+	if len(files) == 0 {
+		return fmt.Errorf("failed to stat remote path: %w", &fs.PathError{Op: "stat", Path: remotePath, Err: fs.ErrNotExist})
+	}
+
+	for rel, data := range files {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		dst := filepath.Join(localPath, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("failed to create local directories: %w", err)
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return fmt.Errorf("failed to create local file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// under returns the file name, or the files under the directory name.
+func (f *FakeFS) under(name string) []string {
+
+	if _, ok := f.files[name]; ok {
+		return []string{name}
+	}
+
+	prefix := strings.TrimSuffix(name, "/") + "/"
+
+	var paths []string
+	for p := range f.files {
+		if strings.HasPrefix(p, prefix) {
+			paths = append(paths, p)
+		}
+	}
+
+	return paths
+}
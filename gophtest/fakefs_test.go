@@ -0,0 +1,54 @@
+package gophtest_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestFakeFS(t *testing.T) {
+
+	fake := gophtest.NewFakeFS()
+	fake.WriteFile("/etc/app/app.conf", []byte("port=80"))
+	fake.WriteFile("/etc/app/conf.d/tls.conf", []byte("tls=on"))
+
+	dir := t.TempDir()
+
+	if err := fake.Download("/etc/app", filepath.Join(dir, "app")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "app", "conf.d", "tls.conf"))
+	if err != nil || string(data) != "tls=on" {
+		t.Fatalf("unexpected download %q, %v", data, err)
+	}
+
+	if err = fake.Upload(filepath.Join(dir, "app"), "/backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err = fake.ReadFile("/backup/app.conf"); err != nil || string(data) != "port=80" {
+		t.Errorf("unexpected upload %q, %v", data, err)
+	}
+
+	fake.Remove("/etc/app")
+	if files := fake.Files(); len(files) != 2 {
+		t.Errorf("unexpected files after remove %q", files)
+	}
+
+	if err = fake.Download("/etc/app", dir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err = fake.UploadContext(ctx, filepath.Join(dir, "app"), "/x"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled upload, got %v", err)
+	}
+}
@@ -0,0 +1,698 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+// Package gophtest provides an in-process SSH and SFTP server for hermetic
+// tests of code using goph, no Docker or sshd needed.
+//
+//	srv := gophtest.NewServer()
+//	srv.AddUser("alice", "secret")
+//	srv.HandleFunc("uptime", func(e *gophtest.Exec) int {
+//		fmt.Fprintln(e.Stdout, "up 3 days")
+//		return 0
+//	})
+//	if err := srv.Start(); err != nil {
+//		...
+//	}
+//	defer srv.Close()
+//
+//	client, err := goph.NewConn(srv.Config("alice", "secret"))
+package gophtest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Exec is an exec request received by the server.
+type Exec struct {
+	User    string
+	Command string
+
+	// Env holds the variables set by the client before the command.
+	Env map[string]string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Agent is the agent forwarded by the client, nil unless the session
+	// requested agent forwarding.
+	Agent agent.ExtendedAgent
+
+	// Pty is the terminal requested by the session, nil without. Resize
+	// receives its window changes.
+	Pty    *Pty
+	Resize <-chan Window
+}
+
+// Pty is a pseudo terminal requested by a session.
+type Pty struct {
+	Term string
+	Window
+}
+
+// Window is the size of a terminal in characters.
+type Window struct {
+	Cols, Rows int
+}
+
+// Handler runs an exec request and returns the command exit status.
+type Handler func(e *Exec) int
+
+// Server is an in-process SSH server with password and public key auth,
+// command handlers and an sftp subsystem.
+type Server struct {
+
+	// HostKey of the server, an ed25519 key is generated by NewServer.
+	HostKey ssh.Signer
+
+	// Banner, if set, is sent to clients before authentication.
+	Banner string
+
+	// FS serves the sftp subsystem, NewServer sets an in-memory filesystem
+	// shared by every connection. A nil FS disables sftp.
+	FS sftp.Handlers
+
+	// Shell, if set, handles shell requests with an empty command, the
+	// server accepts pty requests but does not emulate a terminal.
+	Shell Handler
+
+	// UserCA, if set, accepts the user certificates it signed, like the
+	// sshd TrustedUserCAKeys.
+	UserCA ssh.PublicKey
+
+	// Forwarding allows direct-tcpip channels and tcpip-forward requests,
+	// so the server can be used as a jump host or to forward local and
+	// remote ports. Remote ports are forwarded from 127.0.0.1.
+	Forwarding bool
+
+	// SCP, if set, is the local directory served to the scp -t and -f
+	// commands without handler, remote paths are resolved under it. With
+	// a nil FS, the server is like a host without an sftp subsystem.
+	SCP string
+
+	// NotFound handles the commands without handler, by default it writes
+	// an error to stderr and exits with 127.
+	NotFound Handler
+
+	mu       sync.Mutex
+	users    map[string]string
+	keys     map[string][]ssh.PublicKey
+	handlers map[string]Handler
+	subs     map[string]func(io.ReadWriter)
+	commands []string
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer returns a server with a generated host key and an in-memory
+// filesystem, add users and handlers before calling Start.
+func NewServer() *Server {
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("gophtest: generate host key: %s", err))
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		panic(fmt.Sprintf("gophtest: host key signer: %s", err))
+	}
+
+	return &Server{
+		HostKey:  signer,
+		FS:       sftp.InMemHandler(),
+		users:    make(map[string]string),
+		keys:     make(map[string][]ssh.PublicKey),
+		handlers: make(map[string]Handler),
+		subs:     make(map[string]func(io.ReadWriter)),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// AddUser allows user to log in with password.
+func (s *Server) AddUser(user, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user] = password
+}
+
+// AddKey allows user to log in with the private key of key.
+func (s *Server) AddKey(user string, key ssh.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[user] = append(s.keys[user], key)
+}
+
+// HandleFunc registers the handler of the command line cmd, surrounding
+// spaces are ignored when matching commands.
+func (s *Server) HandleFunc(cmd string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[cmd] = h
+}
+
+// HandleSubsystem registers the handler of the subsystem name, the
+// subsystem ends when h returns. It overrides the sftp subsystem.
+func (s *Server) HandleSubsystem(name string, h func(rw io.ReadWriter)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[name] = h
+}
+
+// Commands returns the command lines executed so far, in order.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Start listens on a random local port and serves connections until Close.
+func (s *Server) Start() error {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the "host:port" address of a started server.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Config returns a goph config connecting to the server as user with
+// password, the server host key is pinned.
+func (s *Server) Config(user, password string) *goph.Config {
+
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.ParseUint(port, 10, 16)
+
+	return &goph.Config{
+		User:     user,
+		Addr:     host,
+		Port:     uint(p),
+		Auth:     goph.Password(password),
+		Callback: ssh.FixedHostKey(s.HostKey.PublicKey()),
+	}
+}
+
+// Close stops the server and closes every connection.
+func (s *Server) Close() error {
+
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+// serverConfig returns the ssh config checking the server users and keys.
+func (s *Server) serverConfig() *ssh.ServerConfig {
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if want, ok := s.users[meta.User()]; ok && want == string(password) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %q", meta.User())
+		},
+		PublicKeyCallback: s.publicKey,
+		// password users answer a single password prompt.
+		KeyboardInteractiveCallback: func(meta ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge(meta.User(), "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if want, ok := s.users[meta.User()]; ok && len(answers) == 1 && answers[0] == want {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("keyboard-interactive rejected for %q", meta.User())
+		},
+	}
+
+	if s.UserCA != nil {
+		checker := &ssh.CertChecker{
+			IsUserAuthority: func(auth ssh.PublicKey) bool {
+				return bytes.Equal(auth.Marshal(), s.UserCA.Marshal())
+			},
+			UserKeyFallback: s.publicKey,
+		}
+		config.PublicKeyCallback = checker.Authenticate
+	}
+
+	if s.Banner != "" {
+		config.BannerCallback = func(ssh.ConnMetadata) string {
+			return s.Banner
+		}
+	}
+
+	config.AddHostKey(s.HostKey)
+
+	return config
+}
+
+// serve runs a single client connection.
+func (s *Server) serve(conn net.Conn) {
+
+	defer conn.Close()
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.serverConfig())
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+
+	go s.globalRequests(sshConn, reqs)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for newChannel := range chans {
+
+		if newChannel.ChannelType() == "direct-tcpip" && s.Forwarding {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.directTCPIP(newChannel)
+			}()
+			continue
+		}
+
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.session(sshConn, channel, requests)
+		}()
+	}
+}
+
+// globalRequests serves the global requests of conn: keepalives, and
+// remote port forwards with Forwarding.
+func (s *Server) globalRequests(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+
+	listeners := make(map[string]net.Listener)
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	for req := range reqs {
+
+		var forward struct {
+			Addr string
+			Port uint32
+		}
+
+		switch {
+
+		// keepalives succeed, like openssh.
+		case req.Type == "keepalive@openssh.com":
+			req.Reply(true, nil)
+
+		case req.Type == "tcpip-forward" && s.Forwarding && ssh.Unmarshal(req.Payload, &forward) == nil:
+			l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(forward.Port))))
+			if err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			port := uint32(l.Addr().(*net.TCPAddr).Port)
+			listeners[net.JoinHostPort(forward.Addr, strconv.Itoa(int(port)))] = l
+			req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+			go s.forwardedTCPIP(conn, l, forward.Addr, port)
+
+		case req.Type == "cancel-tcpip-forward" && ssh.Unmarshal(req.Payload, &forward) == nil:
+			key := net.JoinHostPort(forward.Addr, strconv.Itoa(int(forward.Port)))
+			l, ok := listeners[key]
+			if ok {
+				l.Close()
+				delete(listeners, key)
+			}
+			req.Reply(ok, nil)
+
+		case req.WantReply:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// forwardedTCPIP opens a forwarded-tcpip channel to the client for every
+// connection accepted by l.
+func (s *Server) forwardedTCPIP(conn *ssh.ServerConn, l net.Listener, addr string, port uint32) {
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		origin := c.RemoteAddr().(*net.TCPAddr)
+		payload := ssh.Marshal(struct {
+			Addr       string
+			Port       uint32
+			OriginAddr string
+			OriginPort uint32
+		}{addr, port, origin.IP.String(), uint32(origin.Port)})
+
+		go func() {
+			defer c.Close()
+
+			channel, requests, err := conn.OpenChannel("forwarded-tcpip", payload)
+			if err != nil {
+				return
+			}
+			defer channel.Close()
+			go ssh.DiscardRequests(requests)
+
+			pipe(c.(*net.TCPConn), channel)
+		}()
+	}
+}
+
+// directTCPIP connects a direct-tcpip channel to the requested address.
+func (s *Server) directTCPIP(newChannel ssh.NewChannel) {
+
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	pipe(conn.(*net.TCPConn), channel)
+}
+
+// pipe copies data both ways between conn and channel, until both sides
+// are done.
+func pipe(conn *net.TCPConn, channel ssh.Channel) {
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(conn, channel)
+		conn.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		done <- struct{}{}
+	}()
+
+	<-done
+	<-done
+}
+
+// publicKey accepts the keys added for the user.
+func (s *Server) publicKey(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.keys[meta.User()] {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("public key rejected for %q", meta.User())
+}
+
+// session serves the requests of a session channel.
+func (s *Server) session(conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
+
+	defer channel.Close()
+
+	var (
+		user         = conn.User()
+		env          = make(map[string]string)
+		forwardAgent bool
+		pty          *Pty
+		resize       = make(chan Window, 16)
+	)
+
+	for req := range requests {
+		switch req.Type {
+
+		case "env":
+			var kv struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &kv); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			env[kv.Name] = kv.Value
+			req.Reply(true, nil)
+
+		case "exec":
+			var cmd struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &cmd); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+
+			go windowChanges(requests, resize)
+			e := &Exec{
+				User:    user,
+				Command: cmd.Command,
+				Env:     env,
+				Stdin:   channel,
+				Stdout:  channel,
+				Stderr:  channel.Stderr(),
+				Pty:     pty,
+				Resize:  resize,
+			}
+			if forwardAgent {
+				defer s.agent(conn, e)()
+			}
+			s.exec(e, channel)
+			return
+
+		case "shell":
+			if s.Shell == nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+
+			go windowChanges(requests, resize)
+			e := &Exec{
+				User:   user,
+				Env:    env,
+				Stdin:  channel,
+				Stdout: channel,
+				Stderr: channel.Stderr(),
+				Pty:    pty,
+				Resize: resize,
+			}
+			if forwardAgent {
+				defer s.agent(conn, e)()
+			}
+			s.exec(e, channel)
+			return
+
+		case "subsystem":
+			var sub struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &sub); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+
+			s.mu.Lock()
+			h, ok := s.subs[sub.Name]
+			s.mu.Unlock()
+
+			if ok {
+				req.Reply(true, nil)
+				go ssh.DiscardRequests(requests)
+				h(channel)
+				return
+			}
+
+			if sub.Name != "sftp" || s.FS.FileGet == nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+
+			go ssh.DiscardRequests(requests)
+			server := sftp.NewRequestServer(channel, s.FS)
+			server.Serve()
+			server.Close()
+			return
+
+		case "auth-agent-req@openssh.com":
+			forwardAgent = true
+			req.Reply(true, nil)
+
+		case "pty-req":
+			var p struct {
+				Term       string
+				Cols, Rows uint32
+				Rest       []byte `ssh:"rest"`
+			}
+			if err := ssh.Unmarshal(req.Payload, &p); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			pty = &Pty{Term: p.Term, Window: Window{Cols: int(p.Cols), Rows: int(p.Rows)}}
+			req.Reply(true, nil)
+
+		case "window-change", "signal":
+			req.Reply(true, nil)
+
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// windowChanges sends the window changes of requests to resize, and
+// discards the other requests.
+func windowChanges(requests <-chan *ssh.Request, resize chan<- Window) {
+
+	for req := range requests {
+
+		var w struct {
+			Cols, Rows uint32
+			Rest       []byte `ssh:"rest"`
+		}
+		if req.Type == "window-change" && ssh.Unmarshal(req.Payload, &w) == nil {
+			select {
+			case resize <- Window{Cols: int(w.Cols), Rows: int(w.Rows)}:
+			default:
+			}
+		}
+
+		if req.WantReply {
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// agent opens an agent channel to the client for e, and returns the
+// function closing it.
+func (s *Server) agent(conn *ssh.ServerConn, e *Exec) func() {
+
+	channel, requests, err := conn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		return func() {}
+	}
+	go ssh.DiscardRequests(requests)
+
+	e.Agent = agent.NewClient(channel)
+	return func() { channel.Close() }
+}
+
+// exec runs the handler of e and sends its exit status.
+func (s *Server) exec(e *Exec, channel ssh.Channel) {
+
+	s.mu.Lock()
+	h, ok := s.Shell, true
+	if e.Command != "" {
+		s.commands = append(s.commands, e.Command)
+		h, ok = s.handlers[strings.TrimSpace(e.Command)]
+	}
+	s.mu.Unlock()
+
+	if !ok && s.SCP != "" && strings.HasPrefix(e.Command, "scp ") {
+		h, ok = s.scp, true
+	}
+	if !ok {
+		h = s.NotFound
+	}
+	if h == nil {
+		h = notFound
+	}
+
+	status := make([]byte, 4)
+	binary.BigEndian.PutUint32(status, uint32(h(e)))
+
+	channel.SendRequest("exit-status", false, status)
+}
+
+func notFound(e *Exec) int {
+	fmt.Fprintf(e.Stderr, "%s: command not found\n", e.Command)
+	return 127
+}
@@ -0,0 +1,166 @@
+package gophtest_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func newServer(t *testing.T) *gophtest.Server {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	return srv
+}
+
+func connect(t *testing.T, config *goph.Config) *goph.Client {
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestRun(t *testing.T) {
+
+	srv := newServer(t)
+	srv.HandleFunc("greet", func(e *gophtest.Exec) int {
+		fmt.Fprintf(e.Stdout, "hello %s from %s", e.User, e.Env["LANG"])
+		return 0
+	})
+
+	client := connect(t, srv.Config("alice", "secret"))
+
+	cmd, err := client.Command("greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Env = []string{"LANG=C"}
+
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "hello alice from C" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	_, err = client.Run("missing")
+
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 127 {
+		t.Errorf("expected exit status 127, got %v", err)
+	}
+
+	if cmds := srv.Commands(); len(cmds) != 2 || cmds[0] != "greet" || cmds[1] != "missing" {
+		t.Errorf("unexpected commands %q", cmds)
+	}
+}
+
+func TestAuth(t *testing.T) {
+
+	srv := newServer(t)
+
+	if _, err := goph.NewConn(srv.Config("alice", "wrong")); !errors.Is(err, goph.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.AddKey("bob", signer.PublicKey())
+
+	config := srv.Config("bob", "")
+	config.Auth = goph.Auth{ssh.PublicKeys(signer)}
+
+	connect(t, config)
+}
+
+func TestTransfer(t *testing.T) {
+
+	srv := newServer(t)
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	enc, err := goph.AESGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := srv.Config("alice", "secret")
+	config.Transforms = []goph.Transform{enc}
+
+	client := connect(t, config)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	data := bytes.Repeat([]byte("goph "), 100000)
+
+	if err = os.WriteFile(src, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = client.Upload(src, "/data.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the remote file is encrypted.
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	f, err := ftp.Open("/data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(remote, []byte("goph goph")) {
+		t.Error("the remote file should be encrypted")
+	}
+
+	dst := filepath.Join(dir, "dst.txt")
+	if err = client.Download("/data.txt", dst); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Error("the downloaded file differs from the uploaded one")
+	}
+}
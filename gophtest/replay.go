@@ -0,0 +1,333 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package gophtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/babbage88/goph/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+// Client is the part of *goph.Client recorded and replayed.
+type Client interface {
+	goph.Runner
+	goph.Transferer
+}
+
+var (
+	_ Client = (*goph.Client)(nil)
+	_ Client = (*Recorder)(nil)
+	_ Client = (*Replayer)(nil)
+)
+
+// ErrReplayMismatch is returned when a replayed call differs from the
+// recorded one.
+var ErrReplayMismatch = errors.New("gophtest: replay mismatch")
+
+// Interaction is a single recorded call.
+type Interaction struct {
+
+	// Op is "run", "upload" or "download".
+	Op string `json:"op"`
+
+	Command    string `json:"command,omitempty"`
+	LocalPath  string `json:"local_path,omitempty"`
+	RemotePath string `json:"remote_path,omitempty"`
+
+	Output []byte `json:"output,omitempty"`
+
+	// Files holds the transferred file contents by path relative to the
+	// transferred directory, a single file has the "." path.
+	Files map[string][]byte `json:"files,omitempty"`
+
+	Err        string `json:"error,omitempty"`
+	ExitStatus int    `json:"exit_status,omitempty"`
+}
+
+// Cassette holds the recorded interactions in order.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette reads a cassette saved with Recorder.Save.
+func LoadCassette(path string) (*Cassette, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("gophtest: invalid cassette %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Recorder is a Client recording the calls made through it to a real
+// client. Commands are recorded as is, do not commit cassettes of commands
+// holding secrets.
+type Recorder struct {
+	client Client
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a recorder of the calls to client.
+func NewRecorder(client Client) *Recorder {
+	return &Recorder{client: client}
+}
+
+func (r *Recorder) Run(cmd string) ([]byte, error) {
+	out, err := r.client.Run(cmd)
+	r.record(Interaction{Op: "run", Command: cmd, Output: out}, err)
+	return out, err
+}
+
+func (r *Recorder) RunContext(ctx context.Context, cmd string) ([]byte, error) {
+	out, err := r.client.RunContext(ctx, cmd)
+	r.record(Interaction{Op: "run", Command: cmd, Output: out}, err)
+	return out, err
+}
+
+func (r *Recorder) Upload(localPath, remotePath string) error {
+
+	i := Interaction{Op: "upload", LocalPath: localPath, RemotePath: remotePath}
+
+	err := r.client.Upload(localPath, remotePath)
+	if err == nil {
+		i.Files, err = readFiles(localPath)
+	}
+
+	r.record(i, err)
+	return err
+}
+
+func (r *Recorder) Download(remotePath, localPath string) error {
+
+	i := Interaction{Op: "download", LocalPath: localPath, RemotePath: remotePath}
+
+	err := r.client.Download(remotePath, localPath)
+	if err == nil {
+		i.Files, err = readFiles(localPath)
+	}
+
+	r.record(i, err)
+	return err
+}
+
+func (r *Recorder) record(i Interaction, err error) {
+
+	if err != nil {
+		i.Err = err.Error()
+
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			i.ExitStatus = exitErr.ExitStatus()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+}
+
+// Cassette returns a copy of the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Save writes the recorded interactions to path as JSON.
+func (r *Recorder) Save(path string) error {
+
+	data, err := json.MarshalIndent(r.Cassette(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// Replayer is a Client replaying a cassette without any server. Calls must
+// be made in the recorded order, with the recorded commands and paths.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	next     int
+}
+
+// NewReplayer returns a replayer of the cassette.
+func NewReplayer(c *Cassette) *Replayer {
+	return &Replayer{cassette: c}
+}
+
+func (r *Replayer) Run(cmd string) ([]byte, error) {
+	return r.RunContext(context.Background(), cmd)
+}
+
+func (r *Replayer) RunContext(ctx context.Context, cmd string) ([]byte, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i, err := r.take(Interaction{Op: "run", Command: cmd})
+	if err != nil {
+		return nil, err
+	}
+
+	return i.Output, i.err()
+}
+
+func (r *Replayer) Upload(localPath, remotePath string) error {
+
+	i, err := r.take(Interaction{Op: "upload", LocalPath: localPath, RemotePath: remotePath})
+	if err != nil {
+		return err
+	}
+
+	if i.Err != "" {
+		return i.err()
+	}
+
+	files, err := readFiles(localPath)
+	if err != nil {
+		return err
+	}
+
+	for path, data := range i.Files {
+		if !bytes.Equal(files[path], data) {
+			return fmt.Errorf("%w: upload of %s differs from the recorded one", ErrReplayMismatch, filepath.Join(localPath, path))
+		}
+	}
+
+	return nil
+}
+
+func (r *Replayer) Download(remotePath, localPath string) error {
+
+	i, err := r.take(Interaction{Op: "download", LocalPath: localPath, RemotePath: remotePath})
+	if err != nil {
+		return err
+	}
+
+	if i.Err != "" {
+		return i.err()
+	}
+
+	for path, data := range i.Files {
+		dst := filepath.Join(localPath, path)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Done returns an error if some recorded interactions were not replayed.
+func (r *Replayer) Done() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if left := len(r.cassette.Interactions) - r.next; left > 0 {
+		return fmt.Errorf("%w: %d interactions not replayed", ErrReplayMismatch, left)
+	}
+
+	return nil
+}
+
+// take returns the next interaction if it matches want.
+func (r *Replayer) take(want Interaction) (Interaction, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.cassette.Interactions) {
+		return Interaction{}, fmt.Errorf("%w: unexpected %s %s", ErrReplayMismatch, want.Op, want.describe())
+	}
+
+	i := r.cassette.Interactions[r.next]
+	if i.Op != want.Op || i.Command != want.Command || i.LocalPath != want.LocalPath || i.RemotePath != want.RemotePath {
+		return Interaction{}, fmt.Errorf("%w: got %s %s, recorded %s %s", ErrReplayMismatch, want.Op, want.describe(), i.Op, i.describe())
+	}
+
+	r.next++
+
+	return i, nil
+}
+
+func (i Interaction) describe() string {
+	if i.Op == "run" {
+		return fmt.Sprintf("%q", i.Command)
+	}
+	return fmt.Sprintf("%s -> %s", i.LocalPath, i.RemotePath)
+}
+
+// err returns the recorded error.
+func (i Interaction) err() error {
+
+	switch {
+	case i.Err == "":
+		return nil
+	case i.ExitStatus != 0:
+		return &ReplayExitError{Msg: i.Err, Status: i.ExitStatus}
+	}
+
+	return errors.New(i.Err)
+}
+
+// ReplayExitError is the replayed error of a remote command that exited
+// with a non-zero status, it stands for *ssh.ExitError which can not be
+// created outside of the ssh package.
+type ReplayExitError struct {
+	Msg    string
+	Status int
+}
+
+func (e *ReplayExitError) Error() string   { return e.Msg }
+func (e *ReplayExitError) ExitStatus() int { return e.Status }
+
+// readFiles returns the contents of the file, or of the files under the
+// directory at path.
+func readFiles(path string) (map[string][]byte, error) {
+
+	files := make(map[string][]byte)
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+
+		files[rel], err = os.ReadFile(p)
+		return err
+	})
+
+	return files, err
+}
@@ -0,0 +1,87 @@
+package gophtest_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestRecordReplay(t *testing.T) {
+
+	srv := newServer(t)
+	srv.HandleFunc("hostname", func(e *gophtest.Exec) int {
+		fmt.Fprint(e.Stdout, "web-1")
+		return 0
+	})
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(local, []byte("port=80"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cassette := filepath.Join(dir, "cassette.json")
+
+	// record against the server.
+	rec := gophtest.NewRecorder(connect(t, srv.Config("alice", "secret")))
+
+	if _, err := rec.Run("hostname"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.Run("reboot"); err == nil {
+		t.Fatal("unknown commands should fail")
+	}
+	if err := rec.Upload(local, "/app.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Download("/app.conf", filepath.Join(dir, "copy.conf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(cassette); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Close()
+
+	// replay without server.
+	c, err := gophtest.LoadCassette(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := gophtest.NewReplayer(c)
+
+	out, err := rep.Run("hostname")
+	if err != nil || string(out) != "web-1" {
+		t.Errorf("unexpected replay %q, %v", out, err)
+	}
+
+	_, err = rep.Run("reboot")
+	var exitErr *gophtest.ReplayExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 127 {
+		t.Errorf("expected the recorded exit status, got %v", err)
+	}
+
+	if err = rep.Upload(local, "/app.conf"); err != nil {
+		t.Error(err)
+	}
+
+	os.Remove(filepath.Join(dir, "copy.conf"))
+	if err = rep.Download("/app.conf", filepath.Join(dir, "copy.conf")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "copy.conf")); string(data) != "port=80" {
+		t.Errorf("unexpected downloaded data %q", data)
+	}
+
+	if err = rep.Done(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = rep.Run("uptime"); !errors.Is(err, gophtest.ErrReplayMismatch) {
+		t.Errorf("expected a mismatch, got %v", err)
+	}
+}
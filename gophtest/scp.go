@@ -0,0 +1,282 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package gophtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scp serves the scp -t and -f commands from the SCP directory, like the
+// scp of openssh started by sshd.
+func (s *Server) scp(e *Exec) int {
+
+	var (
+		sink, source, preserve bool
+		target                 string
+	)
+
+	words := shellWords(e.Command)
+	for i, w := range words[1:] {
+		switch w {
+		case "-t":
+			sink = true
+		case "-f":
+			source = true
+		case "-p":
+			preserve = true
+		case "-r", "-d", "-v":
+		case "--":
+			if rest := words[i+2:]; len(rest) == 1 {
+				target = rest[0]
+			}
+		}
+		if w == "--" {
+			break
+		}
+	}
+
+	if target == "" || sink == source {
+		fmt.Fprintln(e.Stderr, "usage: scp [-p] [-r] -t|-f -- path")
+		return 1
+	}
+
+	local := filepath.Join(s.SCP, filepath.FromSlash(target))
+
+	if sink {
+		return scpSink(e, local, preserve)
+	}
+	return scpSource(e, local, preserve)
+}
+
+// scpSink receives the files sent by the client into target.
+func scpSink(e *Exec, target string, preserve bool) int {
+
+	var (
+		r      = bufio.NewReader(e.Stdin)
+		status = 0
+		dirs   []string
+		mtime  time.Time
+	)
+
+	ok := func() { e.Stdout.Write([]byte{0}) }
+	fail := func(err error) {
+		fmt.Fprintf(e.Stdout, "\x01scp: %s\n", err)
+		status = 1
+	}
+
+	ok()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return status
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch line[0] {
+
+		case 'T':
+			var sec int64
+			fmt.Sscanf(line, "T%d", &sec)
+			mtime = time.Unix(sec, 0)
+			ok()
+
+		case 'E':
+			if len(dirs) == 0 {
+				fmt.Fprintf(e.Stdout, "\x02scp: protocol error\n")
+				return 1
+			}
+			if preserve && !mtime.IsZero() {
+				os.Chtimes(dirs[len(dirs)-1], mtime, mtime)
+			}
+			dirs = dirs[:len(dirs)-1]
+			ok()
+
+		case 'C', 'D':
+			fields := strings.SplitN(line[1:], " ", 3)
+			if len(fields) != 3 {
+				fmt.Fprintf(e.Stdout, "\x02scp: protocol error\n")
+				return 1
+			}
+			mode, _ := strconv.ParseUint(fields[0], 8, 32)
+			size, _ := strconv.ParseInt(fields[1], 10, 64)
+
+			dest := target
+			if len(dirs) > 0 {
+				dest = filepath.Join(dirs[len(dirs)-1], fields[2])
+			} else if info, err := os.Stat(target); err == nil && info.IsDir() {
+				dest = filepath.Join(target, fields[2])
+			}
+
+			if line[0] == 'D' {
+				if err := os.Mkdir(dest, os.FileMode(mode)); err != nil && !os.IsExist(err) {
+					fmt.Fprintf(e.Stdout, "\x02scp: %s\n", err)
+					return 1
+				}
+				dirs = append(dirs, dest)
+				ok()
+				continue
+			}
+
+			f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(mode))
+			if err != nil {
+				fail(err)
+				continue
+			}
+			ok()
+
+			_, err = io.CopyN(f, r, size)
+			f.Close()
+			if err != nil {
+				return 1
+			}
+			r.ReadByte()
+
+			if preserve && !mtime.IsZero() {
+				os.Chmod(dest, os.FileMode(mode))
+				os.Chtimes(dest, mtime, mtime)
+			}
+			mtime = time.Time{}
+			ok()
+
+		default:
+			fmt.Fprintf(e.Stdout, "\x02scp: protocol error\n")
+			return 1
+		}
+	}
+}
+
+// scpSource sends the file or directory src to the client.
+func scpSource(e *Exec, src string, preserve bool) int {
+
+	var (
+		r      = bufio.NewReader(e.Stdin)
+		status = 0
+	)
+
+	// ack reads the response of the client, false when it refused.
+	ack := func() (bool, error) {
+		b, err := r.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		if b != 0 {
+			r.ReadString('\n')
+			status = 1
+		}
+		return b == 0, nil
+	}
+
+	var send func(p string) error
+	send = func(p string) error {
+
+		info, err := os.Stat(p)
+		if err != nil {
+			fmt.Fprintf(e.Stdout, "\x01scp: %s: No such file or directory\n", filepath.Base(p))
+			status = 1
+			return nil
+		}
+
+		if preserve {
+			fmt.Fprintf(e.Stdout, "T%d 0 %d 0\n", info.ModTime().Unix(), info.ModTime().Unix())
+			if _, err := ack(); err != nil {
+				return err
+			}
+		}
+
+		if info.IsDir() {
+			fmt.Fprintf(e.Stdout, "D%04o 0 %s\n", info.Mode().Perm(), info.Name())
+			if _, err := ack(); err != nil {
+				return err
+			}
+			entries, _ := os.ReadDir(p)
+			for _, entry := range entries {
+				if err := send(filepath.Join(p, entry.Name())); err != nil {
+					return err
+				}
+			}
+			fmt.Fprint(e.Stdout, "E\n")
+			_, err := ack()
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			fmt.Fprintf(e.Stdout, "\x01scp: %s: %s\n", filepath.Base(p), err)
+			status = 1
+			return nil
+		}
+		defer f.Close()
+
+		fmt.Fprintf(e.Stdout, "C%04o %d %s\n", info.Mode().Perm(), info.Size(), info.Name())
+		if ok, err := ack(); !ok {
+			return err
+		}
+
+		io.Copy(e.Stdout, f)
+		e.Stdout.Write([]byte{0})
+		_, err = ack()
+		return err
+	}
+
+	if _, err := ack(); err != nil {
+		return 1
+	}
+	if err := send(src); err != nil {
+		return 1
+	}
+
+	return status
+}
+
+// shellWords splits a command line quoted for a POSIX shell into words.
+func shellWords(cmd string) []string {
+
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+		quoted bool
+	)
+
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case quoted:
+			if c == '\'' {
+				quoted = false
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\'':
+			quoted, inWord = true, true
+		case c == '\\' && i+1 < len(cmd):
+			i++
+			word.WriteByte(cmd[i])
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words
+}
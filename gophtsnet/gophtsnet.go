@@ -0,0 +1,52 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+//go:build tsnet
+
+// Package gophtsnet dials goph connections over a tailnet with an embedded
+// tsnet.Server, without a local tailscaled. It is built with the tsnet tag
+// so the tailscale module is only required by programs using it:
+//
+//	go get tailscale.com
+//	go build -tags tsnet
+//
+// Usage:
+//
+//	srv := &tsnet.Server{Hostname: "deployer", AuthKey: os.Getenv("TS_AUTHKEY"), Ephemeral: true}
+//	defer srv.Close()
+//
+//	config.Dialer = gophtsnet.New(srv)
+//	client, err := goph.NewConn(config)
+package gophtsnet
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/babbage88/goph/v2"
+	"tailscale.com/tsnet"
+)
+
+// Dialer is a goph.Dialer connecting through a tsnet.Server.
+type Dialer struct {
+	Server *tsnet.Server
+}
+
+var _ goph.Dialer = (*Dialer)(nil)
+
+// New returns a dialer connecting through srv.
+func New(srv *tsnet.Server) *Dialer {
+	return &Dialer{Server: srv}
+}
+
+// DialContext brings the tsnet server up if needed and dials addr on the
+// tailnet. addr may use a MagicDNS name or a tailnet IP.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	if _, err := d.Server.Up(ctx); err != nil {
+		return nil, fmt.Errorf("tsnet up: %w", err)
+	}
+
+	return d.Server.Dial(ctx, network, addr)
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultGroupConcurrency is the number of hosts a group works on at once
+// when Group.Concurrency is not set.
+var DefaultGroupConcurrency = 10
+
+// Group is a named set of host configs that fleet operations run against.
+type Group struct {
+	Name    string
+	Configs []*Config
+
+	// Concurrency bounds the number of hosts worked on at once.
+	Concurrency int
+
+	// Breaker, if set, skips hosts that keep failing with ErrCircuitOpen.
+	Breaker *CircuitBreaker
+
+	// pool, if set, keeps the connections open between operations.
+	pool *Pool
+}
+
+// HostResult is the outcome of a group operation on a single host.
+type HostResult struct {
+	// Index of the host config in the group.
+	Index    int
+	Config   *Config
+	Output   []byte
+	Err      error
+	Duration time.Duration
+}
+
+// NewGroup returns a new group with the given name and configs.
+func NewGroup(name string, configs ...*Config) *Group {
+	return &Group{
+		Name:    name,
+		Configs: configs,
+	}
+}
+
+// Add appends configs to the group.
+func (g *Group) Add(configs ...*Config) {
+	g.Configs = append(g.Configs, configs...)
+}
+
+// Len returns the number of hosts in the group.
+func (g *Group) Len() int {
+	return len(g.Configs)
+}
+
+// Run runs cmd on every host and blocks until all hosts are done, results
+// are returned in the same order as the group configs.
+func (g *Group) Run(ctx context.Context, cmd string) []HostResult {
+
+	results := make([]HostResult, len(g.Configs))
+	for r := range g.Stream(ctx, cmd) {
+		results[r.Index] = r
+	}
+
+	return results
+}
+
+// Stream runs cmd on every host and returns a channel that receives each
+// host result as soon as the host completes. The channel is closed once
+// every host is done.
+func (g *Group) Stream(ctx context.Context, cmd string) <-chan HostResult {
+	return g.stream(ctx, func(ctx context.Context, c *Client) ([]byte, error) {
+		return c.RunContext(ctx, cmd)
+	})
+}
+
+// Upload uploads the local file or directory to remotePath on every host,
+// see Client.UploadContext, and blocks until all hosts are done.
+func (g *Group) Upload(ctx context.Context, localPath, remotePath string) []HostResult {
+	return g.Each(ctx, func(ctx context.Context, c *Client) error {
+		return c.UploadContext(ctx, localPath, remotePath, nil)
+	})
+}
+
+// Each calls fn with a connected client for every host and blocks until all
+// hosts are done. Unlike Batch, a failing host does not stop the others.
+func (g *Group) Each(ctx context.Context, fn func(context.Context, *Client) error) []HostResult {
+
+	results := make([]HostResult, len(g.Configs))
+	for r := range g.stream(ctx, func(ctx context.Context, c *Client) ([]byte, error) {
+		return nil, fn(ctx, c)
+	}) {
+		results[r.Index] = r
+	}
+
+	return results
+}
+
+// Batch calls fn with a connected client for every host, with errgroup
+// semantics: the first failing host cancels the context of every other host,
+// which closes their connections and aborts in-flight sessions and transfers.
+// Canceling the parent ctx does the same. Batch returns the first error.
+func (g *Group) Batch(ctx context.Context, fn func(context.Context, *Client) error) error {
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(g.limit())
+
+	for _, config := range g.Configs {
+		eg.Go(func() error {
+			_, err := g.do(ctx, config, func(ctx context.Context, c *Client) ([]byte, error) {
+				return nil, fn(ctx, c)
+			})
+			// errors of client operations already name the host.
+			var opErr *OpError
+			if err != nil && !errors.As(err, &opErr) {
+				return fmt.Errorf("%s: %w", config.hostPort(), err)
+			}
+			return err
+		})
+	}
+
+	return eg.Wait()
+}
+
+func (g *Group) limit() int {
+	if g.Concurrency <= 0 {
+		return DefaultGroupConcurrency
+	}
+	return g.Concurrency
+}
+
+// stream connects to every host with bounded concurrency, calls fn with the
+// connected client and sends the results to the returned channel.
+func (g *Group) stream(ctx context.Context, fn func(context.Context, *Client) ([]byte, error)) <-chan HostResult {
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, g.limit())
+		results = make(chan HostResult, len(g.Configs))
+	)
+
+	for i, config := range g.Configs {
+
+		wg.Add(1)
+		go func(i int, config *Config) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results <- HostResult{Index: i, Config: config, Err: ctx.Err()}
+				return
+			}
+
+			start := time.Now()
+			output, err := g.do(ctx, config, fn)
+
+			results <- HostResult{
+				Index:    i,
+				Config:   config,
+				Output:   output,
+				Err:      err,
+				Duration: time.Since(start),
+			}
+		}(i, config)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// do runs fn against a fresh connection to the host, or the one of the
+// pool, the connection is closed as soon as ctx is done so remote work
+// stops immediately.
+func (g *Group) do(ctx context.Context, config *Config, fn func(context.Context, *Client) ([]byte, error)) (output []byte, err error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if g.Breaker != nil {
+		host := config.hostPort()
+		if !g.Breaker.Allow(host) {
+			return nil, ErrCircuitOpen
+		}
+		// once ctx is done, like for the hosts still running when another
+		// host fails a Batch, err is not the host's own.
+		defer func() { g.Breaker.Record(ctx, host, err) }()
+	}
+
+	client, release, err := g.connect(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+	})
+	defer stop()
+
+	output, err = fn(ctx, client)
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil {
+		err = ctxErr
+	}
+
+	return output, err
+}
+
+// connect returns a client connected to the host and the function
+// releasing it once the operation is done.
+func (g *Group) connect(ctx context.Context, config *Config) (*Client, func(), error) {
+
+	if g.pool != nil {
+		return g.pool.acquire(ctx, config)
+	}
+
+	client, err := NewConnContext(ctx, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, func() { client.Close() }, nil
+}
@@ -0,0 +1,261 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGroup(t *testing.T) {
+
+	t.Run("groupStreamTest", groupStreamTest)
+}
+
+func groupStreamTest(t *testing.T) {
+
+	newServer("2030")
+	newServer("2031")
+
+	config := func(port uint, pass string) *goph.Config {
+		return &goph.Config{
+			Addr:     "127.0.10.10",
+			Port:     port,
+			User:     "babbage88",
+			Auth:     goph.Password(pass),
+			Callback: ssh.InsecureIgnoreHostKey(),
+		}
+	}
+
+	group := goph.NewGroup("test", config(2030, "123456"), config(2031, "123456"), config(2039, "123456"))
+
+	var ok, failed int
+	for r := range group.Stream(context.Background(), "ls") {
+		if r.Err != nil {
+			failed++
+		} else {
+			ok++
+		}
+	}
+
+	if ok != 2 || failed != 1 {
+		t.Errorf("expected 2 ok and 1 failed hosts, got %d ok and %d failed", ok, failed)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+
+	b := goph.NewCircuitBreaker(2, 20*time.Millisecond)
+
+	b.Failure("h:22")
+	if !b.Allow("h:22") {
+		t.Fatal("breaker should stay closed below the threshold")
+	}
+
+	b.Failure("h:22")
+	if b.Allow("h:22") || b.State("h:22") != goph.BreakerOpen {
+		t.Fatal("breaker should be open")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if !b.Allow("h:22") {
+		t.Fatal("breaker should allow a probe after the cooldown")
+	}
+	if b.Allow("h:22") {
+		t.Fatal("breaker should allow a single probe")
+	}
+
+	b.Success("h:22")
+	if b.State("h:22") != goph.BreakerClosed {
+		t.Fatal("breaker should be closed after a successful probe")
+	}
+}
+
+func TestCircuitBreakerCancelled(t *testing.T) {
+
+	b := goph.NewCircuitBreaker(1, 20*time.Millisecond)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, err := range []error{context.Canceled, fmt.Errorf("run: %w", context.DeadlineExceeded)} {
+		b.Record(cancelled, "h:22", err)
+		if b.State("h:22") != goph.BreakerClosed {
+			t.Fatalf("%v should not count as a failure once ctx is done", err)
+		}
+	}
+
+	b.Record(context.Background(), "h:22", errors.New("connection refused"))
+	time.Sleep(30 * time.Millisecond)
+
+	if !b.Allow("h:22") {
+		t.Fatal("breaker should allow a probe after the cooldown")
+	}
+
+	// a cancelled probe neither closes the breaker nor blocks the next one.
+	b.Record(cancelled, "h:22", context.Canceled)
+	if b.State("h:22") != goph.BreakerHalfOpen || !b.Allow("h:22") {
+		t.Fatal("breaker should allow another probe after a cancelled one")
+	}
+}
+
+// timeoutDialer times out every dial after its delay, like an unreachable
+// host dropping the packets.
+type timeoutDialer time.Duration
+
+func (d timeoutDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(d))
+	defer cancel()
+
+	<-ctx.Done()
+	return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+}
+
+func TestCircuitBreakerDialTimeout(t *testing.T) {
+
+	config := &goph.Config{
+		User:   "alice",
+		Addr:   "10.255.255.1",
+		Port:   22,
+		Dialer: timeoutDialer(300 * time.Millisecond),
+	}
+
+	group := goph.NewGroup("test", config)
+	group.Breaker = goph.NewCircuitBreaker(1, time.Hour)
+
+	results := group.Run(context.Background(), "true")
+	if len(results) != 1 || !errors.Is(results[0].Err, context.DeadlineExceeded) {
+		t.Fatalf("expected the dial to time out, got %+v", results)
+	}
+
+	if s := group.Breaker.State("10.255.255.1:22"); s != goph.BreakerOpen {
+		t.Errorf("a host timing out on dial should open the breaker, got %s", s)
+	}
+}
+
+func TestBatchBreaker(t *testing.T) {
+
+	var configs []*goph.Config
+	for range 2 {
+		srv := gophtest.NewServer()
+		srv.AddUser("alice", "secret")
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+		configs = append(configs, srv.Config("alice", "secret"))
+	}
+
+	bad, healthy := configs[0], configs[1]
+	hostPort := func(c *goph.Config) string { return fmt.Sprintf("%s:%d", c.Addr, c.Port) }
+
+	group := goph.NewGroup("test", configs...)
+	group.Breaker = goph.NewCircuitBreaker(2, time.Hour)
+
+	for range 2 {
+		running := make(chan struct{})
+
+		err := group.Batch(context.Background(), func(ctx context.Context, c *goph.Client) error {
+			if c.Config == bad {
+				<-running
+				return errors.New("bad host")
+			}
+			// still in flight when the bad host cancels the batch.
+			close(running)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if err == nil {
+			t.Fatal("the batch should fail")
+		}
+	}
+
+	if s := group.Breaker.State(hostPort(bad)); s != goph.BreakerOpen {
+		t.Errorf("the breaker of the failing host should be open, got %s", s)
+	}
+	if s := group.Breaker.State(hostPort(healthy)); s != goph.BreakerClosed {
+		t.Errorf("the breaker of the cancelled host should stay closed, got %s", s)
+	}
+}
+
+func TestPool(t *testing.T) {
+
+	var (
+		dials   atomic.Int32
+		configs []*goph.Config
+		servers []*gophtest.Server
+	)
+
+	for i := range 3 {
+		srv := gophtest.NewServer()
+		srv.AddUser("alice", "secret")
+		srv.HandleFunc("hostname", func(e *gophtest.Exec) int {
+			fmt.Fprintf(e.Stdout, "host%d\n", i)
+			return 0
+		})
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+
+		config := srv.Config("alice", "secret")
+		config.OnConnect = func(goph.ConnInfo) { dials.Add(1) }
+		configs = append(configs, config)
+		servers = append(servers, srv)
+	}
+
+	pool := goph.NewPool(configs...)
+	pool.Concurrency = 2
+	defer pool.Close()
+
+	for range 2 {
+		for i, r := range pool.Run(context.Background(), "hostname") {
+			if r.Err != nil || string(r.Output) != fmt.Sprintf("host%d\n", i) {
+				t.Errorf("host %d: got %q, %v", i, r.Output, r.Err)
+			}
+		}
+	}
+
+	if n := dials.Load(); n != 3 || pool.Conns() != 3 {
+		t.Errorf("expected 3 connections reused, got %d dials and %d open", n, pool.Conns())
+	}
+
+	local := filepath.Join(t.TempDir(), "motd")
+	os.WriteFile(local, []byte("hello"), 0644)
+
+	for i, r := range pool.Upload(context.Background(), local, "/motd") {
+		if r.Err != nil {
+			t.Errorf("host %d: %v", i, r.Err)
+		}
+	}
+	if n := dials.Load(); n != 3 {
+		t.Errorf("expected the upload to reuse the connections, got %d dials", n)
+	}
+
+	// idle connections beyond MaxIdle are closed.
+	pool.MaxIdle = 1
+	servers[0].Close()
+	results := pool.Run(context.Background(), "hostname")
+	if results[0].Err == nil || results[1].Err != nil || results[2].Err != nil {
+		t.Errorf("expected only the first host to fail, got %+v", results)
+	}
+	if pool.Conns() != 1 {
+		t.Errorf("expected 1 idle connection kept, got %d", pool.Conns())
+	}
+
+	pool.Close()
+	if r := pool.Run(context.Background(), "hostname"); !errors.Is(r[1].Err, goph.ErrPoolClosed) {
+		t.Errorf("expected ErrPoolClosed, got %v", r[1].Err)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DialEvent is passed to Config.OnDial after every dial of the server,
+// including the attempts retried by Config.Retry and the re-dials.
+type DialEvent struct {
+
+	// Host is the "host:port" address of the config.
+	Host string
+
+	// RemoteAddr of the connection, nil when the dial failed.
+	RemoteAddr net.Addr
+
+	// Duration of the dial, through the jump hosts of Proxy if any.
+	Duration time.Duration
+
+	Err error
+}
+
+// HostKeyEvent is passed to Config.OnHostKey once the host key of the
+// server was checked by Callback.
+type HostKeyEvent struct {
+
+	// Host is the "host:port" address of the config.
+	Host string
+
+	RemoteAddr  net.Addr
+	KeyType     string
+	Fingerprint string
+
+	// Err is the error of Callback, nil when the key was accepted.
+	Err error
+}
+
+// AuthEvent is passed to Config.OnAuthResult once the handshake of a
+// dialed connection completes.
+type AuthEvent struct {
+	User string
+
+	// Host is the "host:port" address of the config.
+	Host string
+
+	// Methods are the names of the auth methods of the config.
+	Methods []string
+
+	// Duration of the handshake, key exchange included.
+	Duration time.Duration
+
+	// Err is nil once authenticated. ErrAuthFailed is set when the server
+	// rejected the credentials, the handshake may also fail before auth,
+	// with ErrHostKeyMismatch for example.
+	Err error
+}
+
+// SessionEvent is passed to Config.OnSessionStart and OnSessionEnd for the
+// session channels opened by the client, for commands, shells, subsystems
+// and scp copies.
+type SessionEvent struct {
+	User string
+
+	// Host is the "host:port" address of the config.
+	Host string
+
+	// Command of the sessions of Command, set on end.
+	Command string
+
+	// Time of the event.
+	Time time.Time
+}
+
+// TransferEvent is passed to Config.OnTransferStart and OnTransferEnd for
+// every Upload and Download, and the other transfers tracked like them.
+type TransferEvent struct {
+
+	// Operation is "upload" or "download", or the name of the transfer
+	// like "sync-up".
+	Operation  string
+	LocalPath  string
+	RemotePath string
+
+	// Bytes and Files copied, set on end.
+	Bytes int64
+	Files int
+
+	// Duration of the transfer, set on end.
+	Duration time.Duration
+
+	// Err is the transfer error, set on end.
+	Err error
+}
+
+// onDial calls the OnDial hook of the config with the dial started at
+// start.
+func (c *Config) onDial(start time.Time, conn net.Conn, err error) {
+
+	if c == nil || c.OnDial == nil {
+		return
+	}
+
+	e := DialEvent{Host: c.hostPort(), Duration: time.Since(start), Err: err}
+	if conn != nil {
+		e.RemoteAddr = conn.RemoteAddr()
+	}
+
+	c.OnDial(e)
+}
+
+// hostKeyHook wraps callback to call the OnHostKey hook of the config.
+func (c *Config) hostKeyHook(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+
+	if callback == nil || c.OnHostKey == nil {
+		return callback
+	}
+
+	return func(host string, remote net.Addr, key ssh.PublicKey) error {
+
+		err := callback(host, remote, key)
+
+		c.OnHostKey(HostKeyEvent{
+			Host:        c.hostPort(),
+			RemoteAddr:  remote,
+			KeyType:     key.Type(),
+			Fingerprint: ssh.FingerprintSHA256(key),
+			Err:         connectError(err),
+		})
+
+		return err
+	}
+}
+
+// onAuthResult calls the OnAuthResult hook of the config with the
+// handshake started at start.
+func (c *Config) onAuthResult(start time.Time, err error) {
+
+	if c == nil || c.OnAuthResult == nil {
+		return
+	}
+
+	c.OnAuthResult(AuthEvent{
+		User:     c.User,
+		Host:     c.hostPort(),
+		Methods:  authMethodNames(c.Auth),
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// sessionEvent returns the session event of the config for command.
+func (c *Config) sessionEvent(command string) SessionEvent {
+	return SessionEvent{User: c.User, Host: c.hostPort(), Command: command, Time: time.Now()}
+}
+
+// onSessionStart calls the OnSessionStart hook of the config.
+func (c *Config) onSessionStart() {
+	if c != nil && c.OnSessionStart != nil {
+		c.OnSessionStart(c.sessionEvent(""))
+	}
+}
+
+// onSessionEnd calls the OnSessionEnd hook of the config for the session
+// of command, empty when unknown.
+func (c *Config) onSessionEnd(command string) {
+	if c != nil && c.OnSessionEnd != nil {
+		c.OnSessionEnd(c.sessionEvent(command))
+	}
+}
+
+// event returns the transfer event of t.
+func (t *transfer) event() TransferEvent {
+	return TransferEvent{Operation: t.op, LocalPath: t.local, RemotePath: t.remote}
+}
@@ -0,0 +1,182 @@
+package goph_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHooks(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("true", func(e *gophtest.Exec) int { return 0 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var (
+		dials    []goph.DialEvent
+		keys     []goph.HostKeyEvent
+		auths    []goph.AuthEvent
+		started  []goph.SessionEvent
+		ended    []goph.SessionEvent
+		startedT []goph.TransferEvent
+		endedT   []goph.TransferEvent
+	)
+
+	config := srv.Config("alice", "secret")
+	config.OnDial = func(e goph.DialEvent) { dials = append(dials, e) }
+	config.OnHostKey = func(e goph.HostKeyEvent) { keys = append(keys, e) }
+	config.OnAuthResult = func(e goph.AuthEvent) { auths = append(auths, e) }
+	config.OnSessionStart = func(e goph.SessionEvent) { started = append(started, e) }
+	config.OnSessionEnd = func(e goph.SessionEvent) { ended = append(ended, e) }
+	config.OnTransferStart = func(e goph.TransferEvent) { startedT = append(startedT, e) }
+	config.OnTransferEnd = func(e goph.TransferEvent) { endedT = append(endedT, e) }
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if len(dials) != 1 || dials[0].Err != nil || dials[0].RemoteAddr == nil || dials[0].Host != srv.Addr() {
+		t.Errorf("dial events: %+v", dials)
+	}
+	if len(keys) != 1 || keys[0].Err != nil || keys[0].Fingerprint != ssh.FingerprintSHA256(srv.HostKey.PublicKey()) {
+		t.Errorf("host key events: %+v", keys)
+	}
+	if len(auths) != 1 || auths[0].Err != nil || auths[0].User != "alice" || len(auths[0].Methods) != 1 || auths[0].Methods[0] != "password" {
+		t.Errorf("auth events: %+v", auths)
+	}
+
+	if _, err = client.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := client.Command("true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Close()
+
+	if len(started) != 2 || len(ended) != 2 {
+		t.Fatalf("want 2 session starts and ends, got %d and %d", len(started), len(ended))
+	}
+	if ended[0].Command != "" || ended[1].Command != "true" {
+		t.Errorf("session end commands: %q, %q", ended[0].Command, ended[1].Command)
+	}
+
+	local := filepath.Join(t.TempDir(), "data")
+	if err = os.WriteFile(local, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = client.Upload(local, "/data"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(startedT) != 1 || startedT[0].Operation != "upload" || startedT[0].LocalPath != local {
+		t.Errorf("transfer start events: %+v", startedT)
+	}
+	if len(endedT) != 1 || endedT[0].Bytes != 5 || endedT[0].Files != 1 || endedT[0].Duration <= 0 || endedT[0].Err != nil {
+		t.Errorf("transfer end events: %+v", endedT)
+	}
+}
+
+func TestHooksAuthFailed(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var auths []goph.AuthEvent
+
+	config := srv.Config("alice", "wrong")
+	config.OnAuthResult = func(e goph.AuthEvent) { auths = append(auths, e) }
+
+	if _, err := goph.NewConn(config); err == nil {
+		t.Fatal("the connection should fail")
+	}
+
+	if len(auths) != 1 || !errors.Is(auths[0].Err, goph.ErrAuthFailed) || auths[0].Duration <= 0 {
+		t.Errorf("auth events: %+v", auths)
+	}
+}
+
+func TestFileHooks(t *testing.T) {
+
+	client := newFileServer(t)
+
+	var started, completed, failed []goph.FileEvent
+
+	client.Config.OnFileStart = func(e goph.FileEvent) { started = append(started, e) }
+	client.Config.OnFileComplete = func(e goph.FileEvent) { completed = append(completed, e) }
+	client.Config.OnFileError = func(e goph.FileEvent) error {
+		failed = append(failed, e)
+		return e.Err
+	}
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "b.txt"), []byte("bb"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Upload(src, "/dst"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(started) != 2 || len(completed) != 2 || len(failed) != 0 {
+		t.Fatalf("expected 2 files started and completed, got %d, %d and %d errors", len(started), len(completed), len(failed))
+	}
+
+	sizes := map[string]int64{"/dst/a.txt": 1, "/dst/b.txt": 2}
+	for _, e := range started {
+		if e.Operation != "upload" || e.Size != sizes[e.RemotePath] || e.LocalPath != filepath.Join(src, filepath.Base(e.RemotePath)) || e.Bytes != 0 {
+			t.Errorf("unexpected start event %+v", e)
+		}
+	}
+	for _, e := range completed {
+		if e.Operation != "upload" || e.Bytes != sizes[e.RemotePath] || e.Size != e.Bytes || e.Duration <= 0 || e.Err != nil {
+			t.Errorf("unexpected completion event %+v", e)
+		}
+	}
+
+	started, completed = nil, nil
+
+	dst := filepath.Join(t.TempDir(), "out")
+	if err := client.Download("/dst/b.txt", dst); err != nil {
+		t.Fatal(err)
+	}
+	if len(completed) != 1 || completed[0].Operation != "download" || completed[0].LocalPath != dst || completed[0].Bytes != 2 {
+		t.Errorf("unexpected download events %+v", completed)
+	}
+
+	// the hook returns the error, aborting the transfer.
+	if err := os.Symlink(filepath.Join(src, "gone"), filepath.Join(src, "broken")); err != nil {
+		t.Fatal(err)
+	}
+	client.Config.Transfer.FollowSymlinks = true
+
+	if err := client.Upload(src, "/dst"); err == nil {
+		t.Fatal("the upload of a broken link should fail")
+	}
+	if len(failed) != 1 || failed[0].Err == nil || failed[0].LocalPath != filepath.Join(src, "broken") {
+		t.Errorf("unexpected error events %+v", failed)
+	}
+}
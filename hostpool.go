@@ -0,0 +1,178 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned for the operations of a closed pool.
+var ErrPoolClosed = errors.New("goph: pool closed")
+
+// Pool runs fleet operations like a Group, keeping the connection of every
+// host open between operations instead of dialing for each one. Broken
+// connections are dialed again by the next operation on the host.
+type Pool struct {
+	*Group
+
+	// MaxIdle, if set, bounds the connections kept open between
+	// operations, the least recently used are closed first.
+	MaxIdle int
+
+	mu     sync.Mutex
+	conns  map[*Config]*pooledClient
+	closed bool
+}
+
+// pooledClient is a connection of a pool.
+type pooledClient struct {
+	client *Client
+	refs   int
+	used   time.Time
+}
+
+// NewPool returns a pool of connections to the hosts of configs.
+func NewPool(configs ...*Config) *Pool {
+	p := &Pool{
+		Group: NewGroup("", configs...),
+		conns: make(map[*Config]*pooledClient),
+	}
+	p.Group.pool = p
+	return p
+}
+
+// Conns returns the number of open connections of the pool.
+func (p *Pool) Conns() int {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.conns)
+}
+
+// acquire returns the open connection to the host of config, or dials a
+// new one, and the function releasing it.
+func (p *Pool) acquire(ctx context.Context, config *Config) (*Client, func(), error) {
+
+	p.mu.Lock()
+	e, err := p.open(config)
+	p.mu.Unlock()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if e == nil {
+
+		client, err := NewConnContext(ctx, config)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		p.mu.Lock()
+		// another operation may have connected meanwhile.
+		if e, err = p.open(config); e == nil && err == nil {
+			e = &pooledClient{client: client, refs: 1}
+			p.conns[config] = e
+		} else {
+			client.Close()
+		}
+		p.mu.Unlock()
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return e.client, func() { p.release(e) }, nil
+}
+
+// open returns the live connection of config with a new reference, or nil.
+func (p *Pool) open(config *Config) (*pooledClient, error) {
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	e := p.conns[config]
+	if e == nil {
+		return nil, nil
+	}
+
+	if !e.client.alive() {
+		delete(p.conns, config)
+		return nil, nil
+	}
+
+	e.refs++
+	return e, nil
+}
+
+// release drops a reference to e, and closes the least recently used idle
+// connections beyond MaxIdle.
+func (p *Pool) release(e *pooledClient) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.refs--
+	e.used = time.Now()
+
+	if p.closed && e.refs == 0 {
+		e.client.Close()
+		return
+	}
+
+	for p.MaxIdle > 0 && p.idle() > p.MaxIdle {
+
+		var (
+			oldest *pooledClient
+			key    *Config
+		)
+		for config, c := range p.conns {
+			if c.refs == 0 && (oldest == nil || c.used.Before(oldest.used)) {
+				oldest, key = c, config
+			}
+		}
+
+		oldest.client.Close()
+		delete(p.conns, key)
+	}
+}
+
+// idle returns the number of connections not used by an operation.
+func (p *Pool) idle() (n int) {
+	for _, e := range p.conns {
+		if e.refs == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Close closes the connections of the pool, the connections used by an
+// operation are closed once it completes.
+func (p *Pool) Close() error {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	var errs []error
+	for config, e := range p.conns {
+		if e.refs == 0 {
+			if err := e.client.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				errs = append(errs, err)
+			}
+		}
+		delete(p.conns, config)
+	}
+
+	return errors.Join(errs...)
+}
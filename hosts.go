@@ -4,10 +4,13 @@
 package goph
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/knownhosts"
@@ -78,35 +81,146 @@ func CheckKnownHost(host string, remote net.Addr, key ssh.PublicKey, knownFile s
 
 // AddKnownHost add a a host to known hosts file.
 func AddKnownHost(host string, remote net.Addr, key ssh.PublicKey, knownFile string) (err error) {
+	_, err = AddKnownHosts(knownFile, KnownHost{Host: host, Remote: remote, Key: key})
+	return err
+}
+
+// KnownHost is a host key to add to a known hosts file.
+type KnownHost struct {
+
+	// Host is the host name or address, with an optional port.
+	Host string
+
+	// Remote, if set, is the address the host resolved to, added along Host.
+	Remote net.Addr
+
+	Key ssh.PublicKey
+}
+
+// knownHostsMu serializes the writes to known hosts files.
+var knownHostsMu sync.Mutex
+
+// AddKnownHosts adds hosts to the known hosts file in a single write, and
+// returns the number of lines added. Addresses are normalized, "host:22"
+// is written "host" and "host:2222" is written "[host]:2222", and the
+// addresses already known with the same key, including in hashed lines,
+// are skipped. Nothing is added when a key is marked @revoked in the file,
+// the *knownhosts.RevokedError is returned instead.
+func AddKnownHosts(knownFile string, hosts ...KnownHost) (added int, err error) {
 
 	// Fallback to default known_hosts file
 	if knownFile == "" {
 		path, err := DefaultKnownHostsPath()
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		knownFile = path
 	}
 
+	_, added, err = addKnownHosts(knownFile, nil, false, hosts)
+	return added, err
+}
+
+// addKnownHosts appends the lines of the hosts unknown to known, the
+// callback of the file when nil, to the file and returns them. The host
+// names are hashed with hash.
+func addKnownHosts(knownFile string, known ssh.HostKeyCallback, hash bool, hosts []KnownHost) (lines []byte, added int, err error) {
+
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	if known == nil {
+		known = func(string, net.Addr, ssh.PublicKey) error { return errors.New("unknown") }
+		if _, err = os.Stat(knownFile); err == nil {
+			if known, err = KnownHosts(knownFile); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	if lines, added, err = knownHostLines(known, hash, hosts); err != nil || added == 0 {
+		return nil, 0, err
+	}
+
 	f, err := os.OpenFile(knownFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 	if err != nil {
-		return err
+		return nil, 0, err
+	}
+
+	if _, err = f.Write(lines); err != nil {
+		f.Close()
+		return nil, 0, err
 	}
 
-	defer f.Close()
+	return lines, added, f.Close()
+}
+
+// knownHostLines returns the known_hosts lines of the hosts unknown to
+// known, or the *knownhosts.RevokedError of a revoked key.
+func knownHostLines(known ssh.HostKeyCallback, hash bool, hosts []KnownHost) (lines []byte, added int, err error) {
+
+	var (
+		buf  bytes.Buffer
+		seen = make(map[string]bool)
+	)
+
+	for _, h := range hosts {
+
+		candidates := []string{h.Host}
+		if h.Remote != nil {
+			candidates = append([]string{h.Remote.String()}, candidates...)
+		}
 
-	remoteNormalized := knownhosts.Normalize(remote.String())
-	hostNormalized := knownhosts.Normalize(host)
-	addresses := []string{remoteNormalized}
+		var addresses []string
+		for _, a := range candidates {
+
+			if a == "" {
+				continue
+			}
+
+			hostPort := knownHostPort(a)
+			normalized := knownhosts.Normalize(hostPort)
+			dedupe := normalized + " " + string(h.Key.Marshal())
+			if seen[dedupe] {
+				continue
+			}
+			seen[dedupe] = true
+
+			err := known(hostPort, &net.TCPAddr{}, h.Key)
+			if err == nil {
+				continue
+			}
+
+			var revoked *knownhosts.RevokedError
+			if errors.As(err, &revoked) {
+				return nil, 0, revoked
+			}
+
+			if hash {
+				normalized = knownhosts.HashHostname(normalized)
+			}
+			addresses = append(addresses, normalized)
+		}
 
-	if hostNormalized != remoteNormalized {
-		addresses = append(addresses, hostNormalized)
+		if len(addresses) > 0 {
+			buf.WriteString(knownhosts.Line(addresses, h.Key) + "\n")
+			added++
+		}
 	}
 
-	_, err = f.WriteString(knownhosts.Line(addresses, key) + "\n")
+	return buf.Bytes(), added, nil
+}
+
+// knownHostPort returns address with the default ssh port when it has no
+// port.
+func knownHostPort(address string) string {
 
-	return err
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+
+	return net.JoinHostPort(strings.Trim(address, "[]"), "22")
 }
 
 // DefaultKnownHostsPath returns default user knows hosts file.
@@ -0,0 +1,252 @@
+package goph_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestAddKnownHosts(t *testing.T) {
+
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	k1, k2, k3 := newKey(), newKey(), newKey()
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	hashed := knownhosts.Line([]string{knownhosts.HashHostname("a.example")}, k1)
+	if err := os.WriteFile(file, []byte(hashed+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := []goph.KnownHost{
+		{Host: "a.example:22", Key: k1},
+		{Host: "b.example:2222", Key: k2},
+		{Host: "[b.example]:2222", Key: k2},
+		{Host: "c.example", Remote: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}, Key: k3},
+	}
+
+	added, err := goph.AddKnownHosts(file, hosts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 {
+		t.Errorf("expected 2 lines added, got %d", added)
+	}
+
+	data, _ := os.ReadFile(file)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 ||
+		!strings.HasPrefix(lines[1], "[b.example]:2222 ") ||
+		!strings.HasPrefix(lines[2], "10.0.0.1,c.example ") {
+		t.Errorf("unexpected known hosts:\n%s", data)
+	}
+
+	if added, err = goph.AddKnownHosts(file, hosts...); err != nil || added != 0 {
+		t.Errorf("adding the hosts again should add nothing, got %d, %v", added, err)
+	}
+}
+
+func TestAddKnownHostsRevoked(t *testing.T) {
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	revoked := "@revoked * " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + "\n"
+	if err = os.WriteFile(file, []byte(revoked), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := goph.AddKnownHosts(file, goph.KnownHost{Host: "a.example", Key: key})
+
+	var revokedErr *knownhosts.RevokedError
+	if !errors.As(err, &revokedErr) || added != 0 {
+		t.Errorf("expected a RevokedError, got %d, %v", added, err)
+	}
+
+	if data, _ := os.ReadFile(file); string(data) != revoked {
+		t.Errorf("the revoked key should not be added:\n%s", data)
+	}
+}
+
+func TestKnownHostsDB(t *testing.T) {
+
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	k1, k2 := newKey(), newKey()
+
+	db, err := goph.NewKnownHostsDB([]byte(knownhosts.Line([]string{"a.example"}, k1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Check("a.example", nil, k1); err != nil {
+		t.Errorf("expected a.example known, got %v", err)
+	}
+	if err = db.Check("a.example:22", nil, k2); !errors.Is(err, goph.ErrHostKeyMismatch) {
+		t.Errorf("expected ErrHostKeyMismatch, got %v", err)
+	}
+	if err = db.Check("b.example", nil, k2); !errors.Is(err, goph.ErrUnknownHost) {
+		t.Errorf("expected ErrUnknownHost, got %v", err)
+	}
+
+	if err = db.Add(goph.KnownHost{Host: "b.example:2222", Key: k2}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Check("b.example:2222", nil, k2); err != nil {
+		t.Errorf("expected b.example added, got %v", err)
+	}
+	if !strings.Contains(string(db.Bytes()), "[b.example]:2222 ") {
+		t.Errorf("expected b.example in memory, got:\n%s", db.Bytes())
+	}
+
+	// trust on first use, through the server host key.
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err = srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	if db, err = goph.LoadKnownHosts(file); err != nil {
+		t.Fatal(err)
+	}
+	db.Hash = true
+
+	var prompts []string
+	accept := false
+	config := srv.Config("alice", "secret")
+	config.Callback = db.PromptCallback(func(host, fingerprint string) bool {
+		prompts = append(prompts, fingerprint)
+		return accept
+	})
+
+	if _, err = goph.NewConn(config); !errors.Is(err, goph.ErrUnknownHost) {
+		t.Errorf("expected a refused host to stay unknown, got %v", err)
+	}
+
+	accept = true
+	for range 2 {
+		client, err := goph.NewConn(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+	}
+
+	want := ssh.FingerprintSHA256(srv.HostKey.PublicKey())
+	if len(prompts) != 2 || prompts[1] != want {
+		t.Errorf("expected 2 prompts for %s, got %q", want, prompts)
+	}
+
+	data, _ := os.ReadFile(file)
+	host, _, _ := net.SplitHostPort(srv.Addr())
+	if !strings.HasPrefix(string(data), "|1|") || strings.Contains(string(data), host) {
+		t.Errorf("expected a hashed entry, got:\n%s", data)
+	}
+
+	// the file is read back, and changed keys are refused without prompt.
+	if db, err = goph.LoadKnownHosts(file); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Check(srv.Addr(), nil, srv.HostKey.PublicKey()); err != nil {
+		t.Errorf("expected the host known from the file, got %v", err)
+	}
+	if err = db.PromptCallback(nil)(srv.Addr(), nil, k1); !errors.Is(err, goph.ErrHostKeyMismatch) {
+		t.Errorf("expected ErrHostKeyMismatch, got %v", err)
+	}
+}
+
+func TestKnownHostsDBAdd(t *testing.T) {
+
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	k1, k2, k3, revoked := newKey(), newKey(), newKey(), newKey()
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	initial := knownhosts.Line([]string{"a.example"}, k1) + "\n" +
+		"@revoked * " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(revoked))) + "\n"
+	if err := os.WriteFile(file, []byte(initial), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := goph.LoadKnownHosts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Add(
+		goph.KnownHost{Host: "a.example", Key: k1},
+		goph.KnownHost{Host: "b.example", Key: k2},
+		goph.KnownHost{Host: "c.example:2222", Key: k3},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for host, key := range map[string]ssh.PublicKey{"a.example": k1, "b.example": k2, "c.example:2222": k3} {
+		if err = db.Check(host, nil, key); err != nil {
+			t.Errorf("expected %s known, got %v", host, err)
+		}
+	}
+
+	data, _ := os.ReadFile(file)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 4 || string(db.Bytes()) != string(data) {
+		t.Errorf("expected the 2 new hosts appended, got:\n%s", data)
+	}
+
+	var revokedErr *knownhosts.RevokedError
+	if err = db.Add(goph.KnownHost{Host: "d.example", Key: revoked}); !errors.As(err, &revokedErr) {
+		t.Errorf("expected a RevokedError, got %v", err)
+	}
+	if after, _ := os.ReadFile(file); string(after) != string(data) {
+		t.Errorf("the revoked key should not be added:\n%s", after)
+	}
+}
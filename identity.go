@@ -0,0 +1,288 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Identity is a private key with its ssh user certificate, and the
+// certificate authorities trusted for host keys, as bundled in identity
+// files written by Teleport (tsh login --out) or step.
+type Identity struct {
+
+	// Signer signs with the certificate.
+	Signer ssh.Signer
+
+	Cert *ssh.Certificate
+
+	// HostCAs are the authorities of the @cert-authority lines.
+	HostCAs []HostCA
+}
+
+// HostCA is a certificate authority trusted for the host key certificates
+// of the hosts matching its patterns.
+type HostCA struct {
+	Hosts []string
+	Key   ssh.PublicKey
+}
+
+// LoadIdentity parses the identity file: a PEM private key, an ssh user
+// certificate line and optional @cert-authority lines, other content like
+// TLS certificates is ignored. When the file has no certificate, the
+// certificate is read from file+"-cert.pub", as written by ssh-keygen and
+// step.
+func LoadIdentity(file string, passphrase string) (*Identity, error) {
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	id, key, err := parseIdentity(data)
+	if err != nil {
+		return nil, fmt.Errorf("identity %s: %w", file, err)
+	}
+
+	if id.Cert == nil {
+		if data, err = os.ReadFile(file + "-cert.pub"); err == nil {
+			id.Cert, err = parseUserCert(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("identity %s: no certificate: %w", file, err)
+		}
+	}
+
+	signer, err := GetSignerForRawKey(key, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("identity %s: %w", file, err)
+	}
+
+	if id.Signer, err = ssh.NewCertSigner(id.Cert, signer); err != nil {
+		return nil, fmt.Errorf("identity %s: %w", file, err)
+	}
+
+	return id, nil
+}
+
+// parseIdentity parses an identity bundle and returns its private key PEM.
+func parseIdentity(data []byte) (*Identity, []byte, error) {
+
+	var (
+		id      = &Identity{}
+		key     []byte
+		block   bytes.Buffer
+		inBlock bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+
+		case strings.HasPrefix(line, "-----BEGIN "):
+			inBlock = true
+			block.Reset()
+			block.WriteString(line + "\n")
+
+		case inBlock:
+			block.WriteString(line + "\n")
+			if strings.HasPrefix(line, "-----END ") {
+				inBlock = false
+				if key == nil && strings.Contains(line, "PRIVATE KEY") {
+					key = bytes.Clone(block.Bytes())
+				}
+			}
+
+		case strings.HasPrefix(line, "@cert-authority"):
+			marker, hosts, pub, _, _, err := ssh.ParseKnownHosts([]byte(line))
+			if err != nil || marker != "cert-authority" {
+				return nil, nil, fmt.Errorf("invalid cert-authority line: %v", err)
+			}
+			id.HostCAs = append(id.HostCAs, HostCA{Hosts: hosts, Key: pub})
+
+		case line != "" && !strings.HasPrefix(line, "#") && id.Cert == nil:
+			if cert, err := parseUserCert([]byte(line)); err == nil {
+				id.Cert = cert
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if key == nil {
+		return nil, nil, errors.New("no private key")
+	}
+
+	return id, key, nil
+}
+
+// parseUserCert parses an ssh user certificate in authorized_keys format.
+func parseUserCert(data []byte) (*ssh.Certificate, error) {
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok || cert.CertType != ssh.UserCert {
+		return nil, errors.New("not an ssh user certificate")
+	}
+
+	return cert, nil
+}
+
+// Expires returns the end of the certificate validity.
+func (id *Identity) Expires() time.Time {
+
+	if id.Cert.ValidBefore == ssh.CertTimeInfinity {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(id.Cert.ValidBefore), 0)
+}
+
+// IsHostAuthority reports whether key is a trusted authority for host,
+// a "host:port" address.
+func (id *Identity) IsHostAuthority(key ssh.PublicKey, host string) bool {
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, ca := range id.HostCAs {
+		if bytes.Equal(ca.Key.Marshal(), key.Marshal()) && matchHosts(ca.Hosts, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchHosts reports whether host matches the known_hosts patterns,
+// negated patterns exclude a host.
+func matchHosts(patterns []string, host string) bool {
+
+	matched := false
+	for _, p := range patterns {
+		if neg := strings.HasPrefix(p, "!"); neg {
+			if ok, _ := path.Match(p[1:], host); ok {
+				return false
+			}
+		} else if ok, _ := path.Match(p, host); ok {
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// IdentityFile is an identity file reloaded when it changes, so clients
+// keep working as short-lived certificates are renewed underneath them.
+type IdentityFile struct {
+	Path       string
+	Passphrase string
+
+	mu      sync.Mutex
+	id      *Identity
+	modTime time.Time
+	size    int64
+}
+
+// NewIdentityFile loads the identity file, see LoadIdentity.
+func NewIdentityFile(file string, passphrase string) (*IdentityFile, error) {
+
+	f := &IdentityFile{Path: file, Passphrase: passphrase}
+	if _, err := f.Identity(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Identity returns the identity, reloaded if the file changed. A file that
+// fails to load, like one being rewritten, keeps the previous identity.
+func (f *IdentityFile) Identity() (*Identity, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		if f.id != nil {
+			return f.id, nil
+		}
+		return nil, err
+	}
+
+	if f.id != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.id, nil
+	}
+
+	id, err := LoadIdentity(f.Path, f.Passphrase)
+	if err != nil {
+		if f.id != nil {
+			return f.id, nil
+		}
+		return nil, err
+	}
+
+	f.id, f.modTime, f.size = id, info.ModTime(), info.Size()
+
+	return id, nil
+}
+
+// Auth returns the auth method of the identity, reloaded on every
+// connection attempt.
+func (f *IdentityFile) Auth() Auth {
+	return Auth{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			id, err := f.Identity()
+			if err != nil {
+				return nil, err
+			}
+			return []ssh.Signer{id.Signer}, nil
+		}),
+	}
+}
+
+// HostKeyCallback accepts host key certificates signed by the authorities
+// of the identity, and checks plain host keys with fallback. A nil
+// fallback rejects them.
+func (f *IdentityFile) HostKeyCallback(fallback ssh.HostKeyCallback) ssh.HostKeyCallback {
+
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(key ssh.PublicKey, host string) bool {
+			id, err := f.Identity()
+			return err == nil && id.IsHostAuthority(key, host)
+		},
+		HostKeyFallback: fallback,
+	}
+
+	if fallback == nil {
+		checker.HostKeyFallback = func(host string, remote net.Addr, key ssh.PublicKey) error {
+			return fmt.Errorf("ssh: host %s presented a key not signed by a trusted authority", host)
+		}
+	}
+
+	return checker.CheckHostKey
+}
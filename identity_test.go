@@ -0,0 +1,130 @@
+package goph_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+)
+
+// newSigner returns a new ed25519 signer and its private key PEM.
+func newSigner(t *testing.T) (ssh.Signer, []byte) {
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer, pem.EncodeToMemory(block)
+}
+
+// signCert signs a certificate of key with ca.
+func signCert(t *testing.T, ca ssh.Signer, key ssh.PublicKey, typ uint32, serial uint64, principals ...string) *ssh.Certificate {
+
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          serial,
+		CertType:        typ,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+	}
+
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestIdentityFile(t *testing.T) {
+
+	ca, _ := newSigner(t)
+	user, keyPEM := newSigner(t)
+
+	file := filepath.Join(t.TempDir(), "identity")
+	write := func(cert *ssh.Certificate, mtime time.Time) {
+		data := append([]byte(nil), keyPEM...)
+		data = append(data, ssh.MarshalAuthorizedKey(cert)...)
+		data = append(data, "-----BEGIN CERTIFICATE-----\nTUlJ\n-----END CERTIFICATE-----\n"...)
+		data = append(data, "@cert-authority *.example.com,!bad.example.com "+string(ssh.MarshalAuthorizedKey(ca.PublicKey()))...)
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := signCert(t, ca, user.PublicKey(), ssh.UserCert, 1, "alice")
+	write(first, time.Now().Add(-time.Hour))
+
+	f, err := goph.NewIdentityFile(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := gophtest.NewServer()
+	srv.AddKey("alice", first)
+	if err = srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	config := srv.Config("alice", "")
+	config.Auth = f.Auth()
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	// rotate the certificate underneath the client.
+	second := signCert(t, ca, user.PublicKey(), ssh.UserCert, 2, "alice")
+	write(second, time.Now())
+
+	id, err := f.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id.Cert.Serial != 2 || id.Expires().IsZero() {
+		t.Errorf("the identity was not reloaded, serial %d", id.Cert.Serial)
+	}
+
+	// host certificates are checked against the identity authorities.
+	hostKey, _ := newSigner(t)
+	hostCert := signCert(t, ca, hostKey.PublicKey(), ssh.HostCert, 3, "web.example.com")
+	callback := f.HostKeyCallback(nil)
+
+	if err = callback("web.example.com:22", nil, hostCert); err != nil {
+		t.Errorf("a host cert signed by the authority should be accepted: %s", err)
+	}
+
+	badCert := signCert(t, ca, hostKey.PublicKey(), ssh.HostCert, 4, "bad.example.com")
+	if err = callback("bad.example.com:22", nil, badCert); err == nil {
+		t.Error("a negated host should be rejected")
+	}
+
+	if err = callback("web.example.com:22", nil, hostKey.PublicKey()); err == nil {
+		t.Error("a plain host key should be rejected without fallback")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// minIdleCheck bounds how often an idle connection is checked.
+const minIdleCheck = 50 * time.Millisecond
+
+// idle closes conn once no bytes moved on it for Config.IdleTimeout of
+// config, the config of the dial, it returns when the connection is closed.
+func (c *Client) idle(conn *ssh.Client, state *clientState, config *Config) {
+
+	timeout := config.IdleTimeout
+	if timeout <= 0 || state.counter == nil {
+		return
+	}
+
+	interval := max(timeout/4, minIdleCheck)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		last       = state.counter.in.Load() + state.counter.out.Load()
+		lastActive = time.Now()
+	)
+
+	for {
+		select {
+		case <-state.done:
+			return
+		case now := <-ticker.C:
+
+			if n := state.counter.in.Load() + state.counter.out.Load(); n != last {
+				last, lastActive = n, now
+				continue
+			}
+
+			if now.Sub(lastActive) < timeout {
+				continue
+			}
+
+			if config.OnIdle != nil && !config.OnIdle(config.connInfo(conn, nil)) {
+				lastActive = now
+				continue
+			}
+
+			config.logger().Info("closing idle connection", config.logAttrs("idle", now.Sub(lastActive))...)
+
+			state.closed.Store(true)
+			conn.Close()
+			return
+		}
+	}
+}
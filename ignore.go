@@ -0,0 +1,177 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultIgnoreFiles are the ignore files of a working copy, to use as
+// Config.IgnoreFiles.
+var DefaultIgnoreFiles = []string{".gitignore", ".gophignore"}
+
+// ignoreRule is a single pattern of an ignore file.
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// match reports whether the rule matches rel, the slash separated path
+// relative to the directory of the ignore file.
+func (r ignoreRule) match(rel string, isDir bool) bool {
+
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if r.anchored {
+		return globMatch(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+	}
+
+	ok, _ := path.Match(r.pattern, path.Base(rel))
+	return ok
+}
+
+// globMatch matches the path segments name against the pattern segments,
+// where "**" matches any number of segments.
+func globMatch(pattern, name []string) bool {
+
+	for len(pattern) > 0 {
+
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if globMatch(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// parseIgnore parses the gitignore syntax patterns of an ignore file.
+func parseIgnore(f *os.File) ([]ignoreRule, error) {
+
+	var rules []ignoreRule
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r ignoreRule
+
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// a slash at the start or in the middle anchors the pattern to the
+		// directory of the ignore file.
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		r.pattern = line
+		rules = append(rules, r)
+	}
+
+	return rules, scanner.Err()
+}
+
+// ignoreMatcher applies the ignore files found in a local tree.
+type ignoreMatcher struct {
+	root  string
+	names []string
+
+	// rules are the rules of the ignore files by slash separated directory
+	// relative to root, "." for root.
+	rules map[string][]ignoreRule
+}
+
+func newIgnoreMatcher(root string, names []string) *ignoreMatcher {
+	return &ignoreMatcher{root: root, names: names, rules: make(map[string][]ignoreRule)}
+}
+
+// load reads the ignore files of the directory rel.
+func (m *ignoreMatcher) load(rel string) error {
+
+	for _, name := range m.names {
+
+		f, err := os.Open(filepath.Join(m.root, filepath.FromSlash(rel), name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		rules, err := parseIgnore(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		m.rules[rel] = append(m.rules[rel], rules...)
+	}
+
+	return nil
+}
+
+// ignored reports whether the path rel is ignored. The rules of deeper
+// ignore files, and later rules of a file, take precedence.
+func (m *ignoreMatcher) ignored(rel string, isDir bool) bool {
+
+	var ignored bool
+
+	segments := strings.Split(rel, "/")
+
+	dir := "."
+	for i := range segments {
+
+		sub := strings.Join(segments[i:], "/")
+		for _, r := range m.rules[dir] {
+			if r.match(sub, isDir) {
+				ignored = !r.negate
+			}
+		}
+
+		dir = path.Join(dir, segments[i])
+	}
+
+	return ignored
+}
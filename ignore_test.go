@@ -0,0 +1,69 @@
+package goph_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+)
+
+func TestUploadIgnoreFiles(t *testing.T) {
+
+	client := newFileServer(t)
+	client.Config.IgnoreFiles = goph.DefaultIgnoreFiles
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":         "# build output\nbuild/\n*.log\n!keep.log\n/vendor\ndocs/**/*.tmp\n",
+		"main.go":            "package main",
+		"build/out.bin":      "bin",
+		"a.log":              "log",
+		"keep.log":           "keep",
+		"vendor/x.go":        "x",
+		"sub/vendor/y.go":    "y",
+		"sub/.gophignore":    "secret.txt\n",
+		"sub/secret.txt":     "secret",
+		"secret.txt":         "not secret here",
+		"docs/a/b/c.tmp":     "tmp",
+		"docs/a/b/readme.md": "doc",
+		"sub/deep/debug.log": "log",
+		"sub/deep/notes.md":  "notes",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := client.Upload(dir, "/app"); err != nil {
+		t.Fatal(err)
+	}
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	for name, uploaded := range map[string]bool{
+		"main.go":            true,
+		".gitignore":         true,
+		"keep.log":           true,
+		"sub/vendor/y.go":    true,
+		"secret.txt":         true,
+		"docs/a/b/readme.md": true,
+		"sub/deep/notes.md":  true,
+		"build":              false,
+		"a.log":              false,
+		"vendor":             false,
+		"sub/secret.txt":     false,
+		"docs/a/b/c.tmp":     false,
+		"sub/deep/debug.log": false,
+	} {
+		if _, err := ftp.Stat("/app/" + name); (err == nil) != uploaded {
+			t.Errorf("%s: expected uploaded %v, got %v", name, uploaded, err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"net"
+)
+
+// Runner runs remote commands, it is implemented by *Client. Accept a
+// Runner instead of a *Client to substitute fakes in tests.
+type Runner interface {
+	Run(cmd string) ([]byte, error)
+	RunContext(ctx context.Context, cmd string) ([]byte, error)
+}
+
+// Transferer copies files and directories to and from the remote host,
+// it is implemented by *Client.
+type Transferer interface {
+	Upload(localPath, remotePath string) error
+	Download(remotePath, localPath string) error
+}
+
+// Dialer opens connections through the remote host, it is implemented by
+// *Client, and by *net.Dialer for local connections.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+var (
+	_ Runner     = (*Client)(nil)
+	_ Transferer = (*Client)(nil)
+	_ Dialer     = (*Client)(nil)
+)
@@ -0,0 +1,76 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// hostname is code accepting a Runner.
+func hostname(r goph.Runner) (string, error) {
+	out, err := r.RunContext(context.Background(), "hostname")
+	return string(out), err
+}
+
+// roundTrip is code accepting a Transferer.
+func roundTrip(tr goph.Transferer, local, remote string) error {
+	if err := tr.Upload(local, remote); err != nil {
+		return err
+	}
+	return tr.Download(remote, local+".copy")
+}
+
+func TestInterfaces(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.Forwarding = true
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("hostname", func(e *gophtest.Exec) int {
+		fmt.Fprintln(e.Stdout, "web1")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if out, err := hostname(client); err != nil || out != "web1\n" {
+		t.Errorf("expected the Runner to run the command, got %q, %v", out, err)
+	}
+
+	local := filepath.Join(t.TempDir(), "data")
+	if err = os.WriteFile(local, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = roundTrip(client, local, "/data"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(local + ".copy"); err != nil || string(data) != "hello" {
+		t.Errorf("expected the Transferer to copy the file, got %q, %v", data, err)
+	}
+
+	// the client dials the server again through itself.
+	config := srv.Config("alice", "secret")
+	config.Dialer = client
+
+	tunneled, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunneled.Close()
+
+	if out, err := hostname(tunneled); err != nil || out != "web1\n" {
+		t.Errorf("expected the tunneled client to run the command, got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+// Package inventory loads fleet host definitions from JSON, YAML or CSV
+// files and turns them into goph Configs and Groups.
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/babbage88/goph/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Host is a single inventory entry.
+type Host struct {
+	Name   string            `json:"name" yaml:"name"`
+	Addr   string            `json:"addr" yaml:"addr"`
+	Port   uint              `json:"port,omitempty" yaml:"port,omitempty"`
+	User   string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Groups []string          `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	// Jump is the name of another inventory host used as a jump host, its
+	// config is the Proxy of the host config.
+	Jump string `json:"jump,omitempty" yaml:"jump,omitempty"`
+}
+
+// Inventory is a set of hosts loaded from a data file.
+type Inventory struct {
+	Hosts []Host `json:"hosts" yaml:"hosts"`
+}
+
+// Load reads an inventory file, the format is picked from the file extension
+// (.json, .yaml, .yml or .csv).
+func Load(path string) (*Inventory, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return LoadJSON(f)
+	case ".yaml", ".yml":
+		return LoadYAML(f)
+	case ".csv":
+		return LoadCSV(f)
+	}
+
+	return nil, fmt.Errorf("inventory: unsupported file format %q", filepath.Ext(path))
+}
+
+// LoadJSON reads an inventory from JSON.
+func LoadJSON(r io.Reader) (*Inventory, error) {
+
+	inv := &Inventory{}
+	if err := json.NewDecoder(r).Decode(inv); err != nil {
+		return nil, fmt.Errorf("inventory: decode json: %w", err)
+	}
+
+	return inv, inv.validate()
+}
+
+// LoadYAML reads an inventory from YAML.
+func LoadYAML(r io.Reader) (*Inventory, error) {
+
+	inv := &Inventory{}
+	if err := yaml.NewDecoder(r).Decode(inv); err != nil {
+		return nil, fmt.Errorf("inventory: decode yaml: %w", err)
+	}
+
+	return inv, inv.validate()
+}
+
+// LoadCSV reads an inventory from CSV. The first row is a header naming the
+// columns: name, addr, port, user, groups, tags and jump. Groups are separated
+// by ";" and tags are written as "key=value;key=value".
+func LoadCSV(r io.Reader) (*Inventory, error) {
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("inventory: decode csv: %w", err)
+	}
+
+	inv := &Inventory{}
+	if len(records) == 0 {
+		return inv, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for line, record := range records[1:] {
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		host := Host{
+			Name: field("name"),
+			Addr: field("addr"),
+			User: field("user"),
+			Jump: field("jump"),
+		}
+
+		if port := field("port"); port != "" {
+			p, err := strconv.ParseUint(port, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("inventory: line %d: invalid port %q", line+2, port)
+			}
+			host.Port = uint(p)
+		}
+
+		for _, group := range strings.Split(field("groups"), ";") {
+			if group = strings.TrimSpace(group); group != "" {
+				host.Groups = append(host.Groups, group)
+			}
+		}
+
+		for _, tag := range strings.Split(field("tags"), ";") {
+			if tag = strings.TrimSpace(tag); tag == "" {
+				continue
+			}
+			if host.Tags == nil {
+				host.Tags = make(map[string]string)
+			}
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) == 2 {
+				host.Tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			} else {
+				host.Tags[kv[0]] = ""
+			}
+		}
+
+		inv.Hosts = append(inv.Hosts, host)
+	}
+
+	return inv, inv.validate()
+}
+
+// validate checks that every host is named, addressed and that jump hosts exist.
+func (inv *Inventory) validate() error {
+
+	seen := make(map[string]bool, len(inv.Hosts))
+	for i, h := range inv.Hosts {
+		if h.Name == "" {
+			return fmt.Errorf("inventory: host #%d has no name", i+1)
+		}
+		if h.Addr == "" {
+			return fmt.Errorf("inventory: host %q has no addr", h.Name)
+		}
+		if seen[h.Name] {
+			return fmt.Errorf("inventory: duplicate host %q", h.Name)
+		}
+		seen[h.Name] = true
+	}
+
+	for _, h := range inv.Hosts {
+		if h.Jump != "" && !seen[h.Jump] {
+			return fmt.Errorf("inventory: host %q uses unknown jump host %q", h.Name, h.Jump)
+		}
+	}
+
+	// the jump hosts of a host must not lead back to it.
+	for _, h := range inv.Hosts {
+		chain := map[string]bool{h.Name: true}
+		for jump, _ := inv.Host(h.Jump); jump.Name != ""; jump, _ = inv.Host(jump.Jump) {
+			if chain[jump.Name] {
+				return fmt.Errorf("inventory: host %q has a jump host loop through %q", h.Name, jump.Name)
+			}
+			chain[jump.Name] = true
+		}
+	}
+
+	return nil
+}
+
+// Host returns the host with the given name.
+func (inv *Inventory) Host(name string) (Host, bool) {
+	for _, h := range inv.Hosts {
+		if h.Name == name {
+			return h, true
+		}
+	}
+	return Host{}, false
+}
+
+// Config returns a goph Config for the named host. Auth, Timeout, Callback and
+// any other connection settings are copied from defaults, the host's address,
+// port and user override them. The host's jump host, if any, is the Proxy
+// of the config, with its own jump host as its Proxy and so on.
+func (inv *Inventory) Config(name string, defaults goph.Config) (*goph.Config, error) {
+
+	h, ok := inv.Host(name)
+	if !ok {
+		return nil, fmt.Errorf("inventory: unknown host %q", name)
+	}
+
+	return inv.config(h, defaults), nil
+}
+
+func (inv *Inventory) config(h Host, defaults goph.Config) *goph.Config {
+
+	c := defaults
+	c.Addr = h.Addr
+
+	if h.Port != 0 {
+		c.Port = h.Port
+	}
+	if c.Port == 0 {
+		c.Port = 22
+	}
+	if h.User != "" {
+		c.User = h.User
+	}
+	if c.Timeout == 0 {
+		c.Timeout = goph.DefaultTimeout
+	}
+	if jump, ok := inv.Host(h.Jump); ok {
+		c.Proxy = inv.config(jump, defaults)
+	}
+
+	return &c
+}
+
+// Configs returns a Config for every host, in inventory order.
+func (inv *Inventory) Configs(defaults goph.Config) []*goph.Config {
+
+	configs := make([]*goph.Config, 0, len(inv.Hosts))
+	for _, h := range inv.Hosts {
+		configs = append(configs, inv.config(h, defaults))
+	}
+
+	return configs
+}
+
+// All returns a group named "all" holding every host.
+func (inv *Inventory) All(defaults goph.Config) *goph.Group {
+	return goph.NewGroup("all", inv.Configs(defaults)...)
+}
+
+// Groups returns one group per group name used by the hosts.
+func (inv *Inventory) Groups(defaults goph.Config) map[string]*goph.Group {
+
+	groups := make(map[string]*goph.Group)
+	for _, h := range inv.Hosts {
+		for _, name := range h.Groups {
+			g, ok := groups[name]
+			if !ok {
+				g = goph.NewGroup(name)
+				groups[name] = g
+			}
+			g.Add(inv.config(h, defaults))
+		}
+	}
+
+	return groups
+}
+
+// Group returns the named group, and false if no host belongs to it.
+func (inv *Inventory) Group(name string, defaults goph.Config) (*goph.Group, bool) {
+	g, ok := inv.Groups(defaults)[name]
+	return g, ok
+}
+
+// GroupNames returns the sorted names of all groups used by the hosts.
+func (inv *Inventory) GroupNames() []string {
+
+	seen := make(map[string]bool)
+	for _, h := range inv.Hosts {
+		for _, name := range h.Groups {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
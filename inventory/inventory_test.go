@@ -0,0 +1,201 @@
+package inventory_test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"github.com/babbage88/goph/v2/inventory"
+)
+
+func TestInventory(t *testing.T) {
+
+	t.Run("loadJSONTest", loadJSONTest)
+	t.Run("loadYAMLTest", loadYAMLTest)
+	t.Run("loadCSVTest", loadCSVTest)
+	t.Run("unknownJumpTest", unknownJumpTest)
+	t.Run("jumpLoopTest", jumpLoopTest)
+}
+
+func loadJSONTest(t *testing.T) {
+
+	inv, err := inventory.LoadJSON(strings.NewReader(`{"hosts": [
+		{"name": "bastion", "addr": "10.0.0.1", "groups": ["edge"]},
+		{"name": "web1", "addr": "10.0.1.1", "port": 2222, "user": "deploy", "groups": ["web"], "jump": "bastion"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := inv.Config("web1", goph.Config{User: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Addr != "10.0.1.1" || c.Port != 2222 || c.User != "deploy" {
+		t.Errorf("unexpected config: %+v", c)
+	}
+	if c.Proxy == nil || c.Proxy.Addr != "10.0.0.1" || c.Proxy.User != "root" || c.Proxy.Proxy != nil {
+		t.Errorf("expected the bastion as proxy, got %+v", c.Proxy)
+	}
+
+	g, ok := inv.Group("web", goph.Config{})
+	if !ok || g.Len() != 1 {
+		t.Errorf("expected web group with one host")
+	}
+}
+
+func loadYAMLTest(t *testing.T) {
+
+	inv, err := inventory.LoadYAML(strings.NewReader(`
+hosts:
+  - name: db1
+    addr: 10.0.2.1
+    tags:
+      env: prod
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, ok := inv.Host("db1")
+	if !ok || h.Tags["env"] != "prod" {
+		t.Errorf("unexpected host: %+v", h)
+	}
+
+	if c := inv.Configs(goph.Config{})[0]; c.Port != 22 {
+		t.Errorf("expected default port 22, got %d", c.Port)
+	}
+}
+
+func loadCSVTest(t *testing.T) {
+
+	inv, err := inventory.LoadCSV(strings.NewReader("name,addr,port,groups,tags\n" +
+		"app1,10.0.3.1,22,app;eu,env=prod;region=eu\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, _ := inv.Host("app1")
+	if len(h.Groups) != 2 || h.Tags["region"] != "eu" {
+		t.Errorf("unexpected host: %+v", h)
+	}
+}
+
+func unknownJumpTest(t *testing.T) {
+
+	_, err := inventory.LoadJSON(strings.NewReader(`{"hosts": [{"name": "a", "addr": "a", "jump": "missing"}]}`))
+	if err == nil {
+		t.Error("it should return an error")
+	}
+}
+
+func jumpLoopTest(t *testing.T) {
+
+	_, err := inventory.LoadJSON(strings.NewReader(`{"hosts": [
+		{"name": "a", "addr": "a", "jump": "b"},
+		{"name": "b", "addr": "b", "jump": "a"}
+	]}`))
+	if err == nil {
+		t.Error("it should return an error")
+	}
+}
+
+func TestJump(t *testing.T) {
+
+	target := gophtest.NewServer()
+	target.AddUser("alice", "secret")
+	target.HandleFunc("hostname", func(e *gophtest.Exec) int {
+		fmt.Fprintln(e.Stdout, "web1")
+		return 0
+	})
+	if err := target.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	bastion := gophtest.NewServer()
+	bastion.HostKey = target.HostKey
+	bastion.Forwarding = true
+	bastion.AddUser("alice", "secret")
+	if err := bastion.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bastion.Close()
+
+	bastionHost, bastionPort, _ := net.SplitHostPort(bastion.Addr())
+	targetHost, targetPort, _ := net.SplitHostPort(target.Addr())
+
+	inv, err := inventory.LoadJSON(strings.NewReader(fmt.Sprintf(`{"hosts": [
+		{"name": "bastion", "addr": %q, "port": %s},
+		{"name": "web1", "addr": %q, "port": %s, "jump": "bastion"}
+	]}`, bastionHost, bastionPort, targetHost, targetPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dials []string
+
+	defaults := *target.Config("alice", "secret")
+	defaults.OnDial = func(e goph.DialEvent) { dials = append(dials, e.Host) }
+
+	config, err := inv.Config("web1", defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	out, err := client.Run("hostname")
+	if err != nil || string(out) != "web1\n" {
+		t.Fatalf("expected the command run on web1, got %q, %v", out, err)
+	}
+
+	if len(dials) != 2 || dials[0] != bastion.Addr() || dials[1] != target.Addr() {
+		t.Errorf("expected web1 dialed through the bastion, got %q", dials)
+	}
+}
+
+func TestSelector(t *testing.T) {
+
+	inv, err := inventory.LoadCSV(strings.NewReader("name,addr,groups,tags\n" +
+		"web1,10.0.0.1,web,env=prod;region=eu\n" +
+		"web2,10.0.0.2,web,env=prod;region=us;canary\n" +
+		"db1,10.0.0.3,db,env=staging;region=eu\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]int{
+		"":                                   3,
+		"env==prod && region==eu":            1,
+		"env==prod && !canary":               1,
+		"group==web || region==eu":           3,
+		"(group==db || canary) && env!=prod": 1,
+		`name=="web2"`:                       1,
+	}
+
+	for expr, want := range tests {
+		g, err := inv.Select(expr, goph.Config{})
+		if err != nil {
+			t.Errorf("%q: %s", expr, err)
+			continue
+		}
+		if g.Len() != want {
+			t.Errorf("%q: expected %d hosts, got %d", expr, want, g.Len())
+		}
+	}
+
+	for _, expr := range []string{"env==", "(env==prod", "&& env", "env==prod)"} {
+		if _, err := inventory.ParseSelector(expr); err == nil {
+			t.Errorf("%q: it should return an error", expr)
+		}
+	}
+}
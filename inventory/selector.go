@@ -0,0 +1,291 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/babbage88/goph/v2"
+)
+
+// Selector matches inventory hosts.
+type Selector interface {
+	Match(h Host) bool
+}
+
+// SelectorFunc adapts a function to a Selector.
+type SelectorFunc func(h Host) bool
+
+// Match calls f(h).
+func (f SelectorFunc) Match(h Host) bool {
+	return f(h)
+}
+
+// ParseSelector parses a selector expression such as:
+//
+//	env==prod && region==eu
+//	(role==web || role==api) && !canary
+//	group==db && region!=us
+//
+// A bare key matches hosts having that tag, "!key" hosts that don't.
+// The keys "name" and "group" match the host name and its group
+// membership unless the host defines a tag with the same key.
+// An empty expression matches every host.
+func ParseSelector(expr string) (Selector, error) {
+
+	p := &parser{tokens: tokenize(expr), expr: expr}
+	if len(p.tokens) == 0 {
+		return SelectorFunc(func(Host) bool { return true }), nil
+	}
+
+	s, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	return s, nil
+}
+
+// Select returns a group of the hosts matching the selector expression.
+func (inv *Inventory) Select(expr string, defaults goph.Config) (*goph.Group, error) {
+
+	s, err := ParseSelector(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv.SelectFunc(expr, s, defaults), nil
+}
+
+// SelectFunc returns a group with the given name of the hosts matching s.
+func (inv *Inventory) SelectFunc(name string, s Selector, defaults goph.Config) *goph.Group {
+
+	g := goph.NewGroup(name)
+	for _, h := range inv.Hosts {
+		if s.Match(h) {
+			g.Add(inv.config(h, defaults))
+		}
+	}
+
+	return g
+}
+
+// HasTag reports whether the host has the tag key, with the given value when
+// values are passed.
+func (h Host) HasTag(key string, values ...string) bool {
+
+	v, ok := h.lookup(key)
+	if !ok || len(values) == 0 {
+		return ok
+	}
+
+	for _, want := range values {
+		if v == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+// InGroup reports whether the host belongs to the named group.
+func (h Host) InGroup(name string) bool {
+	for _, g := range h.Groups {
+		if g == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (h Host) lookup(key string) (string, bool) {
+
+	if v, ok := h.Tags[key]; ok {
+		return v, true
+	}
+
+	if key == "name" {
+		return h.Name, true
+	}
+
+	return "", false
+}
+
+func (h Host) equals(key, value string) bool {
+
+	if _, ok := h.Tags[key]; !ok && key == "group" {
+		return h.InGroup(value)
+	}
+
+	return h.HasTag(key, value)
+}
+
+type parser struct {
+	expr   string
+	tokens []string
+	pos    int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("inventory: selector %q: %s", p.expr, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) or() (Selector, error) {
+
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = SelectorFunc(func(h Host) bool { return l.Match(h) || right.Match(h) })
+	}
+
+	return left, nil
+}
+
+func (p *parser) and() (Selector, error) {
+
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = SelectorFunc(func(h Host) bool { return l.Match(h) && right.Match(h) })
+	}
+
+	return left, nil
+}
+
+func (p *parser) unary() (Selector, error) {
+
+	switch t := p.next(); t {
+	case "":
+		return nil, p.errorf("unexpected end of expression")
+
+	case "!":
+		s, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return SelectorFunc(func(h Host) bool { return !s.Match(h) }), nil
+
+	case "(":
+		s, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, p.errorf("missing )")
+		}
+		return s, nil
+
+	default:
+		if isOperator(t) {
+			return nil, p.errorf("unexpected %q", t)
+		}
+
+		key := t
+		op := p.peek()
+		if op != "==" && op != "!=" {
+			return SelectorFunc(func(h Host) bool { return h.HasTag(key) }), nil
+		}
+		p.next()
+
+		value := p.next()
+		if value == "" || isOperator(value) {
+			return nil, p.errorf("missing value after %s%s", key, op)
+		}
+		value = strings.Trim(value, `"`)
+
+		if op == "!=" {
+			return SelectorFunc(func(h Host) bool { return !h.equals(key, value) }), nil
+		}
+		return SelectorFunc(func(h Host) bool { return h.equals(key, value) }), nil
+	}
+}
+
+func isOperator(t string) bool {
+	switch t {
+	case "(", ")", "!", "&&", "||", "==", "!=":
+		return true
+	}
+	return false
+}
+
+// tokenize splits a selector expression into operators, parentheses and words.
+func tokenize(expr string) (tokens []string) {
+
+	for i := 0; i < len(expr); {
+
+		c := expr[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case i+1 < len(expr) && (expr[i:i+2] == "&&" || expr[i:i+2] == "||" || expr[i:i+2] == "==" || expr[i:i+2] == "!="):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+
+		case c == '(' || c == ')' || c == '!':
+			tokens = append(tokens, string(c))
+			i++
+
+		case c == '"':
+			j := strings.IndexByte(expr[i+1:], '"')
+			if j < 0 {
+				tokens = append(tokens, expr[i:])
+				return
+			}
+			tokens = append(tokens, expr[i:i+j+2])
+			i += j + 2
+
+		default:
+			j := i
+			for j < len(expr) && !strings.ContainsRune(" \t\n()!&|=\"", rune(expr[j])) {
+				j++
+			}
+			if j == i {
+				// lone operator character, keep it so the parser reports it.
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+
+	return tokens
+}
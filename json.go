@@ -0,0 +1,83 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// RunJSON runs cmd and decodes its stdout as a JSON value into v. Errors
+// include the command stderr, which usually tells why a command printed
+// no or invalid JSON.
+func (c Client) RunJSON(ctx context.Context, cmd string, v any) error {
+
+	stdout, stderr, err := c.runOutput(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(stdout, v); err != nil {
+		return c.jsonError(cmd, err, stderr)
+	}
+
+	return nil
+}
+
+// RunJSONLines runs cmd and decodes each JSON value of its stdout, like
+// the lines of JSON-lines output, as an element appended to the slice
+// pointed to by v.
+func (c Client) RunJSONLines(ctx context.Context, cmd string, v any) error {
+
+	slice := reflect.ValueOf(v)
+	if slice.Kind() != reflect.Pointer || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("goph: RunJSONLines needs a slice pointer, got %T", v)
+	}
+	slice = slice.Elem()
+
+	stdout, stderr, err := c.runOutput(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(stdout))
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		if err = dec.Decode(elem.Interface()); errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return c.jsonError(cmd, err, stderr)
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+}
+
+// runOutput runs cmd and returns its stdout and stderr.
+func (c Client) runOutput(ctx context.Context, cmd string) (stdout, stderr []byte, err error) {
+
+	command, err := c.CommandContext(ctx, cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var errBuf bytes.Buffer
+	command.Stderr = &errBuf
+
+	if stdout, err = command.Output(); err != nil {
+		return nil, errBuf.Bytes(), c.Config.redactError(outputError(err, errBuf.Bytes()))
+	}
+
+	return stdout, errBuf.Bytes(), nil
+}
+
+// jsonError returns the decode error of the output of cmd.
+func (c Client) jsonError(cmd string, err error, stderr []byte) error {
+	return c.Config.opError(OpError{Op: "run", Command: cmd, Err: outputError(fmt.Errorf("decode json: %w", err), stderr)})
+}
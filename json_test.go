@@ -0,0 +1,66 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestRunJSON(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("ip -j addr", func(e *gophtest.Exec) int {
+		fmt.Fprint(e.Stdout, `[{"ifname":"lo","mtu":65536},{"ifname":"eth0","mtu":1500}]`)
+		return 0
+	})
+	srv.HandleFunc("journalctl -o json", func(e *gophtest.Exec) int {
+		fmt.Fprint(e.Stdout, "{\"MESSAGE\":\"started\"}\n{\"MESSAGE\":\"ready\"}\n")
+		return 0
+	})
+	srv.HandleFunc("broken", func(e *gophtest.Exec) int {
+		fmt.Fprint(e.Stdout, "not json")
+		fmt.Fprint(e.Stderr, "warning: old version")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	var links []struct {
+		Name string `json:"ifname"`
+		MTU  int    `json:"mtu"`
+	}
+	if err = client.RunJSON(ctx, "ip -j addr", &links); err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[1].Name != "eth0" || links[1].MTU != 1500 {
+		t.Errorf("unexpected links %+v", links)
+	}
+
+	var entries []map[string]string
+	if err = client.RunJSONLines(ctx, "journalctl -o json", &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1]["MESSAGE"] != "ready" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+
+	var v any
+	if err = client.RunJSON(ctx, "broken", &v); err == nil || !strings.Contains(err.Error(), "warning: old version") {
+		t.Errorf("the decode error should include stderr, got %v", err)
+	}
+}
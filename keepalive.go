@@ -0,0 +1,96 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrKeepAlive is the disconnect cause of a connection closed because a
+// keepalive request was not answered in time.
+var ErrKeepAlive = errors.New("goph: keepalive not answered")
+
+// minReconnectDelay and maxReconnectDelay bound the backoff between the
+// attempts of AutoReconnect.
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+// keepAlive sends a keepalive request every Config.KeepAlive of config,
+// the config of the dial, and closes conn when one fails or is not answered
+// within the interval, it returns when the connection is closed.
+func (c *Client) keepAlive(conn *ssh.Client, state *clientState, config *Config) {
+
+	interval := config.KeepAlive
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-state.done:
+			return
+		case <-ticker.C:
+		}
+
+		// SendRequest blocks until the reply, which never comes from a
+		// dead peer.
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := conn.SendRequest(keepAliveRequest, true, nil)
+			reply <- err
+		}()
+
+		var err error
+		select {
+		case <-state.done:
+			return
+		case err = <-reply:
+			if err == nil {
+				continue
+			}
+			err = errors.Join(ErrKeepAlive, err)
+		case <-time.After(interval):
+			err = ErrKeepAlive
+		}
+
+		config.logger().Warn("keepalive failed, closing connection", config.logAttrs("error", err)...)
+
+		state.lost.Store(&err)
+		conn.Close()
+		return
+	}
+}
+
+// autoReconnect re-dials the host with config once the connection of
+// state broke, until it succeeds or the client is closed.
+func (c *Client) autoReconnect(state *clientState, config *Config) {
+
+	delay := minReconnectDelay
+
+	for !state.closed.Load() {
+
+		conn, next, err := c.redial(context.Background(), state, config)
+		if err == nil {
+			// the client was closed while dialing.
+			if state.closed.Load() {
+				Client{Client: conn, Config: config, state: next}.closeConn()
+			}
+			return
+		}
+
+		config.logger().Warn("auto reconnect failed", config.logAttrs("error", err, "retry", delay)...)
+
+		time.Sleep(delay)
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
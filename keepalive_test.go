@@ -0,0 +1,133 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// freezeConn stops delivering what the server sends once frozen, like a
+// connection dropped by a NAT gateway.
+type freezeConn struct {
+	net.Conn
+	frozen atomic.Bool
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *freezeConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if c.frozen.Load() {
+		<-c.closed
+		return 0, net.ErrClosed
+	}
+	return n, err
+}
+
+func (c *freezeConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// freezeDialer dials the server and keeps the last connection.
+type freezeDialer struct {
+	srv  *gophtest.Server
+	mu   sync.Mutex
+	last *freezeConn
+}
+
+func (d *freezeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, d.srv.Addr())
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last = &freezeConn{Conn: conn, closed: make(chan struct{})}
+	return d.last, nil
+}
+
+func (d *freezeDialer) freeze() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last.frozen.Store(true)
+}
+
+// drop closes the last connection, like a server restart.
+func (d *freezeDialer) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last.Close()
+}
+
+func TestKeepAlive(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("echo hi", func(e *gophtest.Exec) int {
+		fmt.Fprintln(e.Stdout, "hi")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var (
+		dialer       = &freezeDialer{srv: srv}
+		disconnected = make(chan error, 1)
+		reconnected  = make(chan struct{}, 1)
+	)
+
+	config := srv.Config("alice", "secret")
+	config.Dialer = dialer
+	config.KeepAlive = 50 * time.Millisecond
+	config.AutoReconnect = true
+	config.OnDisconnect = func(info goph.ConnInfo) { disconnected <- info.Err }
+	config.OnReconnect = func(goph.ConnInfo) { reconnected <- struct{}{} }
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// answered keepalives keep the connection open.
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case err := <-disconnected:
+		t.Fatalf("unexpected disconnect: %v", err)
+	default:
+	}
+
+	dialer.freeze()
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, goph.ErrKeepAlive) {
+			t.Errorf("expected ErrKeepAlive, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the frozen connection was not closed")
+	}
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client did not reconnect")
+	}
+
+	out, err := client.Run("echo hi")
+	if err != nil || string(out) != "hi\n" {
+		t.Errorf("expected the reconnected client to run commands, got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHostsDB is a known hosts database read from a known_hosts file or
+// from memory, which can trust new hosts on first use. Unlike the callback
+// of KnownHosts, fixed once the file is read, hosts can be added to it
+// while its Callback checks connections. It is safe for concurrent use.
+type KnownHostsDB struct {
+
+	// Hash writes the host names of the new entries hashed, like the
+	// HashKnownHosts option of ssh, so the file does not list the hosts.
+	Hash bool
+
+	// path is the file new entries are appended to, empty in memory.
+	path string
+
+	mu       sync.Mutex
+	data     []byte
+	callback ssh.HostKeyCallback
+
+	// promptMu serializes the prompts of concurrent connections.
+	promptMu sync.Mutex
+}
+
+// LoadKnownHosts reads the known hosts file path, a missing file is empty.
+// New entries are appended to the file.
+func LoadKnownHosts(path string) (*KnownHostsDB, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	db, err := NewKnownHostsDB(data)
+	if err != nil {
+		return nil, err
+	}
+	db.path = path
+
+	return db, nil
+}
+
+// NewKnownHostsDB returns a database of the known_hosts lines of data, new
+// entries are only kept in memory, see Bytes.
+func NewKnownHostsDB(data []byte) (*KnownHostsDB, error) {
+
+	db := &KnownHostsDB{data: bytes.Clone(data)}
+
+	var err error
+	if db.callback, err = parseKnownHosts(db.data); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// parseKnownHosts returns the callback checking the known_hosts lines of
+// data. The knownhosts package only reads files, so data goes through a
+// temporary one.
+func parseKnownHosts(data []byte) (ssh.HostKeyCallback, error) {
+
+	f, err := os.CreateTemp("", "goph-known-hosts-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return knownhosts.New(f.Name())
+}
+
+// Check checks the key of host, a host name or address with an optional
+// port. It returns ErrUnknownHost when the host is not known, and
+// ErrHostKeyMismatch when it is known with other keys, both wrapping the
+// knownhosts.KeyError.
+func (db *KnownHostsDB) Check(host string, remote net.Addr, key ssh.PublicKey) error {
+
+	db.mu.Lock()
+	callback := db.callback
+	db.mu.Unlock()
+
+	if remote == nil {
+		remote = &net.TCPAddr{}
+	}
+
+	return connectError(callback(knownHostPort(host), remote, key))
+}
+
+// Add adds the keys of hosts, skipping the addresses already known with
+// the same key, and appends them to the file of a loaded database with
+// AddKnownHosts. Nothing is added when a key is marked @revoked, the
+// *knownhosts.RevokedError is returned instead.
+func (db *KnownHostsDB) Add(hosts ...KnownHost) error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var (
+		lines []byte
+		err   error
+	)
+	if db.path != "" {
+		lines, _, err = addKnownHosts(db.path, db.callback, db.Hash, hosts)
+	} else {
+		lines, _, err = knownHostLines(db.callback, db.Hash, hosts)
+	}
+	if err != nil || len(lines) == 0 {
+		return err
+	}
+
+	data := db.data
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	data = append(data, lines...)
+
+	// the callback is refreshed once for all the hosts added.
+	var callback ssh.HostKeyCallback
+	if db.path != "" {
+		callback, err = knownhosts.New(db.path)
+	} else {
+		callback, err = parseKnownHosts(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	db.data, db.callback = data, callback
+
+	return nil
+}
+
+// Bytes returns the known_hosts lines of the database.
+func (db *KnownHostsDB) Bytes() []byte {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return bytes.Clone(db.data)
+}
+
+// Callback returns the host key callback accepting the known hosts, see
+// Check.
+func (db *KnownHostsDB) Callback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return db.Check(hostname, remote, key)
+	}
+}
+
+// PromptCallback returns the host key callback accepting the known hosts,
+// and asking prompt about the unknown ones with the SHA256 fingerprint of
+// their key, like "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8".
+// The hosts accepted are added to the database. Changed keys are always
+// rejected with ErrHostKeyMismatch, without prompting.
+func (db *KnownHostsDB) PromptCallback(prompt func(host, fingerprint string) bool) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+
+		if err := db.Check(hostname, remote, key); !errors.Is(err, ErrUnknownHost) {
+			return err
+		}
+
+		db.promptMu.Lock()
+		defer db.promptMu.Unlock()
+
+		// another connection may have added the host while prompting.
+		err := db.Check(hostname, remote, key)
+		if !errors.Is(err, ErrUnknownHost) {
+			return err
+		}
+
+		if prompt == nil || !prompt(hostname, ssh.FingerprintSHA256(key)) {
+			return err
+		}
+
+		if err := db.Add(KnownHost{Host: hostname, Remote: remote, Key: key}); err != nil {
+			return fmt.Errorf("add known host: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// HostKeyPromptCallback returns the PromptCallback of the default known
+// hosts file, trusting the hosts accepted by prompt on first use.
+func HostKeyPromptCallback(prompt func(host, fingerprint string) bool) (ssh.HostKeyCallback, error) {
+
+	path, err := DefaultKnownHostsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := LoadKnownHosts(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.PromptCallback(prompt), nil
+}
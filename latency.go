@@ -0,0 +1,236 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// keepAliveRequest is the global request used to measure round trips,
+// servers reply to unknown requests with a failure which is enough.
+const keepAliveRequest = "keepalive@openssh.com"
+
+// Latency measures the round-trip time of an ssh keepalive request.
+func (c Client) Latency(ctx context.Context) (time.Duration, error) {
+
+	c = c.live()
+
+	type reply struct {
+		d   time.Duration
+		err error
+	}
+
+	ch := make(chan reply, 1)
+
+	go func() {
+		start := time.Now()
+		_, _, err := c.SendRequest(keepAliveRequest, true, nil)
+		ch <- reply{time.Since(start), err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.d, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// ExecLatency measures the time to open a session and run a trivial command,
+// it includes the server side process startup unlike Latency.
+func (c Client) ExecLatency(ctx context.Context) (time.Duration, error) {
+
+	start := time.Now()
+
+	cmd, err := c.CommandContext(ctx, "true")
+	if err != nil {
+		return 0, err
+	}
+	defer cmd.Close()
+
+	if err = cmd.Run(); err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
+
+// Closest returns the client with the lowest latency, and its latency.
+func Closest(ctx context.Context, clients ...*Client) (*Client, time.Duration, error) {
+
+	var (
+		best    *Client
+		bestRTT time.Duration
+		lastErr = errors.New("goph: no clients")
+	)
+
+	for _, c := range clients {
+		d, err := c.Latency(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if best == nil || d < bestRTT {
+			best, bestRTT = c, d
+		}
+	}
+
+	if best == nil {
+		return nil, 0, lastErr
+	}
+
+	return best, bestRTT, nil
+}
+
+// LatencyStats is a summary of the latency samples in the sampler window.
+type LatencyStats struct {
+	Last    time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Mean    time.Duration
+	Samples int
+
+	// Errors is the number of failed measurements in the window.
+	Errors int
+
+	// LastErr is the error of the last failed measurement.
+	LastErr error
+}
+
+// LatencySampler periodically measures a client latency and keeps a rolling
+// window of samples, for detecting degraded links.
+type LatencySampler struct {
+	client   *Client
+	interval time.Duration
+	window   int
+
+	mu      sync.Mutex
+	samples []time.Duration
+	errs    []bool
+	lastErr error
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewLatencySampler returns a sampler measuring c every interval and
+// keeping the last window samples.
+func NewLatencySampler(c *Client, interval time.Duration, window int) *LatencySampler {
+
+	if window <= 0 {
+		window = 1
+	}
+
+	return &LatencySampler{
+		client:   c,
+		interval: interval,
+		window:   window,
+	}
+}
+
+// Start starts sampling until ctx is done or Stop is called.
+func (s *LatencySampler) Start(ctx context.Context) {
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	done := s.done
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.Sample(ctx)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops sampling and waits for the sampling goroutine to exit.
+func (s *LatencySampler) Stop() {
+
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Sample takes a single measurement and adds it to the window.
+func (s *LatencySampler) Sample(ctx context.Context) (time.Duration, error) {
+
+	timeout := s.interval
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d, err := s.client.Latency(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = append(s.samples, d)
+	s.errs = append(s.errs, err != nil)
+	if err != nil {
+		s.lastErr = err
+	}
+
+	if len(s.samples) > s.window {
+		s.samples = s.samples[1:]
+		s.errs = s.errs[1:]
+	}
+
+	return d, err
+}
+
+// Stats returns a summary of the current window.
+func (s *LatencySampler) Stats() LatencyStats {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := LatencyStats{LastErr: s.lastErr}
+
+	var total time.Duration
+	for i, d := range s.samples {
+		if s.errs[i] {
+			stats.Errors++
+			continue
+		}
+		if stats.Samples == 0 || d < stats.Min {
+			stats.Min = d
+		}
+		if d > stats.Max {
+			stats.Max = d
+		}
+		stats.Last = d
+		total += d
+		stats.Samples++
+	}
+
+	if stats.Samples > 0 {
+		stats.Mean = total / time.Duration(stats.Samples)
+	}
+
+	return stats
+}
@@ -0,0 +1,250 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// ConnInfo describes a client connection for the lifecycle hooks.
+type ConnInfo struct {
+	User string
+
+	// Host is the "host:port" address of the config.
+	Host string
+
+	LocalAddr     net.Addr
+	RemoteAddr    net.Addr
+	ServerVersion string
+
+	// Time of the event.
+	Time time.Time
+
+	// Err is the disconnect cause, nil when the client was closed.
+	Err error
+}
+
+// clientState is the mutable state shared by the copies of a Client.
+type clientState struct {
+	closed  atomic.Bool
+	counter *countingConn
+
+	// done is closed once the connection is closed, err is then the
+	// disconnect cause.
+	done chan struct{}
+	err  error
+
+	// lost is the cause of a connection closed by keepAlive.
+	lost atomic.Pointer[error]
+
+	banner         string
+	bannerReceived bool
+
+	// drain tracks the operations in flight for Shutdown.
+	drain drain
+
+	// limiter applies the command rate and session limits, nil without.
+	limiter *limiter
+
+	// user caches the remote user resolved by Whoami.
+	userMu sync.Mutex
+	user   *RemoteUser
+
+	// env caches the remote environment read by Environ.
+	envMu sync.Mutex
+	env   map[string]string
+
+	// sftp is the sftp client shared by the file operations and FS.
+	sftpMu sync.Mutex
+	sftp   *sftp.Client
+
+	// credentials are applied to the config on the next dial.
+	credentials credentials
+
+	// release, if set, releases a reference to a shared client and
+	// reports whether it was the last one.
+	release func() bool
+
+	// live holds the current connection of the client. It is shared by
+	// the states of the successive connections and replaced by redial, so
+	// the client follows the reconnects made in the background.
+	live *atomic.Pointer[liveConn]
+}
+
+// liveConn is a connection of a client with its state.
+type liveConn struct {
+	client *ssh.Client
+	state  *clientState
+}
+
+// live returns c with the current connection of the client, the one of its
+// last reconnect. The methods read the connection and the state through
+// it, never from c directly.
+func (c Client) live() Client {
+
+	if c.state == nil || c.state.live == nil {
+		return c
+	}
+
+	if l := c.state.live.Load(); l != nil {
+		c.Client, c.state = l.client, l.state
+	}
+
+	return c
+}
+
+// connInfo returns the info of the ssh connection conn.
+func (c *Config) connInfo(conn *ssh.Client, err error) ConnInfo {
+
+	info := ConnInfo{
+		User: c.User,
+		Host: c.hostPort(),
+		Time: time.Now(),
+		Err:  err,
+	}
+
+	if conn != nil {
+		info.LocalAddr = conn.LocalAddr()
+		info.RemoteAddr = conn.RemoteAddr()
+		info.ServerVersion = string(conn.ServerVersion())
+	}
+
+	return info
+}
+
+// connected initializes the client state once conn is established and
+// starts watching it for disconnects.
+func (c *Client) connected(conn *ssh.Client, state *clientState) {
+
+	c.state = state
+
+	state.live = new(atomic.Pointer[liveConn])
+	state.live.Store(&liveConn{client: conn, state: state})
+
+	if c.Config.OnConnect != nil {
+		c.Config.OnConnect(c.Config.connInfo(conn, nil))
+	}
+
+	c.startWatchers(conn, c.state, *c.Config)
+}
+
+// startWatchers starts watching conn for disconnects, idleness and
+// keepalives with a copy of the config, so the watchers never read the
+// config of the caller, which may change it, after dial. Their hooks are
+// those of the config at dial.
+func (c *Client) startWatchers(conn *ssh.Client, state *clientState, config Config) {
+	go c.watch(conn, state, &config)
+	go c.idle(conn, state, &config)
+	go c.keepAlive(conn, state, &config)
+}
+
+// watch waits for conn to close and calls the OnDisconnect hook.
+func (c *Client) watch(conn *ssh.Client, state *clientState, config *Config) {
+
+	err := conn.Wait()
+	if lost := state.lost.Load(); lost != nil {
+		err = *lost
+	}
+	if state.closed.Load() {
+		err = nil
+	}
+
+	state.err = err
+	close(state.done)
+
+	config.logger().Info("disconnected", config.logAttrs("error", err)...)
+
+	if config.OnDisconnect != nil {
+		config.OnDisconnect(config.connInfo(conn, err))
+	}
+
+	if err != nil && config.AutoReconnect {
+		c.autoReconnect(state, config)
+	}
+}
+
+// Done returns a channel closed when the connection closes, for
+// supervisors reacting to disconnects. Reconnect replaces the connection,
+// Done must then be called again.
+func (c Client) Done() <-chan struct{} {
+	c = c.live()
+	if c.state == nil {
+		return nil
+	}
+	return c.state.done
+}
+
+// Wait blocks until the connection closes and returns the disconnect
+// cause, nil when the client was closed.
+func (c Client) Wait() error {
+	c = c.live()
+	if c.state == nil {
+		return c.Client.Wait()
+	}
+	<-c.state.done
+	return c.state.err
+}
+
+// Reconnect closes the current connection and dials the host again with the
+// client config, calling the OnReconnect hook on success. Reconnect must not
+// be called concurrently with other client methods.
+func (c *Client) Reconnect(ctx context.Context) error {
+
+	*c = c.live()
+
+	if c.Client != nil {
+		c.closeConn()
+	}
+
+	conn, state, err := c.redial(ctx, c.state, c.Config)
+	if err != nil {
+		return err
+	}
+
+	c.Client, c.state = conn, state
+
+	return nil
+}
+
+// redial dials the host again with config and makes the new connection the
+// live one of the client, prev being the state of the previous one. It
+// never writes c, which the background reconnects share with the caller.
+func (c *Client) redial(ctx context.Context, prev *clientState, config *Config) (*ssh.Client, *clientState, error) {
+
+	auth, callback := c.applyCredentials(prev, config)
+
+	conn, state, err := config.dial(ctx, "tcp")
+	if err != nil {
+		config.logger().Error("reconnect failed", config.logAttrs("error", err)...)
+		return nil, nil, err
+	}
+
+	state.credentials.auth, state.credentials.callback = auth, callback
+
+	state.live = new(atomic.Pointer[liveConn])
+	if prev != nil {
+		state.release = prev.release
+		if prev.live != nil {
+			state.live = prev.live
+		}
+	}
+	state.live.Store(&liveConn{client: conn, state: state})
+
+	config.logger().Info("reconnected", config.logAttrs()...)
+
+	if config.OnReconnect != nil {
+		config.OnReconnect(config.connInfo(conn, nil))
+	}
+
+	c.startWatchers(conn, state, *config)
+
+	return conn, state, nil
+}
@@ -0,0 +1,230 @@
+package goph_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestDone(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other.Close()
+	if err = other.Wait(); err != nil {
+		t.Errorf("a closed client should have no disconnect error, got %v", err)
+	}
+
+	select {
+	case <-client.Done():
+		t.Fatal("the connection should be open")
+	default:
+	}
+
+	srv.Close()
+
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("done was not closed on disconnect")
+	}
+
+	if client.Wait() == nil {
+		t.Error("a lost connection should report its error")
+	}
+}
+
+func TestWatchConfigCopy(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	disconnected := make(chan goph.ConnInfo, 1)
+
+	config := srv.Config("alice", "secret")
+	config.OnDisconnect = func(info goph.ConnInfo) { disconnected <- info }
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the config may be reused once dialed, the watchers of the
+	// connection keep the copy taken on dial.
+	client.Close()
+	config.User, config.Port, config.OnDisconnect = "bob", 0, nil
+
+	select {
+	case info := <-disconnected:
+		if info.User != "alice" {
+			t.Errorf("expected the dialed user in the disconnect info, got %s", info.User)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnDisconnect was not called")
+	}
+}
+
+func TestAutoReconnectRace(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("true", func(e *gophtest.Exec) int { return 0 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var (
+		dialer      = &freezeDialer{srv: srv}
+		reconnected = make(chan struct{}, 1)
+	)
+
+	config := srv.Config("alice", "secret")
+	config.Dialer = dialer
+	config.AutoReconnect = true
+	config.OnReconnect = func(goph.ConnInfo) { reconnected <- struct{}{} }
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// a copy taken before the reconnects.
+	copied := *client
+
+	var (
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+	)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// the commands running while the connection drops fail.
+				client.Run("true")
+				copied.Stats()
+				copied.RemoteOS()
+				client.Done()
+			}
+		}()
+	}
+
+	for range 3 {
+		time.Sleep(20 * time.Millisecond)
+		dialer.drop()
+
+		select {
+		case <-reconnected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the client did not reconnect")
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	if _, err = client.Run("true"); err != nil {
+		t.Errorf("expected the reconnected client to run commands, got %v", err)
+	}
+	if _, err = copied.Run("true"); err != nil {
+		t.Errorf("expected the copy to follow the reconnects, got %v", err)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var (
+		dialer       = &freezeDialer{srv: srv}
+		connected    []goph.ConnInfo
+		reconnected  []goph.ConnInfo
+		disconnected = make(chan goph.ConnInfo, 3)
+	)
+
+	config := srv.Config("alice", "secret")
+	config.Dialer = dialer
+	config.OnConnect = func(info goph.ConnInfo) { connected = append(connected, info) }
+	config.OnReconnect = func(info goph.ConnInfo) { reconnected = append(reconnected, info) }
+	config.OnDisconnect = func(info goph.ConnInfo) { disconnected <- info }
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if len(connected) != 1 {
+		t.Fatalf("expected 1 connect event, got %d", len(connected))
+	}
+	if info := connected[0]; info.User != "alice" || info.Host != srv.Addr() || info.RemoteAddr == nil ||
+		info.LocalAddr == nil || info.ServerVersion == "" || info.Time.IsZero() || info.Err != nil {
+		t.Errorf("unexpected connect event %+v", info)
+	}
+
+	wait := func() goph.ConnInfo {
+		t.Helper()
+		select {
+		case info := <-disconnected:
+			return info
+		case <-time.After(5 * time.Second):
+			t.Fatal("no disconnect event")
+			return goph.ConnInfo{}
+		}
+	}
+
+	// the connection closed by Reconnect is not lost.
+	if err = client.Reconnect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if info := wait(); info.Err != nil || info.Host != srv.Addr() {
+		t.Errorf("unexpected disconnect event %+v", info)
+	}
+	if len(reconnected) != 1 || reconnected[0].RemoteAddr == nil || len(connected) != 1 {
+		t.Errorf("expected 1 reconnect event, got %+v", reconnected)
+	}
+
+	// a dropped connection reports its cause.
+	dialer.drop()
+	if info := wait(); info.Err == nil {
+		t.Errorf("expected the disconnect cause, got %+v", info)
+	}
+
+	if _, err = client.Run("true"); err == nil {
+		t.Error("the dropped connection should not run commands")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// LineEdit describes a line to ensure present or absent in a remote file.
+type LineEdit struct {
+
+	// Line is the line to ensure present, without newline.
+	Line string
+
+	// Regexp, if set, matches the lines to replace or remove, otherwise
+	// lines equal to Line are matched. The last matching line is replaced
+	// by Line.
+	Regexp *regexp.Regexp
+
+	// Absent removes the matching lines instead.
+	Absent bool
+
+	// InsertAfter or InsertBefore, if set and no line matches, insert Line
+	// after the last or before the first line they match. Line is appended
+	// otherwise.
+	InsertAfter  *regexp.Regexp
+	InsertBefore *regexp.Regexp
+
+	// Create creates a missing file with mode 0644 when Line is present.
+	Create bool
+}
+
+// match reports whether line is matched by the edit.
+func (e LineEdit) match(line string) bool {
+	if e.Regexp != nil {
+		return e.Regexp.MatchString(line)
+	}
+	return line == e.Line
+}
+
+// apply returns lines edited, and whether they changed.
+func (e LineEdit) apply(lines []string) ([]string, bool) {
+
+	if e.Absent {
+		kept := lines[:0:0]
+		for _, l := range lines {
+			if !e.match(l) {
+				kept = append(kept, l)
+			}
+		}
+		return kept, len(kept) != len(lines)
+	}
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		if e.match(lines[i]) {
+			if lines[i] == e.Line {
+				return lines, false
+			}
+			lines[i] = e.Line
+			return lines, true
+		}
+	}
+
+	at := len(lines)
+	switch {
+	case e.InsertAfter != nil:
+		for i := len(lines) - 1; i >= 0; i-- {
+			if e.InsertAfter.MatchString(lines[i]) {
+				at = i + 1
+				break
+			}
+		}
+	case e.InsertBefore != nil:
+		for i, l := range lines {
+			if e.InsertBefore.MatchString(l) {
+				at = i
+				break
+			}
+		}
+	}
+
+	return append(lines[:at], append([]string{e.Line}, lines[at:]...)...), true
+}
+
+// LineInFile edits a single line of the remote file, and reports whether
+// the file changed. The file is read, edited and written back through a
+// temporary file renamed over it, keeping its mode.
+func (c Client) LineInFile(remotePath string, edit LineEdit) (changed bool, err error) {
+
+	if remotePath, err = c.remotePath(remotePath); err != nil {
+		return false, err
+	}
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return false, err
+	}
+	defer ftp.Close()
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "sftp", RemotePath: remotePath, Err: err})
+	}()
+
+	var (
+		data []byte
+		mode os.FileMode = 0644
+	)
+
+	f, err := ftp.Open(remotePath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && (edit.Absent || edit.Create):
+		if edit.Absent {
+			return false, nil
+		}
+	case err != nil:
+		return false, err
+	default:
+		info, err := f.Stat()
+		if err == nil {
+			mode = info.Mode().Perm()
+			data, err = io.ReadAll(f)
+		}
+		f.Close()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	lines, changed = edit.apply(lines)
+	if !changed {
+		return false, nil
+	}
+
+	out := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		out += "\n"
+	}
+
+	if err = writeAtomic(ftp, remotePath, bytes.NewReader([]byte(out)), mode); err != nil {
+		return false, err
+	}
+
+	c.Config.logger().Info("file line changed", c.Config.logAttrs("remote", remotePath, "absent", edit.Absent)...)
+
+	return true, nil
+}
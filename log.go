@@ -0,0 +1,81 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"fmt"
+	"log/slog"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Logger receives structured events from goph, args are alternating
+// key/value pairs like log/slog. A *slog.Logger satisfies Logger.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// SlogLogger returns a Logger writing to the given slog handler.
+func SlogLogger(h slog.Handler) Logger {
+	return slog.New(h)
+}
+
+// nopLogger discards every event.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// logger returns the config logger, or a logger discarding events.
+func (c *Config) logger() Logger {
+	if c == nil || c.Logger == nil {
+		return nopLogger{}
+	}
+	return c.Logger
+}
+
+// logAttrs returns the attributes identifying the connection of c, with
+// secrets in the given values redacted.
+func (c *Config) logAttrs(args ...any) []any {
+	if c == nil {
+		return c.redactArgs(args)
+	}
+	return append([]any{"host", c.hostPort(), "user", c.User}, c.redactArgs(args)...)
+}
+
+// authMethodNames returns the ssh names of the auth methods.
+func authMethodNames(auth Auth) []string {
+
+	names := make([]string, 0, len(auth))
+	for _, m := range auth {
+		names = append(names, authMethodName(m))
+	}
+
+	return names
+}
+
+func authMethodName(m ssh.AuthMethod) string {
+
+	// ssh.AuthMethod keeps its wire name unexported, map the types returned
+	// by the ssh constructors instead.
+	switch fmt.Sprintf("%T", m) {
+	case "ssh.passwordCallback":
+		return "password"
+	case "ssh.publicKeyCallback":
+		return "publickey"
+	case "ssh.KeyboardInteractiveChallenge":
+		return "keyboard-interactive"
+	case "*ssh.gssAPIWithMICCallback":
+		return "gssapi-with-mic"
+	case "*ssh.retryableAuthMethod":
+		return "retryable"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,154 @@
+package goph_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// logEntry is a record of testHandler.
+type logEntry struct {
+	level slog.Level
+	msg   string
+	attrs map[string]string
+}
+
+// testHandler is a slog handler recording the entries in memory.
+type testHandler struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (h *testHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *testHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *testHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *testHandler) Handle(_ context.Context, r slog.Record) error {
+
+	e := logEntry{level: r.Level, msg: r.Message, attrs: make(map[string]string)}
+	r.Attrs(func(a slog.Attr) bool {
+		e.attrs[a.Key] = a.Value.String()
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, e)
+
+	return nil
+}
+
+// find returns the first entry with msg.
+func (h *testHandler) find(msg string) (logEntry, bool) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, e := range h.entries {
+		if e.msg == msg {
+			return e, true
+		}
+	}
+
+	return logEntry{}, false
+}
+
+func TestLogger(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("true", func(e *gophtest.Exec) int { return 0 })
+	srv.HandleFunc("false", func(e *gophtest.Exec) int { return 1 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	h := &testHandler{}
+
+	config := srv.Config("alice", "secret")
+	config.Logger = goph.SlogLogger(h)
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err = client.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Run("false"); err == nil {
+		t.Fatal("false should fail")
+	}
+
+	tests := []struct {
+		msg   string
+		level slog.Level
+		attrs map[string]string
+	}{
+		{"connecting", slog.LevelDebug, map[string]string{"auth": "[password]"}},
+		{"connected", slog.LevelInfo, map[string]string{"host": srv.Addr(), "user": "alice"}},
+		{"command finished", slog.LevelDebug, map[string]string{"command": "true"}},
+		{"command failed", slog.LevelError, map[string]string{"command": "false", "host": srv.Addr()}},
+	}
+
+	for _, tt := range tests {
+		e, ok := h.find(tt.msg)
+		if !ok {
+			t.Errorf("%q was not logged", tt.msg)
+			continue
+		}
+		if e.level != tt.level {
+			t.Errorf("%q: expected level %s, got %s", tt.msg, tt.level, e.level)
+		}
+		for k, v := range tt.attrs {
+			if e.attrs[k] != v {
+				t.Errorf("%q: expected %s=%s, got %q", tt.msg, k, v, e.attrs[k])
+			}
+		}
+	}
+
+	if e, _ := h.find("command failed"); e.attrs["error"] == "" {
+		t.Error("the failed command should log its error")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.entries {
+		for _, v := range e.attrs {
+			if strings.Contains(v, "secret") {
+				t.Errorf("%q should not log the password", e.msg)
+			}
+		}
+	}
+}
+
+func TestLoggerConnectFailed(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	h := &testHandler{}
+
+	config := srv.Config("alice", "wrong")
+	config.Logger = goph.SlogLogger(h)
+
+	if _, err := goph.NewConn(config); err == nil {
+		t.Fatal("the connection should fail")
+	}
+
+	e, ok := h.find("connect failed")
+	if !ok || e.level != slog.LevelError || e.attrs["error"] == "" || e.attrs["user"] != "alice" {
+		t.Errorf("expected the failure logged, got %+v", e)
+	}
+}
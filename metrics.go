@@ -0,0 +1,91 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Metrics receives connection, session, command and transfer measurements,
+// host is the "host:port" address of the connection.
+// See the gophprom package for a Prometheus implementation.
+type Metrics interface {
+	ConnectionOpened(host string)
+	ConnectionFailed(host string, err error)
+	AuthFailed(host string)
+	SessionStarted(host string)
+	SessionEnded(host string)
+	CommandDuration(host string, d time.Duration, err error)
+
+	// BytesTransferred is called per file, direction is "upload" or "download".
+	BytesTransferred(host string, direction string, n int64)
+}
+
+// nopMetrics discards every measurement.
+type nopMetrics struct{}
+
+func (nopMetrics) ConnectionOpened(string)                      {}
+func (nopMetrics) ConnectionFailed(string, error)               {}
+func (nopMetrics) AuthFailed(string)                            {}
+func (nopMetrics) SessionStarted(string)                        {}
+func (nopMetrics) SessionEnded(string)                          {}
+func (nopMetrics) CommandDuration(string, time.Duration, error) {}
+func (nopMetrics) BytesTransferred(string, string, int64)       {}
+
+// metrics returns the config metrics, or metrics discarding measurements.
+func (c *Config) metrics() Metrics {
+	if c == nil || c.Metrics == nil {
+		return nopMetrics{}
+	}
+	return c.Metrics
+}
+
+// sessionConn reports the session channels opened on the connection to
+// Metrics, once opened and once closed, whoever closes them: sessions of
+// commands and sftp clients, those of NewSession closed directly, and
+// those the server closed.
+type sessionConn struct {
+	ssh.Conn
+	metrics Metrics
+	host    string
+}
+
+// countSessions returns conn reporting its sessions to the config metrics,
+// or conn without metrics.
+func (c *Config) countSessions(conn ssh.Conn) ssh.Conn {
+	if c.Metrics == nil {
+		return conn
+	}
+	return &sessionConn{Conn: conn, metrics: c.Metrics, host: c.hostPort()}
+}
+
+func (c *sessionConn) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+
+	ch, in, err := c.Conn.OpenChannel(name, data)
+	if err != nil || name != "session" {
+		return ch, in, err
+	}
+
+	c.metrics.SessionStarted(c.host)
+
+	// the requests of the channel are closed with it.
+	reqs := make(chan *ssh.Request, cap(in))
+	go func() {
+		for r := range in {
+			reqs <- r
+		}
+		close(reqs)
+		c.metrics.SessionEnded(c.host)
+	}()
+
+	return ch, reqs, nil
+}
+
+// isAuthError reports whether err is an ssh authentication failure.
+func isAuthError(err error) bool {
+	return errors.Is(err, ErrAuthFailed)
+}
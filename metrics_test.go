@@ -0,0 +1,198 @@
+package goph_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// testMetrics records the measurements of a client.
+type testMetrics struct {
+	mu          sync.Mutex
+	opened      int
+	failed      int
+	authFailed  int
+	sessions    int
+	maxSessions int
+	commands    int
+	bytes       map[string]int64
+}
+
+func (m *testMetrics) ConnectionOpened(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opened++
+}
+
+func (m *testMetrics) ConnectionFailed(string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed++
+}
+
+func (m *testMetrics) AuthFailed(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.authFailed++
+}
+
+func (m *testMetrics) SessionStarted(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions++
+	m.maxSessions = max(m.maxSessions, m.sessions)
+}
+
+func (m *testMetrics) SessionEnded(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions--
+}
+
+func (m *testMetrics) CommandDuration(string, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands++
+}
+
+func (m *testMetrics) BytesTransferred(_ string, direction string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.bytes == nil {
+		m.bytes = make(map[string]int64)
+	}
+	m.bytes[direction] += n
+}
+
+// activeSessions waits for the sessions closed by the server to be
+// reported and returns the sessions still open.
+func (m *testMetrics) activeSessions() int {
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mu.Lock()
+		n := m.sessions
+		m.mu.Unlock()
+
+		if n == 0 || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("true", func(e *gophtest.Exec) int { return 0 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	m := &testMetrics{}
+
+	config := srv.Config("alice", "secret")
+	config.Metrics = m
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// every way of opening a session, none left open.
+	if _, err = client.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.RunContext(context.Background(), "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := client.Command("true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cmd.Output(); err != nil {
+		t.Fatal(err)
+	}
+
+	started, err := client.Command("true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = started.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err = started.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Close()
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftp.Close()
+
+	local := filepath.Join(t.TempDir(), "data")
+	if err = os.WriteFile(local, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Upload(local, "/data"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Download("/data", local+".copy"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := m.activeSessions(); n != 0 {
+		t.Errorf("expected every session ended, %d still active", n)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the commands, the session, the sftp client and the two transfers.
+	if m.maxSessions < 1 || m.opened != 1 || m.commands != 4 {
+		t.Errorf("unexpected measurements %+v", m)
+	}
+	if m.bytes["upload"] != 5 || m.bytes["download"] != 5 {
+		t.Errorf("expected 5 bytes each way, got %v", m.bytes)
+	}
+}
+
+func TestMetricsAuthFailed(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	m := &testMetrics{}
+
+	config := srv.Config("alice", "wrong")
+	config.Metrics = m
+
+	if _, err := goph.NewConn(config); err == nil {
+		t.Fatal("the connection should fail")
+	}
+
+	if m.opened != 0 || m.failed != 1 || m.authFailed != 1 {
+		t.Errorf("unexpected measurements %+v", m)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// endOfMessage delimits NETCONF 1.0 messages (RFC 6242 section 4.3).
+const endOfMessage = "]]>]]>"
+
+// maxChunkSize is the largest chunk allowed by RFC 6242.
+const maxChunkSize = 4294967295
+
+// ErrFraming is returned for messages violating the NETCONF framing.
+var ErrFraming = errors.New("netconf: invalid framing")
+
+// transport reads and writes framed NETCONF messages.
+type transport struct {
+	r *bufio.Reader
+	w io.Writer
+
+	// chunked is set once both sides announced base:1.1.
+	chunked bool
+}
+
+func newTransport(rw io.ReadWriter) *transport {
+	return &transport{r: bufio.NewReader(rw), w: rw}
+}
+
+// send writes a single message.
+func (t *transport) send(msg []byte) error {
+
+	var err error
+	if t.chunked {
+		_, err = fmt.Fprintf(t.w, "\n#%d\n%s\n##\n", len(msg), msg)
+	} else {
+		_, err = fmt.Fprintf(t.w, "%s%s", msg, endOfMessage)
+	}
+
+	return err
+}
+
+// receive reads a single message.
+func (t *transport) receive() ([]byte, error) {
+	if t.chunked {
+		return t.receiveChunked()
+	}
+	return t.receiveEOM()
+}
+
+func (t *transport) receiveEOM() ([]byte, error) {
+
+	var msg []byte
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(bytes.TrimSpace(msg)) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		msg = append(msg, b)
+		if bytes.HasSuffix(msg, []byte(endOfMessage)) {
+			return bytes.TrimSpace(msg[:len(msg)-len(endOfMessage)]), nil
+		}
+	}
+}
+
+func (t *transport) receiveChunked() ([]byte, error) {
+
+	var msg []byte
+	for {
+		// chunk headers are "\n#<size>\n", the end of chunks is "\n##\n".
+		if err := t.expect('\n'); err != nil {
+			return nil, err
+		}
+		if err := t.expect('#'); err != nil {
+			return nil, err
+		}
+
+		header, err := t.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		header = header[:len(header)-1]
+
+		if header == "#" {
+			return msg, nil
+		}
+
+		size, err := strconv.ParseUint(header, 10, 32)
+		if err != nil || size == 0 || size > maxChunkSize {
+			return nil, fmt.Errorf("%w: chunk size %q", ErrFraming, header)
+		}
+
+		chunk := make([]byte, size)
+		if _, err = io.ReadFull(t.r, chunk); err != nil {
+			return nil, err
+		}
+		msg = append(msg, chunk...)
+	}
+}
+
+func (t *transport) expect(want byte) error {
+
+	b, err := t.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != want {
+		return fmt.Errorf("%w: got %q, want %q", ErrFraming, b, want)
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+// Package netconf is a NETCONF (RFC 6241) client over goph connections, it
+// handles the hello exchange, the 1.0 and 1.1 framings and RPC replies.
+//
+//	s, err := netconf.Open(client)
+//	if err != nil {
+//		...
+//	}
+//	defer s.Close()
+//
+//	reply, err := s.Exec(ctx, "<get-config><source><running/></source></get-config>")
+package netconf
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/babbage88/goph/v2"
+)
+
+const (
+	// Namespace of the NETCONF base protocol.
+	Namespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
+	// CapabilityBase10 and CapabilityBase11 are the base protocol versions.
+	CapabilityBase10 = "urn:ietf:params:netconf:base:1.0"
+	CapabilityBase11 = "urn:ietf:params:netconf:base:1.1"
+)
+
+// DefaultCapabilities are announced by Open and NewSession.
+var DefaultCapabilities = []string{CapabilityBase10, CapabilityBase11}
+
+// Session is a NETCONF session, RPCs are executed one at a time.
+type Session struct {
+
+	// ID is the session id assigned by the server.
+	ID uint64
+
+	// ServerCapabilities are the capabilities announced by the server.
+	ServerCapabilities []string
+
+	mu        sync.Mutex
+	rwc       io.ReadWriteCloser
+	t         *transport
+	messageID uint64
+}
+
+// Open starts the "netconf" subsystem on client and exchanges hellos.
+func Open(client *goph.Client) (*Session, error) {
+
+	sub, err := client.NewSubsystem("netconf")
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewSession(sub, DefaultCapabilities...)
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewSession exchanges hellos over rwc announcing capabilities, and returns
+// the session. The 1.1 chunked framing is used when both sides support it.
+func NewSession(rwc io.ReadWriteCloser, capabilities ...string) (*Session, error) {
+
+	s := &Session{rwc: rwc, t: newTransport(rwc)}
+
+	type helloMsg struct {
+		XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
+		Capabilities []string `xml:"capabilities>capability"`
+		SessionID    uint64   `xml:"session-id,omitempty"`
+	}
+
+	// hellos are always sent with the 1.0 framing.
+	hello, err := xml.Marshal(helloMsg{Capabilities: capabilities})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.t.send(append([]byte(xml.Header), hello...)); err != nil {
+		return nil, fmt.Errorf("netconf: send hello: %w", err)
+	}
+
+	data, err := s.t.receive()
+	if err != nil {
+		return nil, fmt.Errorf("netconf: receive hello: %w", err)
+	}
+
+	var server helloMsg
+	if err = xml.Unmarshal(data, &server); err != nil {
+		return nil, fmt.Errorf("netconf: invalid server hello: %w", err)
+	}
+
+	s.ID = server.SessionID
+	s.ServerCapabilities = server.Capabilities
+	s.t.chunked = s.HasCapability(CapabilityBase11) && contains(capabilities, CapabilityBase11)
+
+	return s, nil
+}
+
+// HasCapability reports whether the server announced the capability,
+// parameters after "?" are ignored.
+func (s *Session) HasCapability(capability string) bool {
+	for _, c := range s.ServerCapabilities {
+		if c, _, _ = strings.Cut(strings.TrimSpace(c), "?"); c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Reply is an rpc-reply.
+type Reply struct {
+	MessageID string     `xml:"message-id,attr"`
+	Errors    []RPCError `xml:"rpc-error"`
+	OK        *struct{}  `xml:"ok"`
+
+	// Data is the content of the data element, if any.
+	Data InnerXML `xml:"data"`
+
+	// Raw is the whole reply.
+	Raw []byte `xml:"-"`
+}
+
+// InnerXML holds the raw content of an element.
+type InnerXML struct {
+	Content string `xml:",innerxml"`
+}
+
+// RPCError is an rpc-error of a reply.
+type RPCError struct {
+	Type     string   `xml:"error-type"`
+	Tag      string   `xml:"error-tag"`
+	Severity string   `xml:"error-severity"`
+	Path     string   `xml:"error-path"`
+	Message  string   `xml:"error-message"`
+	Info     InnerXML `xml:"error-info"`
+}
+
+func (e *RPCError) Error() string {
+	msg := fmt.Sprintf("netconf: %s %s error: %s", e.Type, e.Severity, e.Tag)
+	if m := strings.TrimSpace(e.Message); m != "" {
+		msg += ": " + m
+	}
+	return msg
+}
+
+// Exec sends the rpc operation, like "<get-config>...</get-config>", and
+// waits for its reply. Replies with error severity rpc-errors are returned
+// with the first one as error, warnings are only in the reply.
+func (s *Session) Exec(ctx context.Context, operation string) (*Reply, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// a done context aborts the session, as the reply may never come.
+	stop := context.AfterFunc(ctx, func() {
+		s.rwc.Close()
+	})
+	defer stop()
+
+	s.messageID++
+	id := strconv.FormatUint(s.messageID, 10)
+
+	rpc := fmt.Sprintf(`%s<rpc message-id="%s" xmlns="%s">%s</rpc>`, xml.Header, id, Namespace, operation)
+	if err := s.t.send([]byte(rpc)); err != nil {
+		return nil, s.ctxErr(ctx, err)
+	}
+
+	for {
+		data, err := s.t.receive()
+		if err != nil {
+			return nil, s.ctxErr(ctx, err)
+		}
+
+		var msg struct {
+			XMLName xml.Name
+			Reply
+		}
+		if err = xml.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("netconf: invalid reply: %w", err)
+		}
+
+		// skip notifications and replies to other messages.
+		if msg.XMLName.Local != "rpc-reply" || (msg.MessageID != "" && msg.MessageID != id) {
+			continue
+		}
+
+		reply := msg.Reply
+		reply.Raw = data
+
+		for i := range reply.Errors {
+			if reply.Errors[i].Severity != "warning" {
+				return &reply, &reply.Errors[i]
+			}
+		}
+
+		return &reply, nil
+	}
+}
+
+func (s *Session) ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Close sends close-session and closes the transport.
+func (s *Session) Close() error {
+
+	_, err := s.Exec(context.Background(), "<close-session/>")
+	if closeErr := s.rwc.Close(); err == nil {
+		err = closeErr
+	}
+
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package netconf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+const serverHello = `<?xml version="1.0" encoding="UTF-8"?>
+<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+    <capability>urn:ietf:params:netconf:base:1.1</capability>
+    <capability>urn:ietf:params:netconf:capability:candidate:1.0</capability>
+  </capabilities>
+  <session-id>42</session-id>
+</hello>`
+
+// fakeServer answers rpcs with the replies by operation name.
+func fakeServer(t *testing.T, conn io.ReadWriter, replies map[string]string) {
+
+	tr := newTransport(conn)
+
+	if _, err := tr.receive(); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := tr.send([]byte(serverHello)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	tr.chunked = true
+
+	for {
+		msg, err := tr.receive()
+		if err != nil {
+			return
+		}
+
+		for op, reply := range replies {
+			if strings.Contains(string(msg), "<"+op) {
+				tr.send([]byte(`<rpc-reply message-id="` + messageID(string(msg)) + `" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + reply + `</rpc-reply>`))
+			}
+		}
+	}
+}
+
+func messageID(msg string) string {
+	_, after, _ := strings.Cut(msg, `message-id="`)
+	id, _, _ := strings.Cut(after, `"`)
+	return id
+}
+
+func TestSession(t *testing.T) {
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go fakeServer(t, server, map[string]string{
+		"get-config":    `<data><system><hostname>r1</hostname></system></data>`,
+		"edit-config":   `<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag><error-severity>error</error-severity><error-message>bad mtu</error-message></rpc-error>`,
+		"close-session": `<ok/>`,
+	})
+
+	s, err := NewSession(client, DefaultCapabilities...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.ID != 42 || !s.HasCapability("urn:ietf:params:netconf:capability:candidate:1.0") || !s.t.chunked {
+		t.Errorf("unexpected session %+v", s)
+	}
+
+	reply, err := s.Exec(context.Background(), "<get-config><source><running/></source></get-config>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(reply.Data.Content, "<hostname>r1</hostname>") {
+		t.Errorf("unexpected data %q", reply.Data.Content)
+	}
+
+	_, err = s.Exec(context.Background(), "<edit-config/>")
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Tag != "invalid-value" || rpcErr.Message != "bad mtu" {
+		t.Errorf("expected an rpc error, got %v", err)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChunkedFraming(t *testing.T) {
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go server.Write([]byte("\n#4\n<rpc\n#6\n-reply\n#2\n/>\n##\n\n#x\n"))
+
+	tr := newTransport(client)
+	tr.chunked = true
+
+	msg, err := tr.receive()
+	if err != nil || string(msg) != "<rpc-reply/>" {
+		t.Errorf("unexpected message %q, %v", msg, err)
+	}
+
+	if _, err = tr.receive(); !errors.Is(err, ErrFraming) {
+		t.Errorf("expected a framing error, got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("admin", "admin")
+	srv.HandleSubsystem("netconf", func(rw io.ReadWriter) {
+		fakeServer(t, rw, map[string]string{"close-session": "<ok/>"})
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("admin", "admin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	s, err := Open(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.ID != 42 {
+		t.Errorf("unexpected session id %d", s.ID)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+//go:build !unix
+
+package goph
+
+import "os"
+
+// localOwner reports no owner, local files have none on this system.
+func localOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// chownLocal does nothing, local files have no owner on this system.
+func chownLocal(name string, uid, gid int) error {
+	return nil
+}
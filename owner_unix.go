@@ -0,0 +1,26 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+//go:build unix
+
+package goph
+
+import (
+	"os"
+	"syscall"
+)
+
+// localOwner returns the numeric user and group owning the local file.
+func localOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// chownLocal changes the numeric user and group of the local file, not
+// following links.
+func chownLocal(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNoPackageManager is returned when no supported package manager was
+// found on the remote host.
+var ErrNoPackageManager = errors.New("goph: no supported package manager")
+
+// DefaultLockWait is how long package managers wait for the lock held by
+// another install, like unattended upgrades on a freshly booted host.
+var DefaultLockWait = 5 * time.Minute
+
+// packageManagers are the supported package managers, in detection order.
+var packageManagers = []string{"apt-get", "dnf", "yum", "zypper", "apk"}
+
+// PackageManager installs packages on the remote host non-interactively.
+type PackageManager struct {
+	client Client
+
+	// Name is the detected package manager: "apt-get", "dnf", "yum",
+	// "zypper" or "apk".
+	Name string
+
+	// Sudo runs the package manager with "sudo -n".
+	Sudo bool
+
+	// LockWait bounds the wait for the package manager lock,
+	// DefaultLockWait if zero.
+	LockWait time.Duration
+}
+
+// PackageManager detects the package manager of the remote host.
+func (c Client) PackageManager(ctx context.Context) (*PackageManager, error) {
+
+	script := "for m in " + strings.Join(packageManagers, " ") + "; do " +
+		"command -v $m >/dev/null 2>&1 && echo $m && exit 0; done; exit 1"
+
+	out, err := c.RunContext(ctx, "sh -c "+shellQuote(script))
+	if err != nil {
+		return nil, errors.Join(ErrNoPackageManager, err)
+	}
+
+	return &PackageManager{client: c, Name: strings.TrimSpace(string(out))}, nil
+}
+
+// Install installs the packages.
+func (p *PackageManager) Install(ctx context.Context, packages ...string) error {
+	return p.run(ctx, "install", packages)
+}
+
+// Remove removes the packages.
+func (p *PackageManager) Remove(ctx context.Context, packages ...string) error {
+	return p.run(ctx, "remove", packages)
+}
+
+// Update refreshes the package index.
+func (p *PackageManager) Update(ctx context.Context) error {
+	return p.run(ctx, "update", nil)
+}
+
+// run runs the package manager action on packages.
+func (p *PackageManager) run(ctx context.Context, action string, packages []string) error {
+
+	cmd, err := p.command(action, packages)
+	if err != nil {
+		return err
+	}
+
+	out, err := p.client.RunContext(ctx, cmd)
+	if err != nil {
+		return outputError(err, out)
+	}
+
+	p.client.Config.logger().Info("packages "+action, p.client.Config.logAttrs("manager", p.Name, "packages", packages)...)
+
+	return nil
+}
+
+// command returns the command line of the package manager action.
+func (p *PackageManager) command(action string, packages []string) (string, error) {
+
+	wait := p.LockWait
+	if wait <= 0 {
+		wait = DefaultLockWait
+	}
+	seconds := fmt.Sprint(int(wait.Seconds()))
+
+	var env, args []string
+
+	switch p.Name {
+
+	case "apt-get":
+		env = []string{"DEBIAN_FRONTEND=noninteractive"}
+		args = []string{"apt-get", "-y", "-q", "-o", "DPkg::Lock::Timeout=" + seconds}
+		switch action {
+		case "install":
+			args = append(args, "-o", "Dpkg::Options::=--force-confold", "install")
+		case "remove", "update":
+			args = append(args, action)
+		}
+
+	case "dnf", "yum":
+		// dnf and yum wait for the lock by themselves.
+		args = []string{p.Name, "-y", "-q"}
+		switch action {
+		case "install", "remove":
+			args = append(args, action)
+		case "update":
+			args = append(args, "makecache")
+		}
+
+	case "zypper":
+		env = []string{"ZYPP_LOCK_TIMEOUT=" + seconds}
+		args = []string{"zypper", "--non-interactive", "--quiet"}
+		switch action {
+		case "install", "remove":
+			args = append(args, action)
+		case "update":
+			args = append(args, "refresh")
+		}
+
+	case "apk":
+		args = []string{"apk", "--wait", seconds}
+		switch action {
+		case "install":
+			args = append(args, "add")
+		case "remove":
+			args = append(args, "del")
+		case "update":
+			args = append(args, "update")
+		}
+
+	default:
+		return "", fmt.Errorf("%w: %q", ErrNoPackageManager, p.Name)
+	}
+
+	for _, pkg := range packages {
+		args = append(args, shellQuote(pkg))
+	}
+
+	cmd := strings.Join(args, " ")
+	if len(env) > 0 {
+		cmd = "env " + strings.Join(env, " ") + " " + cmd
+	}
+	if p.Sudo {
+		cmd = "sudo -n " + cmd
+	}
+
+	return cmd, nil
+}
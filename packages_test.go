@@ -0,0 +1,80 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestPackageManager(t *testing.T) {
+
+	var (
+		manager  = "apt-get"
+		commands []string
+	)
+
+	srv := gophtest.NewServer()
+	srv.AddUser("root", "secret")
+	srv.NotFound = func(e *gophtest.Exec) int {
+		if strings.HasPrefix(e.Command, "sh -c ") {
+			if manager == "" {
+				return 1
+			}
+			fmt.Fprintln(e.Stdout, manager)
+			return 0
+		}
+		commands = append(commands, e.Command)
+		return 0
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("root", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	pm, err := client.PackageManager(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm.Sudo = true
+	pm.LockWait = time.Minute
+
+	if err = pm.Install(ctx, "nginx", "curl"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "sudo -n env DEBIAN_FRONTEND=noninteractive apt-get -y -q -o DPkg::Lock::Timeout=60 -o Dpkg::Options::=--force-confold install nginx curl"
+	if len(commands) != 1 || commands[0] != want {
+		t.Errorf("got %q, want %q", commands, want)
+	}
+
+	manager = "apk"
+	if pm, err = client.PackageManager(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = pm.Remove(ctx, "nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if last := commands[len(commands)-1]; last != "apk --wait 300 del nginx" {
+		t.Errorf("unexpected apk command %q", last)
+	}
+
+	manager = ""
+	if _, err = client.PackageManager(ctx); !errors.Is(err, goph.ErrNoPackageManager) {
+		t.Errorf("expected ErrNoPackageManager, got %v", err)
+	}
+}
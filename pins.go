@@ -0,0 +1,70 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyPins accepts the server host keys by fingerprint. Pinning both the
+// current and the next key of a server lets it rotate its host key without
+// updating every client at once.
+type HostKeyPins struct {
+
+	// Pins are the accepted SHA256 fingerprints, as printed by ssh-keygen
+	// -l, like "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8". The
+	// "SHA256:" prefix is optional.
+	Pins []string
+
+	// OnMatch, if set, is called with the pin that matched the host key of
+	// every connection, to find the clients still using a retiring key.
+	OnMatch func(hostname, pin string)
+}
+
+// PinHostKeys returns the pins accepting the host keys with the given
+// fingerprints.
+func PinHostKeys(pins ...string) *HostKeyPins {
+	return &HostKeyPins{Pins: pins}
+}
+
+// Match returns the pin matching key.
+func (p *HostKeyPins) Match(key ssh.PublicKey) (pin string, ok bool) {
+
+	fingerprint := normalizePin(ssh.FingerprintSHA256(key))
+
+	for _, pin := range p.Pins {
+		if normalizePin(pin) == fingerprint {
+			return pin, true
+		}
+	}
+
+	return "", false
+}
+
+// Callback returns the host key callback accepting the pinned keys. Other
+// keys are rejected with ErrHostKeyMismatch.
+func (p *HostKeyPins) Callback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+
+		pin, ok := p.Match(key)
+		if !ok {
+			return fmt.Errorf("%w: %s presented %s, not pinned", ErrHostKeyMismatch, hostname, ssh.FingerprintSHA256(key))
+		}
+
+		if p.OnMatch != nil {
+			p.OnMatch(hostname, pin)
+		}
+
+		return nil
+	}
+}
+
+// normalizePin returns the base64 hash of a SHA256 fingerprint.
+func normalizePin(pin string) string {
+	return strings.TrimRight(strings.TrimPrefix(strings.TrimSpace(pin), "SHA256:"), "=")
+}
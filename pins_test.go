@@ -0,0 +1,50 @@
+package goph_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHostKeyPins(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	next, _ := ssh.NewPublicKey(pub)
+
+	current := ssh.FingerprintSHA256(srv.HostKey.PublicKey())
+	pins := goph.PinHostKeys(ssh.FingerprintSHA256(next), strings.TrimPrefix(current, "SHA256:"))
+
+	var matched string
+	pins.OnMatch = func(hostname, pin string) { matched = pin }
+
+	config := srv.Config("alice", "secret")
+	config.Callback = pins.Callback()
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if matched != strings.TrimPrefix(current, "SHA256:") {
+		t.Errorf("expected the current key pin to match, got %q", matched)
+	}
+
+	config.Callback = goph.PinHostKeys(ssh.FingerprintSHA256(next)).Callback()
+	if _, err = goph.NewConn(config); !errors.Is(err, goph.ErrHostKeyMismatch) {
+		t.Errorf("expected ErrHostKeyMismatch, got %v", err)
+	}
+}
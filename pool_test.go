@@ -0,0 +1,51 @@
+package goph_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestRunAppend(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("uptime", func(e *gophtest.Exec) int {
+		fmt.Fprint(e.Stdout, "up 3 days, load 0.1")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	out := make([]byte, 0, 256)
+	for range 3 {
+		if out, err = client.RunAppend("uptime", out[:0]); err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != "up 3 days, load 0.1" || cap(out) != 256 {
+			t.Errorf("unexpected output %q with capacity %d", out, cap(out))
+		}
+	}
+
+	if out, err = client.RunAppend("uptime", []byte("host1: ")); string(out) != "host1: up 3 days, load 0.1" {
+		t.Errorf("the output should be appended, got %q, %v", out, err)
+	}
+
+	// Run copies the pooled output, later runs do not change it.
+	first, _ := client.Run("uptime")
+	client.Run("uptime")
+	if !bytes.Equal(first, []byte("up 3 days, load 0.1")) {
+		t.Errorf("unexpected output %q", first)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// maxLinks bounds the symbolic links followed to resolve a path, like the
+// SYMLOOP_MAX of most systems.
+const maxLinks = 40
+
+// TransferOptions set the file attributes preserved by Upload and Download,
+// and how they copy symbolic links. The zero value keeps the defaults of
+// the destination and recreates links.
+type TransferOptions struct {
+
+	// PreservePermissions gives the copied files and directories the
+	// permission bits of their source, so executables stay executable.
+	PreservePermissions bool
+
+	// PreserveTimes gives the copied files and directories the modification
+	// time of their source.
+	PreserveTimes bool
+
+	// PreserveOwner gives the copied files and directories the numeric user
+	// and group of their source, which usually requires root on the
+	// destination. Local files get no owner on systems without one.
+	PreserveOwner bool
+
+	// FollowSymlinks copies what the symbolic links of directory transfers
+	// point to. Otherwise the links are recreated at the destination with
+	// the same target.
+	FollowSymlinks bool
+}
+
+// transferOptions returns the transfer options of the config.
+func (c *Config) transferOptions() TransferOptions {
+	if c == nil {
+		return TransferOptions{}
+	}
+	return c.Transfer
+}
+
+// preserve reports whether any file attribute is preserved.
+func (o TransferOptions) preserve() bool {
+	return o.PreservePermissions || o.PreserveTimes || o.PreserveOwner
+}
+
+// setRemote gives the remote path the attributes of the local file info
+// preserved by o.
+func (o TransferOptions) setRemote(ftp *sftp.Client, remotePath string, info os.FileInfo) error {
+
+	if o.PreserveOwner {
+		if uid, gid, ok := localOwner(info); ok {
+			if err := ftp.Chown(remotePath, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.PreservePermissions {
+		if err := ftp.Chmod(remotePath, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	// the access time of local files is not portable.
+	if o.PreserveTimes {
+		if err := ftp.Chtimes(remotePath, time.Now(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setLocal gives the local path the attributes of the remote file info
+// preserved by o.
+func (o TransferOptions) setLocal(localPath string, info os.FileInfo) error {
+
+	stat, _ := info.Sys().(*sftp.FileStat)
+
+	if o.PreserveOwner && stat != nil {
+		if err := chownLocal(localPath, int(stat.UID), int(stat.GID)); err != nil {
+			return err
+		}
+	}
+
+	if o.PreservePermissions {
+		if err := os.Chmod(localPath, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if o.PreserveTimes {
+		atime := time.Now()
+		if stat != nil {
+			atime = time.Unix(int64(stat.Atime), 0)
+		}
+		if err := os.Chtimes(localPath, atime, info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkToRemote recreates the local symbolic link srcPath at dstPath,
+// replacing the file there.
+func (c *Client) linkToRemote(t *transfer, sftpClient *sftp.Client, srcPath, dstPath string) error {
+
+	e := t.fileStart(srcPath, dstPath, 0)
+
+	target, err := os.Readlink(srcPath)
+	if err != nil {
+		return t.fileError(e, fmt.Errorf("failed to read source link: %w", err))
+	}
+
+	if err := sftpClient.Remove(dstPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return t.fileError(e, fmt.Errorf("failed to replace remote file: %w", err))
+	}
+
+	if err := sftpClient.Symlink(filepath.ToSlash(target), dstPath); err != nil {
+		return t.fileError(e, fmt.Errorf("failed to create remote link: %w", err))
+	}
+
+	t.file(e, 0)
+	return nil
+}
+
+// linkToLocal recreates the remote symbolic link remotePath at localPath,
+// replacing the file there.
+func (c Client) linkToLocal(t *transfer, sftpClient *sftp.Client, remotePath, localPath string) error {
+
+	e := t.fileStart(localPath, remotePath, 0)
+
+	target, err := sftpClient.ReadLink(remotePath)
+	if err != nil {
+		return t.fileError(e, fmt.Errorf("failed to read remote link: %w", err))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return t.fileError(e, fmt.Errorf("failed to create local directories: %w", err))
+	}
+
+	if err := os.Remove(localPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return t.fileError(e, fmt.Errorf("failed to replace local file: %w", err))
+	}
+
+	if err := os.Symlink(filepath.FromSlash(target), localPath); err != nil {
+		return t.fileError(e, fmt.Errorf("failed to create local link: %w", err))
+	}
+
+	t.file(e, 0)
+	return nil
+}
+
+// resolveRemote returns the path the remote symbolic link p points to,
+// following chained links.
+func resolveRemote(ftp *sftp.Client, p string) (string, error) {
+
+	for range maxLinks {
+
+		target, err := ftp.ReadLink(p)
+		if err != nil {
+			return "", err
+		}
+
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+		p = path.Clean(target)
+
+		info, err := ftp.Lstat(p)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: too many levels of symbolic links", p)
+}
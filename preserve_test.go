@@ -0,0 +1,150 @@
+package goph_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"github.com/pkg/sftp"
+)
+
+// setstatRecorder records the attributes set on remote paths, which the
+// in-memory file system ignores.
+type setstatRecorder struct {
+	sftp.FileCmder
+	mu    sync.Mutex
+	modes map[string]os.FileMode
+	times map[string]time.Time
+}
+
+func (r *setstatRecorder) Filecmd(req *sftp.Request) error {
+
+	if req.Method != "Setstat" {
+		return r.FileCmder.Filecmd(req)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flags, attrs := req.AttrFlags(), req.Attributes()
+	if flags.Permissions {
+		r.modes[req.Filepath] = attrs.FileMode().Perm()
+	}
+	if flags.Acmodtime {
+		r.times[req.Filepath] = time.Unix(int64(attrs.Mtime), 0)
+	}
+
+	return nil
+}
+
+func TestTransferOptions(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	rec := &setstatRecorder{
+		FileCmder: srv.FS.FileCmd,
+		modes:     make(map[string]os.FileMode),
+		times:     make(map[string]time.Time),
+	}
+	srv.FS.FileCmd = rec
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	mtime := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	src := filepath.Join(t.TempDir(), "app")
+	os.MkdirAll(filepath.Join(src, "bin"), 0755)
+	script := filepath.Join(src, "bin", "run.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(script, 0750)
+	os.Chtimes(script, mtime, mtime)
+	os.Symlink("bin/run.sh", filepath.Join(src, "run"))
+	os.Symlink("bin", filepath.Join(src, "tools"))
+
+	client.Config.Transfer = goph.TransferOptions{PreservePermissions: true, PreserveTimes: true}
+	if err := client.Upload(src, "/app"); err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := rec.modes["/app/bin/run.sh"]; mode != 0750 {
+		t.Errorf("expected remote mode 0750, got %v", mode)
+	}
+	if mt := rec.times["/app/bin/run.sh"]; !mt.Equal(mtime) {
+		t.Errorf("expected remote mtime %v, got %v", mtime, mt)
+	}
+	if _, ok := rec.times["/app/bin"]; !ok {
+		t.Error("expected the directory times to be set")
+	}
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	for _, link := range []string{"/app/run", "/app/tools"} {
+		if info, err := ftp.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s: expected a link, got %v, %v", link, info, err)
+		}
+	}
+
+	// Links are recreated on download.
+	dst := filepath.Join(t.TempDir(), "app")
+	if err := client.Download("/app", dst); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "tools")); err != nil || target != "bin" {
+		t.Errorf("expected local link to bin, got %q, %v", target, err)
+	}
+
+	info, err := ftp.Stat("/app/bin/run.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := os.Stat(filepath.Join(dst, "bin", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.Mode().Perm() != info.Mode().Perm() || !local.ModTime().Equal(info.ModTime()) {
+		t.Errorf("expected local %v %v, got %v %v", info.Mode().Perm(), info.ModTime(), local.Mode().Perm(), local.ModTime())
+	}
+
+	// Following links copies what they point to.
+	client.Config.Transfer = goph.TransferOptions{FollowSymlinks: true}
+	if err := client.Upload(src, "/followed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRemote(t, client, "/followed/tools/run.sh"); got != "#!/bin/sh\n" {
+		t.Errorf("expected the linked directory to be copied, got %q", got)
+	}
+
+	// the in-memory file system resolves relative targets from the root.
+	for link, target := range map[string]string{"/app/run": "/app/bin/run.sh", "/app/tools": "/app/bin"} {
+		ftp.Remove(link)
+		if err := ftp.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst = filepath.Join(t.TempDir(), "app")
+	if err := client.Download("/app", dst); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(filepath.Join(dst, "tools", "run.sh")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("expected a regular file through the followed link, got %v, %v", info, err)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AlgorithmProfile is a named set of algorithms a Config is restricted to.
+type AlgorithmProfile struct {
+	Name              string
+	Ciphers           []string
+	KeyExchanges      []string
+	MACs              []string
+	HostKeyAlgorithms []string
+}
+
+// FIPSProfile restricts negotiation to FIPS 140 approved algorithms:
+// AES-GCM/CTR ciphers, NIST ECDH and finite field DH with SHA-2 key exchanges,
+// SHA-2 MACs and ECDSA/RSA SHA-2 host keys.
+var FIPSProfile = AlgorithmProfile{
+	Name: "fips",
+	Ciphers: []string{
+		"aes256-gcm@openssh.com",
+		"aes128-gcm@openssh.com",
+		"aes256-ctr",
+		"aes192-ctr",
+		"aes128-ctr",
+	},
+	KeyExchanges: []string{
+		"ecdh-sha2-nistp384",
+		"ecdh-sha2-nistp256",
+		"ecdh-sha2-nistp521",
+		"diffie-hellman-group16-sha512",
+		"diffie-hellman-group14-sha256",
+	},
+	MACs: []string{
+		"hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256-etm@openssh.com",
+		"hmac-sha2-512",
+		"hmac-sha2-256",
+	},
+	HostKeyAlgorithms: []string{
+		ssh.KeyAlgoECDSA384,
+		ssh.KeyAlgoECDSA256,
+		ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512,
+		ssh.KeyAlgoRSASHA256,
+		ssh.CertAlgoECDSA384v01,
+		ssh.CertAlgoECDSA256v01,
+		ssh.CertAlgoECDSA521v01,
+		ssh.CertAlgoRSASHA512v01,
+		ssh.CertAlgoRSASHA256v01,
+	},
+}
+
+// HardenedProfile only enables current best-practice algorithms:
+// curve25519 key exchanges, chacha20-poly1305 and AES-GCM ciphers and
+// ed25519 host keys. Weak servers are rejected with an AlgorithmError
+// listing what they offered.
+var HardenedProfile = AlgorithmProfile{
+	Name: "hardened",
+	Ciphers: []string{
+		"chacha20-poly1305@openssh.com",
+		"aes256-gcm@openssh.com",
+		"aes128-gcm@openssh.com",
+	},
+	KeyExchanges: []string{
+		"curve25519-sha256",
+		"curve25519-sha256@libssh.org",
+	},
+	MACs: []string{
+		"hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256-etm@openssh.com",
+	},
+	HostKeyAlgorithms: []string{
+		ssh.KeyAlgoED25519,
+		ssh.CertAlgoED25519v01,
+	},
+}
+
+// LegacyProfile keeps the modern algorithms first and adds the legacy ones old
+// switches and appliances still require: diffie-hellman-group14-sha1 and
+// group1-sha1 key exchanges, ssh-rsa and ssh-dss host keys and CBC ciphers.
+// It is opt-in per Config and never changes the defaults of other configs.
+var LegacyProfile = AlgorithmProfile{
+	Name: "legacy",
+	Ciphers: []string{
+		"aes128-gcm@openssh.com",
+		"aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"aes128-ctr",
+		"aes192-ctr",
+		"aes256-ctr",
+		"aes128-cbc",
+		"3des-cbc",
+	},
+	KeyExchanges: []string{
+		"curve25519-sha256",
+		"curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256",
+		"ecdh-sha2-nistp384",
+		"ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256",
+		"diffie-hellman-group-exchange-sha256",
+		"diffie-hellman-group14-sha1",
+		"diffie-hellman-group-exchange-sha1",
+		"diffie-hellman-group1-sha1",
+	},
+	MACs: []string{
+		"hmac-sha2-256-etm@openssh.com",
+		"hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256",
+		"hmac-sha2-512",
+		"hmac-sha1",
+		"hmac-sha1-96",
+	},
+	HostKeyAlgorithms: []string{
+		ssh.KeyAlgoED25519,
+		ssh.KeyAlgoECDSA256,
+		ssh.KeyAlgoECDSA384,
+		ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512,
+		ssh.KeyAlgoRSASHA256,
+		ssh.KeyAlgoRSA,
+		ssh.KeyAlgoDSA,
+	},
+}
+
+// UseProfile restricts the config algorithms to the profile, connections to
+// servers not supporting any of them fail. It returns c for chaining.
+func (c *Config) UseProfile(p AlgorithmProfile) *Config {
+
+	c.Ciphers = append([]string(nil), p.Ciphers...)
+	c.KeyExchanges = append([]string(nil), p.KeyExchanges...)
+	c.MACs = append([]string(nil), p.MACs...)
+	c.HostKeyAlgorithms = append([]string(nil), p.HostKeyAlgorithms...)
+	c.profile = p.Name
+
+	return c
+}
+
+// UseFIPSProfile restricts the config to FIPSProfile, refusing to connect to
+// servers that can't negotiate FIPS approved algorithms. It returns c for chaining.
+func (c *Config) UseFIPSProfile() *Config {
+	return c.UseProfile(FIPSProfile)
+}
+
+// UseHardenedProfile restricts the config to HardenedProfile. It returns c for chaining.
+func (c *Config) UseHardenedProfile() *Config {
+	return c.UseProfile(HardenedProfile)
+}
+
+// UseLegacyProfile enables LegacyProfile on this config only, for old
+// devices. It returns c for chaining.
+func (c *Config) UseLegacyProfile() *Config {
+	return c.UseProfile(LegacyProfile)
+}
+
+// Profile returns the name of the profile the config uses, if any.
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+// AlgorithmError is returned when a profile restricted config fails to
+// negotiate with a server, it lists the algorithms the server offered.
+type AlgorithmError struct {
+	Profile string
+
+	// Algorithms offered by the server, empty if the server sent none.
+	KeyExchanges []string
+	HostKeys     []string
+	Ciphers      []string
+	MACs         []string
+
+	Err error
+}
+
+func (e *AlgorithmError) Error() string {
+
+	if len(e.KeyExchanges) == 0 {
+		return fmt.Sprintf("goph: %s profile: %s", e.Profile, e.Err)
+	}
+
+	return fmt.Sprintf("goph: %s profile: server offered kex [%s], host keys [%s], ciphers [%s], macs [%s]: %s",
+		e.Profile,
+		strings.Join(e.KeyExchanges, ", "),
+		strings.Join(e.HostKeys, ", "),
+		strings.Join(e.Ciphers, ", "),
+		strings.Join(e.MACs, ", "),
+		e.Err,
+	)
+}
+
+func (e *AlgorithmError) Unwrap() error {
+	return e.Err
+}
+
+// profileError wraps a handshake error of a profile restricted config with
+// the algorithms offered by the server.
+func (c *Config) profileError(err error, kex *kexConn) error {
+
+	if c.profile == "" || err == nil {
+		return err
+	}
+
+	e := &AlgorithmError{
+		Profile: c.profile,
+		Err:     err,
+	}
+
+	if kex != nil {
+		if server := kex.server.result(); server != nil {
+			e.KeyExchanges = server.KeyExchanges
+			e.HostKeys = server.HostKeys
+			e.Ciphers = server.CiphersS2C
+			e.MACs = server.MACsS2C
+		}
+	}
+
+	return e
+}
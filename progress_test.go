@@ -0,0 +1,172 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+)
+
+// countWriter counts the bytes written, like a progress bar.
+type countWriter struct{ n int }
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// countReader counts the bytes read through it.
+type countReader struct {
+	io.Reader
+	n *int
+}
+
+func (r countReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	*r.n += n
+	return n, err
+}
+
+func TestProgress(t *testing.T) {
+
+	client := newFileServer(t)
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "data")
+	content := strings.Repeat("0123456789", 10000)
+	if err := os.WriteFile(local, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		bar     countWriter
+		proxied int
+	)
+	client.Config.Progress = &bar
+	client.Config.ProxyReader = func(r io.Reader) io.Reader {
+		return countReader{Reader: r, n: &proxied}
+	}
+
+	if err := client.Upload(local, "/data"); err != nil {
+		t.Fatal(err)
+	}
+	if bar.n != len(content) || proxied != len(content) {
+		t.Errorf("upload progress: writer got %d and reader %d bytes, expected %d", bar.n, proxied, len(content))
+	}
+
+	bar.n, proxied = 0, 0
+	if err := client.Download("/data", filepath.Join(dir, "copy")); err != nil {
+		t.Fatal(err)
+	}
+	if bar.n != len(content) || proxied != len(content) {
+		t.Errorf("download progress: writer got %d and reader %d bytes, expected %d", bar.n, proxied, len(content))
+	}
+}
+
+func TestParallelDownload(t *testing.T) {
+
+	client := newFileServer(t)
+
+	src := t.TempDir()
+	for i := range 20 {
+		name := filepath.Join(src, "logs", fmt.Sprintf("day%02d", i%3), fmt.Sprintf("app%02d.log", i))
+		os.MkdirAll(filepath.Dir(name), 0755)
+		if err := os.WriteFile(name, []byte(strings.Repeat("x", 1000+i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Upload(filepath.Join(src, "logs"), "/logs"); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		bar   countWriter
+		files int
+	)
+	client.Config.DownloadWorkers = 4
+	client.Config.Progress = &bar
+	client.Config.OnFileComplete = func(goph.FileEvent) { files++ }
+
+	dst := filepath.Join(t.TempDir(), "logs")
+	if err := client.Download("/logs", dst); err != nil {
+		t.Fatal(err)
+	}
+
+	var size int
+	for i := range 20 {
+		data, err := os.ReadFile(filepath.Join(dst, fmt.Sprintf("day%02d", i%3), fmt.Sprintf("app%02d.log", i)))
+		if err != nil || len(data) != 1000+i {
+			t.Errorf("file %d: got %d bytes, %v", i, len(data), err)
+		}
+		size += 1000 + i
+	}
+
+	if files != 20 || bar.n != size {
+		t.Errorf("expected 20 files and %d bytes reported, got %d and %d", size, files, bar.n)
+	}
+}
+
+func TestTransferContext(t *testing.T) {
+
+	client := newFileServer(t)
+
+	src := filepath.Join(t.TempDir(), "tree")
+	for _, name := range []string{"a", "sub/b", "sub/c"} {
+		os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(src, name), []byte(strings.Repeat("x", 40000)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var last goph.TransferProgress
+	progress := func(p goph.TransferProgress) {
+		if p.Bytes < last.Bytes || p.FileBytes > p.FileSize {
+			t.Errorf("unexpected progress %+v after %+v", p, last)
+		}
+		last = p
+	}
+
+	if err := client.UploadContext(context.Background(), src, "/tree", progress); err != nil {
+		t.Fatal(err)
+	}
+	if last.Bytes != 120000 || last.Total != 120000 {
+		t.Errorf("upload: got %d of %d bytes, expected 120000", last.Bytes, last.Total)
+	}
+
+	last = goph.TransferProgress{}
+	if err := client.DownloadContext(context.Background(), "/tree", filepath.Join(t.TempDir(), "tree"), progress); err != nil {
+		t.Fatal(err)
+	}
+	if last.Bytes != 120000 || last.Total != 120000 {
+		t.Errorf("download: got %d of %d bytes, expected 120000", last.Bytes, last.Total)
+	}
+
+	// Cancel in the middle of the first file.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var copied int64
+	err := client.UploadContext(ctx, src, "/cancelled", func(p goph.TransferProgress) {
+		copied = p.Bytes
+		if p.FileBytes >= 1000 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if copied >= 40000 {
+		t.Errorf("transfer went on after cancel, %d bytes copied", copied)
+	}
+
+	err = client.DownloadContext(ctx, "/tree", filepath.Join(t.TempDir(), "tree"), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// jumpConn is a connection tunneled through a jump host, closing the jump
+// host connection with it.
+type jumpConn struct {
+	net.Conn
+	jump *ssh.Client
+}
+
+func (c *jumpConn) Close() error {
+	err := c.Conn.Close()
+	c.jump.Close()
+	return err
+}
+
+// proxyDial connects to the jump host of c.Proxy, itself possibly behind
+// another jump host, and dials the host of c through it.
+func (c *Config) proxyDial(ctx context.Context, proto string) (net.Conn, error) {
+
+	jump, _, err := c.Proxy.dial(ctx, "tcp")
+	if err != nil {
+		return nil, fmt.Errorf("jump host: %w", err)
+	}
+
+	c.logger().Debug("connected to jump host", c.logAttrs("jump_host", c.Proxy.hostPort())...)
+
+	conn, err := jump.DialContext(ctx, proto, c.hostPort())
+	if err != nil {
+		jump.Close()
+		return nil, fmt.Errorf("jump host %s: %w", c.Proxy.hostPort(), err)
+	}
+
+	return &jumpConn{Conn: conn, jump: jump}, nil
+}
+
+// DialThrough connects to the host at addr, "host" or "host:port", through
+// the client connection used as a jump host, like OpenSSH ProxyJump. The
+// host key is checked with the callback of the client config. The client
+// must stay open while the returned client is used.
+func (c Client) DialThrough(user, addr string, auth Auth) (*Client, error) {
+
+	c = c.live()
+
+	host, port := addr, uint(22)
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("goph: invalid port in %q", addr)
+		}
+		host, port = h, uint(n)
+	}
+
+	timeout := DefaultTimeout
+	if c.Config != nil && c.Config.Timeout > 0 {
+		timeout = c.Config.Timeout
+	}
+
+	config := &Config{
+		User:    user,
+		Addr:    host,
+		Port:    port,
+		Auth:    auth,
+		Timeout: timeout,
+		Dialer:  c.Client,
+	}
+	if c.Config != nil {
+		config.Callback = c.Config.Callback
+		config.Logger = c.Config.Logger
+	}
+
+	return NewConn(config)
+}
@@ -0,0 +1,71 @@
+package goph_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestProxyJump(t *testing.T) {
+
+	var servers []*gophtest.Server
+	for _, name := range []string{"bastion1", "bastion2", "target"} {
+		srv := gophtest.NewServer()
+		srv.AddUser("alice", "secret")
+		srv.Forwarding = name != "target"
+		srv.HandleFunc("hostname", func(e *gophtest.Exec) int {
+			fmt.Fprintln(e.Stdout, name)
+			return 0
+		})
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+		servers = append(servers, srv)
+	}
+
+	bastion1, bastion2, target := servers[0], servers[1], servers[2]
+
+	config := target.Config("alice", "secret")
+	config.Proxy = bastion2.Config("alice", "secret")
+	config.Proxy.Proxy = bastion1.Config("alice", "secret")
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := client.Run("hostname"); err != nil || strings.TrimSpace(string(out)) != "target" {
+		t.Errorf("expected the target host, got %q, %v", out, err)
+	}
+	client.Close()
+
+	jump, err := goph.NewConn(bastion1.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jump.Close()
+
+	// the target key is checked with the callback of the jump client.
+	jump.Config.Callback = target.Config("alice", "secret").Callback
+
+	client, err = jump.DialThrough("alice", target.Addr(), goph.Password("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if out, err := client.Run("hostname"); err != nil || strings.TrimSpace(string(out)) != "target" {
+		t.Errorf("expected the target host, got %q, %v", out, err)
+	}
+
+	// the target does not forward.
+	config = bastion1.Config("alice", "secret")
+	config.Proxy = target.Config("alice", "secret")
+	if _, err = goph.NewConn(config); err == nil || !strings.Contains(err.Error(), "jump host") {
+		t.Errorf("expected a jump host error, got %v", err)
+	}
+}
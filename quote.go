@@ -0,0 +1,30 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import "strings"
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-.,:/@=+") == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Quote quotes args as POSIX shell words joined by spaces, for the command
+// lines built from untrusted values, like pipelines:
+//
+//	client.Run("grep -- " + goph.Quote(pattern, file) + " | wc -l")
+func Quote(args ...string) string {
+
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = shellQuote(arg)
+	}
+
+	return strings.Join(words, " ")
+}
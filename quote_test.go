@@ -0,0 +1,81 @@
+package goph_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestQuote(t *testing.T) {
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ls", "-la"}, "ls -la"},
+		{[]string{"my file.txt"}, "'my file.txt'"},
+		{[]string{"it's"}, `'it'\''s'`},
+		{[]string{"$(rm -rf /)", ""}, "'$(rm -rf /)' ''"},
+		{[]string{"a;b", "*.go", "x|y"}, "'a;b' '*.go' 'x|y'"},
+	}
+
+	for _, tt := range tests {
+		if got := goph.Quote(tt.args...); got != tt.want {
+			t.Errorf("Quote(%q): expected %s, got %s", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestCommandQuoting(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+
+	var commands []string
+	srv.NotFound = func(e *gophtest.Exec) int {
+		commands = append(commands, e.Command)
+		return 0
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	cmd, err := client.Command("cat", "my file.txt", "; reboot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cmd.CombinedOutput(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err = client.Command("/opt/my tool", "--name=$USER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.NoShell = true
+	cmd.Dir = "/srv"
+	if _, err = cmd.CombinedOutput(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`cat 'my file.txt' '; reboot'`,
+		`cd /srv && exec '/opt/my tool' '--name=$USER'`,
+	}
+	if got := strings.Join(commands, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("expected the commands\n%s\ngot\n%s", strings.Join(want, "\n"), got)
+	}
+	if s := fmt.Sprint(cmd); s != want[1] {
+		t.Errorf("expected String %s, got %s", want[1], s)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter applies the CommandRate and MaxSessions of a config to the
+// sessions of a connection.
+type limiter struct {
+
+	// tokens refill at rate per second up to burst.
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// sessions holds a slot per open session, nil without MaxSessions.
+	sessions chan struct{}
+	held     map[any]struct{}
+}
+
+// newLimiter returns the limiter of the config, or nil without limits.
+func (c *Config) newLimiter() *limiter {
+
+	if c.CommandRate <= 0 && c.MaxSessions <= 0 {
+		return nil
+	}
+
+	l := &limiter{rate: c.CommandRate, held: make(map[any]struct{})}
+
+	if l.rate > 0 {
+		l.burst = float64(max(c.CommandBurst, 1))
+		l.tokens = l.burst
+		l.last = time.Now()
+	}
+
+	if c.MaxSessions > 0 {
+		l.sessions = make(chan struct{}, c.MaxSessions)
+	}
+
+	return l
+}
+
+// wait waits for a token of the command rate.
+func (l *limiter) wait(ctx context.Context) error {
+
+	if l.rate <= 0 {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// acquire waits for the command rate and a free session slot.
+func (l *limiter) acquire(ctx context.Context) error {
+
+	if l == nil {
+		return nil
+	}
+
+	if err := l.wait(ctx); err != nil {
+		return err
+	}
+
+	if l.sessions == nil {
+		return nil
+	}
+
+	select {
+	case l.sessions <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hold assigns the slot acquired to op, released by release.
+func (l *limiter) hold(op any) {
+
+	if l == nil || l.sessions == nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.held[op] = struct{}{}
+	l.mu.Unlock()
+}
+
+// put frees a slot acquired but not held.
+func (l *limiter) put() {
+	if l != nil && l.sessions != nil {
+		<-l.sessions
+	}
+}
+
+// release frees the slot of op, it may be called more than once.
+func (l *limiter) release(op any) {
+
+	if l == nil || l.sessions == nil {
+		return
+	}
+
+	l.mu.Lock()
+	_, ok := l.held[op]
+	delete(l.held, op)
+	l.mu.Unlock()
+
+	if ok {
+		<-l.sessions
+	}
+}
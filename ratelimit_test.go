@@ -0,0 +1,81 @@
+package goph_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestRateLimit(t *testing.T) {
+
+	var running, peak atomic.Int32
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("slow", func(e *gophtest.Exec) int {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		return 0
+	})
+	srv.HandleFunc("fast", func(e *gophtest.Exec) int { return 0 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	config := srv.Config("alice", "secret")
+	config.MaxSessions = 1
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Run("slow"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() != 1 {
+		t.Errorf("expected one session at a time, got %d", peak.Load())
+	}
+
+	config = srv.Config("alice", "secret")
+	config.CommandRate = 20
+	config.CommandBurst = 1
+
+	if client, err = goph.NewConn(config); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	start := time.Now()
+	for range 4 {
+		if _, err = client.Run("fast"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d := time.Since(start); d < 140*time.Millisecond {
+		t.Errorf("4 commands at 20/s with a burst of 1 took %s", d)
+	}
+}
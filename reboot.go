@@ -0,0 +1,161 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// bootIDCommand prints the random ID Linux generates at every boot.
+const bootIDCommand = "cat /proc/sys/kernel/random/boot_id"
+
+// RebootOptions configures RebootAndReconnect.
+type RebootOptions struct {
+
+	// Command reboots the host, "reboot" if empty.
+	Command string
+
+	// Sudo runs Command with "sudo -n".
+	Sudo bool
+
+	// Interval between the connection attempts once the host went down,
+	// DefaultWaitInterval if zero.
+	Interval time.Duration
+
+	// VerifyBootID compares the Linux boot ID before and after the reboot,
+	// so a connection made before the host went down is not mistaken for
+	// the rebooted host.
+	VerifyBootID bool
+
+	// Probes are commands that must succeed on the rebooted host, like
+	// "systemctl is-system-running --wait", see WaitFor.
+	Probes []string
+}
+
+// RebootAndReconnect reboots the remote host, waits for the connection to
+// drop, then connects again with the client config until the host is back
+// and returns the new client. The client is closed. ctx bounds the whole
+// reboot.
+func (c *Client) RebootAndReconnect(ctx context.Context, opts RebootOptions) (_ *Client, err error) {
+
+	log := c.Config.logger()
+
+	var bootID string
+	if opts.VerifyBootID {
+		if bootID, err = c.bootID(ctx); err != nil {
+			return nil, fmt.Errorf("reboot: %w", err)
+		}
+	}
+
+	if err = c.reboot(ctx, opts); err != nil {
+		return nil, err
+	}
+
+	c.Close()
+
+	log.Info("host rebooting", c.Config.logAttrs()...)
+
+	for {
+		client, err := WaitFor(ctx, c.Config, opts.Interval, opts.Probes...)
+		if err != nil {
+			return nil, fmt.Errorf("reboot: %w", err)
+		}
+
+		if !opts.VerifyBootID {
+			return client, nil
+		}
+
+		id, err := client.bootID(ctx)
+		if err == nil && id != bootID {
+			log.Info("host rebooted", c.Config.logAttrs("boot_id", id)...)
+			return client, nil
+		}
+		client.Close()
+
+		if err == nil {
+			err = errors.New("boot ID unchanged")
+		}
+		log.Debug("host not rebooted yet", c.Config.logAttrs("error", err)...)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("reboot: %w", errors.Join(ctx.Err(), err))
+		case <-time.After(opts.interval()):
+		}
+	}
+}
+
+// interval returns the time between connection attempts.
+func (o RebootOptions) interval() time.Duration {
+	if o.Interval <= 0 {
+		return DefaultWaitInterval
+	}
+	return o.Interval
+}
+
+// bootID returns the boot ID of the remote host.
+func (c Client) bootID(ctx context.Context) (string, error) {
+	out, err := c.RunContext(ctx, bootIDCommand)
+	if err != nil {
+		return "", outputError(err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// reboot runs the reboot command and waits for the connection to drop.
+func (c *Client) reboot(ctx context.Context, opts RebootOptions) error {
+
+	command := opts.Command
+	if command == "" {
+		command = "reboot"
+	}
+	if opts.Sudo {
+		command = "sudo -n " + command
+	}
+
+	cmd, err := c.CommandContext(ctx, command)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	w := &lockedWriter{w: &out}
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err = <-exited:
+		// a command failing before the host goes down did not reboot it,
+		// the others usually lose their session.
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return outputError(err, out.Bytes())
+		}
+	case <-c.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-c.Done():
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("reboot: waiting for the connection to drop: %w", ctx.Err())
+	}
+}
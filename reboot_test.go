@@ -0,0 +1,92 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// rebootDialer dials the server before the reboot, then the one after.
+type rebootDialer struct {
+	before, after *gophtest.Server
+	rebooted      atomic.Bool
+}
+
+func (d *rebootDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	srv := d.before
+	if d.rebooted.Load() {
+		srv = d.after
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, srv.Addr())
+}
+
+func TestRebootAndReconnect(t *testing.T) {
+
+	before := gophtest.NewServer()
+	after := gophtest.NewServer()
+	after.HostKey = before.HostKey
+
+	dialer := &rebootDialer{before: before, after: after}
+
+	for id, srv := range map[string]*gophtest.Server{"1111": before, "2222": after} {
+		srv.AddUser("alice", "secret")
+		srv.HandleFunc("cat /proc/sys/kernel/random/boot_id", func(e *gophtest.Exec) int {
+			fmt.Fprintln(e.Stdout, id)
+			return 0
+		})
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+	}
+
+	before.HandleFunc("sudo -n reboot", func(e *gophtest.Exec) int {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			dialer.rebooted.Store(true)
+			before.Close()
+		}()
+		return 0
+	})
+	before.HandleFunc("reboot", func(e *gophtest.Exec) int {
+		fmt.Fprintln(e.Stderr, "Failed to set wall message: Interactive authentication required.")
+		return 1
+	})
+
+	config := before.Config("alice", "secret")
+	config.Dialer = dialer
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := goph.RebootOptions{Interval: 10 * time.Millisecond, VerifyBootID: true}
+
+	if _, err = client.RebootAndReconnect(ctx, opts); err == nil || !strings.Contains(err.Error(), "Interactive authentication required") {
+		t.Fatalf("expected the reboot command failure, got %v", err)
+	}
+
+	opts.Sudo = true
+	client, err = client.RebootAndReconnect(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	out, err := client.Run("cat /proc/sys/kernel/random/boot_id")
+	if err != nil || strings.TrimSpace(string(out)) != "2222" {
+		t.Errorf("expected the rebooted host, got %q, %v", out, err)
+	}
+}
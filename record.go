@@ -0,0 +1,258 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RecordFormat is the file format of a session recording.
+type RecordFormat int
+
+const (
+	// RecordAsciicast writes asciinema v2 (asciicast) recordings.
+	RecordAsciicast RecordFormat = iota
+
+	// RecordTypescript writes script(1) typescript recordings, with an optional
+	// timing file for scriptreplay.
+	RecordTypescript
+)
+
+// SessionRecorder records the timestamped output, and optionally the input,
+// of interactive shell and PTY sessions for compliance and postmortems.
+// A recorder is safe for concurrent use by the stdout and stderr writers.
+type SessionRecorder struct {
+
+	// RecordInput records session input too, asciicast recordings only.
+	RecordInput bool
+
+	format RecordFormat
+	w      io.Writer
+	timing io.Writer
+	start  time.Time
+	last   time.Time
+
+	mu  sync.Mutex
+	err error
+}
+
+// asciicastHeader is the first line of an asciicast v2 file.
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewAsciicastRecorder returns a recorder writing an asciinema v2 recording
+// of a terminal of the given size to w.
+func NewAsciicastRecorder(w io.Writer, width, height int, title string) (*SessionRecorder, error) {
+
+	r := &SessionRecorder{
+		format: RecordAsciicast,
+		w:      w,
+		start:  time.Now(),
+	}
+	r.last = r.start
+
+	header, err := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = fmt.Fprintf(w, "%s\n", header); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// NewTypescriptRecorder returns a recorder writing a script(1) typescript to w,
+// and scriptreplay timings to timing when it's not nil.
+func NewTypescriptRecorder(w io.Writer, timing io.Writer) (*SessionRecorder, error) {
+
+	r := &SessionRecorder{
+		format: RecordTypescript,
+		w:      w,
+		timing: timing,
+		start:  time.Now(),
+	}
+	r.last = r.start
+
+	if _, err := fmt.Fprintf(w, "Script started on %s\n", r.start.Format(time.RFC1123Z)); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// record writes a single event, typ is "o" for output, "i" for input and "r" for resize.
+func (r *SessionRecorder) record(typ string, p []byte) {
+
+	now := time.Now()
+
+	switch r.format {
+	case RecordAsciicast:
+		event, err := json.Marshal([]interface{}{now.Sub(r.start).Seconds(), typ, string(p)})
+		if err == nil {
+			_, err = fmt.Fprintf(r.w, "%s\n", event)
+		}
+		r.setErr(err)
+
+	case RecordTypescript:
+		if typ != "o" {
+			return
+		}
+		_, err := r.w.Write(p)
+		r.setErr(err)
+		if r.timing != nil {
+			_, err = fmt.Fprintf(r.timing, "%f %d\n", now.Sub(r.last).Seconds(), len(p))
+			r.setErr(err)
+		}
+	}
+
+	r.last = now
+}
+
+func (r *SessionRecorder) setErr(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Writer returns a writer recording session output before writing it to dst,
+// dst may be nil to only record.
+func (r *SessionRecorder) Writer(dst io.Writer) io.Writer {
+	return &recordWriter{r: r, dst: dst}
+}
+
+// Reader returns a reader recording the session input read from src.
+func (r *SessionRecorder) Reader(src io.Reader) io.Reader {
+	return &recordReader{r: r, src: src}
+}
+
+// Resize records a terminal resize.
+func (r *SessionRecorder) Resize(width, height int) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.record("r", []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+// Err returns the first error that occurred while writing the recording.
+func (r *SessionRecorder) Err() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// Close ends the recording, it does not close the underlying writers.
+func (r *SessionRecorder) Close() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.format == RecordTypescript {
+		_, err := fmt.Fprintf(r.w, "\nScript done on %s\n", time.Now().Format(time.RFC1123Z))
+		r.setErr(err)
+	}
+
+	return r.err
+}
+
+// runeTail holds back the incomplete UTF-8 rune ending the data of a
+// stream until the next data completes it, asciicast events being JSON
+// strings, which would replace the halves of a rune split across writes.
+type runeTail struct {
+	buf []byte
+}
+
+// complete returns the held back bytes followed by p, without the
+// incomplete rune ending them, held back in turn.
+func (t *runeTail) complete(p []byte) []byte {
+
+	data := append(t.buf, p...)
+
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+
+	t.buf = append([]byte(nil), data[cut:]...)
+
+	return data[:cut]
+}
+
+// recordStream records the data of a stream, an asciicast event holding
+// only complete runes.
+func (r *SessionRecorder) recordStream(typ string, tail *runeTail, p []byte) {
+
+	if r.format == RecordAsciicast {
+		if p = tail.complete(p); len(p) == 0 {
+			return
+		}
+	}
+
+	r.record(typ, p)
+}
+
+type recordWriter struct {
+	r    *SessionRecorder
+	dst  io.Writer
+	tail runeTail
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+
+	w.r.mu.Lock()
+	defer w.r.mu.Unlock()
+
+	w.r.recordStream("o", &w.tail, p)
+
+	if w.dst == nil {
+		return len(p), nil
+	}
+
+	return w.dst.Write(p)
+}
+
+type recordReader struct {
+	r    *SessionRecorder
+	src  io.Reader
+	tail runeTail
+}
+
+func (rr *recordReader) Read(p []byte) (int, error) {
+
+	n, err := rr.src.Read(p)
+
+	if n > 0 && rr.r.RecordInput {
+		rr.r.mu.Lock()
+		rr.r.recordStream("i", &rr.tail, p[:n])
+		rr.r.mu.Unlock()
+	}
+
+	return n, err
+}
@@ -0,0 +1,88 @@
+package goph_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+)
+
+func TestAsciicastRecorder(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	rec, err := goph.NewAsciicastRecorder(&buf, 80, 24, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	w := rec.Writer(&out)
+	w.Write([]byte("hello\r\n"))
+	rec.Resize(100, 30)
+
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "hello\r\n" {
+		t.Errorf("output should be passed through, got %q", out.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 events, got %d lines", len(lines))
+	}
+
+	var event []interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	if event[1] != "o" || event[2] != "hello\r\n" {
+		t.Errorf("unexpected output event: %v", event)
+	}
+}
+
+func TestAsciicastSplitRune(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	rec, err := goph.NewAsciicastRecorder(&buf, 80, 24, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	w := rec.Writer(&out)
+
+	// "é" is 0xc3 0xa9, and "€" 0xe2 0x82 0xac.
+	for _, p := range []string{"caf\xc3", "\xa9 ", "\xe2", "\x82", "\xac!"} {
+		if _, err = w.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "café €!" {
+		t.Errorf("the output should be passed through as written, got %q", out.String())
+	}
+
+	var recorded string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n")[1:] {
+		var event []interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		recorded += event[2].(string)
+	}
+
+	if recorded != "café €!" {
+		t.Errorf("expected the split runes recorded whole, got %q", recorded)
+	}
+}
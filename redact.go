@@ -0,0 +1,129 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in logs, audit records and errors.
+const Redacted = "[REDACTED]"
+
+// DefaultSecretPatterns are the secret patterns used when
+// Config.SecretPatterns is nil. When a pattern has a capture group only the
+// first group is redacted, otherwise the whole match is.
+var DefaultSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`(?i)--?(?:password|passwd|passphrase|secret|token|api[-_]?key)(?:=|\s+)("[^"]*"|'[^']*'|[^\s'";&|]+)`),
+	regexp.MustCompile(`(?i)\b(?:password|passwd|passphrase|secret|token|api[-_]?key)\s*[=:]\s*("[^"]*"|'[^']*'|[^\s'";&|]+)`),
+	regexp.MustCompile(`(?i)\bauthorization:\s*(?:bearer|basic)\s+("[^"]*"|'[^']*'|[^\s'";&|]+)`),
+	regexp.MustCompile(`\bsshpass\s+-p\s*("[^"]*"|'[^']*'|[^\s'";&|]+)`),
+	regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+:([^@\s]+)@`),
+}
+
+// Redact returns s with the secrets matching the config secret patterns
+// replaced by Redacted.
+func (c *Config) Redact(s string) string {
+
+	patterns := DefaultSecretPatterns
+	if c != nil && c.SecretPatterns != nil {
+		patterns = c.SecretPatterns
+	}
+
+	for _, re := range patterns {
+		s = redactPattern(re, s)
+	}
+
+	return s
+}
+
+func redactPattern(re *regexp.Regexp, s string) string {
+
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, Redacted)
+	}
+
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var (
+		b    strings.Builder
+		last int
+	)
+
+	for _, m := range matches {
+		start, end := m[2], m[3]
+		if start < 0 {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(Redacted)
+		last = end
+	}
+	b.WriteString(s[last:])
+
+	return b.String()
+}
+
+// redactedError is an error with a scrubbed message that still unwraps to
+// the original error.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError returns err with its message scrubbed, or err itself when
+// it holds no secret.
+func (c *Config) redactError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	if scrubbed := c.Redact(msg); scrubbed != msg {
+		return &redactedError{msg: scrubbed, err: err}
+	}
+
+	return err
+}
+
+// redactArgs scrubs the string and error values of log key/value pairs.
+func (c *Config) redactArgs(args []any) []any {
+
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			args[i] = c.Redact(v)
+		case error:
+			args[i] = c.redactError(v)
+		}
+	}
+
+	return args
+}
+
+// String returns a description of the config safe for logs, auth methods
+// are listed by name only.
+func (c *Config) String() string {
+
+	if c == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("goph.Config{User: %s, Addr: %s, Auth: [%s], Timeout: %s}",
+		c.User, c.hostPort(), strings.Join(authMethodNames(c.Auth), " "), c.Timeout)
+}
+
+// GoString is like String, so %#v does not dump the auth methods either.
+func (c *Config) GoString() string {
+	return c.String()
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// WithRedial runs op with the client, and when op fails because the
+// connection broke, re-dials once with Reconnect and runs op again. op must
+// be idempotent: it may have partially run on the server before the
+// connection was lost. A client closed with Close is not re-dialed.
+func (c *Client) WithRedial(ctx context.Context, op func(*Client) error) error {
+
+	err := op(c)
+	if err == nil || !c.broken(err) {
+		return err
+	}
+
+	c.Config.logger().Warn("connection lost, redialing", c.Config.logAttrs("error", err)...)
+
+	if rerr := c.Reconnect(ctx); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+
+	return op(c)
+}
+
+// RunIdempotent runs cmd like RunContext, re-dialing once and running it
+// again when the connection broke, see WithRedial.
+func (c *Client) RunIdempotent(ctx context.Context, cmd string) (out []byte, err error) {
+
+	err = c.WithRedial(ctx, func(c *Client) (err error) {
+		out, err = c.RunContext(ctx, cmd)
+		return err
+	})
+
+	return out, err
+}
+
+// broken reports whether err is caused by a lost connection of c rather
+// than by the operation itself.
+func (c *Client) broken(err error) bool {
+
+	state := c.live().state
+	if state != nil && state.closed.Load() {
+		return false
+	}
+
+	var (
+		exitErr  *ssh.ExitError
+		exitMiss *ssh.ExitMissingError
+	)
+
+	switch {
+	case errors.As(err, &exitErr), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &exitMiss), isAny(err, io.EOF, net.ErrClosed, syscall.EPIPE, syscall.ECONNRESET):
+		return true
+	}
+
+	if state != nil {
+		select {
+		case <-state.done:
+			return true
+		default:
+		}
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection lost")
+}
@@ -0,0 +1,57 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestRunIdempotent(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("uptime", func(e *gophtest.Exec) int {
+		fmt.Fprint(e.Stdout, "up 3 days")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reconnected bool
+	client.Config.OnReconnect = func(goph.ConnInfo) { reconnected = true }
+
+	// break the connection under the client.
+	client.Client.Close()
+
+	if _, err = client.Run("uptime"); err == nil {
+		t.Fatal("run should fail on a broken connection")
+	}
+
+	out, err := client.RunIdempotent(context.Background(), "uptime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "up 3 days" || !reconnected {
+		t.Errorf("expected a re-dial and the command output, got %q", out)
+	}
+
+	// a closed client is not re-dialed.
+	client.Close()
+	reconnected = false
+
+	if _, err = client.RunIdempotent(context.Background(), "uptime"); err == nil || reconnected {
+		t.Error("a closed client should not be re-dialed")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+
+	"github.com/pkg/sftp"
+)
+
+// RemoteFile is a remote file opened by OpenFile. It implements
+// io.ReaderAt, io.WriterAt and io.Seeker, to read or patch parts of large
+// files without transferring them whole.
+type RemoteFile struct {
+	*sftp.File
+	ftp *sftp.Client
+}
+
+// Close closes the file and its sftp client.
+func (f *RemoteFile) Close() error {
+	return errors.Join(f.File.Close(), f.ftp.Close())
+}
+
+// OpenFile opens the remote file with the os.O_* flags, like os.OpenFile,
+// over a dedicated sftp client. A leading "~" is expanded to the home
+// directory of the remote user.
+func (c Client) OpenFile(remotePath string, flags int) (_ *RemoteFile, err error) {
+
+	if remotePath, err = c.remotePath(remotePath); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "sftp", RemotePath: remotePath, Err: err})
+	}()
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := ftp.OpenFile(remotePath, flags)
+	if err != nil {
+		ftp.Close()
+		return nil, err
+	}
+
+	return &RemoteFile{File: f, ftp: ftp}, nil
+}
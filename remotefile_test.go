@@ -0,0 +1,53 @@
+package goph_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOpenFile(t *testing.T) {
+
+	client := newFileServer(t)
+
+	f, err := client.OpenFile("/disk.img", os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = f.Write([]byte(strings.Repeat(".", 32))); err != nil {
+		t.Fatal(err)
+	}
+
+	var _ io.ReaderAt = f
+	var _ io.WriterAt = f
+	var _ io.Seeker = f
+
+	if _, err = f.WriteAt([]byte("MAGIC"), 8); err != nil {
+		t.Fatal(err)
+	}
+
+	header := make([]byte, 5)
+	if _, err = f.ReadAt(header, 8); err != nil || string(header) != "MAGIC" {
+		t.Errorf("unexpected header %q, %v", header, err)
+	}
+
+	if pos, err := f.Seek(-4, io.SeekEnd); err != nil || pos != 28 {
+		t.Errorf("unexpected position %d, %v", pos, err)
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readRemote(t, client, "/disk.img"); got != "........MAGIC..................." {
+		t.Errorf("unexpected content %q", got)
+	}
+
+	if _, err = client.OpenFile("/missing", os.O_RDONLY); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing file, got %v", err)
+	}
+}
@@ -0,0 +1,464 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// remoteRel returns the path of p relative to root, p being root or a path
+// under it, like the paths of an sftp walker, joined with path.Join.
+func remoteRel(root, p string) string {
+
+	root, p = path.Clean(root), path.Clean(p)
+
+	switch {
+	case p == root:
+		return "."
+	case root == ".":
+		return p
+	case root == "/":
+		return strings.TrimPrefix(p, "/")
+	}
+
+	return strings.TrimPrefix(p, root+"/")
+}
+
+// sharedSftp returns the sftp client of the connection, opened on first use
+// and kept until the connection closes, and the function to call once done
+// with it. A client without connection state gets a dedicated sftp client,
+// closed by done.
+func (c Client) sharedSftp() (ftp *sftp.Client, done func() error, err error) {
+
+	c = c.live()
+
+	if c.state == nil {
+		if ftp, err = c.NewSftp(); err != nil {
+			return nil, nil, err
+		}
+		return ftp, ftp.Close, nil
+	}
+
+	if err = c.state.drain.accepting(); err != nil {
+		return nil, nil, err
+	}
+
+	c.state.sftpMu.Lock()
+	defer c.state.sftpMu.Unlock()
+
+	if c.state.sftp == nil {
+		if c.state.sftp, err = sftp.NewClient(c.Client); err != nil {
+			return nil, nil, withKind(ErrSFTPUnavailable, err)
+		}
+	}
+
+	return c.state.sftp, func() error { return nil }, nil
+}
+
+// dropSftp forgets the shared sftp client ftp once it failed with err
+// because its session was lost, the next operation opens another one.
+func (c Client) dropSftp(ftp *sftp.Client, err error) {
+
+	c = c.live()
+
+	if c.state == nil || !isAny(err, sftp.ErrSSHFxConnectionLost, io.EOF, io.ErrUnexpectedEOF) {
+		return
+	}
+
+	c.state.sftpMu.Lock()
+	defer c.state.sftpMu.Unlock()
+
+	if c.state.sftp == ftp {
+		c.state.sftp = nil
+		ftp.Close()
+	}
+}
+
+// withSftp calls op with the shared sftp client and remotePath expanded
+// like the paths of transfers.
+func (c Client) withSftp(remotePath string, op func(ftp *sftp.Client, p string) error) (err error) {
+
+	if remotePath, err = c.remotePath(remotePath); err != nil {
+		return err
+	}
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "sftp", RemotePath: remotePath, Err: err})
+	}()
+
+	ftp, done, err := c.sharedSftp()
+	if err != nil {
+		return err
+	}
+
+	if err = op(ftp, remotePath); err != nil {
+		c.dropSftp(ftp, err)
+	}
+
+	return errors.Join(err, done())
+}
+
+// ReadFile returns the content of the remote file, like os.ReadFile. A
+// leading "~" is expanded to the home directory of the remote user, like
+// the other file operations of the client.
+func (c Client) ReadFile(remotePath string) (data []byte, err error) {
+
+	err = c.withSftp(remotePath, func(ftp *sftp.Client, p string) error {
+
+		f, err := ftp.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		data, err = io.ReadAll(f)
+		return err
+	})
+
+	return data, err
+}
+
+// WriteFile writes data to the remote file, creating or truncating it, and
+// sets its mode to perm. Unlike EnsureFile, the file is written in place.
+func (c Client) WriteFile(remotePath string, data []byte, perm os.FileMode) error {
+	return c.withSftp(remotePath, func(ftp *sftp.Client, p string) (err error) {
+
+		f, err := ftp.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+
+		if _, err = f.Write(data); err != nil {
+			return err
+		}
+
+		return f.Chmod(perm)
+	})
+}
+
+// Remove removes the remote file or empty directory.
+func (c Client) Remove(remotePath string) error {
+	return c.withSftp(remotePath, func(ftp *sftp.Client, p string) error {
+		return ftp.Remove(p)
+	})
+}
+
+// RemoveAll removes the remote path and everything it contains, like
+// os.RemoveAll. A missing path is not an error.
+func (c Client) RemoveAll(remotePath string) error {
+	return c.withSftp(remotePath, removeAll)
+}
+
+// removeAll removes p and its content, without following symbolic links.
+func removeAll(ftp *sftp.Client, p string) error {
+
+	info, err := ftp.Lstat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return ftp.Remove(p)
+	}
+
+	entries, err := ftp.ReadDir(p)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err = removeAll(ftp, path.Join(p, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return ftp.RemoveDirectory(p)
+}
+
+// Rename renames the remote oldpath to newpath. Many servers refuse to
+// replace an existing newpath, see PosixRename.
+func (c Client) Rename(oldpath, newpath string) (err error) {
+
+	if oldpath, err = c.remotePath(oldpath); err != nil {
+		return err
+	}
+
+	return c.withSftp(newpath, func(ftp *sftp.Client, p string) error {
+		return ftp.Rename(oldpath, p)
+	})
+}
+
+// Chmod sets the mode of the remote path.
+func (c Client) Chmod(remotePath string, mode os.FileMode) error {
+	return c.withSftp(remotePath, func(ftp *sftp.Client, p string) error {
+		return ftp.Chmod(p, mode)
+	})
+}
+
+// Exists reports whether the remote path exists, following symbolic
+// links. A path that cannot be checked is an error.
+func (c Client) Exists(remotePath string) (exists bool, err error) {
+
+	err = c.withSftp(remotePath, func(ftp *sftp.Client, p string) error {
+		_, err := ftp.Stat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		exists = err == nil
+		return err
+	})
+
+	return exists, err
+}
+
+// Glob returns the remote paths matching pattern, with the syntax of
+// path.Match, or nil when none matches.
+func (c Client) Glob(pattern string) (matches []string, err error) {
+
+	err = c.withSftp(pattern, func(ftp *sftp.Client, p string) error {
+		matches, err = ftp.Glob(p)
+		return err
+	})
+
+	return matches, err
+}
+
+// FS returns the remote filesystem as an fs.FS rooted at "/", for the
+// io/fs functions and the packages reading an fs.FS, like html/template.
+// It implements fs.ReadDirFS, fs.ReadFileFS and fs.StatFS over the sftp
+// client shared with the file operations of the client. Use fs.Sub to
+// root it at a directory.
+func (c Client) FS() fs.FS {
+	return remoteFS{client: c}
+}
+
+// remoteFS is the fs.FS of the remote filesystem.
+type remoteFS struct {
+	client Client
+}
+
+var (
+	_ fs.ReadDirFS  = remoteFS{}
+	_ fs.ReadFileFS = remoteFS{}
+	_ fs.StatFS     = remoteFS{}
+)
+
+// do calls op with the sftp client and the absolute remote path of name,
+// and returns its error as a *fs.PathError. done is left to op when it
+// keeps the client, like Open.
+func (r remoteFS) do(op, name string, fn func(ftp *sftp.Client, p string, done func() error) error) error {
+
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	ftp, done, err := r.client.sharedSftp()
+	if err == nil {
+		if err = fn(ftp, path.Join("/", name), done); err != nil {
+			r.client.dropSftp(ftp, err)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	// the sftp client already returns some errors as path errors.
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Open opens the named file or directory for reading.
+func (r remoteFS) Open(name string) (file fs.File, err error) {
+
+	err = r.do("open", name, func(ftp *sftp.Client, p string, done func() error) error {
+
+		info, err := ftp.Stat(p)
+		if err != nil {
+			done()
+			return err
+		}
+
+		if info.IsDir() {
+			file = &remoteDir{ftp: ftp, path: p, info: fsInfo(name, info), done: done}
+			return nil
+		}
+
+		f, err := ftp.Open(p)
+		if err != nil {
+			done()
+			return err
+		}
+
+		file = &remoteFSFile{File: f, info: fsInfo(name, info), done: done}
+		return nil
+	})
+
+	return file, err
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (r remoteFS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+
+	err = r.do("readdir", name, func(ftp *sftp.Client, p string, done func() error) error {
+		defer done()
+		entries, err = readDirEntries(ftp, p)
+		return err
+	})
+
+	return entries, err
+}
+
+// ReadFile returns the content of the named file.
+func (r remoteFS) ReadFile(name string) (data []byte, err error) {
+
+	err = r.do("read", name, func(ftp *sftp.Client, p string, done func() error) error {
+		defer done()
+
+		f, err := ftp.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		data, err = io.ReadAll(f)
+		return err
+	})
+
+	return data, err
+}
+
+// Stat returns the info of the named file, following symbolic links.
+func (r remoteFS) Stat(name string) (info fs.FileInfo, err error) {
+
+	err = r.do("stat", name, func(ftp *sftp.Client, p string, done func() error) error {
+		defer done()
+		if info, err = ftp.Stat(p); err == nil {
+			info = fsInfo(name, info)
+		}
+		return err
+	})
+
+	return info, err
+}
+
+// readDirEntries returns the entries of the remote directory p sorted by
+// name.
+func readDirEntries(ftp *sftp.Client, p string) ([]fs.DirEntry, error) {
+
+	infos, err := ftp.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+// fsInfo returns info named after the base of the fs.FS name, "." for the
+// root, where sftp names it "/".
+func fsInfo(name string, info fs.FileInfo) fs.FileInfo {
+	return namedInfo{FileInfo: info, name: path.Base(name)}
+}
+
+type namedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i namedInfo) Name() string { return i.name }
+
+// remoteFSFile is a remote file opened by the fs.FS.
+type remoteFSFile struct {
+	*sftp.File
+	info fs.FileInfo
+	done func() error
+}
+
+func (f *remoteFSFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *remoteFSFile) Close() error {
+	return errors.Join(f.File.Close(), f.done())
+}
+
+// remoteDir is a remote directory opened by the fs.FS, its entries are
+// read on the first ReadDir.
+type remoteDir struct {
+	ftp     *sftp.Client
+	path    string
+	info    fs.FileInfo
+	done    func() error
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *remoteDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *remoteDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a directory")}
+}
+
+func (d *remoteDir) Close() error {
+	return d.done()
+}
+
+// ReadDir returns the next n entries of the directory, or all of them when
+// n <= 0, like fs.ReadDirFile.
+func (d *remoteDir) ReadDir(n int) ([]fs.DirEntry, error) {
+
+	if !d.read {
+		entries, err := readDirEntries(d.ftp, d.path)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.path, Err: err}
+		}
+		d.entries, d.read = entries, true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return entries, nil
+}
@@ -0,0 +1,94 @@
+package goph_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRemoteFS(t *testing.T) {
+
+	client := newFileServer(t)
+
+	files := map[string]string{
+		"/tree/a.txt":       "alpha",
+		"/tree/sub/b.txt":   "bravo",
+		"/tree/sub/c.conf":  "charlie",
+		"/tree/sub/deep/d":  "delta",
+		"/tree/sub/deep/e1": "",
+	}
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftp.MkdirAll("/tree/sub/deep")
+	ftp.Close()
+
+	for name, data := range files {
+		if err = client.WriteFile(name, []byte(data), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if data, err := client.ReadFile("/tree/sub/b.txt"); err != nil || string(data) != "bravo" {
+		t.Errorf("expected bravo, got %q, %v", data, err)
+	}
+
+	// the fs.FS behaves like the local ones.
+	sub, err := fs.Sub(client.FS(), "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fstest.TestFS(sub, "a.txt", "sub/b.txt", "sub/c.conf", "sub/deep/d", "sub/deep/e1"); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := fs.Glob(sub, "sub/*.txt")
+	if err != nil || len(matches) != 1 || matches[0] != "sub/b.txt" {
+		t.Errorf("expected sub/b.txt, got %v, %v", matches, err)
+	}
+
+	if _, err = fs.Stat(client.FS(), "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err = client.FS().Open("/tree"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected fs.ErrInvalid for a rooted name, got %v", err)
+	}
+
+	// the file operations of the client.
+	matches, err = client.Glob("/tree/sub/*.conf")
+	if err != nil || len(matches) != 1 || matches[0] != "/tree/sub/c.conf" {
+		t.Errorf("expected /tree/sub/c.conf, got %v, %v", matches, err)
+	}
+
+	if err = client.Rename("/tree/a.txt", "/tree/z.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Chmod("/tree/z.txt", 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"/tree/a.txt": false, "/tree/z.txt": true} {
+		if ok, err := client.Exists(name); err != nil || ok != want {
+			t.Errorf("%s: expected exists %v, got %v, %v", name, want, ok, err)
+		}
+	}
+
+	if err = client.Remove("/tree/sub"); err == nil {
+		t.Error("expected an error removing a directory that is not empty")
+	}
+	if err = client.Remove("/tree/z.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = client.RemoveAll("/tree"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := client.Exists("/tree"); ok {
+		t.Error("expected the tree removed")
+	}
+	if err = client.RemoveAll("/tree"); err != nil {
+		t.Errorf("expected a missing path removed without error, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"unicode/utf16"
+)
+
+// Operating systems of Config.RemoteOS.
+const (
+	RemoteUnix    = "unix"
+	RemoteWindows = "windows"
+)
+
+// Shells of Config.RemoteShell, running the command lines of the server.
+const (
+	ShellPOSIX      = "sh"
+	ShellCmd        = "cmd"
+	ShellPowerShell = "powershell"
+)
+
+// RemoteOS returns the operating system of the server, Config.RemoteOS
+// when set. Otherwise, servers announcing a Windows build of OpenSSH,
+// like "SSH-2.0-OpenSSH_for_Windows_8.1", are RemoteWindows ones and the
+// others RemoteUnix.
+func (c Client) RemoteOS() string {
+
+	c = c.live()
+
+	if c.Config != nil && c.Config.RemoteOS != "" {
+		return c.Config.RemoteOS
+	}
+
+	if c.Client != nil && strings.Contains(strings.ToLower(string(c.ServerVersion())), "windows") {
+		return RemoteWindows
+	}
+
+	return RemoteUnix
+}
+
+// RemoteShell returns the shell of the command lines of the server,
+// Config.RemoteShell when set. Otherwise ShellCmd, the default shell of
+// the Windows OpenSSH server, for Windows servers and ShellPOSIX for the
+// others.
+func (c Client) RemoteShell() string {
+
+	if c.Config != nil && c.Config.RemoteShell != "" {
+		return c.Config.RemoteShell
+	}
+
+	if c.RemoteOS() == RemoteWindows {
+		return ShellCmd
+	}
+
+	return ShellPOSIX
+}
+
+// QuoteShell quotes args as words of the shell, one of ShellPOSIX,
+// ShellCmd or ShellPowerShell, joined by spaces. Like Quote for
+// ShellPOSIX. The %VAR% references are still expanded by cmd.
+func QuoteShell(shell string, args ...string) string {
+
+	quote := shellQuote
+	switch shell {
+	case ShellCmd:
+		quote = cmdQuote
+	case ShellPowerShell:
+		quote = powerShellQuote
+	}
+
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = quote(arg)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// isPlainWord reports whether s needs no quoting for cmd and PowerShell.
+func isPlainWord(s string) bool {
+	return s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-.:/\\+") == ""
+}
+
+// cmdQuote quotes s as a single argument of the programs started by cmd,
+// parsed like the Microsoft C runtime does.
+func cmdQuote(s string) string {
+
+	if isPlainWord(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+
+	slashes := 0
+	for _, r := range s {
+		switch r {
+		case '\\':
+			slashes++
+		case '"':
+			// backslashes before a quote escape, double them.
+			b.WriteString(strings.Repeat(`\`, slashes*2+1))
+			slashes = 0
+		default:
+			b.WriteString(strings.Repeat(`\`, slashes))
+			slashes = 0
+		}
+		if r != '\\' {
+			b.WriteRune(r)
+		}
+	}
+
+	// the closing quote is escaped by trailing backslashes too.
+	b.WriteString(strings.Repeat(`\`, slashes*2))
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// powerShellQuote quotes s as a single PowerShell word.
+func powerShellQuote(s string) string {
+
+	if isPlainWord(s) && !strings.HasPrefix(s, "-") {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// RunPowerShell runs the PowerShell script on the server and returns its
+// combined output. The script is passed encoded with -EncodedCommand, so
+// it runs as is from any remote shell.
+func (c Client) RunPowerShell(ctx context.Context, script string) ([]byte, error) {
+	return c.RunContext(ctx, "powershell -NoProfile -NonInteractive -EncodedCommand "+encodePowerShell(script))
+}
+
+// encodePowerShell returns the script as the base64 of its UTF-16LE bytes,
+// expected by -EncodedCommand.
+func encodePowerShell(script string) string {
+
+	units := utf16.Encode([]rune(script))
+
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		b[2*i], b[2*i+1] = byte(u), byte(u>>8)
+	}
+
+	return base64.StdEncoding.EncodeToString(b)
+}
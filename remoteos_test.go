@@ -0,0 +1,145 @@
+package goph_test
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestQuoteShell(t *testing.T) {
+
+	tests := []struct {
+		shell string
+		args  []string
+		want  string
+	}{
+		{goph.ShellPOSIX, []string{"my file", "it's"}, `'my file' 'it'\''s'`},
+		{goph.ShellCmd, []string{`C:\Temp\x.txt`, "my file"}, `C:\Temp\x.txt "my file"`},
+		{goph.ShellCmd, []string{`say "hi"`, `dir\ `, ""}, `"say \"hi\"" "dir\ " ""`},
+		{goph.ShellCmd, []string{`a\"b`, `end\`}, `"a\\\"b" end\`},
+		{goph.ShellCmd, []string{`end\ x\`}, `"end\ x\\"`},
+		{goph.ShellPowerShell, []string{"my file", "it's", "-Force", "$env:PATH"}, `'my file' 'it''s' '-Force' '$env:PATH'`},
+	}
+
+	for _, tt := range tests {
+		if got := goph.QuoteShell(tt.shell, tt.args...); got != tt.want {
+			t.Errorf("QuoteShell(%s, %q): expected %s, got %s", tt.shell, tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestRemoteShell(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+
+	var commands []string
+	srv.NotFound = func(e *gophtest.Exec) int {
+		commands = append(commands, e.Command)
+		return 0
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	config := srv.Config("alice", "secret")
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if client.RemoteOS() != goph.RemoteUnix || client.RemoteShell() != goph.ShellPOSIX {
+		t.Errorf("expected a unix server with a POSIX shell, got %s and %s", client.RemoteOS(), client.RemoteShell())
+	}
+
+	config.RemoteOS = goph.RemoteWindows
+	if client.RemoteShell() != goph.ShellCmd {
+		t.Errorf("expected cmd for a windows server, got %s", client.RemoteShell())
+	}
+
+	run := func(cmd *goph.Cmd, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cmd.Close()
+		if err = cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd, err := client.Command("type", "my file.txt")
+	cmd.Dir = `C:\Program Files`
+	run(cmd, err)
+
+	config.RemoteShell = goph.ShellPowerShell
+
+	cmd, err = client.Command(`C:\Tools\my tool.exe`, "it's")
+	cmd.NoShell = true
+	cmd.Dir = `C:\Temp`
+	run(cmd, err)
+
+	if _, err = client.RunPowerShell(context.Background(), "Get-Date"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`cd /d "C:\Program Files" && type "my file.txt"`,
+		`Set-Location -LiteralPath C:\Temp -ErrorAction Stop; & 'C:\Tools\my tool.exe' 'it''s'`,
+	}
+	if len(commands) != 3 || commands[0] != want[0] || commands[1] != want[1] {
+		t.Fatalf("expected %q, got %q", want, commands)
+	}
+
+	encoded, ok := strings.CutPrefix(commands[2], "powershell -NoProfile -NonInteractive -EncodedCommand ")
+	if !ok {
+		t.Fatalf("unexpected powershell command %q", commands[2])
+	}
+	script, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(script) != "G\x00e\x00t\x00-\x00D\x00a\x00t\x00e\x00" {
+		t.Errorf("expected the UTF-16LE script, got %q", script)
+	}
+}
+
+func TestWindowsPaths(t *testing.T) {
+
+	client := newFileServer(t)
+	client.Config.RemoteOS = goph.RemoteWindows
+
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Upload(src, `\dst`); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readRemote(t, client, "/dst/sub/a.txt"); got != "a" {
+		t.Errorf("expected the file uploaded to /dst/sub/a.txt, got %q", got)
+	}
+
+	dst := filepath.Join(t.TempDir(), "out")
+	if err := client.Download(`\dst`, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dst, "sub", "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("expected the file downloaded, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Result is how a command run by RunResult or Cmd.Result ended.
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+
+	// ExitCode is the exit status of the command, -1 when it was killed
+	// by a signal or exited without status.
+	ExitCode int
+
+	// Signal is the name of the signal killing the command, like "KILL",
+	// empty when it exited.
+	Signal string
+
+	// Duration is the time the command ran.
+	Duration time.Duration
+}
+
+// Success reports whether the command exited with status 0.
+func (r *Result) Success() bool {
+	return r.ExitCode == 0 && r.Signal == ""
+}
+
+// RunResult runs cmd and returns its stdout and stderr apart, with its exit
+// status. Unlike Run, a command exiting with a non zero status or killed
+// by a signal is not an error, the Result tells how it ended. The error is
+// set when the command could not run, or ctx ended first.
+func (c Client) RunResult(ctx context.Context, cmd string) (*Result, error) {
+
+	command, err := c.CommandContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return command.Result()
+}
+
+// Result runs the command and returns how it ended, see RunResult. The
+// output is also written to the Stdout and Stderr of the session when set.
+func (c *Cmd) Result() (_ *Result, err error) {
+	defer func() { err = c.opError(err) }()
+
+	var stdout, stderr bytes.Buffer
+	c.Session.Stdout = teeOutput(&stdout, c.Session.Stdout)
+	c.Session.Stderr = teeOutput(&stderr, c.Session.Stderr)
+
+	if err := c.init(); err != nil {
+		return nil, fmt.Errorf("cmd init: %w", err)
+	}
+
+	start := time.Now()
+	_, err = c.runWithContext(func() ([]byte, error) {
+		return nil, c.Session.Run(c.String())
+	})
+
+	// the output is only complete once the command returned.
+	var exitErr *ssh.ExitError
+	var missingErr *ssh.ExitMissingError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+	case errors.As(err, &missingErr):
+	default:
+		return nil, err
+	}
+
+	r := &Result{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		Duration: time.Since(start),
+	}
+
+	switch {
+	case exitErr != nil && exitErr.Signal() != "":
+		r.ExitCode, r.Signal = -1, exitErr.Signal()
+	case exitErr != nil:
+		r.ExitCode = exitErr.ExitStatus()
+	case missingErr != nil:
+		r.ExitCode = -1
+		return r, err
+	}
+
+	return r, nil
+}
+
+// teeOutput returns buf, also writing to w when set.
+func teeOutput(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
@@ -0,0 +1,70 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestRunResult(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("check", func(e *gophtest.Exec) int {
+		fmt.Fprint(e.Stdout, "out")
+		fmt.Fprint(e.Stderr, "err")
+		return 3
+	})
+	srv.HandleFunc("cd '/srv/my app' && upper", func(e *gophtest.Exec) int {
+		in, _ := io.ReadAll(e.Stdin)
+		fmt.Fprint(e.Stdout, strings.ToUpper(string(in)))
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	r, err := client.RunResult(context.Background(), "check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Stdout) != "out" || string(r.Stderr) != "err" || r.ExitCode != 3 || r.Success() {
+		t.Errorf("expected out, err and status 3, got %q, %q and %d", r.Stdout, r.Stderr, r.ExitCode)
+	}
+
+	cmd, err := client.Command("upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Dir = "/srv/my app"
+	cmd.Stdin = strings.NewReader("input")
+
+	var stdout strings.Builder
+	cmd.Stdout = &stdout
+
+	if r, err = cmd.Result(); err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Stdout) != "INPUT" || stdout.String() != "INPUT" || !r.Success() {
+		t.Errorf("expected INPUT from the working directory, got %q and %q, %d", r.Stdout, stdout.String(), r.ExitCode)
+	}
+
+	// a command that cannot run is an error.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = client.RunResult(ctx, "check"); err == nil {
+		t.Error("expected an error with a cancelled context")
+	}
+}
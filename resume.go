@@ -0,0 +1,363 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// errResumeTransforms is returned by the resumable transfers of a config
+// with Transforms, the offsets of the transformed files do not match their
+// source.
+var errResumeTransforms = errors.New("goph: resumable transfers do not support Config.Transforms")
+
+// DefaultCheckpoint is the number of bytes of a file copied between two
+// saves of the state of a resumable transfer.
+var DefaultCheckpoint int64 = 8 << 20
+
+// TransferState is the progress of a resumable transfer, saved as JSON in
+// its state file.
+type TransferState struct {
+
+	// Op is "upload" or "download".
+	Op         string `json:"op"`
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+
+	// Files are the states of the files by slash separated path relative
+	// to the source, "." when the source is a file.
+	Files map[string]*FileState `json:"files"`
+}
+
+// FileState is the progress of a single file of a resumable transfer.
+type FileState struct {
+
+	// Size and ModTime of the source file, a changed file is copied again.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+
+	// Offset is the number of bytes copied.
+	Offset int64 `json:"offset"`
+
+	// Done is set once the file is copied, SHA256 is then its checksum.
+	Done   bool   `json:"done,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// LoadTransferState reads the state file of a resumable transfer.
+func LoadTransferState(stateFile string) (*TransferState, error) {
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var s TransferState
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("transfer state %s: %w", stateFile, err)
+	}
+
+	if s.Op != "upload" && s.Op != "download" {
+		return nil, fmt.Errorf("transfer state %s: unknown operation %q", stateFile, s.Op)
+	}
+
+	return &s, nil
+}
+
+// save writes the state to stateFile through a temporary file, so a killed
+// process leaves the previous state.
+func (s *TransferState) save(stateFile string) error {
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := stateFile + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, stateFile)
+}
+
+// UploadResumable uploads the local file or directory like Upload, saving
+// its progress to stateFile. When stateFile holds the state of the same
+// upload, the files already copied are skipped and the partial file
+// continues at its offset. The state file is removed once the upload
+// completes. Configs with Transforms are refused. With Config.Retry, a
+// dropped connection is re-dialed and the upload resumed, so the client
+// must not be used concurrently meanwhile, see Reconnect.
+func (c *Client) UploadResumable(ctx context.Context, localPath, remotePath, stateFile string) error {
+	return c.resumable(ctx, "upload", localPath, remotePath, stateFile)
+}
+
+// DownloadResumable downloads the remote file or directory like Download,
+// resuming from stateFile like UploadResumable.
+func (c *Client) DownloadResumable(ctx context.Context, remotePath, localPath, stateFile string) error {
+	return c.resumable(ctx, "download", localPath, remotePath, stateFile)
+}
+
+// Resume continues the resumable upload or download saved in stateFile.
+func (c *Client) Resume(ctx context.Context, stateFile string) error {
+
+	if c.Config != nil && len(c.Config.Transforms) > 0 {
+		return errResumeTransforms
+	}
+
+	s, err := LoadTransferState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	return c.resumeRetry(ctx, s, stateFile)
+}
+
+// resumable starts or continues the transfer op, with the state of
+// stateFile when it is the same transfer.
+func (c *Client) resumable(ctx context.Context, op, localPath, remotePath, stateFile string) (err error) {
+
+	if c.Config != nil && len(c.Config.Transforms) > 0 {
+		return errResumeTransforms
+	}
+
+	if remotePath, err = c.remotePath(remotePath); err != nil {
+		return err
+	}
+
+	s, err := LoadTransferState(stateFile)
+	if err != nil || s.Op != op || s.LocalPath != localPath || s.RemotePath != remotePath {
+		s = &TransferState{Op: op, LocalPath: localPath, RemotePath: remotePath}
+	}
+
+	return c.resumeRetry(ctx, s, stateFile)
+}
+
+// resume runs the transfer of s.
+func (c *Client) resume(ctx context.Context, s *TransferState, stateFile string) (err error) {
+	t := c.Config.startTransfer(ctx, s.Op, s.LocalPath, s.RemotePath)
+	defer func() { err = t.end(err) }()
+
+	if err = c.beginOp(t); err != nil {
+		return err
+	}
+	defer c.endOp(t)
+
+	if s.Files == nil {
+		s.Files = make(map[string]*FileState)
+	}
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	r := &resumer{client: c, ftp: ftp, t: t, state: s, stateFile: stateFile}
+
+	if s.Op == "upload" {
+		err = filepath.Walk(s.LocalPath, func(p string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(s.LocalPath, p)
+			if err != nil {
+				return err
+			}
+			return r.entry(ctx, filepath.ToSlash(rel), info)
+		})
+	} else {
+		walker := ftp.Walk(s.RemotePath)
+		for err == nil && walker.Step() {
+			if err = walker.Err(); err != nil {
+				break
+			}
+			err = r.entry(ctx, remoteRel(s.RemotePath, walker.Path()), walker.Stat())
+		}
+	}
+
+	if err != nil {
+		if serr := s.save(stateFile); serr != nil {
+			err = errors.Join(err, serr)
+		}
+		return err
+	}
+
+	if err = os.Remove(stateFile); errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+
+	return err
+}
+
+// resumer copies the files of a resumable transfer.
+type resumer struct {
+	client    *Client
+	ftp       *sftp.Client
+	t         *transfer
+	state     *TransferState
+	stateFile string
+}
+
+// entry copies the source entry rel, creating the directories.
+func (r *resumer) entry(ctx context.Context, rel string, info fs.FileInfo) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	local := filepath.Join(r.state.LocalPath, filepath.FromSlash(rel))
+	remote := path.Join(r.state.RemotePath, rel)
+
+	if info.IsDir() {
+		if r.state.Op == "upload" {
+			return r.ftp.MkdirAll(remote)
+		}
+		return os.MkdirAll(local, 0755)
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f := r.state.Files[rel]
+	if f == nil || f.Size != info.Size() || !f.ModTime.Equal(info.ModTime()) {
+		f = &FileState{Size: info.Size(), ModTime: info.ModTime()}
+		r.state.Files[rel] = f
+	}
+
+	if f.Done {
+		return nil
+	}
+
+	e := r.t.fileStart(local, remote, info.Size())
+
+	n, err := r.copy(ctx, e, f, local, remote)
+	e.Bytes = n
+	if err != nil {
+		return r.t.fileError(e, err)
+	}
+
+	r.t.file(e, n)
+
+	return r.state.save(r.stateFile)
+}
+
+// copy copies the file from its offset, saving the state at every
+// checkpoint, and returns the bytes copied.
+func (r *resumer) copy(ctx context.Context, e *FileEvent, f *FileState, local, remote string) (n int64, err error) {
+
+	var (
+		src io.ReadSeekCloser
+		dst interface {
+			io.WriteSeeker
+			io.Closer
+			Stat() (fs.FileInfo, error)
+		}
+	)
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if f.Offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	if r.state.Op == "upload" {
+		if src, err = os.Open(local); err != nil {
+			return 0, err
+		}
+		dst, err = r.ftp.OpenFile(remote, flags)
+	} else {
+		if src, err = r.ftp.Open(remote); err != nil {
+			return 0, err
+		}
+		if err = os.MkdirAll(filepath.Dir(local), 0755); err == nil {
+			dst, err = os.OpenFile(local, flags, 0644)
+		}
+	}
+	defer src.Close()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	// the destination lost the bytes copied before, start over.
+	if info, err := dst.Stat(); err != nil || info.Size() < f.Offset {
+		f.Offset = 0
+	}
+
+	h := sha256.New()
+	if err = hashPrefix(h, local, f.Offset); err != nil {
+		return 0, err
+	}
+
+	if _, err = src.Seek(f.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err = dst.Seek(f.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	in := io.TeeReader(r.t.source(e, src), h)
+
+	for {
+		copied, err := io.CopyN(dst, in, DefaultCheckpoint)
+		n += copied
+		f.Offset += copied
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if err = r.state.save(r.stateFile); err != nil {
+			return n, err
+		}
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+	}
+
+	f.Done = true
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	return n, nil
+}
+
+// hashPrefix hashes the first n bytes of the local file, the source of an
+// upload or the destination of a download, already copied.
+func hashPrefix(h hash.Hash, local string, n int64) error {
+
+	if n == 0 {
+		return nil
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.CopyN(h, f, n)
+	return err
+}
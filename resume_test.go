@@ -0,0 +1,177 @@
+package goph_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+)
+
+// failingReader fails once budget bytes were read, like a killed transfer.
+type failingReader struct {
+	io.Reader
+	budget *int
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	if *r.budget <= 0 {
+		return 0, errors.New("killed")
+	}
+	if len(p) > *r.budget {
+		p = p[:*r.budget]
+	}
+	n, err := r.Reader.Read(p)
+	*r.budget -= n
+	return n, err
+}
+
+func TestResume(t *testing.T) {
+
+	defer func(checkpoint int64) { goph.DefaultCheckpoint = checkpoint }(goph.DefaultCheckpoint)
+	goph.DefaultCheckpoint = 1024
+
+	client := newFileServer(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "backup")
+	os.MkdirAll(filepath.Join(src, "db"), 0755)
+	contents := map[string]string{
+		"a.txt":     strings.Repeat("a", 10000),
+		"db/b.dump": strings.Repeat("b", 10000),
+		"db/c.dump": strings.Repeat("c", 10000),
+	}
+	for name, content := range contents {
+		os.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(content), 0644)
+	}
+
+	stateFile := filepath.Join(dir, "backup.state")
+
+	budget := 15000
+	client.Config.ProxyReader = func(r io.Reader) io.Reader { return failingReader{Reader: r, budget: &budget} }
+
+	if err := client.UploadResumable(ctx, src, "/backup", stateFile); err == nil {
+		t.Fatal("the upload should be interrupted")
+	}
+
+	state, err := goph.LoadTransferState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := state.Files["a.txt"]; f == nil || !f.Done || len(f.SHA256) != 64 {
+		t.Errorf("the first file should be done, got %+v", f)
+	}
+	if f := state.Files["db/b.dump"]; f == nil || f.Done || f.Offset != 5000 {
+		t.Errorf("the second file should be at offset 5000, got %+v", f)
+	}
+
+	var bar countWriter
+	client.Config.ProxyReader = nil
+	client.Config.Progress = &bar
+
+	if err = client.Resume(ctx, stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if bar.n != 15000 {
+		t.Errorf("the resume should copy the 15000 bytes left, copied %d", bar.n)
+	}
+	for name, content := range contents {
+		if got := readRemote(t, client, "/backup/"+name); got != content {
+			t.Errorf("%s: unexpected content of %d bytes", name, len(got))
+		}
+	}
+	if _, err = os.Stat(stateFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the state file should be removed, got %v", err)
+	}
+
+	// downloads resume the same way.
+	budget = 25000
+	client.Config.Progress = nil
+	client.Config.ProxyReader = func(r io.Reader) io.Reader { return failingReader{Reader: r, budget: &budget} }
+
+	dst := filepath.Join(dir, "restore")
+	if err = client.DownloadResumable(ctx, "/backup", dst, stateFile); err == nil {
+		t.Fatal("the download should be interrupted")
+	}
+
+	bar.n = 0
+	client.Config.ProxyReader = nil
+	client.Config.Progress = &bar
+
+	if err = client.DownloadResumable(ctx, "/backup", dst, stateFile); err != nil {
+		t.Fatal(err)
+	}
+	if bar.n != 5000 {
+		t.Errorf("the resume should copy the 5000 bytes left, copied %d", bar.n)
+	}
+	for name, content := range contents {
+		if got, _ := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name))); string(got) != content {
+			t.Errorf("%s: unexpected content of %d bytes", name, len(got))
+		}
+	}
+}
+
+func TestResumeRoots(t *testing.T) {
+
+	client := newFileServer(t)
+	ctx := context.Background()
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	if err = ftp.Mkdir("/logs"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.WriteFile("/logs/a", []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range []string{"/", "."} {
+		dst := filepath.Join(t.TempDir(), "out")
+		if err := client.DownloadResumable(ctx, root, dst, filepath.Join(t.TempDir(), "state")); err != nil {
+			t.Fatalf("%s: %v", root, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(dst, "logs", "a")); err != nil || string(got) != "a" {
+			t.Errorf("%s: expected logs/a downloaded, got %q, %v", root, got, err)
+		}
+	}
+}
+
+func TestResumeTransforms(t *testing.T) {
+
+	client := newFileServer(t)
+	ctx := context.Background()
+
+	aes, err := goph.AESGCM(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Config.Transforms = []goph.Transform{aes}
+
+	local := filepath.Join(t.TempDir(), "data")
+	if err = os.WriteFile(local, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(t.TempDir(), "state")
+
+	if err = client.UploadResumable(ctx, local, "/data", stateFile); err == nil {
+		t.Error("a resumable upload should refuse the transforms")
+	}
+	if err = client.DownloadResumable(ctx, "/data", local, stateFile); err == nil {
+		t.Error("a resumable download should refuse the transforms")
+	}
+	if exists, err := client.Exists("/data"); err != nil || exists {
+		t.Error("nothing should be sent in plaintext")
+	}
+}
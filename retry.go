@@ -0,0 +1,139 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RetryPolicy retries the connection of NewConn, and the resumable
+// transfers broken by a dropped connection, with exponential backoff.
+// The zero policy tries once.
+type RetryPolicy struct {
+
+	// MaxAttempts bounds the attempts, including the first one. Zero or
+	// one tries once.
+	MaxAttempts int
+
+	// Delay is the wait before the second attempt, doubled after every
+	// attempt up to MaxDelay. Zero waits 500ms, up to 30s without MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+
+	// Jitter spreads every wait randomly by up to this fraction, 0.2 waits
+	// between 80% and 120% of the delay, so clients failing together do
+	// not retry together.
+	Jitter float64
+
+	// Retryable, if set, reports whether an attempt failing with err is
+	// tried again, IsRetryable is used when nil. Auth and host key errors
+	// are not retryable by default.
+	Retryable func(err error) bool
+}
+
+// retryable reports whether an attempt failing with err is tried again.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the wait after the failed attempt, counted from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+
+	delay, maxDelay := p.Delay, p.MaxDelay
+	if delay <= 0 {
+		delay = minReconnectDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = maxReconnectDelay
+	}
+
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+
+	if p.Jitter > 0 {
+		delay += time.Duration(float64(delay) * p.Jitter * (2*rand.Float64() - 1))
+	}
+
+	return max(delay, 0)
+}
+
+// do runs op until it succeeds, fails with an error retryable rejects, or
+// the attempts run out, and returns its last error. The wait between two
+// attempts stops with the context error once ctx is done.
+func (p RetryPolicy) do(ctx context.Context, c *Config, name string, retryable func(error) bool, op func(attempt int) error) error {
+
+	for attempt := 1; ; attempt++ {
+
+		err := op(attempt)
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		c.logger().Warn(name+" failed, retrying", c.logAttrs("error", err, "attempt", attempt, "retry", delay)...)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// retryPolicy returns the retry policy of the config.
+func (c *Config) retryPolicy() RetryPolicy {
+	if c == nil {
+		return RetryPolicy{}
+	}
+	return c.Retry
+}
+
+// dialRetry dials the server like dial, trying again the failed attempts
+// allowed by Config.Retry.
+func (c *Config) dialRetry(ctx context.Context, proto string) (client *ssh.Client, state *clientState, err error) {
+
+	policy := c.retryPolicy()
+
+	err = policy.do(ctx, c, "connect", policy.retryable, func(int) (err error) {
+		client, state, err = c.dial(ctx, proto)
+		return err
+	})
+
+	return client, state, err
+}
+
+// resumeRetry runs the resumable transfer of s, and when the connection
+// drops, re-dials and resumes it from its state, as allowed by
+// Config.Retry.
+func (c *Client) resumeRetry(ctx context.Context, s *TransferState, stateFile string) error {
+
+	policy := c.Config.retryPolicy()
+
+	// the transfer errors of a dropped connection are not always
+	// network errors, like the connection lost of sftp.
+	retryable := func(err error) bool {
+		return c.broken(err) || policy.retryable(err)
+	}
+
+	return policy.do(ctx, c.Config, s.Op, retryable, func(attempt int) error {
+		if attempt > 1 {
+			if err := c.Reconnect(ctx); err != nil {
+				return err
+			}
+		}
+		return c.resume(ctx, s, stateFile)
+	})
+}
@@ -0,0 +1,161 @@
+package goph_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// flakyDialer refuses the first fail dials, and keeps the last connection
+// open to drop it.
+type flakyDialer struct {
+	mu    sync.Mutex
+	fail  int
+	dials int
+	conn  net.Conn
+}
+
+func (d *flakyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dials++
+	if d.dials <= d.fail {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	d.conn = conn
+	return conn, err
+}
+
+// drop closes the last connection.
+func (d *flakyDialer) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conn.Close()
+}
+
+func TestRetry(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	policy := goph.RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond, Jitter: 0.5}
+
+	tests := []struct {
+		name     string
+		password string
+		fail     int
+		dials    int
+		ok       bool
+	}{
+		{"refused then connected", "secret", 2, 3, true},
+		{"attempts run out", "secret", 5, 3, false},
+		{"auth errors are final", "wrong", 0, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dialer := &flakyDialer{fail: tt.fail}
+			config := srv.Config("alice", tt.password)
+			config.Dialer = dialer
+			config.Retry = policy
+
+			client, err := goph.NewConn(config)
+			if err == nil {
+				client.Close()
+			}
+			if (err == nil) != tt.ok || dialer.dials != tt.dials {
+				t.Errorf("expected ok %v after %d dials, got %v after %d", tt.ok, tt.dials, err, dialer.dials)
+			}
+		})
+	}
+
+	// the wait between attempts ends with the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	config := srv.Config("alice", "secret")
+	config.Dialer = &flakyDialer{fail: 5}
+	config.Retry = goph.RetryPolicy{MaxAttempts: 5, Delay: time.Hour}
+
+	if _, err := goph.NewConnContext(ctx, config); !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
+
+func TestRetryResume(t *testing.T) {
+
+	defer func(checkpoint int64) { goph.DefaultCheckpoint = checkpoint }(goph.DefaultCheckpoint)
+	goph.DefaultCheckpoint = 1024
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	dialer := &flakyDialer{}
+	config := srv.Config("alice", "secret")
+	config.Dialer = dialer
+	config.Retry = goph.RetryPolicy{MaxAttempts: 2, Delay: time.Millisecond}
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "backup")
+	os.MkdirAll(src, 0755)
+	contents := map[string]string{
+		"a.txt": strings.Repeat("a", 10000),
+		"b.txt": strings.Repeat("b", 10000),
+	}
+	for name, content := range contents {
+		os.WriteFile(filepath.Join(src, name), []byte(content), 0644)
+	}
+
+	// the connection drops once the first file is copied. The partial
+	// files of sftp servers are covered by TestResume.
+	var once sync.Once
+	client.Config.OnFileComplete = func(goph.FileEvent) { once.Do(dialer.drop) }
+
+	var bar countWriter
+	client.Config.Progress = &bar
+
+	if err = client.UploadResumable(context.Background(), src, "/backup", filepath.Join(dir, "state")); err != nil {
+		t.Fatal(err)
+	}
+
+	if dialer.dials != 2 {
+		t.Errorf("expected the upload resumed on a second connection, got %d dials", dialer.dials)
+	}
+	if bar.n != 20000 {
+		t.Errorf("expected every byte copied once, copied %d", bar.n)
+	}
+
+	for name, content := range contents {
+		if got := readRemote(t, client, "/backup/"+name); got != content {
+			t.Errorf("%s: unexpected content of %d bytes", name, len(got))
+		}
+	}
+}
@@ -0,0 +1,579 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// UploadSCP is like UploadContext, but copies over the scp protocol instead
+// of sftp, for hosts without an sftp subsystem like embedded devices and
+// locked-down appliances. The remote host needs the scp command.
+//
+// scp has no symbolic links: links to files are copied as the file they
+// point to, and links to directories need TransferOptions.FollowSymlinks.
+// Owners are not preserved, and the config Transforms are not supported.
+func (c *Client) UploadSCP(ctx context.Context, srcPath, dstPath string, progress func(TransferProgress)) error {
+	return c.upload(ctx, srcPath, dstPath, progress, true)
+}
+
+// DownloadSCP is like DownloadContext, but copies over the scp protocol
+// instead of sftp, with the limits of UploadSCP. The Total of the progress
+// is zero, the size of the remote files is only known as they are copied.
+func (c Client) DownloadSCP(ctx context.Context, remotePath, localPath string, progress func(TransferProgress)) error {
+	return c.download(ctx, remotePath, localPath, progress, true)
+}
+
+// scpFallback reports whether transfers use scp when sftp is unavailable.
+func (c *Config) scpFallback() bool {
+	return c != nil && c.SCPFallback
+}
+
+// errSCPTransforms is returned by scp transfers of a config with transforms,
+// rather than copying the files as is.
+var errSCPTransforms = errors.New("goph: scp transfers do not support transforms")
+
+// uploadSCP uploads the local file or directory srcPath to dstPath with
+// the scp sink of the remote host.
+func (c *Client) uploadSCP(t *transfer, srcPath, dstPath string, info os.FileInfo) (err error) {
+
+	if c.Config != nil && len(c.Config.Transforms) > 0 {
+		return errSCPTransforms
+	}
+
+	opts := c.Config.transferOptions()
+
+	cmd := "scp"
+	if opts.PreserveTimes {
+		cmd += " -p"
+	}
+	if info.IsDir() {
+		cmd += " -r"
+	}
+
+	// the sink writes into the parent directory, under the names sent.
+	s, err := c.startSCP(t.ctx, cmd+" -t -- "+shellQuote(path.Dir(dstPath)), opts)
+	if err != nil {
+		return err
+	}
+	defer func() { err = s.close(t, err) }()
+
+	if err = s.ack(); err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return s.sendFile(t, srcPath, dstPath)
+	}
+
+	// open are the relative paths of the directories sent and not ended.
+	var open []string
+
+	err = c.walkUpload(srcPath, func(localPath, relPath string, info os.FileInfo) error {
+		if err := t.ctx.Err(); err != nil {
+			return err
+		}
+
+		for len(open) > 0 && open[len(open)-1] != filepath.Dir(relPath) {
+			if err := s.send("E\n"); err != nil {
+				return err
+			}
+			open = open[:len(open)-1]
+		}
+
+		remotePath := path.Join(dstPath, filepath.ToSlash(relPath))
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Stat(localPath)
+			if err == nil && target.IsDir() {
+				err = errors.New("scp does not copy links to directories")
+			}
+			if err != nil {
+				return t.fileError(t.fileStart(localPath, remotePath, 0), err)
+			}
+			info = target
+		}
+
+		if !info.IsDir() {
+			return s.sendFile(t, localPath, remotePath)
+		}
+
+		if err := s.sendTimes(info); err != nil {
+			return err
+		}
+		if err := s.send("D%04o 0 %s\n", s.mode(info), path.Base(remotePath)); err != nil {
+			return err
+		}
+		open = append(open, relPath)
+		return nil
+	})
+
+	for ; err == nil && len(open) > 0; open = open[:len(open)-1] {
+		err = s.send("E\n")
+	}
+
+	return err
+}
+
+// downloadSCP downloads the remote file or directory remotePath to
+// localPath with the scp source of the remote host.
+func (c Client) downloadSCP(t *transfer, remotePath, localPath string) (err error) {
+
+	if c.Config != nil && len(c.Config.Transforms) > 0 {
+		return errSCPTransforms
+	}
+
+	opts := c.Config.transferOptions()
+
+	cmd := "scp -r"
+	if opts.PreserveTimes {
+		cmd += " -p"
+	}
+
+	s, err := c.startSCP(t.ctx, cmd+" -f -- "+shellQuote(remotePath), opts)
+	if err != nil {
+		return err
+	}
+	defer func() { err = s.close(t, err) }()
+
+	return s.receive(t, remotePath, localPath)
+}
+
+// scpConn is a session running the remote scp command, as a sink with -t
+// or as a source with -f.
+type scpConn struct {
+	client Client
+	opts   TransferOptions
+	sess   *ssh.Session
+	w      io.WriteCloser
+	r      *bufio.Reader
+	stderr bytes.Buffer
+	stop   func() bool
+
+	// skipped is set once a file failure reported by scp was skipped by
+	// OnFileError, scp then exits with status 1.
+	skipped bool
+}
+
+// scpError is an error reported by the remote scp, which exits after the
+// fatal ones.
+type scpError struct {
+	msg   string
+	fatal bool
+}
+
+func (e *scpError) Error() string { return e.msg }
+
+// startSCP starts the scp command line cmd.
+func (c Client) startSCP(ctx context.Context, cmd string, opts TransferOptions) (_ *scpConn, err error) {
+
+	sess, err := c.openSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scpConn{client: c, opts: opts, sess: sess}
+
+	defer func() {
+		if err != nil {
+			c.closeSession(sess)
+		}
+	}()
+
+	if s.w, err = sess.StdinPipe(); err != nil {
+		return nil, err
+	}
+
+	out, err := sess.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.r = bufio.NewReader(out)
+	sess.Stderr = &s.stderr
+
+	if err = sess.Start(cmd); err != nil {
+		return nil, err
+	}
+
+	// blocked reads and writes end with the session once ctx is done.
+	s.stop = context.AfterFunc(ctx, func() { sess.Close() })
+
+	return s, nil
+}
+
+// close ends the input of scp and waits for it to exit, err is the result
+// of the copy. On failure the session is closed at once, as scp may be
+// blocked writing, unless scp ended first and its status tells why.
+func (s *scpConn) close(t *transfer, err error) error {
+
+	s.stop()
+	s.w.Close()
+
+	ended := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	if err != nil && !ended {
+		s.sess.Close()
+	}
+
+	werr := s.sess.Wait()
+	s.client.closeSession(s.sess)
+
+	if ctxErr := t.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case ended && werr != nil:
+		return outputError(werr, s.stderr.Bytes())
+	case err != nil:
+		return err
+	case s.skipped && errors.As(werr, &exitErr) && exitErr.ExitStatus() == 1:
+		return nil
+	}
+
+	return outputError(werr, s.stderr.Bytes())
+}
+
+// ack reads the response of scp to the last message.
+func (s *scpConn) ack() error {
+
+	b, err := s.r.ReadByte()
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	switch b {
+	case 0:
+		return nil
+	case 1, 2:
+		msg, _ := s.r.ReadString('\n')
+		return &scpError{msg: strings.TrimSpace(msg), fatal: b == 2}
+	}
+
+	return fmt.Errorf("scp: unexpected response %q", b)
+}
+
+// ok acknowledges the last message of scp.
+func (s *scpConn) ok() error {
+	_, err := s.w.Write([]byte{0})
+	return err
+}
+
+// fail reports err to scp, which skips the current file.
+func (s *scpConn) fail(err error) error {
+	_, werr := fmt.Fprintf(s.w, "\x01scp: %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+	return werr
+}
+
+// send writes a protocol message to scp and reads its response.
+func (s *scpConn) send(format string, args ...any) error {
+	if _, err := fmt.Fprintf(s.w, format, args...); err != nil {
+		return err
+	}
+	return s.ack()
+}
+
+// mode returns the permissions sent for info, the defaults of the
+// destination unless preserved.
+func (s *scpConn) mode(info os.FileInfo) os.FileMode {
+	switch {
+	case s.opts.PreservePermissions:
+		return info.Mode().Perm()
+	case info.IsDir():
+		return 0755
+	}
+	return 0644
+}
+
+// sendTimes sends the modification time of info when preserved, the
+// access time of local files is not portable.
+func (s *scpConn) sendTimes(info os.FileInfo) error {
+	if !s.opts.PreserveTimes {
+		return nil
+	}
+	return s.send("T%d 0 %d 0\n", info.ModTime().Unix(), time.Now().Unix())
+}
+
+// fileError records the failure of the file of e. Only the failures
+// reported by scp that are not fatal may be skipped by OnFileError, the
+// others leave the protocol in an unknown state and end the transfer.
+func (s *scpConn) fileError(t *transfer, e *FileEvent, err error) error {
+
+	var scpErr *scpError
+	if errors.As(err, &scpErr) && !scpErr.fatal {
+		if err = t.fileError(e, err); err == nil {
+			s.skipped = true
+		}
+		return err
+	}
+
+	return &TransferError{Op: t.op, LocalPath: e.LocalPath, RemotePath: e.RemotePath, Offset: e.Bytes, Err: err}
+}
+
+// sendFile sends the local file to the sink, under the name of remotePath.
+func (s *scpConn) sendFile(t *transfer, localPath, remotePath string) error {
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return t.fileError(t.fileStart(localPath, remotePath, 0), fmt.Errorf("failed to open source file: %w", err))
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return t.fileError(t.fileStart(localPath, remotePath, 0), fmt.Errorf("failed to stat source file: %w", err))
+	}
+
+	e := t.fileStart(localPath, remotePath, info.Size())
+
+	if err := s.sendTimes(info); err != nil {
+		return s.fileError(t, e, err)
+	}
+
+	// the sink refusing the file skips it.
+	if err := s.send("C%04o %d %s\n", s.mode(info), info.Size(), path.Base(remotePath)); err != nil {
+		return s.fileError(t, e, err)
+	}
+
+	n, err := io.CopyN(s.w, t.source(e, f), info.Size())
+	e.Bytes = n
+	if err != nil {
+		return s.fileError(t, e, err)
+	}
+
+	if err := s.send("\x00"); err != nil {
+		return s.fileError(t, e, err)
+	}
+
+	t.file(e, n)
+	return nil
+}
+
+// scpDir is a directory being received from the source.
+type scpDir struct {
+	local  string
+	remote string
+	info   os.FileInfo
+}
+
+// receive receives the files sent by the source, the first one is written
+// to localPath.
+func (s *scpConn) receive(t *transfer, remotePath, localPath string) error {
+
+	// dirs are the directories being received, their attributes are set
+	// once they end.
+	var dirs []scpDir
+
+	// mtime is the modification time sent for the next file.
+	var mtime time.Time
+
+	if err := s.ok(); err != nil {
+		return err
+	}
+
+	for {
+		if err := t.ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := s.r.ReadString('\n')
+		if err == io.EOF && line == "" && len(dirs) == 0 {
+			return nil
+		}
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch line[0] {
+
+		case 1, 2:
+			// the source skips the files it cannot read.
+			scpErr := &scpError{msg: strings.TrimSpace(line[1:]), fatal: line[0] == 2}
+			if err := s.fileError(t, t.fileStart(localPath, remotePath, 0), scpErr); err != nil {
+				return err
+			}
+
+		case 'T':
+			var sec, usec int64
+			if _, err := fmt.Sscanf(line, "T%d %d", &sec, &usec); err != nil {
+				return fmt.Errorf("scp: invalid times %q", line)
+			}
+			mtime = time.Unix(sec, 0)
+			if err := s.ok(); err != nil {
+				return err
+			}
+
+		case 'E':
+			if len(dirs) == 0 {
+				return fmt.Errorf("scp: unexpected %q", line)
+			}
+			dir := dirs[len(dirs)-1]
+			dirs = dirs[:len(dirs)-1]
+			if err := s.opts.setLocal(dir.local, dir.info); err != nil {
+				return fmt.Errorf("failed to set local directory attributes: %w", err)
+			}
+			if err := s.ok(); err != nil {
+				return err
+			}
+
+		case 'C', 'D':
+			info, err := parseSCPHeader(line, mtime)
+			if err != nil {
+				return err
+			}
+			mtime = time.Time{}
+
+			local, remote := localPath, remotePath
+			if len(dirs) > 0 {
+				local = filepath.Join(dirs[len(dirs)-1].local, info.name)
+				remote = path.Join(dirs[len(dirs)-1].remote, info.name)
+			}
+
+			if line[0] == 'C' {
+				if err := s.receiveFile(t, info, local, remote); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := os.MkdirAll(local, 0755); err != nil {
+				return fmt.Errorf("failed to create local directory: %w", err)
+			}
+			dirs = append(dirs, scpDir{local, remote, info})
+			if err := s.ok(); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("scp: unexpected %q", line)
+		}
+	}
+}
+
+// receiveFile receives the file of info from the source into localPath.
+func (s *scpConn) receiveFile(t *transfer, info scpFileInfo, localPath, remotePath string) error {
+
+	e := t.fileStart(localPath, remotePath, info.size)
+
+	// refusing the file makes the source skip it.
+	err := os.MkdirAll(filepath.Dir(localPath), 0755)
+	if err != nil {
+		err = fmt.Errorf("failed to create local directories: %w", err)
+	}
+
+	var f *os.File
+	if err == nil {
+		if f, err = os.Create(localPath); err != nil {
+			err = fmt.Errorf("failed to create local file: %w", err)
+		}
+	}
+
+	if err != nil {
+		if ferr := s.fail(err); ferr != nil {
+			return s.fileError(t, e, ferr)
+		}
+		return s.fileError(t, e, &scpError{msg: err.Error()})
+	}
+	defer f.Close()
+
+	if err := s.ok(); err != nil {
+		return s.fileError(t, e, err)
+	}
+
+	n, err := io.Copy(f, t.source(e, io.LimitReader(s.r, info.size)))
+	e.Bytes = n
+	if err == nil && n < info.size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return s.fileError(t, e, err)
+	}
+
+	// the source reports the failure to read the file after its data.
+	if err := s.ack(); err != nil {
+		s.ok()
+		return s.fileError(t, e, err)
+	}
+
+	err = f.Sync()
+	if err == nil {
+		if err = s.opts.setLocal(localPath, info); err != nil {
+			err = fmt.Errorf("failed to set local file attributes: %w", err)
+		}
+	}
+	if err != nil {
+		if ferr := s.fail(err); ferr != nil {
+			return s.fileError(t, e, ferr)
+		}
+		return s.fileError(t, e, &scpError{msg: err.Error()})
+	}
+
+	if err := s.ok(); err != nil {
+		return s.fileError(t, e, err)
+	}
+
+	t.file(e, n)
+	return nil
+}
+
+// scpFileInfo describes a file or directory sent by the source.
+type scpFileInfo struct {
+	name  string
+	mode  os.FileMode
+	size  int64
+	mtime time.Time
+}
+
+func (i scpFileInfo) Name() string       { return i.name }
+func (i scpFileInfo) Size() int64        { return i.size }
+func (i scpFileInfo) Mode() os.FileMode  { return i.mode }
+func (i scpFileInfo) ModTime() time.Time { return i.mtime }
+func (i scpFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i scpFileInfo) Sys() any           { return nil }
+
+// parseSCPHeader parses the "C" file and "D" directory headers of the
+// source, like "C0644 12 name". Names leaving the directory are refused.
+func parseSCPHeader(line string, mtime time.Time) (scpFileInfo, error) {
+
+	fields := strings.SplitN(line[1:], " ", 3)
+	if len(fields) != 3 {
+		return scpFileInfo{}, fmt.Errorf("scp: invalid header %q", line)
+	}
+
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		return scpFileInfo{}, fmt.Errorf("scp: invalid mode in %q", line)
+	}
+
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return scpFileInfo{}, fmt.Errorf("scp: invalid size in %q", line)
+	}
+
+	name := fields[2]
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return scpFileInfo{}, fmt.Errorf("scp: invalid file name %q", name)
+	}
+
+	info := scpFileInfo{name: name, mode: os.FileMode(mode).Perm(), size: size, mtime: mtime}
+	if line[0] == 'D' {
+		info.mode |= os.ModeDir
+	}
+
+	return info, nil
+}
@@ -0,0 +1,167 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"github.com/pkg/sftp"
+)
+
+// newSCPServer returns a client of a server without sftp, serving scp from
+// the returned directory.
+func newSCPServer(t *testing.T) (*goph.Client, string) {
+
+	root := t.TempDir()
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.FS = sftp.Handlers{}
+	srv.SCP = root
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	config := srv.Config("alice", "secret")
+	config.SCPFallback = true
+	config.Transfer.PreservePermissions = true
+	config.Transfer.PreserveTimes = true
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client, root
+}
+
+func TestSCP(t *testing.T) {
+
+	client, root := newSCPServer(t)
+
+	src := t.TempDir()
+	mtime := time.Unix(1600000000, 0)
+	files := map[string]string{
+		"a.txt":              "alpha",
+		"sub/b.txt":          "bravo",
+		"sub/deep/with sp":   "charlie",
+		"sub/deep/empty.txt": "",
+	}
+	for name, data := range files {
+		p := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, mtime, mtime)
+	}
+	os.Chmod(filepath.Join(src, "a.txt"), 0750)
+
+	// Upload falls back to scp without sftp.
+	var progress int64
+	err := client.UploadContext(context.Background(), src, "/dest", func(p goph.TransferProgress) {
+		progress = p.Bytes
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != int64(len("alphabravocharlie")) {
+		t.Errorf("expected the progress of every byte, got %d", progress)
+	}
+
+	for name, data := range files {
+		got, err := os.ReadFile(filepath.Join(root, "dest", name))
+		if err != nil || string(got) != data {
+			t.Errorf("%s: expected %q, got %q, %v", name, data, got, err)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(root, "dest", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 || !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mode 0750 and time %s, got %s and %s", mtime, info.Mode().Perm(), info.ModTime())
+	}
+
+	if err = client.UploadSCP(context.Background(), filepath.Join(src, "a.txt"), "/single.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "single.txt")); string(got) != "alpha" {
+		t.Errorf("expected the single file uploaded, got %q", got)
+	}
+
+	// Download brings the tree back.
+	dst := filepath.Join(t.TempDir(), "back")
+	if err = client.Download("/dest", dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil || string(got) != data {
+			t.Errorf("%s: expected %q downloaded, got %q, %v", name, data, got, err)
+		}
+	}
+
+	info, err = os.Stat(filepath.Join(dst, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 || !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mode 0750 and time %s downloaded, got %s and %s", mtime, info.Mode().Perm(), info.ModTime())
+	}
+
+	single := filepath.Join(t.TempDir(), "single.txt")
+	if err = client.DownloadSCP(context.Background(), "/single.txt", single, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(single); string(got) != "alpha" {
+		t.Errorf("expected the single file downloaded, got %q", got)
+	}
+
+	var transferErr *goph.TransferError
+	if err = client.Download("/missing", filepath.Join(t.TempDir(), "missing")); !errors.As(err, &transferErr) {
+		t.Errorf("expected a transfer error for a missing file, got %v", err)
+	}
+}
+
+func TestSCPUnavailable(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.FS = sftp.Handlers{}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if err = os.WriteFile(local, []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// without fallback, the missing sftp subsystem is reported.
+	if err = client.Upload(local, "/a.txt"); !errors.Is(err, goph.ErrSFTPUnavailable) {
+		t.Errorf("expected ErrSFTPUnavailable, got %v", err)
+	}
+
+	// a host without scp fails with the output of the shell.
+	if err = client.UploadSCP(context.Background(), local, "/a.txt", nil); err == nil {
+		t.Error("expected an error without scp")
+	}
+}
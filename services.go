@@ -0,0 +1,200 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Services manages the systemd units of the remote host with systemctl.
+type Services struct {
+	client Client
+
+	// Sudo runs the commands changing units with "sudo -n", so they fail
+	// instead of prompting when a password is required.
+	Sudo bool
+
+	// User manages the units of the user service manager.
+	User bool
+}
+
+// Services returns the systemd services of the remote host.
+func (c Client) Services() *Services {
+	return &Services{client: c}
+}
+
+// ServiceStatus is the state of a unit, as reported by systemctl show.
+type ServiceStatus struct {
+	Unit        string
+	Description string
+
+	// LoadState is "loaded", "not-found", "masked"...
+	LoadState string
+
+	// ActiveState is "active", "inactive", "failed", "activating"...
+	ActiveState string
+
+	// SubState is the unit type specific state, like "running" or "exited".
+	SubState string
+
+	// UnitFileState is "enabled", "disabled", "static"...
+	UnitFileState string
+
+	// MainPID is the main process of a running service, 0 otherwise.
+	MainPID int
+
+	// ExitStatus is the exit status of the last main process.
+	ExitStatus int
+}
+
+// Active reports whether the unit is active.
+func (s ServiceStatus) Active() bool {
+	return s.ActiveState == "active"
+}
+
+// Enabled reports whether the unit starts at boot.
+func (s ServiceStatus) Enabled() bool {
+	return s.UnitFileState == "enabled"
+}
+
+// Exists reports whether systemd knows the unit.
+func (s ServiceStatus) Exists() bool {
+	return s.LoadState != "" && s.LoadState != "not-found"
+}
+
+// statusProperties are the unit properties read by Status.
+var statusProperties = "Id,Description,LoadState,ActiveState,SubState,UnitFileState,MainPID,ExecMainStatus"
+
+// systemctl returns the systemctl command line with args, prefixed with
+// sudo when privileged.
+func (s *Services) systemctl(privileged bool, args ...string) string {
+
+	cmd := "systemctl"
+	if s.User {
+		cmd += " --user"
+	}
+	if privileged && s.Sudo && !s.User {
+		cmd = "sudo -n " + cmd
+	}
+
+	for _, a := range args {
+		cmd += " " + shellQuote(a)
+	}
+
+	return cmd
+}
+
+// Status returns the state of unit.
+func (s *Services) Status(ctx context.Context, unit string) (ServiceStatus, error) {
+
+	out, err := s.client.RunContext(ctx, s.systemctl(false, "show", unit, "--no-pager", "--property="+statusProperties))
+	if err != nil {
+		return ServiceStatus{}, outputError(err, out)
+	}
+
+	return parseServiceStatus(string(out)), nil
+}
+
+// parseServiceStatus parses the KEY=VALUE lines of systemctl show.
+func parseServiceStatus(out string) ServiceStatus {
+
+	var status ServiceStatus
+
+	for _, line := range strings.Split(out, "\n") {
+
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Id":
+			status.Unit = value
+		case "Description":
+			status.Description = value
+		case "LoadState":
+			status.LoadState = value
+		case "ActiveState":
+			status.ActiveState = value
+		case "SubState":
+			status.SubState = value
+		case "UnitFileState":
+			status.UnitFileState = value
+		case "MainPID":
+			status.MainPID, _ = strconv.Atoi(value)
+		case "ExecMainStatus":
+			status.ExitStatus, _ = strconv.Atoi(value)
+		}
+	}
+
+	return status
+}
+
+// IsActive reports whether unit is active, with systemctl is-active.
+func (s *Services) IsActive(ctx context.Context, unit string) (bool, error) {
+
+	_, err := s.client.RunContext(ctx, s.systemctl(false, "is-active", "--quiet", unit))
+
+	// is-active exits with a non zero status for units not active.
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Start starts unit.
+func (s *Services) Start(ctx context.Context, unit string) error {
+	return s.run(ctx, "start", unit)
+}
+
+// Stop stops unit.
+func (s *Services) Stop(ctx context.Context, unit string) error {
+	return s.run(ctx, "stop", unit)
+}
+
+// Restart restarts unit, starting it if it is not running.
+func (s *Services) Restart(ctx context.Context, unit string) error {
+	return s.run(ctx, "restart", unit)
+}
+
+// Reload reloads the configuration of unit.
+func (s *Services) Reload(ctx context.Context, unit string) error {
+	return s.run(ctx, "reload", unit)
+}
+
+// Enable enables unit to start at boot.
+func (s *Services) Enable(ctx context.Context, unit string) error {
+	return s.run(ctx, "enable", unit)
+}
+
+// Disable disables unit from starting at boot.
+func (s *Services) Disable(ctx context.Context, unit string) error {
+	return s.run(ctx, "disable", unit)
+}
+
+// DaemonReload reloads the unit files, after installing or changing units.
+func (s *Services) DaemonReload(ctx context.Context) error {
+	out, err := s.client.RunContext(ctx, s.systemctl(true, "daemon-reload"))
+	return outputError(err, out)
+}
+
+// run runs the privileged systemctl command on unit.
+func (s *Services) run(ctx context.Context, command, unit string) error {
+
+	out, err := s.client.RunContext(ctx, s.systemctl(true, command, unit))
+	if err != nil {
+		return outputError(err, out)
+	}
+
+	s.client.Config.logger().Info("service "+command, s.client.Config.logAttrs("unit", unit)...)
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestServices(t *testing.T) {
+
+	var (
+		mu       sync.Mutex
+		commands []string
+	)
+
+	srv := gophtest.NewServer()
+	srv.AddUser("deploy", "secret")
+	srv.NotFound = func(e *gophtest.Exec) int {
+		mu.Lock()
+		commands = append(commands, e.Command)
+		mu.Unlock()
+
+		switch e.Command {
+		case "systemctl show nginx.service --no-pager --property=Id,Description,LoadState,ActiveState,SubState,UnitFileState,MainPID,ExecMainStatus":
+			fmt.Fprint(e.Stdout, "Id=nginx.service\nDescription=A high performance web server\nLoadState=loaded\n"+
+				"ActiveState=active\nSubState=running\nUnitFileState=enabled\nMainPID=812\nExecMainStatus=0\n")
+			return 0
+		case "systemctl is-active --quiet nginx.service":
+			return 0
+		case "systemctl is-active --quiet redis.service":
+			return 3
+		case "sudo -n systemctl restart nginx.service":
+			return 0
+		}
+		fmt.Fprintln(e.Stderr, "Failed to start 'bad unit': Unit not found.")
+		return 5
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("deploy", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	services := client.Services()
+	services.Sudo = true
+
+	status, err := services.Status(ctx, "nginx.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Active() || !status.Enabled() || status.SubState != "running" || status.MainPID != 812 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	if active, err := services.IsActive(ctx, "nginx.service"); err != nil || !active {
+		t.Errorf("nginx should be active: %v", err)
+	}
+
+	if active, err := services.IsActive(ctx, "redis.service"); err != nil || active {
+		t.Errorf("redis should not be active: %v", err)
+	}
+
+	if err = services.Restart(ctx, "nginx.service"); err != nil {
+		t.Error(err)
+	}
+
+	if err = services.Start(ctx, "bad unit"); err == nil {
+		t.Error("starting a missing unit should fail")
+	}
+
+	if last := commands[len(commands)-1]; last != "sudo -n systemctl start 'bad unit'" {
+		t.Errorf("the unit should be quoted: %s", last)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// DefaultSFTPCacheTTL is how long SFTPCache keeps results when its TTL is
+// zero.
+var DefaultSFTPCacheTTL = 5 * time.Second
+
+// SFTPCache caches the Stat, Lstat and ReadDir results of an sftp client for
+// a short time, so operations looking at the same paths again, like sync,
+// diff or dry runs, do not pay a round trip each time on high latency
+// links. Missing paths are cached too. Changes made through other clients
+// are seen once the results expire, and changes made through the cached
+// client should be followed by Invalidate.
+type SFTPCache struct {
+	*sftp.Client
+
+	// TTL is how long results are kept, DefaultSFTPCacheTTL if zero.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	stat    map[string]cachedStat
+	lstat   map[string]cachedStat
+	readdir map[string]cachedDir
+}
+
+type cachedStat struct {
+	info    os.FileInfo
+	err     error
+	expires time.Time
+}
+
+type cachedDir struct {
+	entries []os.FileInfo
+	expires time.Time
+}
+
+// NewSFTPCache returns a cache of the results of ftp kept for ttl.
+func NewSFTPCache(ftp *sftp.Client, ttl time.Duration) *SFTPCache {
+	return &SFTPCache{Client: ftp, TTL: ttl}
+}
+
+// ttl returns the time results are kept.
+func (s *SFTPCache) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return DefaultSFTPCacheTTL
+	}
+	return s.TTL
+}
+
+// Stat returns the info of p, following symlinks.
+func (s *SFTPCache) Stat(p string) (os.FileInfo, error) {
+	return s.cachedStat(&s.stat, p, s.Client.Stat)
+}
+
+// Lstat returns the info of p, not following symlinks.
+func (s *SFTPCache) Lstat(p string) (os.FileInfo, error) {
+	return s.cachedStat(&s.lstat, p, s.Client.Lstat)
+}
+
+// cachedStat returns the cached result of stat for p, or calls stat.
+func (s *SFTPCache) cachedStat(cache *map[string]cachedStat, p string, stat func(string) (os.FileInfo, error)) (os.FileInfo, error) {
+
+	p = path.Clean(p)
+
+	s.mu.Lock()
+	e, ok := (*cache)[p]
+	s.mu.Unlock()
+
+	if ok && time.Now().Before(e.expires) {
+		return e.info, e.err
+	}
+
+	info, err := stat(p)
+
+	// only missing paths are worth caching among errors.
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		s.mu.Lock()
+		if *cache == nil {
+			*cache = make(map[string]cachedStat)
+		}
+		(*cache)[p] = cachedStat{info: info, err: err, expires: time.Now().Add(s.ttl())}
+		s.mu.Unlock()
+	}
+
+	return info, err
+}
+
+// ReadDir returns the entries of the directory p. The entries also answer
+// the Lstat calls of the paths in p.
+func (s *SFTPCache) ReadDir(p string) ([]os.FileInfo, error) {
+
+	p = path.Clean(p)
+	now := time.Now()
+
+	s.mu.Lock()
+	e, ok := s.readdir[p]
+	s.mu.Unlock()
+
+	if ok && now.Before(e.expires) {
+		return e.entries, nil
+	}
+
+	entries, err := s.Client.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(s.ttl())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readdir == nil {
+		s.readdir = make(map[string]cachedDir)
+	}
+	s.readdir[p] = cachedDir{entries: entries, expires: expires}
+
+	if s.lstat == nil {
+		s.lstat = make(map[string]cachedStat)
+	}
+	for _, info := range entries {
+		s.lstat[path.Join(p, info.Name())] = cachedStat{info: info, expires: expires}
+	}
+
+	return entries, nil
+}
+
+// Invalidate drops the results of p and of the listing of its directory,
+// after p was changed. The results of the paths under a changed directory
+// p are kept.
+func (s *SFTPCache) Invalidate(p string) {
+
+	p = path.Clean(p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.stat, p)
+	delete(s.lstat, p)
+	delete(s.readdir, p)
+	delete(s.readdir, path.Dir(p))
+}
+
+// Purge drops all the cached results.
+func (s *SFTPCache) Purge() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stat, s.lstat, s.readdir = nil, nil, nil
+}
@@ -0,0 +1,73 @@
+package goph_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+)
+
+func TestSFTPCache(t *testing.T) {
+
+	client := newFileServer(t)
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	if err = ftp.Mkdir("/etc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.EnsureFile("/etc/app.conf", []byte("a=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := goph.NewSFTPCache(ftp, time.Hour)
+
+	if _, err = cache.Stat("/etc/app.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cache.Stat("/etc/missing.conf"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	entries, err := cache.ReadDir("/etc")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("unexpected entries %v, %v", entries, err)
+	}
+
+	// changes are not seen until the results are invalidated.
+	if err = ftp.Remove("/etc/app.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cache.Stat("/etc/app.conf"); err != nil {
+		t.Errorf("the cached result should be returned, got %v", err)
+	}
+	if _, err = cache.Lstat("/etc/app.conf"); err != nil {
+		t.Errorf("the directory listing should answer Lstat, got %v", err)
+	}
+
+	cache.Invalidate("/etc/app.conf")
+	if _, err = cache.Stat("/etc/app.conf"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing file after Invalidate, got %v", err)
+	}
+	if entries, _ = cache.ReadDir("/etc"); len(entries) != 0 {
+		t.Errorf("the listing should be invalidated, got %d entries", len(entries))
+	}
+
+	cache.TTL = time.Millisecond
+	cache.Purge()
+	if _, err = cache.Stat("/etc/missing.conf"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	if _, err = client.EnsureFile("/etc/missing.conf", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err = cache.Stat("/etc/missing.conf"); err != nil {
+		t.Errorf("expired results should be refreshed, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/sftp"
+)
+
+// SFTP extensions used by goph.
+const (
+	ExtPosixRename = "posix-rename@openssh.com"
+	ExtStatVFS     = "statvfs@openssh.com"
+	ExtFsync       = "fsync@openssh.com"
+	ExtHardlink    = "hardlink@openssh.com"
+)
+
+// SFTPVersion is the sftp protocol version negotiated with servers.
+const SFTPVersion = 3
+
+// knownExtensions are probed by SFTPInfo.
+var knownExtensions = []string{ExtPosixRename, ExtStatVFS, ExtFsync, ExtHardlink}
+
+// SFTPInfo describes the sftp server of a connection.
+type SFTPInfo struct {
+
+	// Version is the negotiated protocol version.
+	Version int
+
+	// Extensions maps the known extensions supported by the server to
+	// their version data.
+	Extensions map[string]string
+}
+
+// Supports reports whether the server supports the extension ext.
+func (i SFTPInfo) Supports(ext string) bool {
+	_, ok := i.Extensions[ext]
+	return ok
+}
+
+// Names returns the supported extensions, sorted.
+func (i SFTPInfo) Names() []string {
+
+	names := make([]string, 0, len(i.Extensions))
+	for name := range i.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SFTPExtensionError is returned when an operation needs an sftp extension
+// the server does not support. It matches errors.ErrUnsupported.
+type SFTPExtensionError struct {
+	Op        string
+	Extension string
+}
+
+func (e *SFTPExtensionError) Error() string {
+	return fmt.Sprintf("sftp server does not support %s, required by %s", e.Extension, e.Op)
+}
+
+func (e *SFTPExtensionError) Unwrap() error {
+	return errors.ErrUnsupported
+}
+
+// SFTPInfo returns the sftp protocol version and extensions of the server.
+func (c Client) SFTPInfo() (SFTPInfo, error) {
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return SFTPInfo{}, err
+	}
+	defer ftp.Close()
+
+	return sftpInfo(ftp), nil
+}
+
+// sftpInfo returns the known extensions supported by ftp.
+func sftpInfo(ftp *sftp.Client) SFTPInfo {
+
+	info := SFTPInfo{Version: SFTPVersion, Extensions: make(map[string]string)}
+	for _, ext := range knownExtensions {
+		if data, ok := ftp.HasExtension(ext); ok {
+			info.Extensions[ext] = data
+		}
+	}
+
+	return info
+}
+
+// requireExtension returns an *SFTPExtensionError when ftp does not
+// support ext.
+func requireExtension(ftp *sftp.Client, op, ext string) error {
+	if _, ok := ftp.HasExtension(ext); !ok {
+		return &SFTPExtensionError{Op: op, Extension: ext}
+	}
+	return nil
+}
+
+// PosixRename renames oldpath to newpath, replacing newpath if it exists.
+// It requires the posix-rename@openssh.com extension.
+func (c Client) PosixRename(oldpath, newpath string) (err error) {
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "sftp", RemotePath: newpath, Err: err})
+	}()
+
+	if err = requireExtension(ftp, "rename", ExtPosixRename); err != nil {
+		return err
+	}
+
+	return ftp.PosixRename(oldpath, newpath)
+}
+
+// Hardlink creates newpath as a hard link to oldpath.
+// It requires the hardlink@openssh.com extension.
+func (c Client) Hardlink(oldpath, newpath string) (err error) {
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "sftp", RemotePath: newpath, Err: err})
+	}()
+
+	if err = requireExtension(ftp, "hardlink", ExtHardlink); err != nil {
+		return err
+	}
+
+	return ftp.Link(oldpath, newpath)
+}
+
+// StatVFS returns the file system statistics of the remote path.
+// It requires the statvfs@openssh.com extension.
+func (c Client) StatVFS(path string) (_ *sftp.StatVFS, err error) {
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return nil, err
+	}
+	defer ftp.Close()
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "sftp", RemotePath: path, Err: err})
+	}()
+
+	if err = requireExtension(ftp, "statvfs", ExtStatVFS); err != nil {
+		return nil, err
+	}
+
+	return ftp.StatVFS(path)
+}
@@ -0,0 +1,64 @@
+package goph_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestSFTPExtensions(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	info, err := client.SFTPInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Version != goph.SFTPVersion || !info.Supports(goph.ExtPosixRename) || info.Supports(goph.ExtFsync) {
+		t.Errorf("unexpected sftp info: %+v", info)
+	}
+
+	// uploads skip the fsync the server does not support.
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if err = os.WriteFile(local, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Upload(local, "/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = client.PosixRename("/a.txt", "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ftp.Close()
+
+	if _, err = ftp.Stat("/b.txt"); err != nil {
+		t.Errorf("the file was not renamed: %s", err)
+	}
+
+	var extErr error = &goph.SFTPExtensionError{Op: "sync", Extension: goph.ExtFsync}
+	if !errors.Is(extErr, errors.ErrUnsupported) || goph.Category(extErr) != goph.CategoryProtocol {
+		t.Errorf("unexpected extension error classification: %s", extErr)
+	}
+}
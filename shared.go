@@ -0,0 +1,156 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Registry deduplicates connections by user, host, port and auth, see
+// Config.AuthKey, so parts of a program connecting to the same host share
+// one connection.
+// Shared clients are reference counted: Close only closes the connection
+// once every Connect returning it was matched by a Close.
+type Registry struct {
+	mu      sync.Mutex
+	clients map[string]*sharedClient
+}
+
+// sharedClient is a registry entry.
+type sharedClient struct {
+	client *Client
+	refs   int
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{clients: make(map[string]*sharedClient)}
+}
+
+var shared = NewRegistry()
+
+// Shared returns the process-wide registry.
+func Shared() *Registry {
+	return shared
+}
+
+// Connect returns the live client of the registry for config, or connects
+// a new one.
+func (r *Registry) Connect(config *Config) (*Client, error) {
+	return r.ConnectContext(context.Background(), config)
+}
+
+// ConnectContext is like Connect, the context bounds the dial and handshake
+// of a new connection.
+func (r *Registry) ConnectContext(ctx context.Context, config *Config) (*Client, error) {
+
+	key := config.sharedKey()
+
+	if c := r.acquire(key); c != nil {
+		return c, nil
+	}
+
+	c, err := NewConnContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// another caller may have connected meanwhile.
+	if e := r.clients[key]; e != nil && e.client.alive() {
+		c.closeConn()
+		e.refs++
+		return e.client, nil
+	}
+
+	e := &sharedClient{client: c, refs: 1}
+	c.state.release = func() bool { return r.release(key, e) }
+	r.clients[key] = e
+
+	return c, nil
+}
+
+// Len returns the number of connections in the registry.
+func (r *Registry) Len() int {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.clients)
+}
+
+// acquire returns the live client of key with a new reference, or nil.
+func (r *Registry) acquire(key string) *Client {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.clients[key]
+	if e == nil {
+		return nil
+	}
+
+	if !e.client.alive() {
+		delete(r.clients, key)
+		return nil
+	}
+
+	e.refs++
+	return e.client
+}
+
+// release drops a reference to e and reports whether it was the last one.
+func (r *Registry) release(key string, e *sharedClient) bool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e.refs--; e.refs > 0 {
+		return false
+	}
+
+	if r.clients[key] == e {
+		delete(r.clients, key)
+	}
+
+	return true
+}
+
+// alive reports whether the connection of c is still open.
+func (c *Client) alive() bool {
+
+	state := c.live().state
+	if state == nil || state.closed.Load() {
+		return false
+	}
+
+	select {
+	case <-state.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// sharedKey returns the registry key of the config.
+func (c *Config) sharedKey() string {
+
+	id := "key:" + c.AuthKey
+	if c.AuthKey == "" {
+		id = authIdentity(c.Auth)
+	}
+
+	return c.User + "@" + c.hostPort() + "/" + id
+}
+
+// authIdentity identifies auth by its backing array, calling the methods
+// could prompt the user or sign with an agent.
+func authIdentity(auth Auth) string {
+	return fmt.Sprintf("auth:%x/%d", reflect.ValueOf(auth).Pointer(), len(auth))
+}
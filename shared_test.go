@@ -0,0 +1,122 @@
+package goph_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRegistry(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.AddUser("bob", "hunter2")
+	srv.HandleFunc("true", func(e *gophtest.Exec) int { return 0 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	r := goph.NewRegistry()
+
+	config := srv.Config("alice", "secret")
+
+	a, err := r.Connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := r.Connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a != b || r.Len() != 1 {
+		t.Fatalf("the connection should be shared, got %d connections", r.Len())
+	}
+
+	other, err := r.Connect(srv.Config("bob", "hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if other == a || r.Len() != 2 {
+		t.Errorf("another identity should get its own connection")
+	}
+
+	a.Close()
+
+	if _, err = b.Run("true"); err != nil {
+		t.Fatalf("the shared connection was closed with references left: %s", err)
+	}
+
+	b.Close()
+
+	if _, err = b.Run("true"); err == nil || r.Len() != 1 {
+		t.Error("the last close should close the connection")
+	}
+
+	c, err := r.Connect(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c == a {
+		t.Error("a closed connection should not be reused")
+	}
+}
+
+func TestRegistryAuthKey(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var prompts atomic.Int32
+	config := func(key string) *goph.Config {
+		config := srv.Config("alice", "")
+		config.Auth = goph.Auth{ssh.PasswordCallback(func() (string, error) {
+			prompts.Add(1)
+			return "secret", nil
+		})}
+		config.AuthKey = key
+		return config
+	}
+
+	r := goph.NewRegistry()
+
+	a, err := r.Connect(config("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	b, err := r.Connect(config("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if a != b || prompts.Load() != 1 {
+		t.Errorf("configs of the same AuthKey should share a connection without prompting, got %d prompts", prompts.Load())
+	}
+
+	// without a key, other Auth values get their own connection.
+	c, err := r.Connect(config(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c == a || r.Len() != 2 {
+		t.Error("other credentials should get their own connection")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultTerm is the terminal type of shells without ShellOptions.Term.
+var DefaultTerm = "xterm-256color"
+
+// ShellOptions configure the pseudo terminal and streams of Shell.
+type ShellOptions struct {
+
+	// Term is the terminal type, DefaultTerm if empty.
+	Term string
+
+	// Rows and Cols are the initial terminal size, 24 by 80 if zero.
+	Rows, Cols int
+
+	// Modes are the terminal modes, echo on if nil.
+	Modes ssh.TerminalModes
+
+	// Stdin, Stdout and Stderr are wired to the remote shell. The terminal
+	// merges the remote stderr into Stdout.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Resize, if set, receives the window size changes of the local
+	// terminal, like on SIGWINCH, to forward them to the remote shell.
+	Resize <-chan WindowSize
+}
+
+// WindowSize is the size of a terminal in characters.
+type WindowSize struct {
+	Rows, Cols int
+}
+
+// Shell runs an interactive login shell in a pseudo terminal, and returns
+// when the shell exits, with an *ssh.ExitError for a non zero status. Put
+// the local terminal in raw mode first, see golang.org/x/term. When ctx is
+// done, the session is closed and the context error returned.
+func (c Client) Shell(ctx context.Context, opts ShellOptions) (err error) {
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "shell", Err: err})
+	}()
+
+	sess, err := c.openSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.closeSession(sess)
+
+	sess.Stdin, sess.Stdout, sess.Stderr = opts.Stdin, opts.Stdout, opts.Stderr
+
+	term := opts.Term
+	if term == "" {
+		term = DefaultTerm
+	}
+
+	rows, cols := opts.Rows, opts.Cols
+	if rows <= 0 || cols <= 0 {
+		rows, cols = 24, 80
+	}
+
+	modes := opts.Modes
+	if modes == nil {
+		modes = ssh.TerminalModes{ssh.ECHO: 1}
+	}
+
+	if err = sess.RequestPty(term, rows, cols, modes); err != nil {
+		return err
+	}
+
+	if err = sess.Shell(); err != nil {
+		return err
+	}
+
+	c.Config.logger().Info("shell started", c.Config.logAttrs("term", term)...)
+
+	done := make(chan error, 1)
+	go func() { done <- sess.Wait() }()
+
+	resize := opts.Resize
+	for {
+		select {
+
+		case err = <-done:
+			return err
+
+		case size, ok := <-resize:
+			if !ok {
+				resize = nil
+				continue
+			}
+			if err := sess.WindowChange(size.Rows, size.Cols); err != nil {
+				c.Config.logger().Debug("window change failed", c.Config.logAttrs("error", err)...)
+			}
+
+		case <-ctx.Done():
+			sess.Close()
+			<-done
+			return ctx.Err()
+		}
+	}
+}
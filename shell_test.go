@@ -0,0 +1,85 @@
+package goph_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestShell(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.Shell = func(e *gophtest.Exec) int {
+		if e.Pty == nil {
+			return 1
+		}
+		fmt.Fprintf(e.Stdout, "%s %dx%d\n", e.Pty.Term, e.Pty.Cols, e.Pty.Rows)
+
+		lines := bufio.NewScanner(e.Stdin)
+		for lines.Scan() {
+			switch line := lines.Text(); line {
+			case "size":
+				w := <-e.Resize
+				fmt.Fprintf(e.Stdout, "%dx%d\n", w.Cols, w.Rows)
+			case "exit 3":
+				return 3
+			default:
+				fmt.Fprintln(e.Stdout, line)
+			}
+		}
+		return 0
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var (
+		out    strings.Builder
+		resize = make(chan goph.WindowSize, 1)
+	)
+	resize <- goph.WindowSize{Rows: 50, Cols: 132}
+
+	err = client.Shell(context.Background(), goph.ShellOptions{
+		Term:   "vt220",
+		Rows:   40,
+		Cols:   100,
+		Stdin:  strings.NewReader("hello\nsize\nexit 3\n"),
+		Stdout: &out,
+		Resize: resize,
+	})
+
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+		t.Errorf("expected exit status 3, got %v", err)
+	}
+	if want := "vt220 100x40\nhello\n132x50\n"; out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+
+	// a shell waiting for input is closed with the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	stdin, _ := io.Pipe()
+	err = client.Shell(ctx, goph.ShellOptions{Stdin: stdin, Stdout: io.Discard})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context deadline, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrShuttingDown is returned when a session or transfer is started on a
+// client being shut down.
+var ErrShuttingDown = errors.New("goph: client shutting down")
+
+// drain tracks the sessions and transfers in flight on a connection.
+type drain struct {
+	mu       sync.Mutex
+	active   map[any]struct{}
+	draining bool
+	idle     chan struct{}
+}
+
+// begin tracks the operation op, unless the client is draining.
+func (d *drain) begin(op any) error {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return ErrShuttingDown
+	}
+
+	if d.active == nil {
+		d.active = make(map[any]struct{})
+	}
+	d.active[op] = struct{}{}
+
+	return nil
+}
+
+// end stops tracking op, it may be called more than once.
+func (d *drain) end(op any) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.active, op)
+
+	if len(d.active) == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// accepting returns ErrShuttingDown once the client is draining.
+func (d *drain) accepting() error {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return ErrShuttingDown
+	}
+
+	return nil
+}
+
+// start starts draining, the returned channel is closed once no operation
+// is in flight.
+func (d *drain) start() <-chan struct{} {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.draining = true
+
+	if len(d.active) == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+
+	return d.idle
+}
+
+// openSession opens a session tracked until closeSession, or until the
+// command using it completes, once allowed by the session limits.
+func (c Client) openSession(ctx context.Context) (*ssh.Session, error) {
+
+	c = c.live()
+
+	if c.state == nil {
+		return c.NewSession()
+	}
+
+	if err := c.state.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	sess, err := c.NewSession()
+	if err != nil {
+		c.state.limiter.put()
+		return nil, err
+	}
+
+	if err = c.state.drain.begin(sess); err != nil {
+		sess.Close()
+		c.state.limiter.put()
+		return nil, err
+	}
+
+	c.state.limiter.hold(sess)
+
+	return sess, nil
+}
+
+// beginOp tracks an operation other than a session, like a transfer.
+func (c Client) beginOp(op any) error {
+	c = c.live()
+	if c.state == nil {
+		return nil
+	}
+	return c.state.drain.begin(op)
+}
+
+// endOp stops tracking op.
+func (c Client) endOp(op any) {
+	c = c.live()
+	if c.state != nil {
+		c.state.drain.end(op)
+		c.state.limiter.release(op)
+	}
+}
+
+// Shutdown stops new sessions and transfers, waits for the commands,
+// transfers, subsystems and shells in flight to finish, then closes the
+// connection. When ctx is done first, the connection is closed anyway and
+// the context error returned. Sessions opened with NewSession and sftp
+// clients of NewSftp are not waited for.
+func (c Client) Shutdown(ctx context.Context) error {
+
+	c = c.live()
+
+	if c.state == nil {
+		return c.Client.Close()
+	}
+
+	idle := c.state.drain.start()
+
+	c.Config.logger().Info("shutting down", c.Config.logAttrs()...)
+
+	var err error
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		err = ctx.Err()
+		c.Config.logger().Warn("shutdown interrupted in-flight operations", c.Config.logAttrs("error", err)...)
+	}
+
+	if cerr := c.closeConn(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,112 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestShutdown(t *testing.T) {
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("deploy", func(e *gophtest.Exec) int {
+		close(started)
+		<-release
+		fmt.Fprint(e.Stdout, "done")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		out []byte
+		err error
+	}
+	ran := make(chan result, 1)
+	go func() {
+		out, err := client.Run("deploy")
+		ran <- result{out, err}
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- client.Shutdown(context.Background()) }()
+
+	// wait for the shutdown to start draining.
+	for {
+		if _, err = client.Run("deploy"); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !errors.Is(err, goph.ErrShuttingDown) {
+		t.Errorf("expected ErrShuttingDown, got %v", err)
+	}
+
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown should wait for the command in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	if r := <-ran; r.err != nil || string(r.out) != "done" {
+		t.Errorf("the command in flight should complete: %q, %v", r.out, r.err)
+	}
+
+	if err = <-shutdown; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("hang", func(e *gophtest.Exec) int {
+		time.Sleep(time.Second)
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := client.Command("hang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err = client.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline error, got %v", err)
+	}
+}
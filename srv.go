@@ -0,0 +1,130 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strings"
+)
+
+// SRVResolver looks up SRV records, it is implemented by *net.Resolver.
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// SRVTarget is an ssh host discovered from an SRV record.
+type SRVTarget struct {
+	Addr     string
+	Port     uint
+	Priority uint16
+	Weight   uint16
+}
+
+// LookupSRV returns the ssh targets of name from its _ssh._tcp SRV records,
+// ordered by priority and randomized by weight within a priority as in
+// RFC 2782. A nil resolver uses net.DefaultResolver.
+func LookupSRV(ctx context.Context, r SRVResolver, name string) ([]SRVTarget, error) {
+
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	_, records, err := r.LookupSRV(ctx, "ssh", "tcp", name)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single "." target means the service is not available.
+	if len(records) == 1 && records[0].Target == "." {
+		return nil, &net.DNSError{Err: "ssh service not available", Name: name, IsNotFound: true}
+	}
+
+	targets := make([]SRVTarget, 0, len(records))
+	for _, rec := range orderSRV(records) {
+		targets = append(targets, SRVTarget{
+			Addr:     strings.TrimSuffix(rec.Target, "."),
+			Port:     uint(rec.Port),
+			Priority: rec.Priority,
+			Weight:   rec.Weight,
+		})
+	}
+
+	return targets, nil
+}
+
+// orderSRV sorts records by priority, and shuffles each priority by weight.
+func orderSRV(records []*net.SRV) []*net.SRV {
+
+	records = append([]*net.SRV(nil), records...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Priority < records[j].Priority
+	})
+
+	for i := 0; i < len(records); {
+
+		j := i
+		total := 0
+		for ; j < len(records) && records[j].Priority == records[i].Priority; j++ {
+			total += int(records[j].Weight)
+		}
+
+		// pick each position of the priority with a chance proportional
+		// to the weight of the records left.
+		for k := i; k < j-1; k++ {
+			pick := k
+			if total > 0 {
+				n := rand.IntN(total + 1)
+				for sum := 0; pick < j; pick++ {
+					if sum += int(records[pick].Weight); sum >= n {
+						break
+					}
+				}
+			}
+			total -= int(records[pick].Weight)
+			records[k], records[pick] = records[pick], records[k]
+		}
+
+		i = j
+	}
+
+	return records
+}
+
+// NewConnSRV connects to the ssh targets of name discovered with LookupSRV,
+// trying each in order until one connects. The Addr and Port of config are
+// replaced by those of each target. Authentication failures are not
+// retried on the other targets.
+func NewConnSRV(ctx context.Context, r SRVResolver, config *Config, name string) (*Client, error) {
+
+	targets, err := LookupSRV(ctx, r, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+
+	for _, target := range targets {
+
+		c := *config
+		c.Addr, c.Port = target.Addr, target.Port
+
+		client, err := NewConnContext(ctx, &c)
+		if err == nil {
+			return client, nil
+		}
+
+		config.logger().Warn("srv target failed", c.logAttrs("error", err)...)
+
+		errs = append(errs, err)
+		if Category(err) == CategoryAuth || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package goph_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// fakeResolver returns fixed SRV records.
+type fakeResolver []*net.SRV
+
+func (r fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return "_" + service + "._" + proto + "." + name, r, nil
+}
+
+func TestNewConnSRV(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	host, port, _ := net.SplitHostPort(srv.Addr())
+	p, _ := strconv.Atoi(port)
+
+	// a closed port to fail over from.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := l.Addr().(*net.TCPAddr)
+	l.Close()
+
+	r := fakeResolver{
+		{Target: host + ".", Port: uint16(p), Priority: 20, Weight: 10},
+		{Target: "127.0.0.1.", Port: uint16(dead.Port), Priority: 10, Weight: 0},
+	}
+
+	targets, err := goph.LookupSRV(context.Background(), r, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(targets) != 2 || targets[0].Priority != 10 || targets[1].Addr != host {
+		t.Fatalf("unexpected targets: %+v", targets)
+	}
+
+	client, err := goph.NewConnSRV(context.Background(), r, srv.Config("alice", "secret"), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if client.Config.Port != uint(p) {
+		t.Errorf("expected the live target, got port %d", client.Config.Port)
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	osuser "os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxJumps bounds the ProxyJump chains, which may loop through aliases.
+const maxJumps = 8
+
+// SSHConfig is a parsed OpenSSH client config, like ~/.ssh/config. Host
+// blocks are honored, Match blocks are skipped and Include is not
+// supported.
+type SSHConfig struct {
+	blocks []sshConfigBlock
+}
+
+type sshConfigBlock struct {
+	patterns []string
+	settings map[string][]string
+}
+
+// NewFromSSHConfig returns the config of the host alias in ~/.ssh/config,
+// to connect like "ssh alias", see SSHConfig.Config.
+func NewFromSSHConfig(alias string) (*Config, error) {
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := LoadSSHConfig(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Config(alias)
+}
+
+// LoadSSHConfig parses the ssh_config file, a missing file is an empty
+// config.
+func LoadSSHConfig(file string) (*SSHConfig, error) {
+
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &SSHConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseSSHConfig(f)
+}
+
+// ParseSSHConfig parses the ssh_config lines of r.
+func ParseSSHConfig(r io.Reader) (*SSHConfig, error) {
+
+	c := &SSHConfig{}
+
+	// settings before the first Host line apply to every host.
+	block := sshConfigBlock{patterns: []string{"*"}, settings: map[string][]string{}}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value := line, ""
+		if i := strings.IndexAny(line, " \t="); i >= 0 {
+			key, value = line[:i], strings.TrimLeft(line[i:], " \t=")
+		}
+		key, value = strings.ToLower(key), strings.Trim(strings.TrimSpace(value), `"`)
+
+		switch key {
+		case "host":
+			c.blocks = append(c.blocks, block)
+			block = sshConfigBlock{patterns: strings.Fields(value), settings: map[string][]string{}}
+			continue
+		case "match":
+			// a block without pattern matches no host.
+			c.blocks = append(c.blocks, block)
+			block = sshConfigBlock{settings: map[string][]string{}}
+			continue
+		}
+
+		block.settings[key] = append(block.settings[key], value)
+	}
+
+	c.blocks = append(c.blocks, block)
+
+	return c, scanner.Err()
+}
+
+// Get returns the value of the keyword for the host alias, the first one
+// obtained like ssh, or an empty string. Keywords are case insensitive.
+func (c *SSHConfig) Get(alias, keyword string) string {
+	if values := c.GetAll(alias, keyword); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// GetAll returns every value of the keyword for the host alias, in order,
+// for the keywords used more than once like IdentityFile.
+func (c *SSHConfig) GetAll(alias, keyword string) []string {
+
+	keyword = strings.ToLower(keyword)
+
+	var values []string
+	for _, b := range c.blocks {
+		if b.matches(alias) {
+			values = append(values, b.settings[keyword]...)
+		}
+	}
+
+	return values
+}
+
+func (b sshConfigBlock) matches(host string) bool {
+
+	matched := false
+	for _, p := range b.patterns {
+
+		negated := strings.HasPrefix(p, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(p, "!"), host); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// Config returns the config connecting to the host alias like ssh, with
+// the HostName, User, Port, IdentityFile, ProxyJump, ConnectTimeout and
+// UserKnownHostsFile keywords. The keys of the ssh agent are used when
+// SSH_AUTH_SOCK is set, along the identity files, or the default ones
+// without IdentityFile. Encrypted keys are skipped, load them in the
+// agent. Host keys are checked against the known hosts file.
+func (c *SSHConfig) Config(alias string) (*Config, error) {
+	return c.config(alias, 0)
+}
+
+// config returns the config of alias, reached after jumps jump hosts.
+func (c *SSHConfig) config(alias string, jumps int) (*Config, error) {
+
+	config := &Config{
+		User:    c.Get(alias, "user"),
+		Addr:    alias,
+		Port:    22,
+		Timeout: DefaultTimeout,
+	}
+
+	if config.User == "" {
+		config.User = localUser()
+	}
+
+	if hostname := c.Get(alias, "hostname"); hostname != "" {
+		config.Addr = strings.ReplaceAll(hostname, "%h", alias)
+	}
+
+	if port := c.Get(alias, "port"); port != "" {
+		n, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("ssh_config: invalid port %q for %s", port, alias)
+		}
+		config.Port = uint(n)
+	}
+
+	if timeout := c.Get(alias, "connecttimeout"); timeout != "" {
+		n, err := strconv.Atoi(timeout)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("ssh_config: invalid ConnectTimeout %q for %s", timeout, alias)
+		}
+		config.Timeout = time.Duration(n) * time.Second
+	}
+
+	expand := func(s string) string {
+		return expandSSHTokens(s, config.Addr, config.User)
+	}
+
+	var files []string
+	for _, f := range c.GetAll(alias, "identityfile") {
+		files = append(files, expand(f))
+	}
+
+	var err error
+	if config.Auth, err = sshConfigAuth(files); err != nil {
+		return nil, err
+	}
+
+	knownFile := ""
+	if fields := strings.Fields(c.Get(alias, "userknownhostsfile")); len(fields) > 0 {
+		knownFile = expand(fields[0])
+	} else if knownFile, err = DefaultKnownHostsPath(); err != nil {
+		return nil, err
+	}
+
+	known, err := LoadKnownHosts(knownFile)
+	if err != nil {
+		return nil, err
+	}
+	config.Callback = known.Callback()
+
+	jump := c.Get(alias, "proxyjump")
+	if jump == "" || strings.EqualFold(jump, "none") {
+		return config, nil
+	}
+
+	if jumps >= maxJumps {
+		return nil, fmt.Errorf("ssh_config: more than %d jump hosts to reach %s", maxJumps, alias)
+	}
+
+	// the first jump host may have its own, the others are reached
+	// through the previous one.
+	for i, spec := range strings.Split(jump, ",") {
+
+		proxy, err := c.jumpConfig(strings.TrimSpace(spec), jumps+1)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			proxy.Proxy = config.Proxy
+		}
+		config.Proxy = proxy
+	}
+
+	return config, nil
+}
+
+// jumpConfig returns the config of a ProxyJump host, [user@]host[:port]
+// where host may be an alias.
+func (c *SSHConfig) jumpConfig(spec string, jumps int) (*Config, error) {
+
+	spec = strings.TrimPrefix(spec, "ssh://")
+
+	user, host := "", spec
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		user, host = spec[:i], spec[i+1:]
+	}
+
+	var port uint64
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		if port, err = strconv.ParseUint(p, 10, 16); err != nil {
+			return nil, fmt.Errorf("ssh_config: invalid ProxyJump %q", spec)
+		}
+		host = h
+	}
+
+	config, err := c.config(strings.Trim(host, "[]"), jumps)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != "" {
+		config.User = user
+	}
+	if port != 0 {
+		config.Port = uint(port)
+	}
+
+	return config, nil
+}
+
+// sshConfigAuth returns the keys of the ssh agent and of the identity
+// files, or of the default identity files when none is set, merged into one
+// public key method as the ssh client tries a method name once.
+func sshConfigAuth(files []string) (Auth, error) {
+
+	var auths []Auth
+
+	if HasAgent() {
+		if a, err := UseAgent(); err == nil {
+			auths = append(auths, a)
+		}
+	}
+
+	if len(files) == 0 {
+		home, _ := os.UserHomeDir()
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			files = append(files, filepath.Join(home, ".ssh", name))
+		}
+	}
+
+	for _, file := range files {
+
+		// like ssh, missing identity files are skipped.
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+
+		a, err := Key(file, "")
+
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ssh_config: identity %s: %w", file, err)
+		}
+
+		auths = append(auths, a)
+	}
+
+	return Fallback(auths...), nil
+}
+
+// expandSSHTokens expands the leading "~" and the %d home directory, %h
+// host, %r remote user, %u local user and %% tokens of ssh_config paths.
+func expandSSHTokens(s, host, user string) string {
+
+	home, _ := os.UserHomeDir()
+
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		s = home + s[1:]
+	}
+
+	return strings.NewReplacer(
+		"%%", "%",
+		"%d", home,
+		"%h", host,
+		"%r", user,
+		"%u", localUser(),
+	).Replace(s)
+}
+
+// localUser returns the name of the local user.
+func localUser() string {
+	if u, err := osuser.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
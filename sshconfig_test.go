@@ -0,0 +1,215 @@
+package goph_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestSSHConfig(t *testing.T) {
+
+	c, err := goph.ParseSSHConfig(strings.NewReader(`
+User everyone
+
+Host web-* !web-test
+  HostName %h.example.com
+  Port 2222
+
+Host web-1
+  User deploy
+  Port 22
+
+Match exec "true"
+  Port 3333
+
+Host *
+  IdentityFile ~/.ssh/id_fleet
+  IdentityFile=~/.ssh/id_other
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Get("web-1", "Port") != "2222" || c.Get("web-1", "user") != "everyone" || c.Get("web-1", "identityfile") != "~/.ssh/id_fleet" {
+		t.Errorf("unexpected web-1 settings")
+	}
+	if files := c.GetAll("web-1", "IdentityFile"); len(files) != 2 || files[1] != "~/.ssh/id_other" {
+		t.Errorf("expected both identity files, got %q", files)
+	}
+	if port := c.Get("web-test", "port"); port != "" {
+		t.Errorf("negated pattern should not match, got port %q", port)
+	}
+}
+
+func TestSSHConfigConnect(t *testing.T) {
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	signer, keyPEM := newSigner(t)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_test"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	knownFile := filepath.Join(home, "known_hosts")
+
+	var ports []string
+	for _, name := range []string{"bastion", "target"} {
+		srv := gophtest.NewServer()
+		srv.AddKey("alice", signer.PublicKey())
+		srv.Forwarding = name == "bastion"
+		srv.HandleFunc("hostname", func(e *gophtest.Exec) int {
+			fmt.Fprintln(e.Stdout, name)
+			return 0
+		})
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+
+		if _, err := goph.AddKnownHosts(knownFile, goph.KnownHost{Host: srv.Addr(), Key: srv.HostKey.PublicKey()}); err != nil {
+			t.Fatal(err)
+		}
+		_, port, _ := net.SplitHostPort(srv.Addr())
+		ports = append(ports, port)
+	}
+
+	err := os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(`
+Host bastion
+  HostName 127.0.0.1
+  Port `+ports[0]+`
+
+Host target
+  HostName 127.0.0.1
+  Port `+ports[1]+`
+  ProxyJump bastion
+  ConnectTimeout 5
+
+Host *
+  User alice
+  IdentityFile %d/.ssh/id_missing
+  IdentityFile %d/.ssh/id_test
+  UserKnownHostsFile ~/known_hosts
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := goph.NewFromSSHConfig("target")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.User != "alice" || config.Addr != "127.0.0.1" || fmt.Sprint(config.Port) != ports[1] || config.Timeout != 5*time.Second {
+		t.Errorf("unexpected config %s@%s:%d, timeout %s", config.User, config.Addr, config.Port, config.Timeout)
+	}
+	if config.Proxy == nil || fmt.Sprint(config.Proxy.Port) != ports[0] {
+		t.Fatal("expected the bastion as jump host")
+	}
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	out, err := client.Run("hostname")
+	if err != nil || strings.TrimSpace(string(out)) != "target" {
+		t.Errorf("expected target, got %q, %v", out, err)
+	}
+}
+
+func TestSSHConfigAgentAndIdentity(t *testing.T) {
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// the agent offers a key the server refuses.
+	_, agentPEM := newSigner(t)
+	agentKey, err := ssh.ParseRawPrivateKey(agentPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: agentKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(home, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	signer, keyPEM := newSigner(t)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_test"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := gophtest.NewServer()
+	srv.AddKey("alice", signer.PublicKey())
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	knownFile := filepath.Join(home, "known_hosts")
+	if _, err := goph.AddKnownHosts(knownFile, goph.KnownHost{Host: srv.Addr(), Key: srv.HostKey.PublicKey()}); err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(srv.Addr())
+
+	err = os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(`
+Host target
+  HostName 127.0.0.1
+  Port `+port+`
+  User alice
+  IdentityFile %d/.ssh/id_test
+  UserKnownHostsFile ~/known_hosts
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := goph.NewFromSSHConfig("target")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the identity file is offered after the agent keys.
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats holds the byte counters of a client connection.
+type ConnStats struct {
+
+	// BytesIn and BytesOut count the raw bytes read from and written to the
+	// connection, including ssh framing and encryption overhead.
+	BytesIn  uint64
+	BytesOut uint64
+
+	// Since is the time the connection was established.
+	Since time.Time
+
+	// InRate and OutRate are the throughput in bytes per second since the
+	// previous Stats call, or since the connection was established.
+	InRate  float64
+	OutRate float64
+}
+
+// countingConn is a net.Conn counting the bytes read and written.
+type countingConn struct {
+	net.Conn
+	in    atomic.Uint64
+	out   atomic.Uint64
+	since time.Time
+
+	mu      sync.Mutex
+	lastAt  time.Time
+	lastIn  uint64
+	lastOut uint64
+}
+
+func newCountingConn(conn net.Conn) *countingConn {
+	now := time.Now()
+	return &countingConn{
+		Conn:   conn,
+		since:  now,
+		lastAt: now,
+	}
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.in.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.out.Add(uint64(n))
+	return n, err
+}
+
+// stats returns the counters and the throughput since the previous call.
+func (c *countingConn) stats() ConnStats {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	s := ConnStats{
+		BytesIn:  c.in.Load(),
+		BytesOut: c.out.Load(),
+		Since:    c.since,
+	}
+
+	if elapsed := now.Sub(c.lastAt).Seconds(); elapsed > 0 {
+		s.InRate = float64(s.BytesIn-c.lastIn) / elapsed
+		s.OutRate = float64(s.BytesOut-c.lastOut) / elapsed
+	}
+
+	c.lastAt, c.lastIn, c.lastOut = now, s.BytesIn, s.BytesOut
+
+	return s
+}
+
+// Stats returns the byte counters and current throughput of the connection.
+// It returns zero stats for clients not created by goph.
+func (c Client) Stats() ConnStats {
+
+	c = c.live()
+
+	if c.state == nil || c.state.counter == nil {
+		return ConnStats{}
+	}
+
+	return c.state.counter.stats()
+}
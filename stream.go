@@ -0,0 +1,155 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StdoutPipe returns a pipe receiving the stdout of the command started
+// with Start, like os/exec. Unlike the pipe of the session, the output
+// read counts as activity for IdleTimeout and is recorded by Recorder.
+// Read the pipe to its end before calling Wait.
+func (c *Cmd) StdoutPipe() (io.Reader, error) {
+	return c.pipe(c.Session.StdoutPipe)
+}
+
+// StderrPipe is like StdoutPipe, for stderr.
+func (c *Cmd) StderrPipe() (io.Reader, error) {
+	return c.pipe(c.Session.StderrPipe)
+}
+
+func (c *Cmd) pipe(open func() (io.Reader, error)) (io.Reader, error) {
+
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &cmdPipe{r: r, c: c}, nil
+}
+
+// cmdPipe tracks and records the output read from a pipe of the command.
+type cmdPipe struct {
+	r io.Reader
+	c *Cmd
+}
+
+func (p *cmdPipe) Read(b []byte) (int, error) {
+
+	n, err := p.r.Read(b)
+	if n > 0 {
+		if p.c.activity != nil {
+			p.c.activity.touch()
+		}
+		if p.c.Recorder != nil {
+			p.c.Recorder.Writer(nil).Write(b[:n])
+		}
+	}
+
+	return n, err
+}
+
+// Line is a line of output streamed by Stream.
+type Line struct {
+
+	// Text of the line, without its line ending.
+	Text string
+
+	// Time the line was received.
+	Time time.Time
+}
+
+// Stream runs cmd and sends the lines of its stdout and stderr as they are
+// written, for long running commands like "tail -f" or builds. Both line
+// channels are closed once the command ended, then errc receives the
+// result of the command, like Cmd.Wait, and is closed. Read both line
+// channels, an unread one blocks the command. Once ctx is done, the
+// command is sent SIGINT and errc receives the context error.
+func (c Client) Stream(ctx context.Context, cmd string) (stdout, stderr <-chan Line, errc <-chan error) {
+
+	outc := make(chan Line)
+	errLines := make(chan Line)
+	done := make(chan error, 1)
+
+	go func() {
+		defer close(done)
+		done <- c.stream(ctx, cmd, outc, errLines)
+	}()
+
+	return outc, errLines, done
+}
+
+// stream runs cmd, sending its lines to stdout and stderr, which are
+// closed once the command ended.
+func (c Client) stream(ctx context.Context, cmd string, stdout, stderr chan<- Line) error {
+
+	defer close(stdout)
+	defer close(stderr)
+
+	command, err := c.CommandContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	outPipe, err := command.StdoutPipe()
+	if err != nil {
+		command.Close()
+		return err
+	}
+
+	errPipe, err := command.StderrPipe()
+	if err != nil {
+		command.Close()
+		return err
+	}
+
+	if err = command.Start(); err != nil {
+		command.Close()
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sendLines(ctx, outPipe, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		sendLines(ctx, errPipe, stderr)
+	}()
+
+	// the pipes are read to their end before waiting.
+	wg.Wait()
+
+	return command.Wait()
+}
+
+// sendLines sends the lines read from r to lines, until r ends or ctx is
+// done.
+func sendLines(ctx context.Context, r io.Reader, lines chan<- Line) {
+
+	br := bufio.NewReader(r)
+	for {
+		text, err := br.ReadString('\n')
+		if text != "" {
+			select {
+			case lines <- Line{Text: strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r"), Time: time.Now()}:
+			case <-ctx.Done():
+				// the command is killed, drain its output.
+				io.Copy(io.Discard, br)
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestStream(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("build", func(e *gophtest.Exec) int {
+		fmt.Fprint(e.Stdout, "step 1\nstep 2\r\npartial")
+		fmt.Fprintln(e.Stderr, "warning")
+		return 2
+	})
+	srv.HandleFunc("tail -f log", func(e *gophtest.Exec) int {
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(e.Stdout, "line %d\n", i); err != nil {
+				return 0
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stdout, stderr, errc := client.Stream(context.Background(), "build")
+
+	var out, errOut []string
+	for stdout != nil || stderr != nil {
+		select {
+		case l, ok := <-stdout:
+			if !ok {
+				stdout = nil
+				continue
+			}
+			out = append(out, l.Text)
+		case l, ok := <-stderr:
+			if !ok {
+				stderr = nil
+				continue
+			}
+			errOut = append(errOut, l.Text)
+		}
+	}
+
+	if fmt.Sprint(out) != "[step 1 step 2 partial]" || fmt.Sprint(errOut) != "[warning]" {
+		t.Errorf("unexpected lines %q and %q", out, errOut)
+	}
+
+	var exitErr interface{ ExitStatus() int }
+	if err = <-errc; !errors.As(err, &exitErr) || exitErr.ExitStatus() != 2 {
+		t.Errorf("expected exit status 2, got %v", err)
+	}
+
+	// cancelling stops an endless command.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdout, stderr, errc = client.Stream(ctx, "tail -f log")
+	go func() {
+		for range stderr {
+		}
+	}()
+
+	for l := range stdout {
+		if l.Text == "line 3" {
+			cancel()
+		}
+	}
+
+	select {
+	case err = <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream did not stop")
+	}
+}
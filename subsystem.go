@@ -0,0 +1,68 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Subsystem is an ssh subsystem, like "netconf", running on its own session.
+// Reads return the subsystem output and writes are sent to its input.
+type Subsystem struct {
+	*ssh.Session
+
+	stdin  io.WriteCloser
+	stdout io.Reader
+	client Client
+}
+
+// NewSubsystem starts the subsystem name on a new session.
+func (c Client) NewSubsystem(name string) (_ *Subsystem, err error) {
+
+	defer func() {
+		err = c.Config.opError(OpError{Op: "subsystem", Command: name, Err: err})
+	}()
+
+	sess, err := c.openSession(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subsystem{Session: sess, client: c}
+
+	if s.stdin, err = sess.StdinPipe(); err != nil {
+		c.closeSession(sess)
+		return nil, err
+	}
+
+	if s.stdout, err = sess.StdoutPipe(); err != nil {
+		c.closeSession(sess)
+		return nil, err
+	}
+
+	if err = sess.RequestSubsystem(name); err != nil {
+		c.closeSession(sess)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Subsystem) Read(p []byte) (int, error) {
+	return s.stdout.Read(p)
+}
+
+func (s *Subsystem) Write(p []byte) (int, error) {
+	return s.stdin.Write(p)
+}
+
+// Close closes the subsystem input and its session.
+func (s *Subsystem) Close() error {
+	s.stdin.Close()
+	s.client.closeSession(s.Session)
+	return nil
+}
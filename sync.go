@@ -0,0 +1,676 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sumBatch bounds the files hashed by a single sha256sum command.
+const sumBatch = 100
+
+// errSyncTransforms is returned by the syncs of a config with Transforms,
+// the transformed files cannot be compared with their source.
+var errSyncTransforms = errors.New("goph: sync does not support Config.Transforms")
+
+// SyncOptions set how SyncUp and SyncDown compare the files and clean the
+// destination.
+type SyncOptions struct {
+
+	// Checksum compares the files of the same size by their SHA256 rather
+	// than by their modification time, like rsync -c. The remote files are
+	// hashed by sha256sum on the host, or read over sftp without it.
+	Checksum bool
+
+	// Delete removes the destination files and directories missing from
+	// the source, like rsync --delete. The files ignored by
+	// Config.IgnoreFiles are kept.
+	Delete bool
+
+	// DryRun reports what would be copied and deleted without changing
+	// the destination.
+	DryRun bool
+}
+
+// SyncResult is the summary of a sync. Paths are slash separated and
+// relative to the source, or to the destination for Deleted, "." when the
+// source is a file.
+type SyncResult struct {
+
+	// Copied are the files and links copied.
+	Copied []string
+
+	// Skipped are the files and links already up to date.
+	Skipped []string
+
+	// Deleted are the destination paths removed with SyncOptions.Delete.
+	Deleted []string
+
+	// Bytes is the size of the files copied.
+	Bytes int64
+}
+
+// SyncUp makes the remote dst a copy of the local file or directory src,
+// copying only the files that changed, like rsync. Files of the same size
+// and modification time are up to date, see SyncOptions.Checksum. The
+// copied files keep the modification time of their source, so the next
+// sync skips them. The hooks, progress and options of Upload apply.
+func (c *Client) SyncUp(src, dst string, opts SyncOptions) (*SyncResult, error) {
+	return c.SyncUpContext(context.Background(), src, dst, opts)
+}
+
+// SyncUpContext is like SyncUp, the sync stops with the context error once
+// ctx is done.
+func (c *Client) SyncUpContext(ctx context.Context, src, dst string, opts SyncOptions) (res *SyncResult, err error) {
+	t := c.Config.startTransfer(ctx, "upload", src, dst)
+	defer func() { err = t.end(err) }()
+
+	ftp, err := c.startSync(t, &dst)
+	if err != nil {
+		return nil, err
+	}
+	defer c.endOp(t)
+	defer ftp.Close()
+
+	s := &syncer{
+		t:       t,
+		opts:    opts,
+		src:     localTree{client: c},
+		dst:     remoteTree{client: c, ftp: ftp},
+		srcRoot: src,
+		dstRoot: dst,
+		copy: func(src, dst string) error {
+			return c.copyToRemote(t, ftp, src, dst)
+		},
+		link: func(src, dst string) error {
+			return c.linkToRemote(t, ftp, src, dst)
+		},
+	}
+
+	return s.run()
+}
+
+// SyncDown makes the local dst a copy of the remote file or directory src,
+// like SyncUp. The hooks, progress and options of Download apply.
+func (c *Client) SyncDown(src, dst string, opts SyncOptions) (*SyncResult, error) {
+	return c.SyncDownContext(context.Background(), src, dst, opts)
+}
+
+// SyncDownContext is like SyncDown, the sync stops with the context error
+// once ctx is done.
+func (c *Client) SyncDownContext(ctx context.Context, src, dst string, opts SyncOptions) (res *SyncResult, err error) {
+	t := c.Config.startTransfer(ctx, "download", dst, src)
+	defer func() { err = t.end(err) }()
+
+	ftp, err := c.startSync(t, &src)
+	if err != nil {
+		return nil, err
+	}
+	defer c.endOp(t)
+	defer ftp.Close()
+
+	s := &syncer{
+		t:       t,
+		opts:    opts,
+		src:     remoteTree{client: c, ftp: ftp},
+		dst:     localTree{client: c},
+		srcRoot: src,
+		dstRoot: dst,
+		copy: func(src, dst string) error {
+			return c.downloadFile(t, ftp, src, dst)
+		},
+		link: func(src, dst string) error {
+			return c.linkToLocal(t, ftp, src, dst)
+		},
+	}
+
+	return s.run()
+}
+
+// startSync begins the sync t, expands its remote path and returns the
+// sftp client copying the files. The caller ends the operation.
+func (c *Client) startSync(t *transfer, remotePath *string) (_ *sftp.Client, err error) {
+
+	if c.Config != nil && len(c.Config.Transforms) > 0 {
+		return nil, errSyncTransforms
+	}
+
+	if err = c.beginOp(t); err != nil {
+		return nil, err
+	}
+
+	if *remotePath, err = c.remotePath(*remotePath); err == nil {
+		t.remote = *remotePath
+		var ftp *sftp.Client
+		if ftp, err = c.NewSftp(); err == nil {
+			return ftp, nil
+		}
+	}
+
+	c.endOp(t)
+	return nil, err
+}
+
+// syncTree is the local or remote side of a sync.
+type syncTree interface {
+
+	// join returns the path of rel, slash separated, under root.
+	join(root, rel string) string
+
+	// walk walks the source root like a directory transfer.
+	walk(root string, fn func(p, rel string, info os.FileInfo) error) error
+
+	// list returns the entries under the destination root by slash
+	// separated relative path, without following links. A missing root
+	// is empty.
+	list(root string) (map[string]os.FileInfo, error)
+
+	lstat(p string) (os.FileInfo, error)
+	readlink(p string) (string, error)
+
+	// sums returns the hex SHA256 of the files by path.
+	sums(ctx context.Context, paths []string) (map[string]string, error)
+
+	mkdirAll(p string) error
+	removeAll(p string) error
+	chtimes(p string, mtime time.Time) error
+}
+
+// syncFile is a source entry of a sync, with the destination entry it
+// replaces, if any.
+type syncFile struct {
+	rel  string
+	src  string
+	dst  string
+	info os.FileInfo
+	have os.FileInfo
+}
+
+// syncer compares the trees of a sync and copies the changes.
+type syncer struct {
+	t       *transfer
+	opts    SyncOptions
+	src     syncTree
+	dst     syncTree
+	srcRoot string
+	dstRoot string
+
+	// copy and link copy a file or a symbolic link of src to dst.
+	copy func(src, dst string) error
+	link func(src, dst string) error
+
+	res SyncResult
+}
+
+// run syncs the trees and returns the summary.
+func (s *syncer) run() (*SyncResult, error) {
+
+	existing, err := s.dst.list(s.dstRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs, files, same, links []syncFile
+	seen := make(map[string]bool)
+
+	err = s.src.walk(s.srcRoot, func(p, rel string, info os.FileInfo) error {
+		if err := s.t.ctx.Err(); err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+		f := syncFile{rel: rel, src: p, dst: s.dst.join(s.dstRoot, rel), info: info, have: existing[rel]}
+
+		switch {
+		case info.IsDir():
+			dirs = append(dirs, f)
+		case info.Mode()&os.ModeSymlink != 0:
+			if s.sameLink(f) {
+				s.res.Skipped = append(s.res.Skipped, rel)
+			} else {
+				links = append(links, f)
+			}
+		case !info.Mode().IsRegular():
+		case f.have != nil && f.have.Mode().IsRegular() && f.have.Size() == info.Size():
+			same = append(same, f)
+		default:
+			files = append(files, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := s.changed(same)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, changed...)
+
+	if !s.opts.DryRun {
+		if err = s.apply(dirs, files, links); err != nil {
+			return &s.res, err
+		}
+	} else {
+		for _, f := range append(files, links...) {
+			s.res.Copied = append(s.res.Copied, f.rel)
+			s.res.Bytes += f.info.Size()
+		}
+	}
+
+	if s.opts.Delete {
+		if err = s.delete(existing, seen); err != nil {
+			return &s.res, err
+		}
+	}
+
+	return &s.res, nil
+}
+
+// sameLink reports whether the destination of f is a link with the target
+// of the source link.
+func (s *syncer) sameLink(f syncFile) bool {
+
+	if f.have == nil || f.have.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+
+	want, err := s.src.readlink(f.src)
+	if err != nil {
+		return false
+	}
+	got, err := s.dst.readlink(f.dst)
+
+	return err == nil && filepath.ToSlash(got) == filepath.ToSlash(want)
+}
+
+// changed returns the files of the same size as their destination which
+// differ from it, the others are skipped.
+func (s *syncer) changed(files []syncFile) ([]syncFile, error) {
+
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	differ := func(f syncFile) bool {
+		return f.info.ModTime().Unix() != f.have.ModTime().Unix()
+	}
+
+	if s.opts.Checksum {
+
+		var srcPaths, dstPaths []string
+		for _, f := range files {
+			srcPaths = append(srcPaths, f.src)
+			dstPaths = append(dstPaths, f.dst)
+		}
+
+		srcSums, err := s.src.sums(s.t.ctx, srcPaths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash source files: %w", err)
+		}
+		dstSums, err := s.dst.sums(s.t.ctx, dstPaths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash destination files: %w", err)
+		}
+
+		differ = func(f syncFile) bool {
+			return srcSums[f.src] != dstSums[f.dst]
+		}
+	}
+
+	var changed []syncFile
+	for _, f := range files {
+		if differ(f) {
+			changed = append(changed, f)
+		} else {
+			s.res.Skipped = append(s.res.Skipped, f.rel)
+		}
+	}
+
+	return changed, nil
+}
+
+// apply creates the directories and copies the files and links, replacing
+// the destination entries of another type.
+func (s *syncer) apply(dirs, files, links []syncFile) error {
+
+	for _, d := range dirs {
+		if d.have != nil && !d.have.IsDir() {
+			if err := s.dst.removeAll(d.dst); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", d.dst, err)
+			}
+		}
+		if d.have == nil || !d.have.IsDir() {
+			if err := s.dst.mkdirAll(d.dst); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", d.dst, err)
+			}
+		}
+	}
+
+	for _, f := range files {
+		if err := s.t.ctx.Err(); err != nil {
+			return err
+		}
+
+		// not writing through a link.
+		if f.have != nil && !f.have.Mode().IsRegular() {
+			if err := s.dst.removeAll(f.dst); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", f.dst, err)
+			}
+		}
+
+		if err := s.copy(f.src, f.dst); err != nil {
+			return err
+		}
+
+		// the next sync compares the modification times.
+		if err := s.dst.chtimes(f.dst, f.info.ModTime()); err != nil {
+			return fmt.Errorf("failed to set the time of %s: %w", f.dst, err)
+		}
+
+		s.res.Copied = append(s.res.Copied, f.rel)
+		s.res.Bytes += f.info.Size()
+	}
+
+	for _, f := range links {
+		if f.have != nil && f.have.IsDir() {
+			if err := s.dst.removeAll(f.dst); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", f.dst, err)
+			}
+		}
+		if err := s.link(f.src, f.dst); err != nil {
+			return err
+		}
+		s.res.Copied = append(s.res.Copied, f.rel)
+	}
+
+	opts := s.t.config.transferOptions()
+	if !opts.preserve() {
+		return nil
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := s.setAttrs(dirs[i], opts); err != nil {
+			return fmt.Errorf("failed to set directory attributes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// setAttrs gives the destination directory d the preserved attributes of
+// its source.
+func (s *syncer) setAttrs(d syncFile, opts TransferOptions) error {
+	if tree, ok := s.dst.(remoteTree); ok {
+		return opts.setRemote(tree.ftp, d.dst, d.info)
+	}
+	return opts.setLocal(d.dst, d.info)
+}
+
+// delete removes the destination entries missing from the source, and
+// not ignored there.
+func (s *syncer) delete(existing map[string]os.FileInfo, seen map[string]bool) error {
+
+	var extra []string
+	for rel := range existing {
+		if !seen[rel] {
+			extra = append(extra, rel)
+		}
+	}
+	slices.Sort(extra)
+
+	var removed string
+	for _, rel := range extra {
+
+		// the content of a removed directory goes with it.
+		if removed != "" && strings.HasPrefix(rel, removed+"/") {
+			continue
+		}
+
+		// the ignored source files are not walked, but exist.
+		if _, err := s.src.lstat(s.src.join(s.srcRoot, rel)); err == nil {
+			continue
+		}
+
+		if !s.opts.DryRun {
+			if err := s.dst.removeAll(s.dst.join(s.dstRoot, rel)); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", rel, err)
+			}
+		}
+
+		s.res.Deleted = append(s.res.Deleted, rel)
+		removed = rel
+	}
+
+	if len(s.res.Deleted) > 0 {
+		s.t.config.logger().Info("sync deleted extraneous files", s.t.config.logAttrs("remote", s.t.remote, "count", len(s.res.Deleted))...)
+	}
+
+	return nil
+}
+
+// localTree is the local side of a sync.
+type localTree struct {
+	client *Client
+}
+
+func (localTree) join(root, rel string) string {
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
+
+func (l localTree) walk(root string, fn func(p, rel string, info os.FileInfo) error) error {
+	return l.client.walkUpload(root, fn)
+}
+
+func (localTree) list(root string) (map[string]os.FileInfo, error) {
+
+	entries := make(map[string]os.FileInfo)
+
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entries[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) && len(entries) == 0 {
+		err = nil
+	}
+
+	return entries, err
+}
+
+func (localTree) lstat(p string) (os.FileInfo, error) {
+	return os.Lstat(p)
+}
+
+func (localTree) readlink(p string) (string, error) {
+	return os.Readlink(p)
+}
+
+func (localTree) sums(ctx context.Context, paths []string) (map[string]string, error) {
+
+	sums := make(map[string]string, len(paths))
+
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		sums[p] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return sums, nil
+}
+
+func (localTree) mkdirAll(p string) error {
+	return os.MkdirAll(p, 0755)
+}
+
+func (localTree) removeAll(p string) error {
+	return os.RemoveAll(p)
+}
+
+func (localTree) chtimes(p string, mtime time.Time) error {
+	return os.Chtimes(p, time.Now(), mtime)
+}
+
+// remoteTree is the remote side of a sync.
+type remoteTree struct {
+	client *Client
+	ftp    *sftp.Client
+}
+
+func (remoteTree) join(root, rel string) string {
+	return path.Join(root, rel)
+}
+
+func (r remoteTree) walk(root string, fn func(p, rel string, info os.FileInfo) error) error {
+	return r.client.walkDownload(r.ftp, root, fn)
+}
+
+func (r remoteTree) list(root string) (map[string]os.FileInfo, error) {
+
+	entries := make(map[string]os.FileInfo)
+
+	if _, err := r.ftp.Lstat(root); errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+
+	root = path.Clean(root)
+	walker := r.ftp.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		entries[remoteRel(root, walker.Path())] = walker.Stat()
+	}
+
+	return entries, nil
+}
+
+func (r remoteTree) lstat(p string) (os.FileInfo, error) {
+	return r.ftp.Lstat(p)
+}
+
+func (r remoteTree) readlink(p string) (string, error) {
+	return r.ftp.ReadLink(p)
+}
+
+func (r remoteTree) sums(ctx context.Context, paths []string) (map[string]string, error) {
+	return r.client.remoteSums(ctx, r.ftp, paths)
+}
+
+func (r remoteTree) mkdirAll(p string) error {
+	return r.ftp.MkdirAll(p)
+}
+
+func (r remoteTree) removeAll(p string) error {
+	return removeAll(r.ftp, p)
+}
+
+func (r remoteTree) chtimes(p string, mtime time.Time) error {
+	return r.ftp.Chtimes(p, time.Now(), mtime)
+}
+
+// remoteSums returns the hex SHA256 of the remote files by path, computed
+// by sha256sum on the host, or by reading the files over sftp when it is
+// missing or failed for some of them.
+func (c Client) remoteSums(ctx context.Context, ftp *sftp.Client, paths []string) (map[string]string, error) {
+
+	sums := make(map[string]string, len(paths))
+
+	for batch := range slices.Chunk(paths, sumBatch) {
+
+		cmd, err := c.CommandContext(ctx, "sha256sum", append([]string{"--"}, batch...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		// the output lists the files hashed even when others failed.
+		out, err := cmd.Output()
+		parseSHA256Sums(out, sums)
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitStatus() == 127 {
+			c.Config.logger().Debug("sha256sum not found, hashing over sftp", c.Config.logAttrs()...)
+			break
+		}
+	}
+
+	for _, p := range paths {
+		if _, ok := sums[p]; ok {
+			continue
+		}
+		sum, err := remoteHash(ftp, p)
+		if err != nil {
+			return nil, err
+		}
+		sums[p] = hex.EncodeToString(sum[:])
+	}
+
+	return sums, nil
+}
+
+// parseSHA256Sums adds the sums of the sha256sum output to sums. The names
+// with a newline or a backslash are escaped, and the line starts with a
+// backslash.
+func parseSHA256Sums(out []byte, sums map[string]string) {
+
+	for _, line := range strings.Split(string(out), "\n") {
+
+		escaped := strings.HasPrefix(line, `\`)
+		line = strings.TrimPrefix(line, `\`)
+
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != 2*sha256.Size || name == "" {
+			continue
+		}
+
+		// a space for text mode, or a star for binary mode.
+		name = name[1:]
+		if escaped {
+			name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+		}
+
+		sums[name] = sum
+	}
+}
@@ -0,0 +1,200 @@
+package goph_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+	"github.com/pkg/sftp"
+)
+
+// osSftp serves sftp from the local filesystem, which keeps the file times
+// unlike the in-memory one.
+type osSftp struct{ io.ReadWriter }
+
+func (osSftp) Close() error { return nil }
+
+func TestSync(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleSubsystem("sftp", func(rw io.ReadWriter) {
+		server, err := sftp.NewServer(osSftp{rw})
+		if err != nil {
+			return
+		}
+		server.Serve()
+		server.Close()
+	})
+
+	// sha256sum hashes the local files.
+	hashed := 0
+	srv.NotFound = func(e *gophtest.Exec) int {
+		args, ok := strings.CutPrefix(e.Command, "sha256sum -- ")
+		if !ok {
+			return 127
+		}
+		for _, p := range strings.Fields(args) {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return 1
+			}
+			hashed++
+			fmt.Fprintf(e.Stdout, "%x  %s\n", sha256.Sum256(data), p)
+		}
+		return 0
+	}
+
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Config.IgnoreFiles = goph.DefaultIgnoreFiles
+
+	root := filepath.ToSlash(t.TempDir()) + "/dst"
+
+	src := t.TempDir()
+	mtime := time.Unix(1600000000, 0)
+	write := func(name, data string) {
+		p := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, mtime, mtime)
+	}
+	write("a.txt", "alpha")
+	write("sub/b.txt", "bravo")
+	write("sub/c.txt", "charlie")
+	write(".gitignore", "*.log\n")
+	write("debug.log", "kept")
+
+	check := func(res *goph.SyncResult, err error, copied, skipped, deleted []string) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range [][]string{res.Copied, res.Skipped, res.Deleted} {
+			slices.Sort(s)
+		}
+		if fmt.Sprint(res.Copied, res.Skipped, res.Deleted) != fmt.Sprint(copied, skipped, deleted) {
+			t.Errorf("expected copied %v skipped %v deleted %v, got %v %v %v",
+				copied, skipped, deleted, res.Copied, res.Skipped, res.Deleted)
+		}
+	}
+
+	all := []string{".gitignore", "a.txt", "sub/b.txt", "sub/c.txt"}
+
+	res, err := client.SyncUp(src, root, goph.SyncOptions{})
+	check(res, err, all, nil, nil)
+	if res.Bytes != int64(len("*.log\nalphabravocharlie")) {
+		t.Errorf("unexpected bytes copied %d", res.Bytes)
+	}
+
+	res, err = client.SyncUp(src, root, goph.SyncOptions{})
+	check(res, err, nil, all, nil)
+
+	// a new time is a change, unless the checksums match.
+	later := mtime.Add(time.Hour)
+	os.Chtimes(filepath.Join(src, "a.txt"), later, later)
+
+	res, err = client.SyncUp(src, root, goph.SyncOptions{Checksum: true})
+	check(res, err, nil, all, nil)
+	if hashed != len(all) {
+		t.Errorf("expected the remote files hashed by sha256sum, got %d", hashed)
+	}
+
+	res, err = client.SyncUp(src, root, goph.SyncOptions{})
+	check(res, err, []string{"a.txt"}, []string{".gitignore", "sub/b.txt", "sub/c.txt"}, nil)
+
+	// the same size and time are up to date, unless the checksums differ.
+	write("sub/b.txt", "BRAVO")
+
+	res, err = client.SyncUp(src, root, goph.SyncOptions{})
+	check(res, err, nil, all, nil)
+
+	res, err = client.SyncUp(src, root, goph.SyncOptions{Checksum: true})
+	check(res, err, []string{"sub/b.txt"}, []string{".gitignore", "a.txt", "sub/c.txt"}, nil)
+	if data, _ := client.ReadFile(root + "/sub/b.txt"); string(data) != "BRAVO" {
+		t.Errorf("expected the changed file copied, got %q", data)
+	}
+
+	// extraneous remote files are deleted, not the ignored ones.
+	client.WriteFile(root+"/debug.log", []byte("remote"), 0644)
+	client.WriteFile(root+"/old.txt", []byte("old"), 0644)
+	ftp, err := client.NewSftp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftp.MkdirAll(root + "/gone/deep")
+	ftp.Close()
+	client.WriteFile(root+"/gone/deep/x", []byte("x"), 0644)
+	os.Remove(filepath.Join(src, "sub/c.txt"))
+
+	res, err = client.SyncUp(src, root, goph.SyncOptions{Delete: true, DryRun: true})
+	check(res, err, nil, all[:3], []string{"gone", "old.txt", "sub/c.txt"})
+	if ok, _ := client.Exists(root + "/old.txt"); !ok {
+		t.Error("expected a dry run to keep the files")
+	}
+
+	res, err = client.SyncUp(src, root, goph.SyncOptions{Delete: true})
+	check(res, err, nil, all[:3], []string{"gone", "old.txt", "sub/c.txt"})
+	for name, want := range map[string]bool{root + "/old.txt": false, root + "/gone": false, root + "/debug.log": true} {
+		if ok, _ := client.Exists(name); ok != want {
+			t.Errorf("%s: expected exists %v", name, want)
+		}
+	}
+
+	// downloads sync the same way.
+	dst := filepath.Join(t.TempDir(), "back")
+	remote := []string{".gitignore", "a.txt", "debug.log", "sub/b.txt"}
+
+	res, err = client.SyncDown(root, dst, goph.SyncOptions{})
+	check(res, err, remote, nil, nil)
+	if data, _ := os.ReadFile(filepath.Join(dst, "sub/b.txt")); string(data) != "BRAVO" {
+		t.Errorf("expected the file downloaded, got %q", data)
+	}
+
+	os.WriteFile(filepath.Join(dst, "local.txt"), []byte("local"), 0644)
+
+	res, err = client.SyncDown(root, dst, goph.SyncOptions{Delete: true, Checksum: true})
+	check(res, err, nil, remote, []string{"local.txt"})
+}
+
+func TestSyncRoots(t *testing.T) {
+
+	client := newFileServer(t)
+	if err := client.WriteFile("/old", []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the remote files are listed relative to the root to find the extra ones.
+	for _, root := range []string{"/", "."} {
+		res, err := client.SyncUp(src, root, goph.SyncOptions{Delete: true, DryRun: true})
+		if err != nil {
+			t.Fatalf("%s: %v", root, err)
+		}
+		if fmt.Sprint(res.Deleted) != "[old]" {
+			t.Errorf("%s: expected old deleted, got %v", root, res.Deleted)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+)
+
+// Tracer starts spans around dial, auth, command and transfer operations.
+// See the gophotel package for an OpenTelemetry implementation.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	SetAttributes(attrs ...slog.Attr)
+
+	// End ends the span, recording err when not nil.
+	End(err error)
+}
+
+// nopSpan is used when no Tracer is configured.
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...slog.Attr) {}
+func (nopSpan) End(error)                  {}
+
+// startSpan starts a span with the connection attributes of c.
+func (c *Config) startSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+
+	if c == nil || c.Tracer == nil {
+		return ctx, nopSpan{}
+	}
+
+	attrs = append([]slog.Attr{
+		slog.String("net.peer.name", c.Addr),
+		slog.Int("net.peer.port", int(c.Port)),
+		slog.String("ssh.user", c.User),
+	}, attrs...)
+
+	return c.Tracer.Start(ctx, name, attrs...)
+}
+
+// commandHash returns a short hash identifying cmd without exposing its content.
+func commandHash(cmd string) string {
+	sum := sha256.Sum256([]byte(cmd))
+	return hex.EncodeToString(sum[:8])
+}
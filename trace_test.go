@@ -0,0 +1,154 @@
+package goph_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+// testSpan is a span recorded by testTracer.
+type testSpan struct {
+	name  string
+	attrs map[string]slog.Value
+	err   error
+	ended bool
+}
+
+// testTracer records the spans in memory.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, goph.Span) {
+
+	span := testSpanRef{t, &testSpan{name: name, attrs: make(map[string]slog.Value)}}
+	span.SetAttributes(attrs...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, span.testSpan)
+
+	return ctx, span
+}
+
+// find returns the ended spans named name.
+func (t *testTracer) find(name string) []*testSpan {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var spans []*testSpan
+	for _, s := range t.spans {
+		if s.name == name && s.ended {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+type testSpanRef struct {
+	tracer *testTracer
+	*testSpan
+}
+
+func (s testSpanRef) SetAttributes(attrs ...slog.Attr) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s testSpanRef) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.err, s.ended = err, true
+}
+
+func TestTracer(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("echo hi", func(e *gophtest.Exec) int {
+		fmt.Fprintln(e.Stdout, "hi")
+		return 0
+	})
+	srv.HandleFunc("false", func(e *gophtest.Exec) int { return 1 })
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	tracer := &testTracer{}
+
+	config := srv.Config("alice", "secret")
+	config.Tracer = tracer
+
+	client, err := goph.NewConn(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if spans := tracer.find("goph.connect"); len(spans) != 1 || spans[0].err != nil || spans[0].attrs["ssh.user"].String() != "alice" {
+		t.Errorf("unexpected connect spans %+v", spans)
+	}
+	if spans := tracer.find("goph.handshake"); len(spans) != 1 {
+		t.Errorf("unexpected handshake spans %+v", spans)
+	}
+
+	if _, err = client.Run("echo hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Run("false"); err == nil {
+		t.Fatal("false should fail")
+	}
+
+	runs := tracer.find("goph.run")
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 run spans, got %d", len(runs))
+	}
+	if runs[0].err != nil || runs[0].attrs["goph.output_bytes"].Int64() != 3 || runs[0].attrs["net.peer.name"].String() != config.Addr {
+		t.Errorf("unexpected run span %+v", runs[0])
+	}
+	if hash := runs[0].attrs["goph.command_hash"].String(); hash == "" || hash == "echo hi" {
+		t.Errorf("expected the command hashed, got %q", hash)
+	}
+	if runs[1].err == nil || runs[1].attrs["goph.command_hash"].String() == runs[0].attrs["goph.command_hash"].String() {
+		t.Errorf("expected the failed command recorded, got %+v", runs[1])
+	}
+
+	local := filepath.Join(t.TempDir(), "data")
+	if err = os.WriteFile(local, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Upload(local, "/data"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Download("/data", local+".copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Download("/missing", local+".missing"); err == nil {
+		t.Fatal("the download of a missing file should fail")
+	}
+
+	uploads := tracer.find("goph.upload")
+	if len(uploads) != 1 || uploads[0].err != nil || uploads[0].attrs["goph.bytes"].Int64() != 5 ||
+		uploads[0].attrs["goph.local_path"].String() != local || uploads[0].attrs["goph.remote_path"].String() != "/data" {
+		t.Errorf("unexpected upload spans %+v", uploads)
+	}
+
+	downloads := tracer.find("goph.download")
+	if len(downloads) != 2 || downloads[0].err != nil || downloads[0].attrs["goph.files"].Int64() != 1 || downloads[1].err == nil {
+		t.Errorf("unexpected download spans %+v", downloads)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transfer tracks a single Upload or Download for logging and tracing.
+type transfer struct {
+	ctx    context.Context
+	config *Config
+	span   Span
+
+	op     string
+	local  string
+	remote string
+	start  time.Time
+
+	// progress is the Progress writer of the config, shared by the files
+	// copied concurrently.
+	progress io.Writer
+
+	// mu guards the counters and serializes the file hooks of files copied
+	// concurrently.
+	mu    sync.Mutex
+	bytes int64
+	files int
+
+	// skipped are the file failures skipped by OnFileError.
+	skipped []*TransferError
+
+	// onProgress, if set, is called with the bytes copied out of total.
+	onProgress func(TransferProgress)
+	total      int64
+	copied     int64
+}
+
+// TransferProgress is reported to the progress callback of UploadContext
+// and DownloadContext as bytes are copied.
+type TransferProgress struct {
+
+	// LocalPath and RemotePath of the file being copied.
+	LocalPath  string
+	RemotePath string
+
+	// FileBytes of the current file copied out of FileSize.
+	FileBytes int64
+	FileSize  int64
+
+	// Bytes of the transfer copied out of Total, the size of the source
+	// files when the transfer started, or zero for scp downloads.
+	Bytes int64
+	Total int64
+}
+
+// progressReader stops the copy of a file once the transfer context is
+// done, and reports its progress.
+type progressReader struct {
+	r      io.Reader
+	t      *transfer
+	e      *FileEvent
+	copied int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+
+	if err := p.t.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := p.r.Read(b)
+	if n > 0 && p.t.onProgress != nil {
+		p.copied += int64(n)
+		p.t.report(p.e, int64(n), p.copied)
+	}
+
+	return n, err
+}
+
+// report calls the progress callback after n more bytes of the file of e
+// were copied.
+func (t *transfer) report(e *FileEvent, n, fileBytes int64) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.copied += n
+
+	t.onProgress(TransferProgress{
+		LocalPath:  e.LocalPath,
+		RemotePath: e.RemotePath,
+		FileBytes:  fileBytes,
+		FileSize:   e.Size,
+		Bytes:      t.copied,
+		Total:      t.total,
+	})
+}
+
+// startTransfer starts tracking a transfer, op is "upload" or "download".
+func (c *Config) startTransfer(ctx context.Context, op, local, remote string) *transfer {
+
+	t := &transfer{
+		config: c,
+		op:     op,
+		local:  local,
+		remote: remote,
+		start:  time.Now(),
+	}
+
+	t.ctx, t.span = c.startSpan(ctx, "goph."+op,
+		slog.String("goph.local_path", local),
+		slog.String("goph.remote_path", remote),
+	)
+
+	if c != nil && c.Progress != nil {
+		t.progress = &lockedWriter{w: c.Progress}
+	}
+
+	c.logger().Info(op+" started", c.logAttrs("local", local, "remote", remote)...)
+
+	if c != nil && c.OnTransferStart != nil {
+		c.OnTransferStart(t.event())
+	}
+
+	return t
+}
+
+// source returns r, the source of the file of e, stopping on the transfer
+// context and reporting its progress to the progress callback and the
+// Progress writer and ProxyReader of the config.
+func (t *transfer) source(e *FileEvent, r io.Reader) io.Reader {
+
+	r = &progressReader{r: r, t: t, e: e}
+
+	if t.config == nil {
+		return r
+	}
+
+	if t.progress != nil {
+		r = io.TeeReader(r, t.progress)
+	}
+
+	if t.config.ProxyReader != nil {
+		r = t.config.ProxyReader(r)
+	}
+
+	return r
+}
+
+// TransferError is the failure of a single file of an Upload or Download.
+type TransferError struct {
+
+	// Op is "upload" or "download".
+	Op         string
+	LocalPath  string
+	RemotePath string
+
+	// Offset is the number of bytes of the source file copied before the
+	// failure.
+	Offset int64
+
+	Err error
+}
+
+func (e *TransferError) Error() string {
+
+	src, dst := e.LocalPath, e.RemotePath
+	if e.Op == "download" {
+		src, dst = dst, src
+	}
+
+	return fmt.Sprintf("%s %s -> %s at byte %d: %s", e.Op, src, dst, e.Offset, e.Err)
+}
+
+func (e *TransferError) Unwrap() error { return e.Err }
+
+// PartialTransferError is returned by Upload and Download when files were
+// skipped by the OnFileError hook, once the other files were copied.
+type PartialTransferError struct {
+
+	// Op is "upload" or "download".
+	Op string
+
+	// Files and Bytes count the files copied.
+	Files int
+	Bytes int64
+
+	// Errors are the failures of the skipped files.
+	Errors []*TransferError
+}
+
+func (e *PartialTransferError) Error() string {
+
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%s: %d of %d files failed: %s", e.Op, len(e.Errors), len(e.Errors)+e.Files, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the TransferError of every skipped file.
+func (e *PartialTransferError) Unwrap() []error {
+
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// FileEvent describes a single file of an Upload or Download.
+type FileEvent struct {
+
+	// Operation is "upload" or "download".
+	Operation  string
+	LocalPath  string
+	RemotePath string
+
+	// Size of the source file.
+	Size int64
+
+	// Bytes copied, set on completion and error.
+	Bytes int64
+
+	// Err is set for OnFileError events.
+	Err error
+
+	// Duration of the file copy, set on completion and error.
+	Duration time.Duration
+
+	start time.Time
+}
+
+// fileStart records the start of a single file copy and returns its event.
+func (t *transfer) fileStart(local, remote string, size int64) *FileEvent {
+
+	e := &FileEvent{
+		Operation:  t.op,
+		LocalPath:  local,
+		RemotePath: remote,
+		Size:       size,
+		start:      time.Now(),
+	}
+
+	if t.config != nil && t.config.OnFileStart != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.config.OnFileStart(*e)
+	}
+
+	return e
+}
+
+// file records a single file copied during the transfer.
+func (t *transfer) file(e *FileEvent, n int64) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.bytes += n
+	t.files++
+
+	e.Bytes = n
+	e.Duration = time.Since(e.start)
+
+	t.config.metrics().BytesTransferred(t.config.hostPort(), t.op, n)
+
+	t.config.logger().Debug(t.op+" file", t.config.logAttrs("local", e.LocalPath, "remote", e.RemotePath, "bytes", n)...)
+
+	if t.config != nil && t.config.OnFileComplete != nil {
+		t.config.OnFileComplete(*e)
+	}
+}
+
+// fileError records a failed file copy. It returns the error aborting the
+// transfer, or nil when the OnFileError hook chose to skip the file. The
+// cause is wrapped in a TransferError, with the bytes copied so far.
+func (t *transfer) fileError(e *FileEvent, err error) error {
+
+	err = &TransferError{
+		Op:         t.op,
+		LocalPath:  e.LocalPath,
+		RemotePath: e.RemotePath,
+		Offset:     e.Bytes,
+		Err:        err,
+	}
+
+	e.Err = err
+	e.Duration = time.Since(e.start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.config == nil || t.config.OnFileError == nil {
+		return t.config.opError(OpError{Op: t.op, LocalPath: e.LocalPath, RemotePath: e.RemotePath, Err: err})
+	}
+
+	if err = t.config.OnFileError(*e); err == nil {
+		t.skipped = append(t.skipped, e.Err.(*TransferError))
+		t.config.logger().Warn(t.op+" file skipped", t.config.logAttrs("local", e.LocalPath, "remote", e.RemotePath, "error", e.Err)...)
+	}
+
+	return t.config.opError(OpError{Op: t.op, LocalPath: e.LocalPath, RemotePath: e.RemotePath, Err: err})
+}
+
+// end ends the transfer, err is the transfer result. It returns err with
+// the transfer context, or a PartialTransferError when files were skipped.
+func (t *transfer) end(err error) error {
+
+	if err == nil && len(t.skipped) > 0 {
+		err = &PartialTransferError{Op: t.op, Files: t.files, Bytes: t.bytes, Errors: t.skipped}
+	}
+
+	log := t.config.logger()
+	duration := time.Since(t.start)
+
+	t.span.SetAttributes(
+		slog.Int64("goph.bytes", t.bytes),
+		slog.Int("goph.files", t.files),
+	)
+	t.span.End(err)
+
+	t.config.audit(AuditRecord{
+		Time:       t.start,
+		Operation:  t.op,
+		LocalPath:  t.local,
+		RemotePath: t.remote,
+		Bytes:      t.bytes,
+		Err:        err,
+		Duration:   duration,
+	})
+
+	if t.config != nil && t.config.OnTransferEnd != nil {
+		e := t.event()
+		e.Bytes, e.Files, e.Duration, e.Err = t.bytes, t.files, duration, err
+		t.config.OnTransferEnd(e)
+	}
+
+	if err != nil {
+		log.Error(t.op+" failed", t.config.logAttrs("local", t.local, "remote", t.remote, "error", err, "duration", duration)...)
+		return t.config.opError(OpError{Op: t.op, LocalPath: t.local, RemotePath: t.remote, Err: err})
+	}
+
+	log.Info(t.op+" finished", t.config.logAttrs("local", t.local, "remote", t.remote, "bytes", t.bytes, "files", t.files, "duration", duration)...)
+	return nil
+}
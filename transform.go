@@ -0,0 +1,92 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"errors"
+	"io"
+)
+
+// Transform transforms file contents on the fly during Upload and Download,
+// for example to compress or encrypt files before they reach the remote disk.
+type Transform interface {
+
+	// Writer returns a writer transforming the uploaded data into w, it is
+	// closed once the file is copied and must flush any buffered data.
+	Writer(w io.Writer) (io.WriteCloser, error)
+
+	// Reader returns a reader reversing the transform on the downloaded
+	// data read from r.
+	Reader(r io.Reader) (io.Reader, error)
+}
+
+// transformWriter returns a writer applying the config transforms in order
+// to the data written to w.
+func (c *Config) transformWriter(w io.Writer) (io.WriteCloser, error) {
+
+	if c == nil || len(c.Transforms) == 0 {
+		return nopWriteCloser{w}, nil
+	}
+
+	// the first transform sees the plain data, so it is the outermost writer
+	// and the first to be closed.
+	closers := make(transformClosers, len(c.Transforms))
+
+	for i := len(c.Transforms) - 1; i >= 0; i-- {
+		tw, err := c.Transforms[i].Writer(w)
+		if err != nil {
+			closers[i+1:].Close()
+			return nil, err
+		}
+		closers[i], w = tw, tw
+	}
+
+	return transformWriter{Writer: w, closers: closers}, nil
+}
+
+// transformReader returns a reader reversing the config transforms on the
+// data read from r.
+func (c *Config) transformReader(r io.Reader) (io.Reader, error) {
+
+	if c == nil {
+		return r, nil
+	}
+
+	for i := len(c.Transforms) - 1; i >= 0; i-- {
+		var err error
+		if r, err = c.Transforms[i].Reader(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// transformClosers closes transform writers from the outermost one.
+type transformClosers []io.WriteCloser
+
+func (cs transformClosers) Close() error {
+
+	var errs []error
+	for _, c := range cs {
+		errs = append(errs, c.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+type transformWriter struct {
+	io.Writer
+	closers transformClosers
+}
+
+func (w transformWriter) Close() error {
+	return w.closers.Close()
+}
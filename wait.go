@@ -0,0 +1,77 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultWaitInterval is the time between the connection attempts of
+// WaitFor when its interval is zero.
+var DefaultWaitInterval = 2 * time.Second
+
+// WaitFor connects to the host of config every interval until it succeeds
+// and every probe command, like "test -f /var/lib/cloud/instance/boot-finished",
+// exits with status zero, then returns the connected client. It is meant
+// for hosts booting, like a VM just created: every failure is retried,
+// including authentication ones while keys are being installed. When ctx
+// is done first, the context error is returned with the last failure.
+func WaitFor(ctx context.Context, config *Config, interval time.Duration, probes ...string) (*Client, error) {
+
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+
+	log := config.logger()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last error
+
+	for attempt := 1; ; attempt++ {
+
+		client, err := waitAttempt(ctx, config, probes)
+		if err == nil {
+			log.Info("host ready", config.logAttrs("attempts", attempt)...)
+			return client, nil
+		}
+
+		log.Debug("host not ready", config.logAttrs("attempt", attempt, "error", err)...)
+
+		// an attempt interrupted by ctx tells less than the previous one,
+		// the dialer may hit the deadline before ctx reports it.
+		deadline, ok := ctx.Deadline()
+		interrupted := ctx.Err() != nil || ok && !time.Now().Before(deadline)
+		if !interrupted || last == nil {
+			last = err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(ctx.Err(), last)
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitAttempt connects with config and runs the probes.
+func waitAttempt(ctx context.Context, config *Config, probes []string) (*Client, error) {
+
+	client, err := NewConnContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, probe := range probes {
+		if out, err := client.RunContext(ctx, probe); err != nil {
+			client.Close()
+			return nil, outputError(err, out)
+		}
+	}
+
+	return client, nil
+}
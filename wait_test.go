@@ -0,0 +1,62 @@
+package goph_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestWaitFor(t *testing.T) {
+
+	var probes int
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc("test -f /var/lib/cloud/instance/boot-finished", func(e *gophtest.Exec) int {
+		if probes++; probes < 3 {
+			return 1
+		}
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := goph.WaitFor(ctx, srv.Config("alice", "secret"), 10*time.Millisecond, "test -f /var/lib/cloud/instance/boot-finished")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if probes != 3 {
+		t.Errorf("expected 3 probes, got %d", probes)
+	}
+
+	// a host never listening times out.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	config := srv.Config("alice", "secret")
+	config.Port = uint(l.Addr().(*net.TCPAddr).Port)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = goph.WaitFor(ctx, config, 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("expected the deadline and the last failure, got %v", err)
+	}
+}
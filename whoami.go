@@ -0,0 +1,145 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// RemoteUser is the effective user of the connection on the remote host.
+type RemoteUser struct {
+	Name   string
+	UID    int
+	GID    int
+	Groups []string
+	Home   string
+}
+
+// IsRoot reports whether the user is root.
+func (u RemoteUser) IsRoot() bool {
+	return u.UID == 0
+}
+
+// InGroup reports whether the user is a member of group.
+func (u RemoteUser) InGroup(group string) bool {
+	for _, g := range u.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Whoami returns the effective remote user, resolved once per connection.
+func (c Client) Whoami() (RemoteUser, error) {
+	return c.WhoamiContext(context.Background())
+}
+
+// WhoamiContext is like Whoami with a context.
+func (c Client) WhoamiContext(ctx context.Context) (RemoteUser, error) {
+
+	c = c.live()
+
+	if c.state != nil {
+		c.state.userMu.Lock()
+		defer c.state.userMu.Unlock()
+
+		if c.state.user != nil {
+			return *c.state.user, nil
+		}
+	}
+
+	out, err := c.RunContext(ctx, `id -un; id -u; id -g; id -Gn; echo "$HOME"`)
+	if err != nil {
+		return RemoteUser{}, outputError(err, out)
+	}
+
+	u, err := parseRemoteUser(string(out))
+	if err != nil {
+		return RemoteUser{}, err
+	}
+
+	if c.state != nil {
+		c.state.user = &u
+	}
+
+	return u, nil
+}
+
+// parseRemoteUser parses the output of the Whoami command.
+func parseRemoteUser(out string) (u RemoteUser, err error) {
+
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) != 5 {
+		return u, fmt.Errorf("whoami: unexpected output %q", out)
+	}
+
+	u.Name = strings.TrimSpace(lines[0])
+	if u.UID, err = strconv.Atoi(strings.TrimSpace(lines[1])); err != nil {
+		return u, fmt.Errorf("whoami: %w", err)
+	}
+	if u.GID, err = strconv.Atoi(strings.TrimSpace(lines[2])); err != nil {
+		return u, fmt.Errorf("whoami: %w", err)
+	}
+	u.Groups = strings.Fields(lines[3])
+	u.Home = strings.TrimSpace(lines[4])
+
+	return u, nil
+}
+
+// HomeDir returns the home directory of the remote user. The home of
+// Windows users is the sftp working directory, like "/C:/Users/alice".
+func (c Client) HomeDir() (string, error) {
+
+	if c.RemoteOS() == RemoteWindows {
+		return c.sftpHome()
+	}
+
+	u, err := c.Whoami()
+	return u.Home, err
+}
+
+// sftpHome returns the working directory of the sftp server, the home of
+// the user.
+func (c Client) sftpHome() (string, error) {
+
+	ftp, done, err := c.sharedSftp()
+	if err != nil {
+		return "", err
+	}
+
+	home, err := ftp.Getwd()
+	if err != nil {
+		c.dropSftp(ftp, err)
+	}
+
+	return home, errors.Join(err, done())
+}
+
+// UID returns the user ID of the remote user.
+func (c Client) UID() (int, error) {
+	u, err := c.Whoami()
+	return u.UID, err
+}
+
+// ExpandHome expands a leading "~" of the remote path p to the home
+// directory of the remote user.
+func (c Client) ExpandHome(p string) (string, error) {
+
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+
+	home, err := c.HomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(home, p[1:]), nil
+}
@@ -0,0 +1,54 @@
+package goph_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestWhoami(t *testing.T) {
+
+	var calls int
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	srv.HandleFunc(`id -un; id -u; id -g; id -Gn; echo "$HOME"`, func(e *gophtest.Exec) int {
+		calls++
+		fmt.Fprint(e.Stdout, "alice\n1000\n1000\nalice wheel docker\n/home/alice\n")
+		return 0
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	u, err := client.Whoami()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Name != "alice" || u.UID != 1000 || u.IsRoot() || !u.InGroup("wheel") {
+		t.Errorf("unexpected user: %+v", u)
+	}
+
+	p, err := client.ExpandHome("~/.ssh/authorized_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p != "/home/alice/.ssh/authorized_keys" {
+		t.Errorf("unexpected expansion %q", p)
+	}
+
+	if uid, err := client.UID(); err != nil || uid != 1000 || calls != 1 {
+		t.Errorf("the remote user should be cached, resolved %d times", calls)
+	}
+}
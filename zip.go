@@ -0,0 +1,270 @@
+// Copyright 2020 Mohammed El Bahja. All rights reserved.
+// Use of this source code is governed by a MIT license.
+
+package goph
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// UploadZip uploads the local zip archive and extracts it into the remote
+// directory remoteDir, created if missing. The archive is extracted with
+// unzip when the remote host has it, or entry by entry over sftp
+// otherwise, like on Windows hosts without unzip or tar.
+func (c Client) UploadZip(ctx context.Context, zipPath, remoteDir string) (err error) {
+	t := c.Config.startTransfer(ctx, "upload", zipPath, remoteDir)
+	defer func() { err = t.end(err) }()
+
+	if err = c.beginOp(t); err != nil {
+		return err
+	}
+	defer c.endOp(t)
+
+	if remoteDir, err = c.remotePath(remoteDir); err != nil {
+		return err
+	}
+	t.remote = remoteDir
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	if err = ftp.MkdirAll(remoteDir); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+
+	if _, err = c.RunContext(ctx, "command -v unzip"); err != nil {
+		return c.expandZip(t, ftp, zipPath, remoteDir)
+	}
+
+	remoteZip := path.Join(remoteDir, ".goph-"+filepath.Base(zipPath))
+
+	if err = c.copyFile(t, ftp, zipPath, remoteZip); err != nil {
+		return err
+	}
+	defer ftp.Remove(remoteZip)
+
+	out, err := c.RunContext(ctx, "unzip -o -q "+shellQuote(remoteZip)+" -d "+shellQuote(remoteDir))
+	return outputError(err, out)
+}
+
+// copyFile copies the local file src to the remote path dst as is, without
+// the config transforms.
+func (c Client) copyFile(t *transfer, ftp *sftp.Client, src, dst string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var size int64
+	if info, err := in.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	e := t.fileStart(src, dst, size)
+
+	out, err := ftp.Create(dst)
+	if err != nil {
+		return t.fileError(e, err)
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, t.source(e, in))
+	e.Bytes = n
+	if err != nil {
+		return t.fileError(e, err)
+	}
+
+	t.file(e, n)
+	return nil
+}
+
+// expandZip extracts the local zip archive into remoteDir over sftp.
+func (c Client) expandZip(t *transfer, ftp *sftp.Client, zipPath, remoteDir string) error {
+
+	archive, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+
+		name := path.Clean(strings.ReplaceAll(f.Name, `\`, "/"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("zip entry %q escapes the destination", f.Name)
+		}
+		dst := path.Join(remoteDir, name)
+
+		if f.FileInfo().IsDir() {
+			if err = ftp.MkdirAll(dst); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = c.expandZipFile(t, ftp, f, dst); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandZipFile writes the zip entry f to the remote path dst.
+func (c Client) expandZipFile(t *transfer, ftp *sftp.Client, f *zip.File, dst string) error {
+
+	e := t.fileStart(f.Name, dst, int64(f.UncompressedSize64))
+
+	if err := ftp.MkdirAll(path.Dir(dst)); err != nil {
+		return t.fileError(e, err)
+	}
+
+	in, err := f.Open()
+	if err != nil {
+		return t.fileError(e, err)
+	}
+	defer in.Close()
+
+	out, err := ftp.Create(dst)
+	if err != nil {
+		return t.fileError(e, err)
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, t.source(e, in))
+	e.Bytes = n
+	if err != nil {
+		return t.fileError(e, err)
+	}
+
+	if perm := f.Mode().Perm(); perm != 0 {
+		if err = ftp.Chmod(dst, perm); err != nil {
+			return t.fileError(e, err)
+		}
+	}
+
+	t.file(e, n)
+	return nil
+}
+
+// DownloadZip downloads the remote directory remoteDir as the local zip
+// archive zipPath, built locally from the files read over sftp.
+func (c Client) DownloadZip(ctx context.Context, remoteDir, zipPath string) (err error) {
+	t := c.Config.startTransfer(ctx, "download", zipPath, remoteDir)
+	defer func() { err = t.end(err) }()
+
+	if err = c.beginOp(t); err != nil {
+		return err
+	}
+	defer c.endOp(t)
+
+	if remoteDir, err = c.remotePath(remoteDir); err != nil {
+		return err
+	}
+	t.remote = remoteDir
+
+	ftp, err := c.NewSftp()
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	out, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(zipPath)
+		}
+	}()
+
+	archive := zip.NewWriter(out)
+
+	walker := ftp.Walk(remoteDir)
+	for walker.Step() {
+
+		if err = walker.Err(); err != nil {
+			return err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), remoteDir), "/")
+		if rel == "" {
+			continue
+		}
+
+		info := walker.Stat()
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+
+		if info.IsDir() {
+			header.Name += "/"
+			if _, err = archive.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		header.Method = zip.Deflate
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if err = c.zipFile(t, ftp, walker.Path(), zipPath, w, info.Size()); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// zipFile writes the remote file src to the zip entry w.
+func (c Client) zipFile(t *transfer, ftp *sftp.Client, src, zipPath string, w io.Writer, size int64) error {
+
+	e := t.fileStart(zipPath, src, size)
+
+	in, err := ftp.Open(src)
+	if err != nil {
+		return t.fileError(e, err)
+	}
+	defer in.Close()
+
+	n, err := io.Copy(w, t.source(e, in))
+	e.Bytes = n
+	if err != nil {
+		return t.fileError(e, err)
+	}
+
+	t.file(e, n)
+	return nil
+}
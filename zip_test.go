@@ -0,0 +1,127 @@
+package goph_test
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/babbage88/goph/v2"
+	"github.com/babbage88/goph/v2/gophtest"
+)
+
+func TestZip(t *testing.T) {
+
+	srv := gophtest.NewServer()
+	srv.AddUser("alice", "secret")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := goph.NewConn(srv.Config("alice", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "site.zip")
+	writeZip(t, zipPath, map[string]string{
+		"index.html":      "<h1>hi</h1>",
+		"css/site.css":    "body{}",
+		"bin/start.cmd":   "run",
+		`scripts\win.ps1`: "Write-Host",
+	})
+
+	ctx := context.Background()
+
+	// without unzip the archive is expanded over sftp.
+	if err = client.UploadZip(ctx, zipPath, "/srv/site"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRemote(t, client, "/srv/site/css/site.css"); got != "body{}" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if got := readRemote(t, client, "/srv/site/scripts/win.ps1"); got != "Write-Host" {
+		t.Errorf("unexpected content %q", got)
+	}
+
+	out := filepath.Join(dir, "download.zip")
+	if err = client.DownloadZip(ctx, "/srv/site", out); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readZip(t, out)
+	if len(files) != 4 || files["css/site.css"] != "body{}" || files["index.html"] != "<h1>hi</h1>" {
+		t.Errorf("unexpected archive %v", files)
+	}
+
+	// with unzip the archive is uploaded and extracted remotely.
+	var unzipped string
+	srv.HandleFunc("command -v unzip", func(e *gophtest.Exec) int { return 0 })
+	srv.NotFound = func(e *gophtest.Exec) int {
+		if strings.HasPrefix(e.Command, "unzip ") {
+			unzipped = e.Command
+			return 0
+		}
+		return 127
+	}
+
+	if err = client.UploadZip(ctx, zipPath, "/srv/other"); err != nil {
+		t.Fatal(err)
+	}
+	if unzipped != "unzip -o -q /srv/other/.goph-site.zip -d /srv/other" {
+		t.Errorf("unexpected unzip command %q", unzipped)
+	}
+}
+
+func writeZip(t *testing.T, name string, files map[string]string) {
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readZip(t *testing.T, name string) map[string]string {
+
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	files := make(map[string]string)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	return files
+}